@@ -0,0 +1,528 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+
+	"github.com/hhrutter/pdfcpu/pkg/filter"
+	"github.com/hhrutter/pdfcpu/pkg/fonts/metrics"
+	"github.com/hhrutter/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Functions for adding annotations to existing pages.
+
+func numberFormatDict(unit string, c float64) (PDFDict, error) {
+
+	u, err := textStringObject(unit)
+	if err != nil {
+		return PDFDict{}, err
+	}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type": PDFName("NumberFormat"),
+			"U":    u,
+			"C":    PDFFloat(c),
+			"D":    PDFInteger(100),
+		},
+	}
+
+	return d, nil
+}
+
+// measureDict returns a rectilinear measure dict for a scale expressed in units per default user space unit.
+func measureDict(scale float64, unit string) (PDFDict, error) {
+
+	r, err := textStringObject(fmt.Sprintf("1 pt = %g %s", scale, unit))
+	if err != nil {
+		return PDFDict{}, err
+	}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Measure"),
+			"Subtype": PDFName("RL"),
+			"R":       r,
+		},
+	}
+
+	for _, nf := range []struct {
+		key, unit string
+		c         float64
+	}{
+		{"X", unit, scale},
+		{"D", unit, 1},
+		{"A", "sq " + unit, 1},
+	} {
+		nfDict, err := numberFormatDict(nf.unit, nf.c)
+		if err != nil {
+			return PDFDict{}, err
+		}
+		d.Insert(nf.key, PDFArray{nfDict})
+	}
+
+	return d, nil
+}
+
+// AddMeasurementAnnotation adds a captioned Line annotation measuring the distance between p1 and p2.
+// scale is the number of units corresponding to one default user space unit.
+func AddMeasurementAnnotation(xRefTable *XRefTable, pageNr int, p1, p2 [2]float64, scale float64, unit string) error {
+
+	if scale <= 0 {
+		return errors.Errorf("AddMeasurementAnnotation: invalid scale: %f", scale)
+	}
+
+	if len(unit) == 0 {
+		return errors.New("AddMeasurementAnnotation: missing unit")
+	}
+
+	dx, dy := p2[0]-p1[0], p2[1]-p1[1]
+	dist := math.Sqrt(dx*dx+dy*dy) * scale
+
+	contents, err := textStringObject(fmt.Sprintf("%.2f %s", dist, unit))
+	if err != nil {
+		return err
+	}
+
+	measure, err := measureDict(scale, unit)
+	if err != nil {
+		return err
+	}
+
+	// Leave room for the line endings and the caption.
+	const pad = 10.0
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Line"),
+			"Contents": contents,
+			"Rect": NewRectangle(
+				math.Min(p1[0], p2[0])-pad, math.Min(p1[1], p2[1])-pad,
+				math.Max(p1[0], p2[0])+pad, math.Max(p1[1], p2[1])+pad),
+			"C":       NewNumberArray(0, 0, 0),
+			"L":       NewNumberArray(p1[0], p1[1], p2[0], p2[1]),
+			"LE":      NewNameArray("OpenArrow", "OpenArrow"),
+			"BS":      PDFDict{Dict: map[string]PDFObject{"W": PDFFloat(1), "S": PDFName("S")}},
+			"Cap":     PDFBoolean(true),
+			"CP":      PDFName("Inline"),
+			"DA":      PDFStringLiteral("/Helv 10 Tf 0 g"),
+			"IT":      PDFName("LineDimension"),
+			"Measure": measure,
+		},
+	}
+
+	_, err = validateAnnotationDict(xRefTable, &d)
+	if err != nil {
+		return err
+	}
+
+	_, err = addAnnotation(xRefTable, pageNr, d)
+
+	return err
+}
+
+// textAnnotationIcons are the standard icon names of Text annotations, see 12.5.6.4
+var textAnnotationIcons = []string{"Comment", "Key", "Note", "Help", "NewParagraph", "Paragraph", "Insert"}
+
+// AddTextAnnotation adds a sticky note showing the icon iconName at rect to page pageNr
+// and returns its indirect reference, eg. for wiring up a Popup annotation.
+// open controls whether the note gets initially displayed open.
+func AddTextAnnotation(xRefTable *XRefTable, pageNr int, rect types.Rectangle, contents string, open bool, iconName string) (*PDFIndirectRef, error) {
+
+	if !memberOf(iconName, textAnnotationIcons) {
+		return nil, errors.Errorf("AddTextAnnotation: unsupported icon: %s", iconName)
+	}
+
+	s, err := textStringObject(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Text"),
+			"Rect":     NewRectangle(rect.LL.X, rect.LL.Y, rect.UR.X, rect.UR.Y),
+			"Contents": s,
+			"Open":     PDFBoolean(open),
+			"Name":     PDFName(iconName),
+		},
+	}
+
+	_, err = validateAnnotationDict(xRefTable, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	return addAnnotation(xRefTable, pageNr, d)
+}
+
+// AddLinkAnnotation adds a Link annotation opening uri to page pageNr.
+// The optional quadPoints restrict the clickable region within rect to a quadrilateral.
+// The link comes without a visible border.
+func AddLinkAnnotation(xRefTable *XRefTable, pageNr int, rect types.Rectangle, uri string, quadPoints []float64) error {
+
+	if len(uri) == 0 {
+		return errors.New("AddLinkAnnotation: missing uri")
+	}
+
+	// URIs are 7 bit ASCII, see 12.6.4.7
+	for i := 0; i < len(uri); i++ {
+		if uri[i] < 0x20 || uri[i] > 0x7E {
+			return errors.Errorf("AddLinkAnnotation: invalid uri: %q", uri)
+		}
+	}
+
+	if _, err := url.Parse(uri); err != nil {
+		return errors.Wrap(err, "AddLinkAnnotation")
+	}
+
+	if len(quadPoints) != 0 && len(quadPoints) != 8 {
+		return errors.Errorf("AddLinkAnnotation: QuadPoints need 8 numbers: %v", quadPoints)
+	}
+
+	s, err := Escape(uri)
+	if err != nil {
+		return err
+	}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Link"),
+			"Rect":    NewRectangle(rect.LL.X, rect.LL.Y, rect.UR.X, rect.UR.Y),
+			"A": PDFDict{
+				Dict: map[string]PDFObject{
+					"Type": PDFName("Action"),
+					"S":    PDFName("URI"),
+					"URI":  PDFStringLiteral(*s),
+				},
+			},
+			"BS": PDFDict{Dict: map[string]PDFObject{"W": PDFInteger(0)}},
+		},
+	}
+
+	if len(quadPoints) > 0 {
+		d.Insert("QuadPoints", NewNumberArray(quadPoints...))
+	}
+
+	_, err = validateAnnotationDict(xRefTable, &d)
+	if err != nil {
+		return err
+	}
+
+	err = validateURIActionDictEntry(xRefTable, &d, "annotDict", "A", REQUIRED, V11)
+	if err != nil {
+		return err
+	}
+
+	_, err = addAnnotation(xRefTable, pageNr, d)
+
+	return err
+}
+
+// ConvertMarkupToComment adds a Text annotation replying to the Square, Circle, Line or Ink annotation obj#objNr.
+// The note is anchored at the upper left corner of the markup and carries its Contents, Subj and author.
+// The markup annotation remains untouched. Returns the object number of the new note.
+func ConvertMarkupToComment(xRefTable *XRefTable, objNr int) (int, error) {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return 0, err
+	}
+
+	if !memberOf(*d.Subtype(), []string{"Square", "Circle", "Line", "Ink"}) {
+		return 0, errors.Errorf("ConvertMarkupToComment: obj#%d unsupported subtype: %s", objNr, *d.Subtype())
+	}
+
+	pageNr, err := annotPageNr(xRefTable, objNr)
+	if err != nil {
+		return 0, err
+	}
+
+	r, err := numbers(xRefTable, d.Dict["Rect"])
+	if err != nil || len(r) != 4 {
+		return 0, errors.Errorf("ConvertMarkupToComment: obj#%d corrupt Rect", objNr)
+	}
+
+	// Default icon size.
+	const w, h = 20.0, 20.0
+
+	x, y := math.Min(r[0], r[2]), math.Max(r[1], r[3])
+
+	genNr := 0
+	if entry, found := xRefTable.Find(objNr); found && entry.Generation != nil {
+		genNr = *entry.Generation
+	}
+
+	note := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Text"),
+			"Rect":    NewRectangle(x, y-h, x+w, y),
+			"Name":    PDFName("Comment"),
+			"Open":    PDFBoolean(false),
+			"IRT":     *NewPDFIndirectRef(objNr, genNr),
+			"RT":      PDFName("R"),
+		},
+	}
+
+	for _, entryName := range []string{"Contents", "Subj", "T"} {
+		if obj, found := d.Find(entryName); found && obj != nil {
+			note.Insert(entryName, obj)
+		}
+	}
+
+	_, err = validateAnnotationDict(xRefTable, &note)
+	if err != nil {
+		return 0, err
+	}
+
+	indRef, err := addAnnotation(xRefTable, pageNr, note)
+	if err != nil {
+		return 0, err
+	}
+
+	return indRef.ObjectNumber.Value(), nil
+}
+
+// AddFileAttachmentAnnotation embeds the file filePath and attaches it to page pageNr
+// using a FileAttachment annotation with its icon's lower left corner at pos.
+// iconName is one of Graph, PushPin, Paperclip or Tag.
+func AddFileAttachmentAnnotation(xRefTable *XRefTable, pageNr int, pos [2]float64, filePath, iconName string) error {
+
+	if !memberOf(iconName, []string{"Graph", "PushPin", "Paperclip", "Tag"}) {
+		return errors.Errorf("AddFileAttachmentAnnotation: unsupported icon: %s", iconName)
+	}
+
+	fileName := filepath.Base(filePath)
+
+	contents, err := textStringObject(fileName)
+	if err != nil {
+		return err
+	}
+
+	sd, err := xRefTable.NewEmbeddedFileStreamDict(filePath)
+	if err != nil {
+		return err
+	}
+
+	// The checksum is calculated on the uncompressed file content.
+	sum := md5.Sum(sd.Content)
+	params := sd.PDFDict.PDFDictEntry("Params")
+	params.Insert("CheckSum", PDFHexLiteral(hex.EncodeToString(sum[:])))
+
+	err = encodeStream(sd)
+	if err != nil {
+		return err
+	}
+
+	indRef, err := xRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		return err
+	}
+
+	fileSpecDict, err := xRefTable.NewFileSpecDict(fileName, *indRef)
+	if err != nil {
+		return err
+	}
+
+	// Default icon size.
+	const w, h = 20.0, 20.0
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("FileAttachment"),
+			"Contents": contents,
+			"Rect":     NewRectangle(pos[0], pos[1], pos[0]+w, pos[1]+h),
+			"F":        PDFInteger(annotFlagPrint),
+			"Name":     PDFName(iconName),
+			"FS":       *fileSpecDict,
+		},
+	}
+
+	err = validateAnnotationDictFileAttachment(xRefTable, &d, "annotDict")
+	if err == nil {
+		_, err = addAnnotation(xRefTable, pageNr, d)
+	}
+	if err != nil {
+		if e := xRefTable.DeleteObject(indRef.ObjectNumber.Value()); e != nil {
+			return errors.Wrapf(e, "AddFileAttachmentAnnotation: cleanup after %v", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// watermarkAppearance returns a form rendering text using Helvetica at fontSize in color rgb with opacity.
+func watermarkAppearance(xRefTable *XRefTable, text string, fontSize int, rgb [3]float64, opacity float64) (*PDFIndirectRef, float64, float64, error) {
+
+	s, err := Escape(text)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	w := metrics.TextWidth(text, "Helvetica", fontSize)
+	h := float64(fontSize)
+
+	// Leave room for descenders.
+	content := fmt.Sprintf("q /GS0 gs %.3f %.3f %.3f rg BT /F1 %d Tf 0 %.2f Td (%s) Tj ET Q", rgb[0], rgb[1], rgb[2], fontSize, h*0.25, *s)
+
+	fontDict := NewPDFDict()
+	fontDict.InsertName("Type", "Font")
+	fontDict.InsertName("Subtype", "Type1")
+	fontDict.InsertName("BaseFont", "Helvetica")
+
+	sd := &PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":     PDFName("XObject"),
+				"Subtype":  PDFName("Form"),
+				"FormType": PDFInteger(1),
+				"BBox":     NewRectangle(0, 0, w, h*1.25),
+				"Matrix":   NewIntegerArray(1, 0, 0, 1, 0, 0),
+				"Resources": PDFDict{
+					Dict: map[string]PDFObject{
+						"Font": PDFDict{Dict: map[string]PDFObject{"F1": fontDict}},
+						"ExtGState": PDFDict{
+							Dict: map[string]PDFObject{
+								"GS0": PDFDict{
+									Dict: map[string]PDFObject{
+										"Type": PDFName("ExtGState"),
+										"CA":   PDFFloat(opacity),
+										"ca":   PDFFloat(opacity),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Content:        []byte(content),
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+
+	sd.InsertName("Filter", filter.Flate)
+
+	err = encodeStream(sd)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	indRef, err := xRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return indRef, w, h * 1.25, nil
+}
+
+// AddWatermarkAnnotation adds a Watermark annotation rendering text centered on page pageNr
+// in color rgb using opacity. The annotation carries a FixedPrint dict so that
+// its position and size remain constant regardless of the viewer's zoom level.
+func AddWatermarkAnnotation(xRefTable *XRefTable, pageNr int, text string, rgb [3]float64, opacity float64) error {
+
+	if len(text) == 0 {
+		return errors.New("AddWatermarkAnnotation: missing text")
+	}
+
+	for _, c := range rgb {
+		if c < 0 || c > 1 {
+			return errors.Errorf("AddWatermarkAnnotation: invalid color: %v", rgb)
+		}
+	}
+
+	if opacity < 0 || opacity > 1 {
+		return errors.Errorf("AddWatermarkAnnotation: invalid opacity: %f", opacity)
+	}
+
+	_, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return err
+	}
+
+	mediaBox, err := pageMediaBox(xRefTable, *pageIndRef)
+	if err != nil {
+		return err
+	}
+	if mediaBox == nil {
+		return errors.Errorf("AddWatermarkAnnotation: page %d missing MediaBox", pageNr)
+	}
+
+	contents, err := textStringObject(text)
+	if err != nil {
+		return err
+	}
+
+	// Span 80% of the page width.
+	fontSize := metrics.FontSize(text, "Helvetica", mediaBox.Width()*0.8)
+	if fontSize < 1 {
+		fontSize = 1
+	}
+
+	indRef, w, h, err := watermarkAppearance(xRefTable, text, fontSize, rgb, opacity)
+	if err != nil {
+		return err
+	}
+
+	x := mediaBox.LL.X + (mediaBox.Width()-w)/2
+	y := mediaBox.LL.Y + (mediaBox.Height()-h)/2
+
+	fixedPrint := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":   PDFName("FixedPrint"),
+			"Matrix": NewIntegerArray(1, 0, 0, 1, 0, 0),
+			"H":      PDFFloat(0),
+			"V":      PDFFloat(0),
+		},
+	}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":       PDFName("Annot"),
+			"Subtype":    PDFName("Watermark"),
+			"Contents":   contents,
+			"Rect":       NewRectangle(x, y, x+w, y+h),
+			"F":          PDFInteger(annotFlagPrint),
+			"AP":         PDFDict{Dict: map[string]PDFObject{"N": *indRef}},
+			"FixedPrint": fixedPrint,
+		},
+	}
+
+	err = validateAnnotationDictWatermark(xRefTable, &d, "annotDict")
+	if err == nil {
+		_, err = addAnnotation(xRefTable, pageNr, d)
+	}
+	if err != nil {
+		if e := xRefTable.DeleteObject(indRef.ObjectNumber.Value()); e != nil {
+			return errors.Wrapf(e, "AddWatermarkAnnotation: cleanup after %v", err)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,1387 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Annotation flags, see 12.5.3
+const (
+	annotFlagInvisible = 1 << iota
+	annotFlagHidden
+	annotFlagPrint
+	annotFlagNoZoom
+	annotFlagNoRotate
+	annotFlagNoView
+	annotFlagReadOnly
+	annotFlagLocked
+	annotFlagToggleNoView
+	annotFlagLockedContents
+)
+
+// AnnotationFlags represents the annotation flags F of an annotation dict, see table 165.
+type AnnotationFlags int
+
+// The annotation flags.
+const (
+	AnnotFlagInvisible      AnnotationFlags = annotFlagInvisible
+	AnnotFlagHidden         AnnotationFlags = annotFlagHidden
+	AnnotFlagPrint          AnnotationFlags = annotFlagPrint
+	AnnotFlagNoZoom         AnnotationFlags = annotFlagNoZoom
+	AnnotFlagNoRotate       AnnotationFlags = annotFlagNoRotate
+	AnnotFlagNoView         AnnotationFlags = annotFlagNoView
+	AnnotFlagReadOnly       AnnotationFlags = annotFlagReadOnly
+	AnnotFlagLocked         AnnotationFlags = annotFlagLocked
+	AnnotFlagToggleNoView   AnnotationFlags = annotFlagToggleNoView
+	AnnotFlagLockedContents AnnotationFlags = annotFlagLockedContents
+)
+
+// Invisible returns true if an annotation of an unknown type is not to be displayed.
+func (f AnnotationFlags) Invisible() bool { return f&AnnotFlagInvisible > 0 }
+
+// Hidden returns true if an annotation is neither displayed nor printed.
+func (f AnnotationFlags) Hidden() bool { return f&AnnotFlagHidden > 0 }
+
+// Print returns true if an annotation gets printed.
+func (f AnnotationFlags) Print() bool { return f&AnnotFlagPrint > 0 }
+
+// NoZoom returns true if an annotation's appearance does not scale with the page magnification.
+func (f AnnotationFlags) NoZoom() bool { return f&AnnotFlagNoZoom > 0 }
+
+// NoRotate returns true if an annotation's appearance does not rotate with the page.
+func (f AnnotationFlags) NoRotate() bool { return f&AnnotFlagNoRotate > 0 }
+
+// NoView returns true if an annotation is not displayed on screen.
+func (f AnnotationFlags) NoView() bool { return f&AnnotFlagNoView > 0 }
+
+// ReadOnly returns true if an annotation does not interact with the user.
+func (f AnnotationFlags) ReadOnly() bool { return f&AnnotFlagReadOnly > 0 }
+
+// Locked returns true if an annotation may not be deleted or its properties modified.
+func (f AnnotationFlags) Locked() bool { return f&AnnotFlagLocked > 0 }
+
+// ToggleNoView returns true if the NoView flag gets toggled for certain events.
+func (f AnnotationFlags) ToggleNoView() bool { return f&AnnotFlagToggleNoView > 0 }
+
+// LockedContents returns true if an annotation's contents may not be modified.
+func (f AnnotationFlags) LockedContents() bool { return f&AnnotFlagLockedContents > 0 }
+
+// With returns f with the flags mask set if on is true or cleared otherwise.
+func (f AnnotationFlags) With(mask AnnotationFlags, on bool) AnnotationFlags {
+	if on {
+		return f | mask
+	}
+	return f &^ mask
+}
+
+func (f AnnotationFlags) String() string {
+
+	var ss []string
+
+	for i, s := range []string{"Invisible", "Hidden", "Print", "NoZoom", "NoRotate", "NoView", "ReadOnly", "Locked", "ToggleNoView", "LockedContents"} {
+		if f&(1<<uint(i)) > 0 {
+			ss = append(ss, s)
+		}
+	}
+
+	return strings.Join(ss, "|")
+}
+
+// AnnotationFlagsOf returns the annotation flags of dict.
+func AnnotationFlagsOf(dict *PDFDict) AnnotationFlags {
+
+	f := dict.IntEntry("F")
+	if f == nil {
+		return 0
+	}
+
+	return AnnotationFlags(*f)
+}
+
+// SetAnnotationFlags sets the annotation flags of dict to f.
+// dict is a bare annotation dict, eg. one about to be added, unaware of any XRefTable,
+// so the change is not recorded in the annotation change log.
+// Use AnnotationStore.Set to change an annotation of an XRefTable.
+func SetAnnotationFlags(dict *PDFDict, f AnnotationFlags) {
+	dict.Update("F", PDFInteger(f))
+}
+
+// Color represents an annotation color, see 12.5.2
+// The color space is implied by the number of components:
+// 1 for DeviceGray, 3 for DeviceRGB and 4 for DeviceCMYK, each in the range 0.0 to 1.0.
+// A color without components is transparent.
+type Color struct {
+	Components []float64
+}
+
+// GrayColor returns the DeviceGray color g.
+func GrayColor(g float64) Color {
+	return Color{[]float64{g}}
+}
+
+// RGBColor returns the DeviceRGB color r g b.
+func RGBColor(r, g, b float64) Color {
+	return Color{[]float64{r, g, b}}
+}
+
+// CMYKColor returns the DeviceCMYK color c m y k.
+func CMYKColor(c, m, y, k float64) Color {
+	return Color{[]float64{c, m, y, k}}
+}
+
+// ColorSpace returns the color space implied by the components of c or "" if c is transparent or invalid.
+func (c Color) ColorSpace() string {
+
+	switch len(c.Components) {
+	case 1:
+		return "DeviceGray"
+	case 3:
+		return "DeviceRGB"
+	case 4:
+		return "DeviceCMYK"
+	}
+
+	return ""
+}
+
+// annotationColor returns the color of the direct number array entry key of dict.
+func annotationColor(dict *PDFDict, key string) (*Color, error) {
+
+	obj, found := dict.Find(key)
+	if !found || obj == nil {
+		return nil, nil
+	}
+
+	arr, ok := obj.(PDFArray)
+	if !ok || len(arr) == 2 || len(arr) > 4 {
+		return nil, errors.Errorf("annotationColor: corrupt %s: %v", key, obj)
+	}
+
+	if len(arr) == 0 {
+		return nil, nil
+	}
+
+	c := &Color{Components: make([]float64, len(arr))}
+
+	for i, o := range arr {
+		f, ok := directNumber(o)
+		if !ok {
+			return nil, errors.Errorf("annotationColor: invalid %s element: %v", key, o)
+		}
+		c.Components[i] = f
+	}
+
+	return c, nil
+}
+
+// AnnotationColor returns the color C of dict.
+// Returns nil for a missing C or an empty array meaning transparent. C must be a direct array.
+func AnnotationColor(dict *PDFDict) (*Color, error) {
+	return annotationColor(dict, "C")
+}
+
+// SetAnnotationColor sets the color C of dict to c.
+// c must have 0, 1, 3 or 4 components in the range 0..1. A color without components makes C transparent.
+// Like SetAnnotationFlags this is not recorded in the annotation change log.
+func SetAnnotationColor(dict *PDFDict, c Color) error {
+
+	arr, err := colorArray("C", c)
+	if err != nil {
+		return err
+	}
+
+	dict.Update("C", arr)
+
+	return nil
+}
+
+// AnnotationInteriorColor returns the interior color IC of dict.
+// Returns nil for a missing IC or an empty array meaning transparent. IC must be a direct array.
+func AnnotationInteriorColor(dict *PDFDict) (*Color, error) {
+	return annotationColor(dict, "IC")
+}
+
+// SetAnnotationDictInteriorColor sets the interior color IC of dict to c.
+// c must have 0 or 3 components in the range 0..1. A color without components makes IC transparent.
+// Like SetAnnotationFlags this is not recorded in the annotation change log.
+// See SetAnnotationInteriorColor for changing an annotation of the xRefTable.
+func SetAnnotationDictInteriorColor(dict *PDFDict, c Color) error {
+
+	arr, err := colorArray("IC", c)
+	if err != nil {
+		return err
+	}
+
+	dict.Update("IC", arr)
+
+	return nil
+}
+
+// colorArray returns the number array representing c as color entry key of an annotation dict.
+// Like validateEntryIC an interior color IC needs 0 or 3 components.
+func colorArray(key string, c Color) (PDFArray, error) {
+
+	n := len(c.Components)
+
+	if n == 2 || n > 4 || key == "IC" && n != 0 && n != 3 {
+		return nil, errors.Errorf("colorArray: %s: invalid number of color components: %d", key, n)
+	}
+
+	arr := PDFArray{}
+
+	for _, f := range c.Components {
+		if f < 0 || f > 1 {
+			return nil, errors.Errorf("colorArray: %s: color component out of range 0..1: %f", key, f)
+		}
+		arr = append(arr, PDFFloat(f))
+	}
+
+	return arr, nil
+}
+
+// markupAnnotationSubtypes are the subtypes of markup annotations, see 12.5.6.2
+var markupAnnotationSubtypes = []string{
+	"Text", "FreeText", "Line", "Square", "Circle", "Polygon", "PolyLine", "Highlight", "Underline",
+	"Squiggly", "StrikeOut", "Stamp", "Caret", "Ink", "FileAttachment", "Sound", "Redact", "Projection",
+}
+
+func isMarkupAnnotation(annotDict *PDFDict) bool {
+	st := annotDict.Subtype()
+	return st != nil && memberOf(*st, markupAnnotationSubtypes)
+}
+
+// AnnotationSubtype represents the type of an annotation, see table 169.
+type AnnotationSubtype int
+
+// The annotation types defined in ISO 32000-1 and -2 along with RichMedia (Adobe ExtensionLevel 3).
+const (
+	AnnotUnknown AnnotationSubtype = iota
+	AnnotText
+	AnnotLink
+	AnnotFreeText
+	AnnotLine
+	AnnotSquare
+	AnnotCircle
+	AnnotPolygon
+	AnnotPolyLine
+	AnnotHighlight
+	AnnotUnderline
+	AnnotSquiggly
+	AnnotStrikeOut
+	AnnotStamp
+	AnnotCaret
+	AnnotInk
+	AnnotPopup
+	AnnotFileAttachment
+	AnnotSound
+	AnnotMovie
+	AnnotWidget
+	AnnotScreen
+	AnnotPrinterMark
+	AnnotTrapNet
+	AnnotWatermark
+	Annot3D
+	AnnotRedact
+	AnnotRichMedia
+	AnnotProjection
+)
+
+// annotationSubtypeNames are the Subtype names of the annotation types in order of their AnnotationSubtype.
+var annotationSubtypeNames = []string{
+	"", "Text", "Link", "FreeText", "Line", "Square", "Circle", "Polygon", "PolyLine", "Highlight", "Underline",
+	"Squiggly", "StrikeOut", "Stamp", "Caret", "Ink", "Popup", "FileAttachment", "Sound", "Movie", "Widget",
+	"Screen", "PrinterMark", "TrapNet", "Watermark", "3D", "Redact", "RichMedia", "Projection",
+}
+
+func (s AnnotationSubtype) String() string {
+
+	if s <= AnnotUnknown || int(s) >= len(annotationSubtypeNames) {
+		return "unknown"
+	}
+
+	return annotationSubtypeNames[s]
+}
+
+// annotationSubtype returns the AnnotationSubtype for the Subtype name.
+func annotationSubtype(name string) AnnotationSubtype {
+
+	for i, s := range annotationSubtypeNames {
+		if i > 0 && s == name {
+			return AnnotationSubtype(i)
+		}
+	}
+
+	return AnnotUnknown
+}
+
+// Annotation describes an annotation of a page.
+type Annotation struct {
+	Subtype  AnnotationSubtype
+	Rect     *types.Rectangle // nil for a missing or corrupt Rect
+	Contents string
+	NM       string
+	PageNr   int
+	ObjNr    int // 0 for annotation dicts embedded directly into the Annots array
+	Dict     *PDFDict
+}
+
+func (a Annotation) String() string {
+	return fmt.Sprintf("page %d obj#%d %s %v NM=%q: %q", a.PageNr, a.ObjNr, a.Subtype, a.Rect, a.NM, a.Contents)
+}
+
+// PageAnnotations returns the annotations of page pageNr in order of their Annots array.
+// Missing entries of the Annots array are skipped.
+func (xRefTable *XRefTable) PageAnnotations(pageNr int) ([]Annotation, error) {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return nil, err
+	}
+
+	var aa []Annotation
+
+	err = visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		a := Annotation{
+			Contents: decodedTextString(xRefTable, annotDict.Dict["Contents"]),
+			NM:       decodedTextString(xRefTable, annotDict.Dict["NM"]),
+			PageNr:   pageNr,
+			Dict:     annotDict,
+		}
+
+		if st := annotDict.Subtype(); st != nil {
+			a.Subtype = annotationSubtype(*st)
+		}
+
+		if f, err := numbers(xRefTable, annotDict.Dict["Rect"]); err == nil && len(f) == 4 {
+			r := types.NewRectangle(math.Min(f[0], f[2]), math.Min(f[1], f[3]), math.Max(f[0], f[2]), math.Max(f[1], f[3]))
+			a.Rect = &r
+		}
+
+		if indRef != nil {
+			a.ObjNr = indRef.ObjectNumber.Value()
+		}
+
+		aa = append(aa, a)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aa, nil
+}
+
+// AnnotationFilter selects annotations. A nil AnnotationFilter selects all annotations.
+type AnnotationFilter func(pageNr int, annotDict *PDFDict) bool
+
+// AnnotationSubtypeFilter returns an AnnotationFilter selecting annotations of the given subtypes.
+func AnnotationSubtypeFilter(subtypes ...string) AnnotationFilter {
+
+	return func(pageNr int, annotDict *PDFDict) bool {
+		st := annotDict.Subtype()
+		return st != nil && memberOf(*st, subtypes)
+	}
+}
+
+// pageVisitor gets called for every page of the page tree in page order.
+type pageVisitor func(pageNr int, pageIndRef PDFIndirectRef, pageDict *PDFDict) error
+
+// annotVisitor gets called for every annotation of a page.
+// indRef is nil for annotation dicts embedded directly into the Annots array.
+type annotVisitor func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error
+
+func visitPageTree(xRefTable *XRefTable, indRef PDFIndirectRef, pageNr *int, f pageVisitor) error {
+
+	dict, err := xRefTable.DereferenceDict(indRef)
+	if err != nil {
+		return err
+	}
+	if dict == nil {
+		return errors.Errorf("visitPageTree: page node obj#%d is nil", indRef.ObjectNumber)
+	}
+
+	dictType := dict.Type()
+	if dictType == nil {
+		return errors.Errorf("visitPageTree: page node obj#%d missing type", indRef.ObjectNumber)
+	}
+
+	switch *dictType {
+
+	case "Page":
+		*pageNr++
+		return f(*pageNr, indRef, dict)
+
+	case "Pages":
+		kids := dict.PDFArrayEntry("Kids")
+		if kids == nil {
+			return nil
+		}
+		for _, obj := range *kids {
+			if obj == nil {
+				continue
+			}
+			kidIndRef, ok := obj.(PDFIndirectRef)
+			if !ok {
+				return errors.New("visitPageTree: corrupt page node dict")
+			}
+			err = visitPageTree(xRefTable, kidIndRef, pageNr, f)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	}
+
+	return errors.Errorf("visitPageTree: unexpected page node type: %s", *dictType)
+}
+
+// visitPages walks the page tree and calls f for every page.
+func visitPages(xRefTable *XRefTable, f pageVisitor) error {
+
+	root, err := xRefTable.Pages()
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return errors.New("visitPages: missing page tree root")
+	}
+
+	pageNr := 0
+
+	return visitPageTree(xRefTable, *root, &pageNr, f)
+}
+
+// visitPageAnnots calls f for every annotation of a page dict.
+func visitPageAnnots(xRefTable *XRefTable, pageNr int, pageIndRef PDFIndirectRef, pageDict *PDFDict, f annotVisitor) error {
+
+	obj, found := pageDict.Find("Annots")
+	if !found || obj == nil {
+		return nil
+	}
+
+	arr, err := xRefTable.DereferenceArray(obj)
+	if err != nil || arr == nil {
+		return err
+	}
+
+	for _, v := range *arr {
+
+		if v == nil {
+			continue
+		}
+
+		var indRef *PDFIndirectRef
+		if ir, ok := v.(PDFIndirectRef); ok {
+			indRef = &ir
+		}
+
+		d, err := xRefTable.DereferenceDict(v)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			continue
+		}
+
+		err = f(pageNr, pageIndRef, indRef, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// visitAnnotations walks the page tree and calls f for every annotation.
+func visitAnnotations(xRefTable *XRefTable, f annotVisitor) error {
+
+	return visitPages(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, pageDict *PDFDict) error {
+		return visitPageAnnots(xRefTable, pageNr, pageIndRef, pageDict, f)
+	})
+}
+
+// pageCount returns the number of pages of the page tree.
+func pageCount(xRefTable *XRefTable) (int, error) {
+
+	i := 0
+
+	err := visitPages(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, pageDict *PDFDict) error {
+		i = pageNr
+		return nil
+	})
+
+	return i, err
+}
+
+// inheritableAttr returns the value of an inheritable attribute of the page dict or field dict obj, see 7.7.3.4 and 12.7.3.1
+func inheritableAttr(xRefTable *XRefTable, obj PDFObject, key string) (PDFObject, error) {
+
+	visited := IntSet{}
+
+	for obj != nil {
+
+		if indRef, ok := obj.(PDFIndirectRef); ok {
+			if visited[indRef.ObjectNumber.Value()] {
+				return nil, errors.New("inheritableAttr: cycle detected")
+			}
+			visited[indRef.ObjectNumber.Value()] = true
+		}
+
+		d, err := xRefTable.DereferenceDict(obj)
+		if err != nil || d == nil {
+			return nil, err
+		}
+
+		if v, found := d.Find(key); found && v != nil {
+			return xRefTable.Dereference(v)
+		}
+
+		obj = d.Dict["Parent"]
+	}
+
+	return nil, nil
+}
+
+// pageMediaBox returns the media box of the page dict obj.
+func pageMediaBox(xRefTable *XRefTable, obj PDFObject) (*types.Rectangle, error) {
+
+	o, err := inheritableAttr(xRefTable, obj, "MediaBox")
+	if err != nil || o == nil {
+		return nil, err
+	}
+
+	f, err := numbers(xRefTable, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f) != 4 {
+		return nil, errors.New("pageMediaBox: corrupt MediaBox")
+	}
+
+	r := types.NewRectangle(math.Min(f[0], f[2]), math.Min(f[1], f[3]), math.Max(f[0], f[2]), math.Max(f[1], f[3]))
+
+	return &r, nil
+}
+
+// pageRotation returns the rotation of the page dict obj in degrees normalized to [0, 360).
+func pageRotation(xRefTable *XRefTable, obj PDFObject) (int, error) {
+
+	o, err := inheritableAttr(xRefTable, obj, "Rotate")
+	if err != nil || o == nil {
+		return 0, err
+	}
+
+	i, ok := o.(PDFInteger)
+	if !ok {
+		return 0, errors.New("pageRotation: corrupt Rotate")
+	}
+
+	return (i.Value()%360 + 360) % 360, nil
+}
+
+// pageDictAndIndRef returns the page dict for pageNr along with its indirect reference.
+func pageDictAndIndRef(xRefTable *XRefTable, pageNr int) (*PDFDict, *PDFIndirectRef, error) {
+
+	var (
+		pageDict   *PDFDict
+		pageIndRef PDFIndirectRef
+	)
+
+	err := visitPages(xRefTable, func(i int, indRef PDFIndirectRef, d *PDFDict) error {
+		if i == pageNr {
+			pageDict, pageIndRef = d, indRef
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pageDict == nil {
+		return nil, nil, errors.Errorf("pageDictAndIndRef: page %d not found", pageNr)
+	}
+
+	return pageDict, &pageIndRef, nil
+}
+
+// annotsArray returns the Annots array of a page dict.
+// The returned function writes back a modified array honoring an indirect Annots array.
+func annotsArray(xRefTable *XRefTable, pageDict *PDFDict) (PDFArray, func(PDFArray), error) {
+
+	obj, _ := pageDict.Find("Annots")
+
+	arr, err := xRefTable.DereferenceArray(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	update := func(a PDFArray) {
+		if len(a) == 0 {
+			pageDict.Delete("Annots")
+			return
+		}
+		if indRef, ok := obj.(PDFIndirectRef); ok {
+			if entry, found := xRefTable.FindTableEntryForIndRef(&indRef); found {
+				entry.Object = a
+				return
+			}
+		}
+		pageDict.Update("Annots", a)
+	}
+
+	if arr == nil {
+		return PDFArray{}, update, nil
+	}
+
+	return *arr, update, nil
+}
+
+// appendAnnotation appends indRef to the Annots array of pageDict.
+// An optional trailing TrapNet annotation remains the last entry.
+func appendAnnotation(xRefTable *XRefTable, pageDict *PDFDict, indRef PDFIndirectRef) error {
+
+	arr, update, err := annotsArray(xRefTable, pageDict)
+	if err != nil {
+		return err
+	}
+
+	i := len(arr)
+	if i > 0 {
+		last, err := xRefTable.DereferenceDict(arr[i-1])
+		if err != nil {
+			return err
+		}
+		if last != nil && last.Subtype() != nil && *last.Subtype() == "TrapNet" {
+			i--
+		}
+	}
+
+	a := append(PDFArray{}, arr[:i]...)
+	a = append(a, indRef)
+	a = append(a, arr[i:]...)
+
+	update(a)
+
+	xRefTable.recordAnnotationChange(AnnotationAdded, indRef.ObjectNumber.Value(), "", nil, nil)
+
+	return nil
+}
+
+// addAnnotation inserts d as a new object and appends it to the Annots array of page pageNr.
+func addAnnotation(xRefTable *XRefTable, pageNr int, d PDFDict) (*PDFIndirectRef, error) {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Update("P", *pageIndRef)
+
+	indRef, err := xRefTable.IndRefForNewObject(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = appendAnnotation(xRefTable, pageDict, *indRef); err != nil {
+		return nil, err
+	}
+
+	return indRef, nil
+}
+
+// appearanceVisitor gets called for every appearance stream of an annotation.
+// indRef is nil for appearance streams not referenced indirectly.
+type appearanceVisitor func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error
+
+func visitAppearanceEntry(xRefTable *XRefTable, key string, obj PDFObject, f appearanceVisitor) error {
+
+	var indRef *PDFIndirectRef
+	if ir, ok := obj.(PDFIndirectRef); ok {
+		indRef = &ir
+	}
+
+	o, err := xRefTable.Dereference(obj)
+	if err != nil || o == nil {
+		return err
+	}
+
+	switch o := o.(type) {
+
+	case PDFStreamDict:
+		return f(key, indRef, &o)
+
+	case PDFDict:
+		// A subdictionary of appearance streams, one for each appearance state.
+		var states []string
+		for k := range o.Dict {
+			states = append(states, k)
+		}
+		sort.Strings(states)
+		for _, k := range states {
+			v := o.Dict[k]
+			if v == nil {
+				continue
+			}
+			var indRef *PDFIndirectRef
+			if ir, ok := v.(PDFIndirectRef); ok {
+				indRef = &ir
+			}
+			sd, err := xRefTable.DereferenceStreamDict(v)
+			if err != nil {
+				return err
+			}
+			if sd == nil {
+				continue
+			}
+			if err = f(key, indRef, sd); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
+// visitAppearanceStreams calls f for every appearance stream referenced by the N, R and D entries
+// of the appearance dict of an annotation.
+func visitAppearanceStreams(xRefTable *XRefTable, annotDict *PDFDict, f appearanceVisitor) error {
+
+	obj, found := annotDict.Find("AP")
+	if !found || obj == nil {
+		return nil
+	}
+
+	d, err := xRefTable.DereferenceDict(obj)
+	if err != nil || d == nil {
+		return err
+	}
+
+	for _, key := range []string{"N", "R", "D"} {
+		obj, found := d.Find(key)
+		if !found || obj == nil {
+			continue
+		}
+		if err = visitAppearanceEntry(xRefTable, key, obj, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// annotDict returns the annotation dict for objNr.
+func annotDict(xRefTable *XRefTable, objNr int) (*PDFDict, error) {
+
+	obj, err := xRefTable.FindObject(objNr)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := xRefTable.DereferenceDict(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if d == nil || d.Subtype() == nil || (d.Type() != nil && *d.Type() != "Annot") {
+		return nil, errors.Errorf("annotDict: obj#%d is not an annotation", objNr)
+	}
+
+	return d, nil
+}
+
+// annotDictOfSubtype returns the annotation dict for objNr if it is of given subtype.
+func annotDictOfSubtype(xRefTable *XRefTable, objNr int, subtype string) (*PDFDict, error) {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return nil, err
+	}
+
+	if *d.Subtype() != subtype {
+		return nil, errors.Errorf("annotDictOfSubtype: obj#%d is not a %s annotation: %s", objNr, subtype, *d.Subtype())
+	}
+
+	return d, nil
+}
+
+// errAnnotFound terminates an annotation walk early.
+var errAnnotFound = errors.New("annotation found")
+
+// annotPageNr returns the number of the page whose Annots array references obj#objNr.
+func annotPageNr(xRefTable *XRefTable, objNr int) (int, error) {
+
+	pageNr := 0
+
+	err := visitAnnotations(xRefTable, func(i int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		if indRef != nil && indRef.ObjectNumber.Value() == objNr {
+			pageNr = i
+			return errAnnotFound
+		}
+		return nil
+	})
+
+	if err != nil && err != errAnnotFound {
+		return 0, err
+	}
+
+	if pageNr == 0 {
+		return 0, errors.Errorf("annotPageNr: obj#%d not referenced by any page", objNr)
+	}
+
+	return pageNr, nil
+}
+
+// moveAnnotation moves obj#objNr along with its Popup annotation to the Annots array of page pageNr.
+func moveAnnotation(xRefTable *XRefTable, objNr, pageNr int) error {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return err
+	}
+
+	fromPageNr, err := annotPageNr(xRefTable, objNr)
+	if err != nil {
+		return err
+	}
+
+	if fromPageNr == pageNr {
+		return nil
+	}
+
+	toPageDict, toPageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return err
+	}
+
+	fromPageDict, _, err := pageDictAndIndRef(xRefTable, fromPageNr)
+	if err != nil {
+		return err
+	}
+
+	arr, update, err := annotsArray(xRefTable, fromPageDict)
+	if err != nil {
+		return err
+	}
+
+	objNrs := IntSet{objNr: true}
+	if popup := d.IndirectRefEntry("Popup"); popup != nil {
+		objNrs[popup.ObjectNumber.Value()] = true
+	}
+
+	// The annotation and its popup in their original order.
+	var moved []PDFIndirectRef
+
+	a := PDFArray{}
+	for _, v := range arr {
+		if ir, ok := v.(PDFIndirectRef); ok && objNrs[ir.ObjectNumber.Value()] {
+			moved = append(moved, ir)
+			continue
+		}
+		a = append(a, v)
+	}
+
+	update(a)
+
+	for _, indRef := range moved {
+
+		if err = appendAnnotation(xRefTable, toPageDict, indRef); err != nil {
+			return err
+		}
+
+		ad, err := xRefTable.DereferenceDict(indRef)
+		if err != nil {
+			return err
+		}
+
+		if ad != nil {
+			setAnnotationEntry(xRefTable, indRef.ObjectNumber.Value(), ad, "P", *toPageIndRef)
+		}
+	}
+
+	return nil
+}
+
+// GetAnnotationZOrder returns the page of annotation obj#objNr along with its zero based position
+// within the Annots array of this page and the array length.
+// Annotations are painted in array order, so higher indices are drawn on top.
+func GetAnnotationZOrder(xRefTable *XRefTable, objNr int) (pageNr, index, total int, err error) {
+
+	pageNr, err = annotPageNr(xRefTable, objNr)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	pageDict, _, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	arr, _, err := annotsArray(xRefTable, pageDict)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	for i, v := range arr {
+		if indRef, ok := v.(PDFIndirectRef); ok && indRef.ObjectNumber.Value() == objNr {
+			return pageNr, i, len(arr), nil
+		}
+	}
+
+	return 0, 0, 0, errors.Errorf("GetAnnotationZOrder: obj#%d not found", objNr)
+}
+
+// Inconsistency represents an annotation whose page entry P disagrees with the page listing it in its Annots array.
+type Inconsistency struct {
+	PageNr  int // page listing the annotation
+	ObjNr   int // annotation, 0 for annotation dicts embedded directly into the Annots array
+	PPageNr int // page referenced by P, 0 if P does not reference a page of the page tree
+}
+
+func (i Inconsistency) String() string {
+
+	if i.PPageNr == 0 {
+		return fmt.Sprintf("page %d obj#%d: P does not reference a page", i.PageNr, i.ObjNr)
+	}
+
+	return fmt.Sprintf("page %d obj#%d: P references page %d", i.PageNr, i.ObjNr, i.PPageNr)
+}
+
+// CheckAnnotationPageConsistency returns all annotations whose page entry P disagrees
+// with the page whose Annots array contains them.
+func CheckAnnotationPageConsistency(xRefTable *XRefTable) ([]Inconsistency, error) {
+
+	pageNrs := map[int]int{}
+
+	err := visitPages(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, pageDict *PDFDict) error {
+		pageNrs[pageIndRef.ObjectNumber.Value()] = pageNr
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ii []Inconsistency
+
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		obj, found := annotDict.Find("P")
+		if !found || obj == nil {
+			// P is optional.
+			return nil
+		}
+
+		p, ok := obj.(PDFIndirectRef)
+		if ok && p.ObjectNumber == pageIndRef.ObjectNumber {
+			return nil
+		}
+
+		i := Inconsistency{PageNr: pageNr}
+
+		if indRef != nil {
+			i.ObjNr = indRef.ObjectNumber.Value()
+		}
+
+		if ok {
+			i.PPageNr = pageNrs[p.ObjectNumber.Value()]
+		}
+
+		ii = append(ii, i)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ii, nil
+}
+
+// widgetField returns the field the widget annotation obj#objNr belongs to
+// along with the partial field names from the root field down and the possibly inherited field value V.
+func widgetField(xRefTable *XRefTable, objNr int, d *PDFDict) (*PDFDict, []string, PDFObject, error) {
+
+	field := d
+	if _, found := d.Find("T"); !found && d.IndirectRefEntry("Parent") != nil {
+		var err error
+		if field, err = xRefTable.DereferenceDict(*d.IndirectRefEntry("Parent")); err != nil || field == nil {
+			return nil, nil, nil, errors.Errorf("obj#%d corrupt Parent", objNr)
+		}
+	}
+
+	var (
+		names []string
+		value PDFObject
+	)
+
+	visited := IntSet{objNr: true}
+
+	for f := field; f != nil; {
+
+		if obj, found := f.Find("T"); found {
+			names = append([]string{decodedTextString(xRefTable, obj)}, names...)
+		}
+
+		if obj, found := f.Find("V"); found && value == nil {
+			value = obj
+		}
+
+		indRef := f.IndirectRefEntry("Parent")
+		if indRef == nil {
+			break
+		}
+
+		if visited[indRef.ObjectNumber.Value()] {
+			return nil, nil, nil, errors.Errorf("obj#%d cycle in field hierarchy", objNr)
+		}
+		visited[indRef.ObjectNumber.Value()] = true
+
+		var err error
+		if f, err = xRefTable.DereferenceDict(*indRef); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return field, names, value, nil
+}
+
+// GetAnnotationParentField returns the field widget annotation obj#objNr belongs to
+// along with the fully qualified field name, see 12.7.3.2
+// For a widget merged with its field the widget dict itself is returned.
+func GetAnnotationParentField(xRefTable *XRefTable, objNr int) (*PDFDict, string, error) {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if *d.Subtype() != "Widget" {
+		return nil, "", errors.Errorf("GetAnnotationParentField: obj#%d is not a widget annotation: %s", objNr, *d.Subtype())
+	}
+
+	field, names, _, err := widgetField(xRefTable, objNr, d)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "GetAnnotationParentField")
+	}
+
+	return field, strings.Join(names, "."), nil
+}
+
+// GetAnnotationContentsEncoding returns the encoding of the Contents text string of an annotation dict
+// based on its byte order mark, see 7.9.2.2: "UTF-16BE", "PDFDocEncoding" or "ASCII"
+// for PDFDocEncoded strings limited to 7 bit characters.
+func GetAnnotationContentsEncoding(dict *PDFDict) (string, error) {
+
+	obj, found := dict.Find("Contents")
+	if !found || obj == nil {
+		return "", errors.New("GetAnnotationContentsEncoding: missing Contents")
+	}
+
+	b, err := stringBytes(obj)
+	if err != nil {
+		return "", errors.Errorf("GetAnnotationContentsEncoding: Contents must be a direct string: %v", obj)
+	}
+
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return "UTF-16BE", nil
+	}
+
+	for _, c := range b {
+		if c >= 0x80 {
+			return "PDFDocEncoding", nil
+		}
+	}
+
+	return "ASCII", nil
+}
+
+// annotationDateEntry returns the time represented by the date string entryName of an annotation dict
+// and whether the entry is present. Common non-conforming date variants are accepted.
+func annotationDateEntry(dict *PDFDict, entryName string) (time.Time, bool, error) {
+
+	obj, found := dict.Find(entryName)
+	if !found || obj == nil {
+		return time.Time{}, false, nil
+	}
+
+	b, err := stringBytes(obj)
+	if err != nil {
+		return time.Time{}, true, errors.Errorf("annotation: %s must be a direct string: %v", entryName, obj)
+	}
+
+	t, ok := parseDateRelaxed(string(b))
+	if !ok {
+		return time.Time{}, true, errors.Errorf("annotation: %s invalid date: %q", entryName, b)
+	}
+
+	return t, true, nil
+}
+
+// AnnotationModified returns the time an annotation was most recently modified according to its M entry
+// and whether M is present.
+func AnnotationModified(dict *PDFDict) (time.Time, bool, error) {
+	return annotationDateEntry(dict, "M")
+}
+
+// AnnotationCreated returns the time a markup annotation was created according to its CreationDate entry
+// and whether CreationDate is present.
+func AnnotationCreated(dict *PDFDict) (time.Time, bool, error) {
+	return annotationDateEntry(dict, "CreationDate")
+}
+
+// inReplyTo returns the object number of the annotation annotDict is a reply to or 0.
+func inReplyTo(annotDict *PDFDict) int {
+
+	if indRef := annotDict.IndirectRefEntry("IRT"); indRef != nil {
+		return indRef.ObjectNumber.Value()
+	}
+
+	return 0
+}
+
+// threadRoot returns the object number of the annotation starting the reply thread of obj#objNr.
+// irt maps annotations to the annotation they reply to. An annotation replying to an unknown annotation
+// starts its own thread. A cycle of replies is rooted at its lowest object number.
+func threadRoot(objNr int, irt map[int]int) int {
+
+	var path []int
+	onPath := map[int]int{}
+
+	for {
+		if i, found := onPath[objNr]; found {
+			// cycle
+			root := objNr
+			for _, o := range path[i:] {
+				if o < root {
+					root = o
+				}
+			}
+			return root
+		}
+
+		onPath[objNr] = len(path)
+		path = append(path, objNr)
+
+		parent, found := irt[objNr]
+		if !found || parent == 0 {
+			return objNr
+		}
+
+		if _, known := irt[parent]; !known {
+			return objNr
+		}
+
+		objNr = parent
+	}
+}
+
+// annotationDate returns the creation date of an annotation falling back to its modification date.
+func annotationDate(xRefTable *XRefTable, annotDict *PDFDict) time.Time {
+
+	for _, entryName := range []string{"CreationDate", "M"} {
+		s, err := stringValue(xRefTable, annotDict.Dict[entryName])
+		if err != nil || s == nil {
+			continue
+		}
+		if t, ok := parseDateRelaxed(*s); ok {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// GroupAnnotationsByReplyThread partitions all markup annotations into reply threads using IRT relationships.
+// Each thread starts with its root followed by the replies in chronological order.
+// Markup annotations without replies form threads of their own. Threads are ordered by the position of their root.
+func GroupAnnotationsByReplyThread(xRefTable *XRefTable) ([][]*PDFDict, error) {
+
+	var objNrs []int
+	dicts := map[int]*PDFDict{}
+	irt := map[int]int{}
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		// Replies refer to their parent by indirect reference only.
+		if indRef == nil || !isMarkupAnnotation(annotDict) {
+			return nil
+		}
+
+		objNr := indRef.ObjectNumber.Value()
+		if _, found := dicts[objNr]; found {
+			return nil
+		}
+
+		objNrs = append(objNrs, objNr)
+		dicts[objNr] = annotDict
+		irt[objNr] = inReplyTo(annotDict)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []int
+	threads := map[int][]int{}
+	pos := map[int]int{}
+
+	for i, objNr := range objNrs {
+		pos[objNr] = i
+		root := threadRoot(objNr, irt)
+		if _, found := threads[root]; !found {
+			roots = append(roots, root)
+		}
+		threads[root] = append(threads[root], objNr)
+	}
+
+	sort.Slice(roots, func(i, j int) bool { return pos[roots[i]] < pos[roots[j]] })
+
+	var groups [][]*PDFDict
+
+	for _, root := range roots {
+
+		members := threads[root]
+
+		sort.SliceStable(members, func(i, j int) bool {
+			if members[i] == root || members[j] == root {
+				return members[i] == root
+			}
+			return annotationDate(xRefTable, dicts[members[i]]).Before(annotationDate(xRefTable, dicts[members[j]]))
+		})
+
+		group := make([]*PDFDict, len(members))
+		for i, objNr := range members {
+			group[i] = dicts[objNr]
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// ReplyThread is a markup annotation along with its replies, see 12.5.6.2
+type ReplyThread struct {
+	ObjNr    int
+	Author   string    // T
+	Subject  string    // Subj
+	Contents string    // Contents
+	RT       string    // Relationship to the annotation replied to: R or Group, empty for thread roots.
+	Created  time.Time // CreationDate falling back to M, zero if unknown.
+	Replies  []ReplyThread
+}
+
+// ReplyThreads returns the markup annotations of page pageNr as trees of replies following IRT.
+// Threads as well as the replies of each node are ordered by creation date.
+// An annotation replying to an annotation not on this page starts a thread of its own
+// as does the annotation with the lowest object number of a cycle of replies.
+func ReplyThreads(xRefTable *XRefTable, pageNr int) ([]ReplyThread, error) {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return nil, err
+	}
+
+	var objNrs []int
+	nodes := map[int]*ReplyThread{}
+	irt := map[int]int{}
+
+	err = visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		// Replies refer to their parent by indirect reference only.
+		if indRef == nil || !isMarkupAnnotation(annotDict) {
+			return nil
+		}
+
+		objNr := indRef.ObjectNumber.Value()
+		if _, found := nodes[objNr]; found {
+			return nil
+		}
+
+		objNrs = append(objNrs, objNr)
+		irt[objNr] = inReplyTo(annotDict)
+
+		rt := ""
+		if irt[objNr] > 0 {
+			rt = "R"
+			if n := annotDict.NameEntry("RT"); n != nil {
+				rt = *n
+			}
+		}
+
+		nodes[objNr] = &ReplyThread{
+			ObjNr:    objNr,
+			Author:   decodedTextString(xRefTable, annotDict.Dict["T"]),
+			Subject:  decodedTextString(xRefTable, annotDict.Dict["Subj"]),
+			Contents: decodedTextString(xRefTable, annotDict.Dict["Contents"]),
+			RT:       rt,
+			Created:  annotationDate(xRefTable, annotDict),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []int
+	replies := map[int][]int{}
+
+	for _, objNr := range objNrs {
+		if threadRoot(objNr, irt) == objNr {
+			nodes[objNr].RT = ""
+			roots = append(roots, objNr)
+			continue
+		}
+		replies[irt[objNr]] = append(replies[irt[objNr]], objNr)
+	}
+
+	var build func(objNrs []int) []ReplyThread
+
+	build = func(objNrs []int) []ReplyThread {
+
+		sort.SliceStable(objNrs, func(i, j int) bool {
+			return nodes[objNrs[i]].Created.Before(nodes[objNrs[j]].Created)
+		})
+
+		var rt []ReplyThread
+		for _, objNr := range objNrs {
+			n := nodes[objNr]
+			n.Replies = build(replies[objNr])
+			rt = append(rt, *n)
+		}
+
+		return rt
+	}
+
+	return build(roots), nil
+}
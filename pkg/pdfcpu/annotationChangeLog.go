@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"time"
+)
+
+// AnnotationChangeKind represents the kind of an annotation mutation.
+type AnnotationChangeKind int
+
+// The kinds of annotation mutations being recorded.
+const (
+	AnnotationAdded AnnotationChangeKind = iota
+	AnnotationRemoved
+	AnnotationEdited
+)
+
+func (k AnnotationChangeKind) String() string {
+
+	switch k {
+
+	case AnnotationAdded:
+		return "add"
+
+	case AnnotationRemoved:
+		return "remove"
+
+	case AnnotationEdited:
+		return "edit"
+
+	}
+
+	return "?"
+}
+
+// AnnotationChange represents a single recorded annotation mutation.
+// Field, Old and New are only set for edits.
+// ObjNr is 0 for removed annotations embedded directly into an Annots array.
+type AnnotationChange struct {
+	Kind  AnnotationChangeKind
+	ObjNr int
+	Field string
+	Old   PDFObject
+	New   PDFObject
+	Time  time.Time
+}
+
+func (c AnnotationChange) String() string {
+
+	if c.Kind != AnnotationEdited {
+		return fmt.Sprintf("%s %s obj#%d", c.Time.Format(time.RFC3339), c.Kind, c.ObjNr)
+	}
+
+	return fmt.Sprintf("%s %s obj#%d %s: %v -> %v", c.Time.Format(time.RFC3339), c.Kind, c.ObjNr, c.Field, c.Old, c.New)
+}
+
+// AnnotationChangeLog is the in memory history of annotation mutations applied to an XRefTable.
+type AnnotationChangeLog []AnnotationChange
+
+// EnableAnnotationChangeLog starts recording all annotation mutations applied via this package.
+// Helpers editing a bare annotation dict like SetAnnotationFlags and SetAnnotationColor are not recorded.
+func (xRefTable *XRefTable) EnableAnnotationChangeLog() {
+
+	if xRefTable.annotChanges == nil {
+		xRefTable.annotChanges = &AnnotationChangeLog{}
+	}
+}
+
+// AnnotationChanges returns the recorded annotation mutations in chronological order.
+// Returns nil unless the annotation change log is enabled.
+func (xRefTable *XRefTable) AnnotationChanges() AnnotationChangeLog {
+
+	if xRefTable.annotChanges == nil {
+		return nil
+	}
+
+	return *xRefTable.annotChanges
+}
+
+// recordAnnotationChange is the single point all annotation mutations get recorded through.
+func (xRefTable *XRefTable) recordAnnotationChange(kind AnnotationChangeKind, objNr int, field string, old, new PDFObject) {
+
+	if xRefTable.annotChanges == nil {
+		return
+	}
+
+	*xRefTable.annotChanges = append(*xRefTable.annotChanges, AnnotationChange{
+		Kind:  kind,
+		ObjNr: objNr,
+		Field: field,
+		Old:   old,
+		New:   new,
+		Time:  time.Now(),
+	})
+}
+
+// setAnnotationEntry sets entry key of annotation obj#objNr to value and records the change.
+// A nil value removes the entry.
+func setAnnotationEntry(xRefTable *XRefTable, objNr int, d *PDFDict, key string, value PDFObject) {
+
+	old := d.Dict[key]
+
+	if value == nil {
+		d.Delete(key)
+	} else {
+		d.Update(key, value)
+	}
+
+	xRefTable.recordAnnotationChange(AnnotationEdited, objNr, key, old, value)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"testing"
+)
+
+func TestAnnotationChangeLog(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+	s := NewAnnotationStore(xRefTable)
+
+	// Nothing gets recorded unless enabled.
+	if _, err := s.Add(1, squareAnnotForTest(NewRectangle(10, 10, 50, 50))); err != nil {
+		t.Fatalf("TestAnnotationChangeLog: %v\n", err)
+	}
+
+	if changes := xRefTable.AnnotationChanges(); changes != nil {
+		t.Errorf("TestAnnotationChangeLog: expected no changes, got %v\n", changes)
+	}
+
+	xRefTable.EnableAnnotationChangeLog()
+
+	objNr, err := s.Add(1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	if err != nil {
+		t.Fatalf("TestAnnotationChangeLog: %v\n", err)
+	}
+
+	blue := NewNumberArray(0, 0, 1)
+	if err = s.Set(objNr, "C", blue); err != nil {
+		t.Fatalf("TestAnnotationChangeLog: %v\n", err)
+	}
+
+	// Rejected changes are not recorded.
+	if err = s.Set(objNr, "C", PDFName("Blue")); err == nil {
+		t.Errorf("TestAnnotationChangeLog: invalid C => not ok!\n")
+	}
+
+	changes := xRefTable.AnnotationChanges()
+	if len(changes) != 2 {
+		t.Fatalf("TestAnnotationChangeLog: expected 2 changes, got %v\n", changes)
+	}
+
+	add := changes[0]
+	if add.Kind != AnnotationAdded || add.ObjNr != objNr || add.Time.IsZero() {
+		t.Errorf("TestAnnotationChangeLog: unexpected add: %v\n", add)
+	}
+
+	edit := changes[1]
+	if edit.Kind != AnnotationEdited || edit.ObjNr != objNr || edit.Field != "C" {
+		t.Errorf("TestAnnotationChangeLog: unexpected edit: %v\n", edit)
+	}
+
+	if edit.Old == nil || edit.Old.PDFString() != NewNumberArray(1, 0, 0).PDFString() || edit.New.PDFString() != blue.PDFString() {
+		t.Errorf("TestAnnotationChangeLog: unexpected color change: %v\n", edit)
+	}
+}
+
+func TestAnnotationChangeLogBulkEdits(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	indRef := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	objNr := indRef.ObjectNumber.Value()
+
+	xRefTable.EnableAnnotationChangeLog()
+
+	fields := func(from int) map[string]bool {
+		m := map[string]bool{}
+		for _, c := range xRefTable.AnnotationChanges()[from:] {
+			if c.Kind == AnnotationEdited && c.ObjNr == objNr {
+				m[c.Field] = true
+			}
+		}
+		return m
+	}
+
+	if err := MirrorAnnotations(xRefTable, 1, true); err != nil {
+		t.Fatalf("TestAnnotationChangeLogBulkEdits: %v\n", err)
+	}
+
+	if !fields(0)["Rect"] {
+		t.Errorf("TestAnnotationChangeLogBulkEdits: mirrored Rect not recorded: %v\n", xRefTable.AnnotationChanges())
+	}
+
+	n := len(xRefTable.AnnotationChanges())
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		t.Fatalf("TestAnnotationChangeLogBulkEdits: %v\n", err)
+	}
+	d.Update("F", PDFFloat(4))
+
+	if _, err = ValidateAndFixAnnots(xRefTable); err != nil {
+		t.Fatalf("TestAnnotationChangeLogBulkEdits: %v\n", err)
+	}
+
+	if !fields(n)["F"] {
+		t.Errorf("TestAnnotationChangeLogBulkEdits: repaired F not recorded: %v\n", xRefTable.AnnotationChanges()[n:])
+	}
+
+	// Free some object numbers in front of the annotation.
+	for i := 0; i < 3; i++ {
+		ir, err := xRefTable.IndRefForNewObject(PDFInteger(i))
+		if err != nil {
+			t.Fatalf("TestAnnotationChangeLogBulkEdits: %v\n", err)
+		}
+		addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+		if err = xRefTable.DeleteObject(ir.ObjectNumber.Value()); err != nil {
+			t.Fatalf("TestAnnotationChangeLogBulkEdits: %v\n", err)
+		}
+	}
+
+	n = len(xRefTable.AnnotationChanges())
+
+	if _, err = RenumberAnnotations(xRefTable); err != nil {
+		t.Fatalf("TestAnnotationChangeLogBulkEdits: %v\n", err)
+	}
+
+	removed, added := 0, 0
+	for _, c := range xRefTable.AnnotationChanges()[n:] {
+		switch c.Kind {
+		case AnnotationRemoved:
+			removed++
+		case AnnotationAdded:
+			added++
+		}
+	}
+
+	if removed == 0 || removed != added {
+		t.Errorf("TestAnnotationChangeLogBulkEdits: renumbering not recorded: %v\n", xRefTable.AnnotationChanges()[n:])
+	}
+}
@@ -0,0 +1,920 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"math"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Geometric measures of annotations in default user space units.
+
+// numbers returns the resolved values of a number array.
+func numbers(xRefTable *XRefTable, obj PDFObject) ([]float64, error) {
+
+	arr, err := xRefTable.DereferenceArray(obj)
+	if err != nil || arr == nil {
+		return nil, err
+	}
+
+	var f []float64
+
+	for _, v := range *arr {
+
+		o, err := xRefTable.Dereference(v)
+		if err != nil {
+			return nil, err
+		}
+
+		switch o := o.(type) {
+
+		case PDFInteger:
+			f = append(f, float64(o.Value()))
+
+		case PDFFloat:
+			f = append(f, o.Value())
+
+		default:
+			return nil, errors.Errorf("numbers: invalid number array element: %v", o)
+		}
+	}
+
+	return f, nil
+}
+
+// pathLength returns the length of the polyline given by a flat list of coordinates.
+func pathLength(f []float64) float64 {
+
+	var l float64
+
+	for i := 2; i+1 < len(f); i += 2 {
+		l += math.Hypot(f[i]-f[i-2], f[i+1]-f[i-1])
+	}
+
+	return l
+}
+
+// boundingBox returns the smallest rectangle containing all points of a flat list of coordinates.
+func boundingBox(f []float64) types.Rectangle {
+
+	r := types.NewRectangle(math.MaxFloat64, math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64)
+
+	for i := 0; i+1 < len(f); i += 2 {
+		r.LL.X = math.Min(r.LL.X, f[i])
+		r.LL.Y = math.Min(r.LL.Y, f[i+1])
+		r.UR.X = math.Max(r.UR.X, f[i])
+		r.UR.Y = math.Max(r.UR.Y, f[i+1])
+	}
+
+	return r
+}
+
+// containsRect returns true if r1 contains r2 allowing for rounding errors.
+func containsRect(r1, r2 types.Rectangle) bool {
+
+	const eps = 0.01
+
+	return r2.LL.X >= r1.LL.X-eps && r2.LL.Y >= r1.LL.Y-eps && r2.UR.X <= r1.UR.X+eps && r2.UR.Y <= r1.UR.Y+eps
+}
+
+// formMatrix returns the Matrix of a form XObject defaulting to identity.
+func formMatrix(xRefTable *XRefTable, sd *PDFStreamDict) ([]float64, error) {
+
+	obj, found := sd.Find("Matrix")
+	if !found || obj == nil {
+		return []float64{1, 0, 0, 1, 0, 0}, nil
+	}
+
+	m, err := numbers(xRefTable, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m) != 6 {
+		return nil, errors.New("formMatrix: corrupt Matrix")
+	}
+
+	return m, nil
+}
+
+// transformedBBox returns the bounding box of a form XObject transformed by its Matrix, see 12.5.5 Algorithm 8.1
+func transformedBBox(xRefTable *XRefTable, sd *PDFStreamDict) (*types.Rectangle, error) {
+
+	bbox, err := numbers(xRefTable, sd.Dict["BBox"])
+	if err != nil {
+		return nil, err
+	}
+	if len(bbox) != 4 {
+		return nil, errors.New("transformedBBox: corrupt BBox")
+	}
+
+	m, err := formMatrix(xRefTable, sd)
+	if err != nil {
+		return nil, err
+	}
+
+	var f []float64
+
+	for _, p := range [][2]float64{{bbox[0], bbox[1]}, {bbox[2], bbox[1]}, {bbox[2], bbox[3]}, {bbox[0], bbox[3]}} {
+		f = append(f, m[0]*p[0]+m[2]*p[1]+m[4], m[1]*p[0]+m[3]*p[1]+m[5])
+	}
+
+	r := boundingBox(f)
+
+	return &r, nil
+}
+
+// newMatrix returns the matrix for the PDF transformation matrix [a b c d e f].
+func newMatrix(f []float64) matrix {
+	return matrix{{f[0], f[1], 0}, {f[2], f[3], 0}, {f[4], f[5], 1}}
+}
+
+func translationMatrix(tx, ty float64) matrix {
+	m := identMatrix
+	m[2][0], m[2][1] = tx, ty
+	return m
+}
+
+func scaleMatrix(sx, sy float64) matrix {
+	m := identMatrix
+	m[0][0], m[1][1] = sx, sy
+	return m
+}
+
+// invertMatrix returns the inverse of the affine transformation m.
+func invertMatrix(m matrix) (matrix, error) {
+
+	det := m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	if det == 0 {
+		return m, errors.New("invertMatrix: singular matrix")
+	}
+
+	inv := identMatrix
+	inv[0][0], inv[0][1] = m[1][1]/det, -m[0][1]/det
+	inv[1][0], inv[1][1] = -m[1][0]/det, m[0][0]/det
+	inv[2][0] = -(m[2][0]*inv[0][0] + m[2][1]*inv[1][0])
+	inv[2][1] = -(m[2][0]*inv[0][1] + m[2][1]*inv[1][1])
+
+	return inv, nil
+}
+
+// transformPoint applies m to (x,y).
+func transformPoint(m matrix, x, y float64) (float64, float64) {
+	return x*m[0][0] + y*m[1][0] + m[2][0], x*m[0][1] + y*m[1][1] + m[2][1]
+}
+
+// transformRect returns the bounding box of r transformed by m.
+func transformRect(m matrix, r types.Rectangle) types.Rectangle {
+
+	var f []float64
+
+	for _, p := range [][2]float64{{r.LL.X, r.LL.Y}, {r.UR.X, r.LL.Y}, {r.UR.X, r.UR.Y}, {r.LL.X, r.UR.Y}} {
+		x, y := transformPoint(m, p[0], p[1])
+		f = append(f, x, y)
+	}
+
+	return boundingBox(f)
+}
+
+// unionRect returns the smallest rectangle containing r1 and r2, r1 may be nil.
+func unionRect(r1 *types.Rectangle, r2 types.Rectangle) *types.Rectangle {
+
+	if r1 == nil {
+		return &r2
+	}
+
+	r := types.NewRectangle(
+		math.Min(r1.LL.X, r2.LL.X), math.Min(r1.LL.Y, r2.LL.Y),
+		math.Max(r1.UR.X, r2.UR.X), math.Max(r1.UR.Y, r2.UR.Y))
+
+	return &r
+}
+
+// xObjectBounds returns the bounding box of the XObject name in form space.
+// Images and unresolvable XObjects occupy the unit square.
+func xObjectBounds(xRefTable *XRefTable, resources *PDFDict, name string) (types.Rectangle, error) {
+
+	unit := types.NewRectangle(0, 0, 1, 1)
+
+	if resources == nil {
+		return unit, nil
+	}
+
+	d, err := xRefTable.DereferenceDict(resources.Dict["XObject"])
+	if err != nil || d == nil {
+		return unit, err
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(d.Dict[name])
+	if err != nil || sd == nil || sd.Subtype() == nil || *sd.Subtype() != "Form" {
+		return unit, err
+	}
+
+	r, err := transformedBBox(xRefTable, sd)
+	if err != nil {
+		return unit, err
+	}
+
+	return *r, nil
+}
+
+// drawnBounds returns the normalized BBox of a form XObject along with the unclipped bounds of everything drawn by its content.
+// Text extents are estimated from the font size, since font metrics are not taken into account.
+// The bounds are nil if nothing gets drawn.
+func drawnBounds(xRefTable *XRefTable, sd *PDFStreamDict) (types.Rectangle, *types.Rectangle, error) {
+
+	var clip types.Rectangle
+
+	bbox, err := numbers(xRefTable, sd.Dict["BBox"])
+	if err != nil {
+		return clip, nil, err
+	}
+	if len(bbox) != 4 {
+		return clip, nil, errors.New("drawnBounds: corrupt BBox")
+	}
+	clip = types.NewRectangle(math.Min(bbox[0], bbox[2]), math.Min(bbox[1], bbox[3]), math.Max(bbox[0], bbox[2]), math.Max(bbox[1], bbox[3]))
+
+	resources, err := xRefTable.DereferenceDict(sd.Dict["Resources"])
+	if err != nil {
+		return clip, nil, err
+	}
+
+	b, err := streamContent(sd)
+	if err != nil {
+		return clip, nil, err
+	}
+
+	tokens, err := contentOperators(b)
+	if err != nil {
+		return clip, nil, err
+	}
+
+	type graphicsState struct {
+		ctm       matrix
+		lineWidth float64
+	}
+
+	var (
+		gs                = graphicsState{ctm: identMatrix, lineWidth: 1}
+		stack             []graphicsState
+		bounds            *types.Rectangle
+		path              []float64 // in form space
+		tm, tlm           = identMatrix, identMatrix
+		fontSize, leading float64
+		hScale            = 1.0
+	)
+
+	addPoints := func(f ...float64) {
+		for i := 0; i+1 < len(f); i += 2 {
+			x, y := transformPoint(gs.ctm, f[i], f[i+1])
+			path = append(path, x, y)
+		}
+	}
+
+	paint := func(stroke bool) {
+		if len(path) > 0 {
+			r := boundingBox(path)
+			if stroke {
+				m := gs.ctm
+				d := gs.lineWidth / 2 * math.Sqrt(math.Abs(m[0][0]*m[1][1]-m[0][1]*m[1][0]))
+				r = types.NewRectangle(r.LL.X-d, r.LL.Y-d, r.UR.X+d, r.UR.Y+d)
+			}
+			bounds = unionRect(bounds, r)
+		}
+		path = nil
+	}
+
+	nextLine := func(tx, ty float64) {
+		tlm = translationMatrix(tx, ty).multiply(tlm)
+		tm = tlm
+	}
+
+	showText := func(n int) {
+		// Assume an average glyph width of 0.6 em, an ascent of 1 em and a descent of 0.25 em.
+		w := 0.6 * fontSize * float64(n) * hScale
+		r := types.NewRectangle(0, -0.25*fontSize, w, fontSize)
+		bounds = unionRect(bounds, transformRect(tm.multiply(gs.ctm), r))
+		tm = translationMatrix(w, 0).multiply(tm)
+	}
+
+	for _, t := range tokens {
+
+		o := t.operands
+
+		switch t.op {
+
+		case "q":
+			stack = append(stack, gs)
+
+		case "Q":
+			if len(stack) > 0 {
+				gs, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+
+		case "cm":
+			if len(o) == 6 {
+				gs.ctm = newMatrix(o).multiply(gs.ctm)
+			}
+
+		case "w":
+			if len(o) == 1 {
+				gs.lineWidth = o[0]
+			}
+
+		case "m", "l":
+			if len(o) == 2 {
+				addPoints(o...)
+			}
+
+		case "c":
+			if len(o) == 6 {
+				addPoints(o...)
+			}
+
+		case "v", "y":
+			if len(o) == 4 {
+				addPoints(o...)
+			}
+
+		case "re":
+			if len(o) == 4 {
+				addPoints(o[0], o[1], o[0]+o[2], o[1], o[0]+o[2], o[1]+o[3], o[0], o[1]+o[3])
+			}
+
+		case "S", "s", "B", "B*", "b", "b*":
+			paint(true)
+
+		case "f", "F", "f*":
+			paint(false)
+
+		case "n":
+			path = nil
+
+		case "BT":
+			tm, tlm = identMatrix, identMatrix
+
+		case "Tf":
+			if len(o) == 1 {
+				fontSize = o[0]
+			}
+
+		case "Tz":
+			if len(o) == 1 {
+				hScale = o[0] / 100
+			}
+
+		case "TL":
+			if len(o) == 1 {
+				leading = o[0]
+			}
+
+		case "Tm":
+			if len(o) == 6 {
+				tlm = newMatrix(o)
+				tm = tlm
+			}
+
+		case "Td", "TD":
+			if len(o) == 2 {
+				if t.op == "TD" {
+					leading = -o[1]
+				}
+				nextLine(o[0], o[1])
+			}
+
+		case "T*":
+			nextLine(0, -leading)
+
+		case "Tj", "TJ":
+			showText(t.strLen)
+
+		case "'", "\"":
+			nextLine(0, -leading)
+			showText(t.strLen)
+
+		case "EI":
+			// Inline images occupy the unit square.
+			bounds = unionRect(bounds, transformRect(gs.ctm, types.NewRectangle(0, 0, 1, 1)))
+
+		case "Do":
+			r, err := xObjectBounds(xRefTable, resources, t.name)
+			if err != nil {
+				return clip, nil, err
+			}
+			bounds = unionRect(bounds, transformRect(gs.ctm, r))
+
+		case "sh":
+			// A shading fills the current clipping path.
+			bounds = unionRect(bounds, clip)
+		}
+	}
+
+	return clip, bounds, nil
+}
+
+// contentBounds returns the bounds of everything drawn by the content of a form XObject, clipped to its BBox.
+// Returns nil if nothing gets drawn.
+func contentBounds(xRefTable *XRefTable, sd *PDFStreamDict) (*types.Rectangle, error) {
+
+	clip, bounds, err := drawnBounds(xRefTable, sd)
+	if err != nil || bounds == nil {
+		return nil, err
+	}
+
+	// Anything outside BBox is clipped.
+	r := types.NewRectangle(
+		math.Max(bounds.LL.X, clip.LL.X), math.Max(bounds.LL.Y, clip.LL.Y),
+		math.Min(bounds.UR.X, clip.UR.X), math.Min(bounds.UR.Y, clip.UR.Y))
+
+	if r.LL.X >= r.UR.X || r.LL.Y >= r.UR.Y {
+		return nil, nil
+	}
+
+	return &r, nil
+}
+
+// GetAnnotationInkLength returns the accumulated length of all stroked paths of an Ink annotation.
+func GetAnnotationInkLength(xRefTable *XRefTable, objNr int) (float64, error) {
+
+	d, err := annotDictOfSubtype(xRefTable, objNr, "Ink")
+	if err != nil {
+		return 0, err
+	}
+
+	obj, found := d.Find("InkList")
+	if !found {
+		return 0, errors.Errorf("GetAnnotationInkLength: obj#%d missing InkList", objNr)
+	}
+
+	inkList, err := xRefTable.DereferenceArray(obj)
+	if err != nil || inkList == nil {
+		return 0, errors.Errorf("GetAnnotationInkLength: obj#%d corrupt InkList", objNr)
+	}
+
+	var l float64
+
+	for _, v := range *inkList {
+
+		f, err := numbers(xRefTable, v)
+		if err != nil {
+			return 0, err
+		}
+
+		l += pathLength(f)
+	}
+
+	return l, nil
+}
+
+// annotationMeasure returns the Measure dict of an annotation dict.
+// Without a Measure dict measurements are taken in default user space units and nil is returned.
+func annotationMeasure(xRefTable *XRefTable, annotDict *PDFDict) (*Measure, error) {
+
+	d, err := xRefTable.DereferenceDict(annotDict.Dict["Measure"])
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	return Measurement(xRefTable, d)
+}
+
+// firstFactor returns the conversion factor of the first element of a number format array.
+// An empty array results in 1.
+func firstFactor(nn []NumberFormat) float64 {
+
+	if len(nn) == 0 {
+		return 1
+	}
+
+	return nn[0].Factor
+}
+
+// GetAnnotationLineLength returns the length of the line segment L of a Line annotation.
+// The length is given in default user space units or in the distance units of its Measure dict.
+func GetAnnotationLineLength(xRefTable *XRefTable, objNr int) (float64, error) {
+
+	d, err := annotDictOfSubtype(xRefTable, objNr, "Line")
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := numbers(xRefTable, d.Dict["L"])
+	if err != nil || len(f) != 4 {
+		return 0, errors.Errorf("GetAnnotationLineLength: obj#%d corrupt L", objNr)
+	}
+
+	m, err := annotationMeasure(xRefTable, d)
+	if err != nil {
+		return 0, errors.Wrapf(err, "GetAnnotationLineLength: obj#%d", objNr)
+	}
+
+	l := math.Hypot(f[2]-f[0], f[3]-f[1])
+
+	if m != nil {
+		l = math.Hypot((f[2]-f[0])*m.XScale, (f[3]-f[1])*m.YScale) * firstFactor(m.D)
+	}
+
+	return l, nil
+}
+
+// GetAnnotationPolygonArea returns the area enclosed by the Vertices of a Polygon annotation.
+// The area is given in square default user space units or in the area units of its Measure dict.
+func GetAnnotationPolygonArea(xRefTable *XRefTable, objNr int) (float64, error) {
+
+	d, err := annotDictOfSubtype(xRefTable, objNr, "Polygon")
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := numbers(xRefTable, d.Dict["Vertices"])
+	if err != nil || len(f)%2 != 0 {
+		return 0, errors.Errorf("GetAnnotationPolygonArea: obj#%d corrupt Vertices", objNr)
+	}
+
+	m, err := annotationMeasure(xRefTable, d)
+	if err != nil {
+		return 0, errors.Wrapf(err, "GetAnnotationPolygonArea: obj#%d", objNr)
+	}
+
+	// Shoelace formula, the polygon is implicitly closed.
+	var a float64
+
+	for i, n := 0, len(f); i < n; i += 2 {
+		j := (i + 2) % n
+		a += f[i]*f[j+1] - f[j]*f[i+1]
+	}
+
+	a = math.Abs(a) / 2
+
+	if m != nil {
+		a *= m.XScale * m.YScale * firstFactor(m.A)
+	}
+
+	return a, nil
+}
+
+// NumberFormat represents a number format dict, see 12.9.2
+type NumberFormat struct {
+	Unit      string  // U, the label of the units.
+	Factor    float64 // C, converts values in the units of the preceding element or, for the first element, the measured quantity.
+	Precision int     // D, the precision or denominator of fractional values, defaults to 100.
+	Fraction  string  // F, the display of fractional values, defaults to D.
+}
+
+// Measure represents a rectilinear measure dict, see 12.9.1
+type Measure struct {
+	Ratio          string         // R, the scale ratio as displayed, eg. "1 in = 10 ft".
+	XScale, YScale float64        // The conversion factors of default user space units along the x and y axes.
+	X, Y           []NumberFormat // Measurement along the x and y axes. Y defaults to X.
+	D, A           []NumberFormat // Measurement of distances and areas.
+}
+
+// directNumber returns the value of a direct numeric object.
+func directNumber(o PDFObject) (float64, bool) {
+
+	switch o := o.(type) {
+
+	case PDFInteger:
+		return float64(o.Value()), true
+
+	case PDFFloat:
+		return o.Value(), true
+	}
+
+	return 0, false
+}
+
+// numberFormats returns the number format array entry key of the measure dict d.
+func numberFormats(xRefTable *XRefTable, d *PDFDict, key string) ([]NumberFormat, error) {
+
+	obj, found := d.Find(key)
+	if !found || obj == nil {
+		return nil, nil
+	}
+
+	arr, err := xRefTable.DereferenceArray(obj)
+	if err != nil || arr == nil {
+		return nil, errors.Errorf("Measurement: corrupt %s: %v", key, obj)
+	}
+
+	nn := make([]NumberFormat, len(*arr))
+
+	for i, o := range *arr {
+
+		nf, err := xRefTable.DereferenceDict(o)
+		if err != nil || nf == nil {
+			return nil, errors.Errorf("Measurement: corrupt %s[%d]: %v", key, i, o)
+		}
+
+		uObj, _ := xRefTable.Dereference(nf.Dict["U"])
+		u, err := textStringRunes(uObj)
+		if err != nil {
+			return nil, errors.Errorf("Measurement: %s[%d]: corrupt U", key, i)
+		}
+
+		cObj, _ := xRefTable.Dereference(nf.Dict["C"])
+		c, ok := directNumber(cObj)
+		if !ok {
+			return nil, errors.Errorf("Measurement: %s[%d]: corrupt C", key, i)
+		}
+
+		nn[i] = NumberFormat{Unit: string(u), Factor: c, Precision: 100, Fraction: "D"}
+
+		if p := nf.IntEntry("D"); p != nil {
+			nn[i].Precision = *p
+		}
+
+		if f := nf.NameEntry("F"); f != nil {
+			nn[i].Fraction = *f
+		}
+	}
+
+	return nn, nil
+}
+
+// Measurement returns the scale and number formats of a rectilinear measure dict, see 12.9
+// Y defaults to X which covers the common case of a measure dict carrying X only.
+// xRefTable is needed to resolve number format arrays, number format dicts and their entries
+// given as indirect objects, which is why Measurement does not operate on dict alone.
+func Measurement(xRefTable *XRefTable, dict *PDFDict) (*Measure, error) {
+
+	if st := dict.NameEntry("Subtype"); st != nil && *st != "RL" {
+		return nil, errors.Errorf("Measurement: unsupported measure dict subtype: %s", *st)
+	}
+
+	m := &Measure{}
+
+	if o, found := dict.Find("R"); found {
+		o, _ = xRefTable.Dereference(o)
+		r, err := textStringRunes(o)
+		if err != nil {
+			return nil, errors.New("Measurement: corrupt R")
+		}
+		m.Ratio = string(r)
+	}
+
+	var err error
+
+	for _, e := range []struct {
+		key string
+		nn  *[]NumberFormat
+	}{
+		{"X", &m.X}, {"Y", &m.Y}, {"D", &m.D}, {"A", &m.A},
+	} {
+		if *e.nn, err = numberFormats(xRefTable, dict, e.key); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(m.X) == 0 {
+		return nil, errors.New("Measurement: missing X")
+	}
+
+	if len(m.Y) == 0 {
+		m.Y = m.X
+	}
+
+	m.XScale, m.YScale = m.X[0].Factor, m.Y[0].Factor
+
+	return m, nil
+}
+
+// ConvertDistance converts a distance given in default user space units into the units of the first number format dict of D.
+// The distance is taken along the x axis and converted by X first. Without D the units of X apply.
+func (m Measure) ConvertDistance(points float64) (value float64, unit string, err error) {
+
+	if len(m.X) == 0 {
+		return 0, "", errors.New("ConvertDistance: missing X")
+	}
+
+	value, unit = points*m.X[0].Factor, m.X[0].Unit
+
+	if len(m.D) > 0 {
+		value, unit = value*m.D[0].Factor, m.D[0].Unit
+	}
+
+	return value, unit, nil
+}
+
+// Quad is a quadrilateral taken from the QuadPoints of a text markup or link annotation, see 12.5.6.10
+type Quad struct {
+	Points [8]float64      // (x1,y1) .. (x4,y4) as stored.
+	Rect   types.Rectangle // The bounding rectangle.
+}
+
+// Swapped returns true if q lists its lower edge before its upper edge, see quadPointsSwapped.
+func (q Quad) Swapped() bool {
+	return quadPointsSwapped(q.Points[:])
+}
+
+// Normalized returns the points of q with the upper edge (x1,y1) (x2,y2) given first.
+func (q Quad) Normalized() [8]float64 {
+
+	p := q.Points
+
+	if q.Swapped() {
+		for i := 0; i < 4; i++ {
+			p[i], p[i+4] = p[i+4], p[i]
+		}
+	}
+
+	return p
+}
+
+// ComputeAnnotationQuadFromRect returns the QuadPoints of the quadrilateral covering rect given as llx lly urx ury.
+// The points are ordered upper left, upper right, lower left, lower right as expected by viewers.
+func ComputeAnnotationQuadFromRect(rect [4]float64) [8]float64 {
+
+	llx, lly := math.Min(rect[0], rect[2]), math.Min(rect[1], rect[3])
+	urx, ury := math.Max(rect[0], rect[2]), math.Max(rect[1], rect[3])
+
+	return [8]float64{llx, ury, urx, ury, llx, lly, urx, lly}
+}
+
+// Quads returns the quadrilaterals of the QuadPoints of an annotation dict in order of appearance.
+// QuadPoints must be a direct array of a multiple of 8 numbers.
+func Quads(dict *PDFDict) ([]Quad, error) {
+
+	obj, found := dict.Find("QuadPoints")
+	if !found || obj == nil {
+		return nil, nil
+	}
+
+	arr, ok := obj.(PDFArray)
+	if !ok || len(arr)%8 != 0 {
+		return nil, errors.Errorf("Quads: corrupt QuadPoints: %v", obj)
+	}
+
+	qq := make([]Quad, len(arr)/8)
+
+	for i, o := range arr {
+
+		var f float64
+
+		switch o := o.(type) {
+
+		case PDFInteger:
+			f = float64(o.Value())
+
+		case PDFFloat:
+			f = o.Value()
+
+		default:
+			return nil, errors.Errorf("Quads: invalid QuadPoints element: %v", o)
+		}
+
+		qq[i/8].Points[i%8] = f
+	}
+
+	for i := range qq {
+		qq[i].Rect = boundingBox(qq[i].Points[:])
+	}
+
+	return qq, nil
+}
+
+// QuadPoints returns the bounding rectangles of the quadrilaterals of the QuadPoints
+// of an annotation dict in order of appearance regardless of the order of their edges.
+func QuadPoints(dict *PDFDict) ([]types.Rectangle, error) {
+
+	qq, err := Quads(dict)
+	if err != nil {
+		return nil, err
+	}
+
+	var rr []types.Rectangle
+
+	for _, q := range qq {
+		rr = append(rr, q.Rect)
+	}
+
+	return rr, nil
+}
+
+// footprintSkipKeys are the entries referring back to the document structure an annotation is part of.
+var footprintSkipKeys = []string{"P", "Parent", "IRT"}
+
+// objectFootprint returns the serialized size of obj including all objects referenced
+// unless already visited, using the decoded size of streams. Page objects are not taken into account.
+func objectFootprint(xRefTable *XRefTable, obj PDFObject, visited IntSet) (int, error) {
+
+	switch o := obj.(type) {
+
+	case nil:
+		return 0, nil
+
+	case PDFIndirectRef:
+		objNr := o.ObjectNumber.Value()
+		if visited[objNr] {
+			return 0, nil
+		}
+		visited[objNr] = true
+
+		obj, err := xRefTable.Dereference(o)
+		if err != nil {
+			return 0, err
+		}
+
+		if d, ok := obj.(PDFDict); ok && d.Type() != nil && memberOf(*d.Type(), []string{"Page", "Pages"}) {
+			return 0, nil
+		}
+
+		return objectFootprint(xRefTable, obj, visited)
+
+	case PDFStreamDict:
+		n := len(o.PDFDict.PDFString())
+		if b, err := streamContent(&o); err == nil {
+			n += len(b)
+		} else {
+			// Unsupported filter.
+			n += len(o.Raw)
+		}
+		i, err := referencedFootprint(xRefTable, o.PDFDict, visited)
+		return n + i, err
+	}
+
+	i, err := referencedFootprint(xRefTable, obj, visited)
+
+	return len(obj.PDFString()) + i, err
+}
+
+// referencedFootprint returns the accumulated footprint of all objects indirectly referenced by obj.
+func referencedFootprint(xRefTable *XRefTable, obj PDFObject, visited IntSet) (int, error) {
+
+	var objs []PDFObject
+
+	switch o := obj.(type) {
+
+	case PDFIndirectRef:
+		return objectFootprint(xRefTable, o, visited)
+
+	case PDFDict:
+		for k, v := range o.Dict {
+			if !memberOf(k, footprintSkipKeys) {
+				objs = append(objs, v)
+			}
+		}
+
+	case PDFArray:
+		objs = o
+	}
+
+	n := 0
+
+	for _, o := range objs {
+		i, err := referencedFootprint(xRefTable, o, visited)
+		if err != nil {
+			return 0, err
+		}
+		n += i
+	}
+
+	return n, nil
+}
+
+// AnnotationMemoryFootprint estimates the serialized size in bytes of every annotation
+// including appearance streams, its Popup and embedded files by object number.
+// Stream sizes are based on decoded content. Objects shared by annotations count for each of them.
+// Annotation dicts embedded directly into an Annots array are not taken into account.
+func AnnotationMemoryFootprint(xRefTable *XRefTable) (map[int]int, error) {
+
+	m := map[int]int{}
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if indRef == nil {
+			return nil
+		}
+
+		n, err := objectFootprint(xRefTable, *indRef, IntSet{})
+		if err != nil {
+			return err
+		}
+
+		m[indRef.ObjectNumber.Value()] = n
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
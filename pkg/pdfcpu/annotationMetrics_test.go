@@ -0,0 +1,406 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+)
+
+func numberFormatDictForTest(t *testing.T, unit string, c float64) PDFDict {
+
+	d, err := numberFormatDict(unit, c)
+	if err != nil {
+		t.Fatalf("numberFormatDictForTest: %v\n", err)
+	}
+
+	return d
+}
+
+func measureDictForTest(t *testing.T, scale float64, unit string) PDFDict {
+
+	d, err := measureDict(scale, unit)
+	if err != nil {
+		t.Fatalf("measureDictForTest: %v\n", err)
+	}
+
+	return d
+}
+
+func TestGetAnnotationInkLength(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	// A two segment path of length 5 + 10 and a single segment path of length 10.
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Ink"),
+			"Rect":    NewRectangle(0, 0, 100, 100),
+			"InkList": PDFArray{
+				NewNumberArray(10, 10, 13, 14, 13, 24),
+				NewNumberArray(20, 20, 30, 20),
+			},
+		},
+	}
+
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	l, err := GetAnnotationInkLength(xRefTable, indRef.ObjectNumber.Value())
+	if err != nil {
+		t.Fatalf("TestGetAnnotationInkLength: %v\n", err)
+	}
+
+	if math.Abs(l-25) > 1e-9 {
+		t.Errorf("TestGetAnnotationInkLength: expected 25, got %f\n", l)
+	}
+
+	indRef = addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+
+	if _, err = GetAnnotationInkLength(xRefTable, indRef.ObjectNumber.Value()); err == nil {
+		t.Errorf("TestGetAnnotationInkLength: Square annotation => not ok!\n")
+	}
+}
+
+func TestGetAnnotationLineLength(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Line"),
+			"Rect":    NewRectangle(0, 0, 100, 100),
+			"L":       NewNumberArray(10, 10, 40, 50),
+		},
+	}
+
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	l, err := GetAnnotationLineLength(xRefTable, indRef.ObjectNumber.Value())
+	if err != nil {
+		t.Fatalf("TestGetAnnotationLineLength: %v\n", err)
+	}
+
+	if math.Abs(l-50) > 1e-9 {
+		t.Errorf("TestGetAnnotationLineLength: expected 50, got %f\n", l)
+	}
+
+	// 1 pt = 0.5 mm
+	d.Insert("Measure", measureDictForTest(t, 0.5, "mm"))
+
+	if l, err = GetAnnotationLineLength(xRefTable, indRef.ObjectNumber.Value()); err != nil {
+		t.Fatalf("TestGetAnnotationLineLength: %v\n", err)
+	}
+
+	if math.Abs(l-25) > 1e-9 {
+		t.Errorf("TestGetAnnotationLineLength: expected 25, got %f\n", l)
+	}
+
+	// Indirect number format arrays.
+	x, err := xRefTable.IndRefForNewObject(PDFArray{numberFormatDictForTest(t, "mm", 0.5)})
+	if err != nil {
+		t.Fatalf("TestGetAnnotationLineLength: %v\n", err)
+	}
+
+	d.Update("Measure", PDFDict{Dict: map[string]PDFObject{"Type": PDFName("Measure"), "Subtype": PDFName("RL"), "X": *x}})
+
+	if l, err = GetAnnotationLineLength(xRefTable, indRef.ObjectNumber.Value()); err != nil {
+		t.Fatalf("TestGetAnnotationLineLength: %v\n", err)
+	}
+
+	if math.Abs(l-25) > 1e-9 {
+		t.Errorf("TestGetAnnotationLineLength: expected 25, got %f\n", l)
+	}
+
+	indRef = addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+
+	if _, err = GetAnnotationLineLength(xRefTable, indRef.ObjectNumber.Value()); err == nil {
+		t.Errorf("TestGetAnnotationLineLength: Square annotation => not ok!\n")
+	}
+}
+
+func TestGetAnnotationPolygonArea(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	// A right triangle with legs 30 and 40 given clockwise, and a 20 x 10 rectangle.
+	for _, tt := range []struct {
+		vertices PDFArray
+		scale    float64
+		want     float64
+	}{
+		{NewNumberArray(10, 10, 10, 50, 40, 10), 0, 600},
+		{NewNumberArray(0, 0, 20, 0, 20, 10, 0, 10), 0, 200},
+		{NewNumberArray(0, 0, 20, 0, 20, 10, 0, 10), 2, 800},
+	} {
+
+		d := PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":     PDFName("Annot"),
+				"Subtype":  PDFName("Polygon"),
+				"Rect":     NewRectangle(0, 0, 100, 100),
+				"Vertices": tt.vertices,
+			},
+		}
+
+		if tt.scale > 0 {
+			d.Insert("Measure", measureDictForTest(t, tt.scale, "in"))
+		}
+
+		indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+		a, err := GetAnnotationPolygonArea(xRefTable, indRef.ObjectNumber.Value())
+		if err != nil {
+			t.Fatalf("TestGetAnnotationPolygonArea: %v\n", err)
+		}
+
+		if math.Abs(a-tt.want) > 1e-9 {
+			t.Errorf("TestGetAnnotationPolygonArea: expected %f, got %f\n", tt.want, a)
+		}
+	}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Polygon"),
+			"Rect":     NewRectangle(0, 0, 100, 100),
+			"Vertices": NewNumberArray(0, 0, 20, 0, 20),
+		},
+	}
+
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	if _, err := GetAnnotationPolygonArea(xRefTable, indRef.ObjectNumber.Value()); err == nil {
+		t.Errorf("TestGetAnnotationPolygonArea: corrupt Vertices => not ok!\n")
+	}
+}
+
+func TestMeasurement(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	// A drawing at 1 in = 10 ft: 72 pt = 1 in = 10 ft, distances in ft and in.
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Measure"),
+			"Subtype": PDFName("RL"),
+			"R":       PDFStringLiteral("1 in = 10 ft"),
+			"X":       PDFArray{numberFormatDictForTest(t, "ft", 10.0/72), numberFormatDictForTest(t, "in", 12)},
+			"D":       PDFArray{numberFormatDictForTest(t, "ft", 1), numberFormatDictForTest(t, "in", 12)},
+			"A":       PDFArray{numberFormatDictForTest(t, "sq ft", 1)},
+		},
+	}
+
+	m, err := Measurement(xRefTable, &d)
+	if err != nil {
+		t.Fatalf("TestMeasurement: %v\n", err)
+	}
+
+	if m.Ratio != "1 in = 10 ft" || len(m.X) != 2 || m.X[1].Unit != "in" || m.X[1].Precision != 100 || m.X[1].Fraction != "D" {
+		t.Errorf("TestMeasurement: unexpected measure: %+v\n", m)
+	}
+
+	// Only X present.
+	if m.YScale != m.XScale || len(m.Y) != 2 {
+		t.Errorf("TestMeasurement: Y should default to X: %+v\n", m)
+	}
+
+	v, unit, err := m.ConvertDistance(144)
+	if err != nil {
+		t.Fatalf("TestMeasurement: %v\n", err)
+	}
+
+	if math.Abs(v-20) > 1e-9 || unit != "ft" {
+		t.Errorf("TestMeasurement: expected 20 ft, got %f %s\n", v, unit)
+	}
+
+	// Without D the units of X apply.
+	d.Delete("D")
+	d.Update("Y", PDFArray{numberFormatDictForTest(t, "m", 0.5)})
+
+	if m, err = Measurement(xRefTable, &d); err != nil {
+		t.Fatalf("TestMeasurement: %v\n", err)
+	}
+
+	if m.YScale != 0.5 {
+		t.Errorf("TestMeasurement: expected YScale 0.5, got %f\n", m.YScale)
+	}
+
+	if v, unit, _ = m.ConvertDistance(72); math.Abs(v-10) > 1e-9 || unit != "ft" {
+		t.Errorf("TestMeasurement: expected 10 ft, got %f %s\n", v, unit)
+	}
+
+	d.Delete("X")
+	if _, err = Measurement(xRefTable, &d); err == nil {
+		t.Errorf("TestMeasurement: missing X => not ok!\n")
+	}
+
+	d.Update("X", PDFArray{PDFDict{Dict: map[string]PDFObject{"U": PDFStringLiteral("ft")}}})
+	if _, err = Measurement(xRefTable, &d); err == nil {
+		t.Errorf("TestMeasurement: missing C => not ok!\n")
+	}
+}
+
+func TestQuadPoints(t *testing.T) {
+
+	// Two lines of highlighted text, the second one listing its lower edge first.
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Highlight"),
+			"Rect":    NewRectangle(10, 70, 210, 120),
+			"QuadPoints": NewNumberArray(
+				10, 120, 210, 120, 10, 100, 210, 100,
+				10, 70, 110, 70, 10, 90, 110, 90),
+		},
+	}
+
+	rr, err := QuadPoints(&d)
+	if err != nil {
+		t.Fatalf("TestQuadPoints: %v\n", err)
+	}
+
+	want := []types.Rectangle{types.NewRectangle(10, 100, 210, 120), types.NewRectangle(10, 70, 110, 90)}
+	if !reflect.DeepEqual(rr, want) {
+		t.Fatalf("TestQuadPoints: want %v, got %v\n", want, rr)
+	}
+
+	qq, err := Quads(&d)
+	if err != nil {
+		t.Fatalf("TestQuadPoints: %v\n", err)
+	}
+
+	if qq[0].Swapped() || qq[0].Normalized() != qq[0].Points {
+		t.Errorf("TestQuadPoints: unexpected normalization of %v\n", qq[0].Points)
+	}
+
+	if n := qq[1].Normalized(); !qq[1].Swapped() || n != [8]float64{10, 90, 110, 90, 10, 70, 110, 70} {
+		t.Errorf("TestQuadPoints: unexpected normalization of %v: %v\n", qq[1].Points, n)
+	}
+
+	d.Update("QuadPoints", NewNumberArray(10, 120, 210, 120))
+	if _, err = QuadPoints(&d); err == nil {
+		t.Errorf("TestQuadPoints: expected error for incomplete quadrilateral\n")
+	}
+}
+
+func TestComputeAnnotationQuadFromRect(t *testing.T) {
+
+	want := [8]float64{10, 120, 210, 120, 10, 100, 210, 100}
+
+	for _, rect := range [][4]float64{{10, 100, 210, 120}, {210, 120, 10, 100}} {
+		if qp := ComputeAnnotationQuadFromRect(rect); qp != want {
+			t.Errorf("TestComputeAnnotationQuadFromRect(%v): want %v, got %v\n", rect, want, qp)
+		}
+	}
+
+	qp := ComputeAnnotationQuadFromRect([4]float64{10, 100, 210, 120})
+
+	d := PDFDict{Dict: map[string]PDFObject{"QuadPoints": NewNumberArray(qp[:]...)}}
+
+	qq, err := Quads(&d)
+	if err != nil {
+		t.Fatalf("TestComputeAnnotationQuadFromRect: %v\n", err)
+	}
+
+	if qq[0].Swapped() || qq[0].Rect != types.NewRectangle(10, 100, 210, 120) {
+		t.Errorf("TestComputeAnnotationQuadFromRect: unexpected quadrilateral %v\n", qq[0])
+	}
+}
+
+func TestAnnotationMemoryFootprint(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	square := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+
+	ink := addAnnotForTest(t, xRefTable, 1, inkAnnotForTest(NewRectangle(0, 0, 100, 100), NewNumberArray(10, 10, 20, 20, 30, 10, 40, 20)))
+
+	// A note along with its popup.
+	note := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Text"),
+			"Rect":     NewRectangle(100, 100, 120, 120),
+			"Contents": PDFStringLiteral("note"),
+		},
+	})
+
+	popup := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(120, 100, 220, 160),
+			"Parent":  note,
+		},
+	}
+
+	popupIndRef := addAnnotForTest(t, xRefTable, 1, popup)
+
+	noteDict, err := xRefTable.DereferenceDict(note)
+	if err != nil {
+		t.Fatalf("TestAnnotationMemoryFootprint: %v\n", err)
+	}
+	noteDict.Insert("Popup", popupIndRef)
+
+	fileName := filepath.Join(outDir, "footprint.txt")
+	if err := ioutil.WriteFile(fileName, bytes.Repeat([]byte("pdfcpu footprint test\n"), 500), os.ModePerm); err != nil {
+		t.Fatalf("TestAnnotationMemoryFootprint: %v\n", err)
+	}
+
+	if err := AddFileAttachmentAnnotation(xRefTable, 1, [2]float64{200, 200}, fileName, "Paperclip"); err != nil {
+		t.Fatalf("TestAnnotationMemoryFootprint: %v\n", err)
+	}
+
+	m, err := AnnotationMemoryFootprint(xRefTable)
+	if err != nil {
+		t.Fatalf("TestAnnotationMemoryFootprint: %v\n", err)
+	}
+
+	if len(m) != 5 {
+		t.Fatalf("TestAnnotationMemoryFootprint: want 5 annotations, got %v\n", m)
+	}
+
+	largest := 0
+	for objNr, n := range m {
+		if n > m[largest] {
+			largest = objNr
+		}
+	}
+
+	for _, indRef := range []PDFIndirectRef{square, ink, note, popupIndRef} {
+		if indRef.ObjectNumber.Value() == largest {
+			t.Fatalf("TestAnnotationMemoryFootprint: unexpected largest annotation obj#%d: %v\n", largest, m)
+		}
+	}
+
+	if m[largest] < 500*22 {
+		t.Errorf("TestAnnotationMemoryFootprint: embedded file not taken into account: %d\n", m[largest])
+	}
+
+	if n, p := m[note.ObjectNumber.Value()], m[popupIndRef.ObjectNumber.Value()]; n <= p {
+		t.Errorf("TestAnnotationMemoryFootprint: popup not taken into account: note=%d popup=%d\n", n, p)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"math"
+	"strings"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Comparing text markup annotations against the page text they cover, see 12.5.6.10
+
+// textMarkupSubtypes are the subtypes of text markup annotations.
+var textMarkupSubtypes = []string{"Highlight", "Underline", "Squiggly", "StrikeOut"}
+
+// OverlayFinding is the page text covered by a text markup annotation.
+type OverlayFinding struct {
+	ObjNr   int    // The object number of the annotation, 0 for a direct annotation dict.
+	Subtype string // Highlight, Underline, Squiggly or StrikeOut.
+	Text    string // The covered text, "" if the annotation covers no text.
+}
+
+// coveredText collects the text of the glyphs whose center lies within any of areas.
+type coveredText struct {
+	areas []types.Rectangle
+	b     bytes.Buffer
+	last  *types.Rectangle // The bounds of the last covered glyph.
+}
+
+func (ct *coveredText) covers(r types.Rectangle) bool {
+
+	x, y := (r.LL.X+r.UR.X)/2, (r.LL.Y+r.UR.Y)/2
+
+	for _, a := range ct.areas {
+		if x >= a.LL.X && x <= a.UR.X && y >= a.LL.Y && y <= a.UR.Y {
+			return true
+		}
+	}
+
+	return false
+}
+
+// add appends the character c of a glyph with bounds r separated by a blank from a preceding glyph
+// on another line or further apart than a quarter of the glyph height.
+func (ct *coveredText) add(c rune, r types.Rectangle) {
+
+	if !ct.covers(r) {
+		return
+	}
+
+	if l := ct.last; l != nil {
+		h := r.Height()
+		if math.Abs(r.LL.Y-l.LL.Y) > h/2 || r.LL.X-l.UR.X > h/4 {
+			ct.b.WriteByte(' ')
+		}
+	}
+
+	ct.b.WriteRune(c)
+	ct.last = &r
+}
+
+func (ct *coveredText) String() string {
+	return strings.Join(strings.Fields(ct.b.String()), " ")
+}
+
+// glyphRune returns the character of the glyph code g.
+// Codes of simple fonts are taken as PDFDocEncoding, composite fonts result in the replacement character.
+func glyphRune(g []byte) rune {
+
+	if len(g) != 1 {
+		return '\uFFFD'
+	}
+
+	return pdfDocEncodingRune(g[0])
+}
+
+// AnnotationOverlayReport returns the page text covered by each text markup annotation of page pageNr
+// in order of the page's Annots. A glyph is covered by an annotation if its center lies within the quadrilaterals
+// of its QuadPoints or, if QuadPoints is missing, its Rect. Glyphs are located using the font resources of the page
+// just like ApplyRedactions does. Text within form XObjects is not taken into account.
+func AnnotationOverlayReport(xRefTable *XRefTable, pageNr int) ([]OverlayFinding, error) {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ff []OverlayFinding
+		cc []*coveredText
+	)
+
+	err = visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		st := annotDict.Subtype()
+		if st == nil || !memberOf(*st, textMarkupSubtypes) {
+			return nil
+		}
+
+		rr, err := annotationAreas(xRefTable, annotDict)
+		if err != nil {
+			return errors.Wrapf(err, "AnnotationOverlayReport: page %d", pageNr)
+		}
+
+		f := OverlayFinding{Subtype: *st}
+		if indRef != nil {
+			f.ObjNr = indRef.ObjectNumber.Value()
+		}
+
+		ff = append(ff, f)
+		cc = append(cc, &coveredText{areas: rr})
+
+		return nil
+	})
+	if err != nil || len(ff) == 0 {
+		return nil, err
+	}
+
+	obj, err := inheritableAttr(xRefTable, *pageDict, "Resources")
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := xRefTable.DereferenceDict(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := pageContent(xRefTable, pageDict)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := contentOperators(b)
+	if err != nil {
+		return nil, err
+	}
+
+	tl, err := newTextLocator(xRefTable, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	prevEnd := 0
+
+	for _, t := range tokens {
+
+		from := prevEnd
+		prevEnd = t.pos + len(t.op)
+
+		tl.update(t)
+
+		if !memberOf(t.op, []string{"Tj", "TJ", "'", "\""}) {
+			continue
+		}
+
+		elems, err := textOperands(t.op, b[from:t.pos])
+		if err != nil {
+			return nil, err
+		}
+
+		err = showText(elems, &tl.gs, &tl.tm, func(g []byte, tx float64, r types.Rectangle) {
+			for _, c := range cc {
+				c.add(glyphRune(g), r)
+			}
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range cc {
+		ff[i].Text = c.String()
+	}
+
+	return ff, nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"testing"
+)
+
+func TestAnnotationOverlayReport(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	content := "BT /F1 12 Tf 20 500 Td (Hello brave new) Tj 0 -20 Td [(wor) -20 (ld) ( again)] TJ ET\n"
+
+	indRef, err := newContentStream(xRefTable, []byte(content))
+	if err != nil {
+		t.Fatalf("TestAnnotationOverlayReport: %v\n", err)
+	}
+	pageDict.Update("Contents", *indRef)
+
+	markup := func(subtype string, qp PDFArray) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":       PDFName("Annot"),
+				"Subtype":    PDFName(subtype),
+				"Rect":       NewRectangle(0, 0, 400, 600),
+				"QuadPoints": qp,
+			},
+		}
+	}
+
+	// Glyphs span from 3 below to 12 above the baseline.
+	x0 := 20 + textWidth([]byte("Hello "), "Helvetica", 12)
+	x1 := x0 + textWidth([]byte("brave"), "Helvetica", 12)
+
+	h := addAnnotForTest(t, xRefTable, 1, markup("Highlight", NewNumberArray(x0, 512, x1, 512, x0, 497, x1, 497)))
+
+	addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+
+	// "new" at the end of the first line and "world" of the second line.
+	x2 := x1 + textWidth([]byte(" "), "Helvetica", 12)
+	qp := NewNumberArray(x2, 512, 110, 512, x2, 497, 110, 497)
+	qp = append(qp, NewNumberArray(20, 492, 50, 492, 20, 477, 50, 477)...)
+	addAnnotForTest(t, xRefTable, 1, markup("Underline", qp))
+
+	addAnnotForTest(t, xRefTable, 1, markup("StrikeOut", NewNumberArray(200, 312, 250, 312, 200, 297, 250, 297)))
+
+	ff, err := AnnotationOverlayReport(xRefTable, 1)
+	if err != nil {
+		t.Fatalf("TestAnnotationOverlayReport: %v\n", err)
+	}
+
+	if len(ff) != 3 {
+		t.Fatalf("TestAnnotationOverlayReport: want 3 findings, got %v\n", ff)
+	}
+
+	for i, want := range []OverlayFinding{
+		{h.ObjectNumber.Value(), "Highlight", "brave"},
+		{0, "Underline", "new world"},
+		{0, "StrikeOut", ""},
+	} {
+		if ff[i].Subtype != want.Subtype || ff[i].Text != want.Text || want.ObjNr > 0 && ff[i].ObjNr != want.ObjNr {
+			t.Errorf("TestAnnotationOverlayReport: want %v, got %v\n", want, ff[i])
+		}
+	}
+
+	if _, err = AnnotationOverlayReport(xRefTable, 2); err == nil {
+		t.Errorf("TestAnnotationOverlayReport: invalid page => not ok!\n")
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// AnnotationStore provides annotation access to an XRefTable safe for concurrent use.
+// All access to the underlying XRefTable has to go through the store.
+type AnnotationStore struct {
+	mu        sync.RWMutex
+	xRefTable *XRefTable
+}
+
+// NewAnnotationStore returns an AnnotationStore for xRefTable.
+func NewAnnotationStore(xRefTable *XRefTable) *AnnotationStore {
+	return &AnnotationStore{xRefTable: xRefTable}
+}
+
+// copyDict returns a shallow copy of d.
+func copyDict(d PDFDict) PDFDict {
+
+	c := NewPDFDict()
+
+	for k, v := range d.Dict {
+		c.Dict[k] = v
+	}
+
+	return c
+}
+
+// Add validates d and adds it as a new annotation to page pageNr.
+// Returns the object number of the new annotation.
+func (s *AnnotationStore) Add(pageNr int, d PDFDict) (int, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d = copyDict(d)
+
+	_, err := validateAnnotationDict(s.xRefTable, &d)
+	if err != nil {
+		return 0, err
+	}
+
+	indRef, err := addAnnotation(s.xRefTable, pageNr, d)
+	if err != nil {
+		return 0, err
+	}
+
+	return indRef.ObjectNumber.Value(), nil
+}
+
+// Remove removes annotation obj#objNr from its page along with its popup, see RemoveAnnotations.
+func (s *AnnotationStore) Remove(objNr int) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := annotDict(s.xRefTable, objNr); err != nil {
+		return err
+	}
+
+	removed, err := removeAnnotationsByObjNr(s.xRefTable, IntSet{objNr: true})
+	if err != nil {
+		return err
+	}
+
+	if removed == 0 {
+		return errors.Errorf("Remove: obj#%d not referenced by any page", objNr)
+	}
+
+	return nil
+}
+
+// Set sets entry key of annotation obj#objNr to value.
+// A nil value removes the entry. The change is rolled back if the annotation does not validate.
+func (s *AnnotationStore) Set(objNr int, key string, value PDFObject) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := annotDict(s.xRefTable, objNr)
+	if err != nil {
+		return err
+	}
+
+	old, found := d.Find(key)
+
+	if value == nil {
+		d.Delete(key)
+	} else {
+		d.Update(key, value)
+	}
+
+	if _, err = validateAnnotationDict(s.xRefTable, d); err != nil {
+		if found {
+			d.Update(key, old)
+		} else {
+			d.Delete(key)
+		}
+		return err
+	}
+
+	s.xRefTable.recordAnnotationChange(AnnotationEdited, objNr, key, old, value)
+
+	return nil
+}
+
+// Move moves annotation obj#objNr along with its popup to page pageNr.
+// A trailing TrapNet annotation of the target page remains the last entry.
+func (s *AnnotationStore) Move(objNr, pageNr int) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return moveAnnotation(s.xRefTable, objNr, pageNr)
+}
+
+// Get returns a copy of annotation dict obj#objNr.
+func (s *AnnotationStore) Get(objNr int) (PDFDict, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, err := annotDict(s.xRefTable, objNr)
+	if err != nil {
+		return PDFDict{}, err
+	}
+
+	return copyDict(*d), nil
+}
+
+// List returns the object numbers of the annotations of page pageNr.
+// Annotations embedded directly into the Annots array are not included.
+func (s *AnnotationStore) List(pageNr int) ([]int, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(s.xRefTable, pageNr)
+	if err != nil {
+		return nil, err
+	}
+
+	objNrs := []int{}
+
+	err = visitPageAnnots(s.xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		if indRef != nil {
+			objNrs = append(objNrs, indRef.ObjectNumber.Value())
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return objNrs, nil
+}
+
+// Count returns the number of annotations of the document.
+func (s *AnnotationStore) Count() (int, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := 0
+
+	err := visitAnnotations(s.xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		i++
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return i, nil
+}
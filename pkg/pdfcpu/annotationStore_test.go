@@ -0,0 +1,246 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestAnnotationStoreConcurrency(t *testing.T) {
+
+	const pageCount, workers, n = 2, 8, 20
+
+	s := NewAnnotationStore(createAnnotTestXRef(t, pageCount))
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, workers*n*4)
+
+	for w := 0; w < workers; w++ {
+
+		wg.Add(1)
+
+		go func(w int) {
+
+			defer wg.Done()
+
+			pageNr := w%pageCount + 1
+
+			for i := 0; i < n; i++ {
+
+				objNr, err := s.Add(pageNr, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if _, err = s.Get(objNr); err != nil {
+					errs <- err
+				}
+
+				if _, err = s.List(pageNr); err != nil {
+					errs <- err
+				}
+
+				// Keep every other annotation.
+				if i%2 == 0 {
+					if err = s.Remove(objNr); err != nil {
+						errs <- err
+					}
+				}
+			}
+
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("TestAnnotationStoreConcurrency: %v\n", err)
+	}
+
+	c, err := s.Count()
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreConcurrency: %v\n", err)
+	}
+
+	if c != workers*n/2 {
+		t.Errorf("TestAnnotationStoreConcurrency: expected %d annotations, got %d\n", workers*n/2, c)
+	}
+}
+
+func TestAnnotationStoreSetAndMove(t *testing.T) {
+
+	s := NewAnnotationStore(createAnnotTestXRef(t, 2))
+
+	objNr, err := s.Add(1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+	}
+
+	if err = s.Set(objNr, "Contents", PDFStringLiteral("Updated")); err != nil {
+		t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+	}
+
+	// Invalid changes are rolled back.
+	if err = s.Set(objNr, "Rect", PDFName("Rect")); err == nil {
+		t.Errorf("TestAnnotationStoreSetAndMove: invalid Rect => not ok!\n")
+	}
+
+	d, err := s.Get(objNr)
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+	}
+
+	if c := d.StringEntry("Contents"); c == nil || *c != "Updated" {
+		t.Errorf("TestAnnotationStoreSetAndMove: Contents not set: %v\n", c)
+	}
+
+	if d.PDFArrayEntry("Rect") == nil {
+		t.Errorf("TestAnnotationStoreSetAndMove: Rect not restored\n")
+	}
+
+	popupObjNr, err := s.Add(1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(60, 10, 160, 60),
+			"Parent":  *NewPDFIndirectRef(objNr, 0),
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+	}
+
+	if err = s.Set(objNr, "Popup", *NewPDFIndirectRef(popupObjNr, 0)); err != nil {
+		t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+	}
+
+	trapNetObjNr, err := s.Add(2, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("TrapNet"),
+			"Rect":    NewRectangle(0, 0, 10, 10),
+			"F":       PDFInteger(annotFlagPrint),
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+	}
+
+	if err = s.Move(objNr, 2); err != nil {
+		t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+	}
+
+	for pageNr, want := range [][]int{{}, {objNr, popupObjNr, trapNetObjNr}} {
+		objNrs, err := s.List(pageNr + 1)
+		if err != nil {
+			t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+		}
+		if fmt.Sprint(objNrs) != fmt.Sprint(want) {
+			t.Errorf("TestAnnotationStoreSetAndMove: page %d: expected %v, got %v\n", pageNr+1, want, objNrs)
+		}
+	}
+
+	_, pageIndRef := pageForTest(t, s.xRefTable, 2)
+
+	for _, objNr := range []int{objNr, popupObjNr} {
+		d, err := s.Get(objNr)
+		if err != nil {
+			t.Fatalf("TestAnnotationStoreSetAndMove: %v\n", err)
+		}
+		if p := d.IndirectRefEntry("P"); p == nil || *p != pageIndRef {
+			t.Errorf("TestAnnotationStoreSetAndMove: obj#%d: P not updated\n", objNr)
+		}
+	}
+}
+
+func TestAnnotationStoreRemove(t *testing.T) {
+
+	s := NewAnnotationStore(createAnnotTestXRef(t, 1))
+
+	ap := formForTest(t, s.xRefTable, "0 0 40 40 re S", NewRectangle(0, 0, 40, 40), nil)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": ap}})
+
+	objNr, err := s.Add(1, d)
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreRemove: %v\n", err)
+	}
+
+	popupObjNr, err := s.Add(1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(60, 10, 160, 60),
+			"Parent":  *NewPDFIndirectRef(objNr, 0),
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreRemove: %v\n", err)
+	}
+
+	if err = s.Set(objNr, "Popup", *NewPDFIndirectRef(popupObjNr, 0)); err != nil {
+		t.Fatalf("TestAnnotationStoreRemove: %v\n", err)
+	}
+
+	replyObjNr, err := s.Add(1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Text"),
+			"Rect":    NewRectangle(10, 60, 30, 80),
+			"IRT":     *NewPDFIndirectRef(objNr, 0),
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreRemove: %v\n", err)
+	}
+
+	if err = s.Remove(objNr); err != nil {
+		t.Fatalf("TestAnnotationStoreRemove: %v\n", err)
+	}
+
+	objNrs, err := s.List(1)
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreRemove: %v\n", err)
+	}
+	if fmt.Sprint(objNrs) != fmt.Sprint([]int{replyObjNr}) {
+		t.Errorf("TestAnnotationStoreRemove: expected %v, got %v\n", []int{replyObjNr}, objNrs)
+	}
+
+	for _, objNr := range []int{objNr, popupObjNr, ap.ObjectNumber.Value()} {
+		if entry, found := s.xRefTable.Find(objNr); found && !entry.Free {
+			t.Errorf("TestAnnotationStoreRemove: obj#%d not freed\n", objNr)
+		}
+	}
+
+	reply, err := s.Get(replyObjNr)
+	if err != nil {
+		t.Fatalf("TestAnnotationStoreRemove: %v\n", err)
+	}
+	if reply.Dict["IRT"] != nil {
+		t.Errorf("TestAnnotationStoreRemove: dangling IRT\n")
+	}
+
+	if err = s.Remove(objNr); err == nil {
+		t.Errorf("TestAnnotationStoreRemove: removed annotation => not ok!\n")
+	}
+}
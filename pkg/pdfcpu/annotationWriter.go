@@ -0,0 +1,282 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// AnnotationWriter batches annotation additions and commits them as an incremental update
+// appending the new and modified objects along with a new xref section to the original file.
+type AnnotationWriter struct {
+	ctx      *PDFContext
+	offset   int64  // Size of the file the next update gets appended to.
+	prev     int64  // Offset of the most recent xref section.
+	size     int    // Object count at the time of the most recent update.
+	modified IntSet // Modified objects below size.
+}
+
+// NewAnnotationWriter returns an AnnotationWriter for a context obtained by ReadPDFFile.
+// Encrypted files and files using xref streams are not supported.
+func NewAnnotationWriter(ctx *PDFContext) (*AnnotationWriter, error) {
+
+	if ctx.Read == nil {
+		return nil, errors.New("NewAnnotationWriter: missing read context")
+	}
+
+	if ctx.Encrypt != nil {
+		return nil, errors.New("NewAnnotationWriter: encrypted files not supported")
+	}
+
+	if ctx.Read.UsingXRefStreams {
+		return nil, errors.New("NewAnnotationWriter: xref streams not supported")
+	}
+
+	return &AnnotationWriter{
+		ctx:      ctx,
+		offset:   ctx.Read.FileSize,
+		prev:     ctx.Read.OffsetLastXRefSection,
+		size:     *ctx.Size,
+		modified: IntSet{},
+	}, nil
+}
+
+// annotationDict returns the annotation dict for a, completed by the non zero fields of a.
+func annotationDict(a Annotation) PDFDict {
+
+	d := NewPDFDict()
+	if a.Dict != nil {
+		d = *a.Dict
+	}
+
+	d.InsertName("Type", "Annot")
+
+	if a.Subtype != AnnotUnknown {
+		d.InsertName("Subtype", a.Subtype.String())
+	}
+
+	if a.Rect != nil {
+		d.Insert("Rect", NewRectangle(a.Rect.LL.X, a.Rect.LL.Y, a.Rect.UR.X, a.Rect.UR.Y))
+	}
+
+	if a.Contents != "" {
+		d.InsertString("Contents", a.Contents)
+	}
+
+	if a.NM != "" {
+		d.InsertString("NM", a.NM)
+	}
+
+	return d
+}
+
+// Add appends annotation a to the Annots array of page a.PageNr.
+// The annotation dict is taken from a.Dict completed by a's Subtype, Rect, Contents and NM.
+func (aw *AnnotationWriter) Add(a Annotation) error {
+
+	d := annotationDict(a)
+
+	if d.Subtype() == nil {
+		return errors.New("AnnotationWriter.Add: missing Subtype")
+	}
+
+	if _, found := d.Find("Rect"); !found {
+		return errors.New("AnnotationWriter.Add: missing Rect")
+	}
+
+	xRefTable := aw.ctx.XRefTable
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, a.PageNr)
+	if err != nil {
+		return err
+	}
+
+	obj, _ := pageDict.Find("Annots")
+
+	if _, err = addAnnotation(xRefTable, a.PageNr, d); err != nil {
+		return err
+	}
+
+	aw.modify(pageIndRef.ObjectNumber.Value())
+
+	if indRef, ok := obj.(PDFIndirectRef); ok {
+		aw.modify(indRef.ObjectNumber.Value())
+	}
+
+	return nil
+}
+
+func (aw *AnnotationWriter) modify(objNr int) {
+	if objNr < aw.size {
+		aw.modified[objNr] = true
+	}
+}
+
+// objNrs returns the sorted numbers of all objects making up the pending update.
+func (aw *AnnotationWriter) objNrs() []int {
+
+	var objNrs []int
+
+	for objNr := range aw.modified {
+		objNrs = append(objNrs, objNr)
+	}
+
+	for objNr := aw.size; objNr < *aw.ctx.Size; objNr++ {
+		objNrs = append(objNrs, objNr)
+	}
+
+	sort.Ints(objNrs)
+
+	return objNrs
+}
+
+func writeIncrementalObject(b *bytes.Buffer, objNr int, entry *XRefTableEntry) error {
+
+	fmt.Fprintf(b, "%d %d obj\n", objNr, *entry.Generation)
+
+	switch o := entry.Object.(type) {
+
+	case PDFStreamDict:
+		if o.Raw == nil {
+			if err := encodeStream(&o); err != nil {
+				return err
+			}
+		}
+		if _, ok := o.Find("Length"); !ok {
+			o.Insert("Length", PDFInteger(len(o.Raw)))
+		}
+		b.WriteString(o.PDFString())
+		b.WriteString("\nstream\n")
+		b.Write(o.Raw)
+		b.WriteString("\nendstream")
+
+	case nil:
+		b.WriteString("null")
+
+	default:
+		b.WriteString(o.PDFString())
+	}
+
+	b.WriteString("\nendobj\n")
+
+	return nil
+}
+
+// writeXRefSection writes the xref subsections for objNrs based on offsets.
+func (aw *AnnotationWriter) writeXRefSection(b *bytes.Buffer, objNrs []int, offsets map[int]int64) {
+
+	b.WriteString("xref\n")
+
+	for i := 0; i < len(objNrs); {
+
+		j := i + 1
+		for j < len(objNrs) && objNrs[j] == objNrs[j-1]+1 {
+			j++
+		}
+
+		fmt.Fprintf(b, "%d %d\n", objNrs[i], j-i)
+
+		for _, objNr := range objNrs[i:j] {
+			entry, _ := aw.ctx.FindTableEntryLight(objNr)
+			fmt.Fprintf(b, "%010d %05d n \n", offsets[objNr], *entry.Generation)
+		}
+
+		i = j
+	}
+
+	xRefTable := aw.ctx.XRefTable
+
+	d := NewPDFDict()
+	d.Insert("Size", PDFInteger(*xRefTable.Size))
+	d.Insert("Prev", PDFInteger(aw.prev))
+	d.Insert("Root", *xRefTable.Root)
+
+	if xRefTable.Info != nil {
+		d.Insert("Info", *xRefTable.Info)
+	}
+
+	if xRefTable.ID != nil {
+		d.Insert("ID", *xRefTable.ID)
+	}
+
+	fmt.Fprintf(b, "trailer\n%s\n", d.PDFString())
+}
+
+// Commit writes all annotations added since the most recent commit as an incremental update to w.
+// The output is meant to be appended to the file the context has been read from
+// or to the result of the most recent commit.
+func (aw *AnnotationWriter) Commit(w io.Writer) error {
+
+	objNrs := aw.objNrs()
+	if len(objNrs) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+
+	// Make sure the update starts on a new line.
+	b.WriteString("\n")
+
+	offsets := map[int]int64{}
+
+	for _, objNr := range objNrs {
+
+		entry, found := aw.ctx.FindTableEntryLight(objNr)
+		if !found {
+			return errors.Errorf("AnnotationWriter.Commit: missing obj#%d", objNr)
+		}
+
+		if entry.Free {
+			continue
+		}
+
+		offsets[objNr] = aw.offset + int64(b.Len())
+
+		if err := writeIncrementalObject(&b, objNr, entry); err != nil {
+			return err
+		}
+	}
+
+	var written []int
+	for _, objNr := range objNrs {
+		if _, ok := offsets[objNr]; ok {
+			written = append(written, objNr)
+		}
+	}
+
+	xRefOffset := aw.offset + int64(b.Len())
+
+	aw.writeXRefSection(&b, written, offsets)
+
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xRefOffset)
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+
+	aw.offset += int64(b.Len())
+	aw.prev = xRefOffset
+	aw.size = *aw.ctx.Size
+	aw.modified = IntSet{}
+
+	return nil
+}
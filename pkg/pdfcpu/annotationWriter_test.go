@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+)
+
+func TestAnnotationWriter(t *testing.T) {
+
+	config := NewDefaultConfiguration()
+	config.WriteObjectStream = false
+	config.WriteXRefStream = false
+
+	ctx := &PDFContext{
+		Configuration: config,
+		XRefTable:     createAnnotTestXRef(t, 2),
+		Write:         NewWriteContext(config.Eol),
+	}
+	ctx.Write.DirName = outDir + "/"
+	ctx.Write.FileName = "annotationWriter.pdf"
+
+	if err := WritePDFFile(ctx); err != nil {
+		t.Fatalf("TestAnnotationWriter: %v\n", err)
+	}
+
+	fileName := filepath.Join(outDir, "annotationWriter.pdf")
+
+	ctx, err := ReadPDFFile(fileName, NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("TestAnnotationWriter: %v\n", err)
+	}
+
+	aw, err := NewAnnotationWriter(ctx)
+	if err != nil {
+		t.Fatalf("TestAnnotationWriter: %v\n", err)
+	}
+
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("TestAnnotationWriter: %v\n", err)
+	}
+	defer f.Close()
+
+	// Append 100 annotations in batches of 25 alternating pages.
+	for i := 0; i < 100; i++ {
+
+		r := types.NewRectangle(float64(i), float64(i), float64(i+20), float64(i+20))
+
+		a := Annotation{
+			Subtype:  AnnotText,
+			Rect:     &r,
+			Contents: fmt.Sprintf("note %d", i),
+			NM:       fmt.Sprintf("n%d", i),
+			PageNr:   1 + i/25%2,
+		}
+
+		if err = aw.Add(a); err != nil {
+			t.Fatalf("TestAnnotationWriter: %v\n", err)
+		}
+
+		if (i+1)%25 == 0 {
+			if err = aw.Commit(f); err != nil {
+				t.Fatalf("TestAnnotationWriter: %v\n", err)
+			}
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatalf("TestAnnotationWriter: %v\n", err)
+	}
+
+	ctx, err = ReadPDFFile(fileName, NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("TestAnnotationWriter: %v\n", err)
+	}
+
+	for pageNr := 1; pageNr <= 2; pageNr++ {
+
+		aa, err := ctx.PageAnnotations(pageNr)
+		if err != nil {
+			t.Fatalf("TestAnnotationWriter: %v\n", err)
+		}
+
+		if len(aa) != 50 {
+			t.Fatalf("TestAnnotationWriter: page %d: want 50 annotations, got %d\n", pageNr, len(aa))
+		}
+
+		for _, a := range aa {
+			if a.Subtype != AnnotText || a.Rect == nil || a.Contents == "" {
+				t.Fatalf("TestAnnotationWriter: page %d: unexpected annotation %s\n", pageNr, a)
+			}
+		}
+	}
+
+	if aa, _ := ctx.PageAnnotations(2); aa[0].NM != "n25" || aa[49].NM != "n99" {
+		t.Fatalf("TestAnnotationWriter: unexpected annotation order: %s .. %s\n", aa[0], aa[49])
+	}
+}
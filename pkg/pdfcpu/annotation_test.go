@@ -0,0 +1,1251 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hhrutter/pdfcpu/pkg/filter"
+	"github.com/hhrutter/pdfcpu/pkg/types"
+)
+
+// createAnnotTestXRef creates an xRefTable with pageCount empty pages.
+func createAnnotTestXRef(t *testing.T, pageCount int) *XRefTable {
+
+	xRefTable, err := createXRefTableWithRootDict()
+	if err != nil {
+		t.Fatalf("createAnnotTestXRef: %v\n", err)
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("createAnnotTestXRef: %v\n", err)
+	}
+
+	mediaBox := NewRectangle(0, 0, 400, 600)
+
+	pagesDict := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Pages"),
+			"Count":    PDFInteger(pageCount),
+			"MediaBox": mediaBox,
+		},
+	}
+
+	parentPageIndRef, err := xRefTable.IndRefForNewObject(pagesDict)
+	if err != nil {
+		t.Fatalf("createAnnotTestXRef: %v\n", err)
+	}
+
+	kids := PDFArray{}
+
+	for i := 0; i < pageCount; i++ {
+		pageIndRef, err := createPage(xRefTable, parentPageIndRef, &mediaBox)
+		if err != nil {
+			t.Fatalf("createAnnotTestXRef: %v\n", err)
+		}
+		kids = append(kids, *pageIndRef)
+	}
+
+	pagesDict.Insert("Kids", kids)
+
+	rootDict.Insert("Pages", *parentPageIndRef)
+
+	return xRefTable
+}
+
+// pageForTest returns the page dict and its indirect reference for pageNr.
+func pageForTest(t *testing.T, xRefTable *XRefTable, pageNr int) (*PDFDict, PDFIndirectRef) {
+
+	pagesIndRef, err := xRefTable.Pages()
+	if err != nil {
+		t.Fatalf("pageForTest: %v\n", err)
+	}
+
+	pagesDict, err := xRefTable.DereferenceDict(*pagesIndRef)
+	if err != nil {
+		t.Fatalf("pageForTest: %v\n", err)
+	}
+
+	indRef := (*pagesDict.PDFArrayEntry("Kids"))[pageNr-1].(PDFIndirectRef)
+
+	pageDict, err := xRefTable.DereferenceDict(indRef)
+	if err != nil {
+		t.Fatalf("pageForTest: %v\n", err)
+	}
+
+	return pageDict, indRef
+}
+
+// addAnnotForTest adds d as an indirect object to the Annots array of page pageNr.
+func addAnnotForTest(t *testing.T, xRefTable *XRefTable, pageNr int, d PDFDict) PDFIndirectRef {
+
+	pageDict, pageIndRef := pageForTest(t, xRefTable, pageNr)
+
+	if _, found := d.Find("P"); !found {
+		d.Insert("P", pageIndRef)
+	}
+
+	indRef, err := xRefTable.IndRefForNewObject(d)
+	if err != nil {
+		t.Fatalf("addAnnotForTest: %v\n", err)
+	}
+
+	arr := pageDict.PDFArrayEntry("Annots")
+	if arr == nil {
+		pageDict.Insert("Annots", PDFArray{*indRef})
+	} else {
+		pageDict.Update("Annots", append(*arr, *indRef))
+	}
+
+	return *indRef
+}
+
+func squareAnnotForTest(rect PDFArray) PDFDict {
+
+	return PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Square"),
+			"Contents": PDFStringLiteral("Square Annotation"),
+			"Rect":     rect,
+			"C":        NewNumberArray(1, 0, 0),
+		},
+	}
+}
+
+func TestValidateAndFixAnnots(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+
+	// Fixable: wrong Type.
+	d := squareAnnotForTest(NewRectangle(60, 10, 100, 50))
+	d.Update("Type", PDFName("Annotation"))
+	fixedIndRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	// Unfixable: missing Rect.
+	d = squareAnnotForTest(nil)
+	d.Delete("Rect")
+	unfixableIndRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	report, err := ValidateAndFixAnnots(xRefTable)
+	if err != nil {
+		t.Fatalf("TestValidateAndFixAnnots: %v\n", err)
+	}
+
+	if len(report) != 3 {
+		t.Fatalf("TestValidateAndFixAnnots: expected 3 report entries, got %d:\n%s\n", len(report), report)
+	}
+
+	if report.Count(AnnotOK) != 1 || report.Count(AnnotFixed) != 1 || report.Count(AnnotUnfixable) != 1 {
+		t.Fatalf("TestValidateAndFixAnnots: unexpected report:\n%s\n", report)
+	}
+
+	for _, e := range report {
+
+		switch e.ObjNr {
+
+		case fixedIndRef.ObjectNumber.Value():
+			if e.Status != AnnotFixed || e.Entry != "Type" {
+				t.Errorf("TestValidateAndFixAnnots: expected fixed Type, got: %s\n", e)
+			}
+
+		case unfixableIndRef.ObjectNumber.Value():
+			if e.Status != AnnotUnfixable || e.Entry != "Rect" {
+				t.Errorf("TestValidateAndFixAnnots: expected unfixable Rect, got: %s\n", e)
+			}
+
+		}
+	}
+
+	d1, err := xRefTable.DereferenceDict(fixedIndRef)
+	if err != nil {
+		t.Fatalf("TestValidateAndFixAnnots: %v\n", err)
+	}
+
+	if *d1.Type() != "Annot" {
+		t.Errorf("TestValidateAndFixAnnots: Type not repaired: %s\n", *d1.Type())
+	}
+}
+
+func TestAddMeasurementAnnotation(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	err := AddMeasurementAnnotation(xRefTable, 1, [2]float64{100, 100}, [2]float64{200, 100}, 0.5, "mm")
+	if err != nil {
+		t.Fatalf("TestAddMeasurementAnnotation: %v\n", err)
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	arr := pageDict.PDFArrayEntry("Annots")
+	if arr == nil || len(*arr) != 1 {
+		t.Fatalf("TestAddMeasurementAnnotation: expected 1 annotation\n")
+	}
+
+	d, err := xRefTable.DereferenceDict((*arr)[0])
+	if err != nil {
+		t.Fatalf("TestAddMeasurementAnnotation: %v\n", err)
+	}
+
+	if *d.Subtype() != "Line" {
+		t.Errorf("TestAddMeasurementAnnotation: expected Line, got %s\n", *d.Subtype())
+	}
+
+	if b := d.BooleanEntry("Cap"); b == nil || !*b {
+		t.Errorf("TestAddMeasurementAnnotation: missing Cap\n")
+	}
+
+	if s := d.StringEntry("Contents"); s == nil || *s != "50.00 mm" {
+		t.Errorf("TestAddMeasurementAnnotation: unexpected Contents: %v\n", s)
+	}
+
+	measure := d.PDFDictEntry("Measure")
+	if measure == nil {
+		t.Fatalf("TestAddMeasurementAnnotation: missing Measure\n")
+	}
+
+	x := measure.PDFArrayEntry("X")
+	if x == nil || len(*x) != 1 {
+		t.Fatalf("TestAddMeasurementAnnotation: missing X\n")
+	}
+
+	nf := (*x)[0].(PDFDict)
+	if s := nf.StringEntry("U"); s == nil || *s != "mm" {
+		t.Errorf("TestAddMeasurementAnnotation: unexpected unit: %v\n", s)
+	}
+
+	err = AddMeasurementAnnotation(xRefTable, 2, [2]float64{0, 0}, [2]float64{10, 10}, 1, "mm")
+	if err == nil {
+		t.Errorf("TestAddMeasurementAnnotation: expected error for missing page\n")
+	}
+
+	// Units get encoded as text strings.
+	err = AddMeasurementAnnotation(xRefTable, 1, [2]float64{0, 0}, [2]float64{100, 0}, 1, "µm (x)")
+	if err != nil {
+		t.Fatalf("TestAddMeasurementAnnotation: %v\n", err)
+	}
+
+	arr = pageDict.PDFArrayEntry("Annots")
+	if d, err = xRefTable.DereferenceDict((*arr)[1]); err != nil {
+		t.Fatalf("TestAddMeasurementAnnotation: %v\n", err)
+	}
+
+	if s := decodedTextString(xRefTable, d.Dict["Contents"]); s != "100.00 µm (x)" {
+		t.Errorf("TestAddMeasurementAnnotation: unexpected Contents: %s\n", s)
+	}
+
+	nf = (*d.PDFDictEntry("Measure").PDFArrayEntry("X"))[0].(PDFDict)
+	if s := decodedTextString(xRefTable, nf.Dict["U"]); s != "µm (x)" {
+		t.Errorf("TestAddMeasurementAnnotation: unexpected unit: %s\n", s)
+	}
+}
+
+func TestAddTextAnnotation(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	r := types.NewRectangle(100, 500, 120, 520)
+
+	indRef, err := AddTextAnnotation(xRefTable, 1, r, "Grüße", true, "Comment")
+	if err != nil {
+		t.Fatalf("TestAddTextAnnotation: %v\n", err)
+	}
+
+	aa, err := xRefTable.PageAnnotations(1)
+	if err != nil {
+		t.Fatalf("TestAddTextAnnotation: %v\n", err)
+	}
+
+	if len(aa) != 1 || aa[0].ObjNr != indRef.ObjectNumber.Value() {
+		t.Fatalf("TestAddTextAnnotation: unexpected annotations: %v\n", aa)
+	}
+
+	if aa[0].Subtype != AnnotText || aa[0].Contents != "Grüße" || *aa[0].Rect != r {
+		t.Errorf("TestAddTextAnnotation: unexpected annotation: %s\n", aa[0])
+	}
+
+	d, err := xRefTable.DereferenceDict(*indRef)
+	if err != nil {
+		t.Fatalf("TestAddTextAnnotation: %v\n", err)
+	}
+
+	if b := d.BooleanEntry("Open"); b == nil || !*b {
+		t.Errorf("TestAddTextAnnotation: expected Open\n")
+	}
+
+	if n := d.NameEntry("Name"); n == nil || *n != "Comment" {
+		t.Errorf("TestAddTextAnnotation: unexpected Name: %v\n", n)
+	}
+
+	if _, err = AddTextAnnotation(xRefTable, 1, r, "note", false, "Sticker"); err == nil {
+		t.Errorf("TestAddTextAnnotation: expected error for unsupported icon\n")
+	}
+}
+
+func TestAddLinkAnnotation(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	r := types.NewRectangle(100, 500, 300, 520)
+	qp := []float64{100, 520, 300, 520, 100, 500, 300, 500}
+
+	if err := AddLinkAnnotation(xRefTable, 1, r, "https://golang.org/doc/", qp); err != nil {
+		t.Fatalf("TestAddLinkAnnotation: %v\n", err)
+	}
+
+	m, err := ExtractURIs(xRefTable)
+	if err != nil {
+		t.Fatalf("TestAddLinkAnnotation: %v\n", err)
+	}
+
+	if len(m[1]) != 1 || m[1][0] != "https://golang.org/doc/" {
+		t.Fatalf("TestAddLinkAnnotation: unexpected URIs: %v\n", m)
+	}
+
+	aa, err := xRefTable.PageAnnotations(1)
+	if err != nil {
+		t.Fatalf("TestAddLinkAnnotation: %v\n", err)
+	}
+
+	rr, err := QuadPoints(aa[0].Dict)
+	if err != nil || len(rr) != 1 || rr[0] != r {
+		t.Errorf("TestAddLinkAnnotation: unexpected QuadPoints: %v %v\n", rr, err)
+	}
+
+	bs := aa[0].Dict.PDFDictEntry("BS")
+	if bs == nil || bs.IntEntry("W") == nil || *bs.IntEntry("W") != 0 {
+		t.Errorf("TestAddLinkAnnotation: expected invisible border, got %v\n", bs)
+	}
+
+	for _, uri := range []string{"", "http://exa mple.com", "https://example.com/Grüße"} {
+		if err = AddLinkAnnotation(xRefTable, 1, r, uri, nil); err == nil {
+			t.Errorf("TestAddLinkAnnotation: expected error for uri %q\n", uri)
+		}
+	}
+
+	if err = AddLinkAnnotation(xRefTable, 1, r, "https://golang.org", qp[:4]); err == nil {
+		t.Errorf("TestAddLinkAnnotation: expected error for incomplete QuadPoints\n")
+	}
+}
+
+// formForTest creates a form XObject for content using resources.
+func formForTest(t *testing.T, xRefTable *XRefTable, content string, bbox PDFArray, resources *PDFDict) PDFIndirectRef {
+
+	sd := &PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":     PDFName("XObject"),
+				"Subtype":  PDFName("Form"),
+				"FormType": PDFInteger(1),
+				"BBox":     bbox,
+			},
+		},
+		Content: []byte(content),
+	}
+
+	if resources != nil {
+		sd.Insert("Resources", *resources)
+	}
+
+	err := encodeStream(sd)
+	if err != nil {
+		t.Fatalf("formForTest: %v\n", err)
+	}
+
+	indRef, err := xRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		t.Fatalf("formForTest: %v\n", err)
+	}
+
+	return *indRef
+}
+
+// imageStampForTest adds a Stamp annotation to page 1 whose appearance renders imgIndRef.
+func imageStampForTest(t *testing.T, xRefTable *XRefTable, imgIndRef PDFIndirectRef, rect PDFArray) PDFIndirectRef {
+
+	resources := PDFDict{
+		Dict: map[string]PDFObject{
+			"XObject": PDFDict{Dict: map[string]PDFObject{"Im0": imgIndRef}},
+		},
+	}
+
+	apIndRef := formForTest(t, xRefTable, "q 20 0 0 20 0 0 cm /Im0 Do Q", NewRectangle(0, 0, 20, 20), &resources)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Stamp"),
+			"Rect":    rect,
+			"AP":      PDFDict{Dict: map[string]PDFObject{"N": apIndRef}},
+		},
+	}
+
+	return addAnnotForTest(t, xRefTable, 1, d)
+}
+
+func TestExtractAnnotationImages(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	// A 2x2 DeviceGray image.
+	sd, err := createImageObject(xRefTable, []byte{0x00, 0xFF, 0xFF, 0x00}, nil, 2, 2, "DeviceGray")
+	if err != nil {
+		t.Fatalf("TestExtractAnnotationImages: %v\n", err)
+	}
+
+	imgIndRef, err := xRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		t.Fatalf("TestExtractAnnotationImages: %v\n", err)
+	}
+
+	imageStampForTest(t, xRefTable, *imgIndRef, NewRectangle(10, 10, 30, 30))
+
+	// DCT encoded images are written as is.
+	jpg := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+
+	sd = &PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":             PDFName("XObject"),
+				"Subtype":          PDFName("Image"),
+				"Width":            PDFInteger(1),
+				"Height":           PDFInteger(1),
+				"BitsPerComponent": PDFInteger(8),
+				"ColorSpace":       PDFName("DeviceGray"),
+				"Filter":           PDFName(filter.DCT),
+			},
+		},
+		Raw:            jpg,
+		FilterPipeline: []PDFFilter{{Name: filter.DCT}},
+	}
+
+	jpgIndRef, err := xRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		t.Fatalf("TestExtractAnnotationImages: %v\n", err)
+	}
+
+	imageStampForTest(t, xRefTable, *jpgIndRef, NewRectangle(40, 10, 60, 30))
+
+	dir, err := ioutil.TempDir(outDir, "annotImages")
+	if err != nil {
+		t.Fatalf("TestExtractAnnotationImages: %v\n", err)
+	}
+
+	fileNames, err := ExtractAnnotationImages(xRefTable, dir)
+	if err != nil {
+		t.Fatalf("TestExtractAnnotationImages: %v\n", err)
+	}
+
+	want := []string{
+		filepath.Join(dir, fmt.Sprintf("annot_1_%d.png", imgIndRef.ObjectNumber)),
+		filepath.Join(dir, fmt.Sprintf("annot_1_%d.jpg", jpgIndRef.ObjectNumber)),
+	}
+
+	if len(fileNames) != len(want) {
+		t.Fatalf("TestExtractAnnotationImages: expected %v, got %v\n", want, fileNames)
+	}
+
+	for i, fn := range fileNames {
+		if fn != want[i] {
+			t.Errorf("TestExtractAnnotationImages: expected %s, got %s\n", want[i], fn)
+		}
+		if _, err := os.Stat(fn); err != nil {
+			t.Errorf("TestExtractAnnotationImages: %v\n", err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(want[1])
+	if err != nil {
+		t.Fatalf("TestExtractAnnotationImages: %v\n", err)
+	}
+
+	if !bytes.Equal(b, jpg) {
+		t.Errorf("TestExtractAnnotationImages: DCT image not passed through\n")
+	}
+}
+
+func TestConvertMarkupToComment(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := squareAnnotForTest(NewRectangle(100, 100, 200, 150))
+	d.Insert("T", PDFStringLiteral("Reviewer"))
+	d.Insert("Subj", PDFStringLiteral("Layout"))
+
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	objNr, err := ConvertMarkupToComment(xRefTable, indRef.ObjectNumber.Value())
+	if err != nil {
+		t.Fatalf("TestConvertMarkupToComment: %v\n", err)
+	}
+
+	note, err := annotDictOfSubtype(xRefTable, objNr, "Text")
+	if err != nil {
+		t.Fatalf("TestConvertMarkupToComment: %v\n", err)
+	}
+
+	irt := note.IndirectRefEntry("IRT")
+	if irt == nil || irt.ObjectNumber != indRef.ObjectNumber {
+		t.Errorf("TestConvertMarkupToComment: note not linked to markup: %v\n", irt)
+	}
+
+	for _, entryName := range []string{"Contents", "Subj", "T"} {
+		if s := note.StringEntry(entryName); s == nil || *s != *d.StringEntry(entryName) {
+			t.Errorf("TestConvertMarkupToComment: %s not carried over: %v\n", entryName, s)
+		}
+	}
+
+	r := numbersForTest(t, xRefTable, *NewPDFIndirectRef(objNr, 0), "Rect")
+	if r[0] != 100 || r[3] != 150 {
+		t.Errorf("TestConvertMarkupToComment: note not anchored at upper left corner: %v\n", r)
+	}
+
+	// The markup is preserved.
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+	if arr := pageDict.PDFArrayEntry("Annots"); arr == nil || len(*arr) != 2 {
+		t.Errorf("TestConvertMarkupToComment: expected 2 annotations\n")
+	}
+}
+
+func TestGetAnnotationZOrder(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	var indRefs []PDFIndirectRef
+	for i := 0; i < 3; i++ {
+		indRefs = append(indRefs, addAnnotForTest(t, xRefTable, 2, squareAnnotForTest(NewRectangle(10, 10, 50, 50))))
+	}
+
+	pageNr, index, total, err := GetAnnotationZOrder(xRefTable, indRefs[1].ObjectNumber.Value())
+	if err != nil {
+		t.Fatalf("TestGetAnnotationZOrder: %v\n", err)
+	}
+
+	if pageNr != 2 || index != 1 || total != 3 {
+		t.Errorf("TestGetAnnotationZOrder: expected page 2 index 1 of 3, got page %d index %d of %d\n", pageNr, index, total)
+	}
+}
+
+func TestAddFileAttachmentAnnotation(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	content := []byte("pdfcpu attachment test\n")
+
+	fileName := filepath.Join(outDir, "attachment (1).txt")
+	if err := ioutil.WriteFile(fileName, content, os.ModePerm); err != nil {
+		t.Fatalf("TestAddFileAttachmentAnnotation: %v\n", err)
+	}
+
+	if err := AddFileAttachmentAnnotation(xRefTable, 1, [2]float64{50, 50}, fileName, "Pin"); err == nil {
+		t.Fatalf("TestAddFileAttachmentAnnotation: expected error for unsupported icon\n")
+	}
+
+	err := AddFileAttachmentAnnotation(xRefTable, 1, [2]float64{50, 50}, fileName, "PushPin")
+	if err != nil {
+		t.Fatalf("TestAddFileAttachmentAnnotation: %v\n", err)
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	arr := pageDict.PDFArrayEntry("Annots")
+	if arr == nil || len(*arr) != 1 {
+		t.Fatalf("TestAddFileAttachmentAnnotation: expected 1 annotation\n")
+	}
+
+	d, err := xRefTable.DereferenceDict((*arr)[0])
+	if err != nil {
+		t.Fatalf("TestAddFileAttachmentAnnotation: %v\n", err)
+	}
+
+	if *d.Subtype() != "FileAttachment" || d.NameEntry("Name") == nil || *d.NameEntry("Name") != "PushPin" {
+		t.Errorf("TestAddFileAttachmentAnnotation: unexpected annotation: %s\n", d)
+	}
+
+	if s := decodedTextString(xRefTable, d.Dict["Contents"]); s != "attachment (1).txt" {
+		t.Errorf("TestAddFileAttachmentAnnotation: unexpected Contents: %s\n", s)
+	}
+
+	fs := d.PDFDictEntry("FS")
+	if fs == nil || fs.PDFDictEntry("EF") == nil {
+		t.Fatalf("TestAddFileAttachmentAnnotation: missing embedded file\n")
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(fs.PDFDictEntry("EF").Dict["F"])
+	if err != nil || sd == nil {
+		t.Fatalf("TestAddFileAttachmentAnnotation: missing embedded file stream: %v\n", err)
+	}
+
+	params := sd.PDFDictEntry("Params")
+	if params == nil {
+		t.Fatalf("TestAddFileAttachmentAnnotation: missing Params\n")
+	}
+
+	if size := params.IntEntry("Size"); size == nil || *size != len(content) {
+		t.Errorf("TestAddFileAttachmentAnnotation: unexpected Size: %v\n", size)
+	}
+
+	sum := md5.Sum(content)
+	if cs, ok := params.Dict["CheckSum"].(PDFHexLiteral); !ok || cs.Value() != hex.EncodeToString(sum[:]) {
+		t.Errorf("TestAddFileAttachmentAnnotation: unexpected CheckSum: %v\n", params.Dict["CheckSum"])
+	}
+}
+
+func TestExtractAttachments(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	content := []byte("pdfcpu extract attachment test\n")
+
+	fileName := filepath.Join(outDir, "extract.txt")
+	if err := ioutil.WriteFile(fileName, content, os.ModePerm); err != nil {
+		t.Fatalf("TestExtractAttachments: %v\n", err)
+	}
+
+	if err := AddFileAttachmentAnnotation(xRefTable, 2, [2]float64{50, 50}, fileName, "Tag"); err != nil {
+		t.Fatalf("TestExtractAttachments: %v\n", err)
+	}
+
+	aa, err := xRefTable.PageAnnotations(2)
+	if err != nil {
+		t.Fatalf("TestExtractAttachments: %v\n", err)
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(aa[0].Dict.PDFDictEntry("FS").PDFDictEntry("EF").Dict["F"])
+	if err != nil {
+		t.Fatalf("TestExtractAttachments: %v\n", err)
+	}
+	sd.InsertName("Subtype", "text#2Fplain")
+
+	// A file specification string referring to an external file.
+	addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("FileAttachment"),
+			"Rect":    NewRectangle(10, 10, 30, 30),
+			"FS":      PDFStringLiteral("report.csv"),
+		},
+	})
+
+	atts, err := ExtractAttachments(xRefTable, nil)
+	if err != nil {
+		t.Fatalf("TestExtractAttachments: %v\n", err)
+	}
+
+	if len(atts) != 2 {
+		t.Fatalf("TestExtractAttachments: want 2 attachments, got %v\n", atts)
+	}
+
+	if a := atts[0]; a.PageNr != 1 || a.Name != "report.csv" || a.Embedded || a.Reader != nil {
+		t.Errorf("TestExtractAttachments: unexpected external attachment: %v\n", a)
+	}
+
+	a := atts[1]
+	if a.PageNr != 2 || a.Name != "extract.txt" || !a.Embedded || a.MIMEType != "text/plain" {
+		t.Fatalf("TestExtractAttachments: unexpected embedded attachment: %v\n", a)
+	}
+
+	b, err := ioutil.ReadAll(a.Reader)
+	if err != nil {
+		t.Fatalf("TestExtractAttachments: %v\n", err)
+	}
+
+	if !bytes.Equal(b, content) {
+		t.Errorf("TestExtractAttachments: want %q, got %q\n", content, b)
+	}
+
+	if atts, err = ExtractAttachments(xRefTable, []int{1}); err != nil || len(atts) != 1 || atts[0].PageNr != 1 {
+		t.Errorf("TestExtractAttachments: unexpected attachments of page 1: %v %v\n", atts, err)
+	}
+}
+
+func TestAddWatermarkAnnotation(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	if err := AddWatermarkAnnotation(xRefTable, 1, "DRAFT", [3]float64{1, 0, 0}, 1.5); err == nil {
+		t.Fatalf("TestAddWatermarkAnnotation: expected error for invalid opacity\n")
+	}
+
+	err := AddWatermarkAnnotation(xRefTable, 1, "DRAFT", [3]float64{1, 0, 0}, 0.3)
+	if err != nil {
+		t.Fatalf("TestAddWatermarkAnnotation: %v\n", err)
+	}
+
+	aa, err := xRefTable.PageAnnotations(1)
+	if err != nil || len(aa) != 1 {
+		t.Fatalf("TestAddWatermarkAnnotation: expected 1 annotation: %v\n", err)
+	}
+
+	d := aa[0].Dict
+
+	if aa[0].Subtype != AnnotWatermark || aa[0].Contents != "DRAFT" {
+		t.Errorf("TestAddWatermarkAnnotation: unexpected annotation: %s\n", aa[0])
+	}
+
+	fp := d.PDFDictEntry("FixedPrint")
+	if fp == nil {
+		t.Fatalf("TestAddWatermarkAnnotation: missing FixedPrint\n")
+	}
+
+	if fp.Type() == nil || *fp.Type() != "FixedPrint" {
+		t.Errorf("TestAddWatermarkAnnotation: unexpected FixedPrint Type: %v\n", fp.Type())
+	}
+
+	for _, k := range []string{"Matrix", "H", "V"} {
+		if _, found := fp.Find(k); !found {
+			t.Errorf("TestAddWatermarkAnnotation: FixedPrint missing %s\n", k)
+		}
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(d.PDFDictEntry("AP").Dict["N"])
+	if err != nil || sd == nil {
+		t.Fatalf("TestAddWatermarkAnnotation: missing appearance: %v\n", err)
+	}
+
+	b, err := streamContent(sd)
+	if err != nil {
+		t.Fatalf("TestAddWatermarkAnnotation: %v\n", err)
+	}
+
+	if !strings.Contains(string(b), "(DRAFT) Tj") {
+		t.Errorf("TestAddWatermarkAnnotation: unexpected appearance: %s\n", b)
+	}
+
+	// Since PDF 1.5 strict validation requires Widths even for the standard 14 fonts.
+	xRefTable.ValidationMode = ValidationRelaxed
+
+	if _, err = validateAnnotationDict(xRefTable, d); err != nil {
+		t.Errorf("TestAddWatermarkAnnotation: %v\n", err)
+	}
+
+	// Delimiters get escaped both in Contents and the appearance stream.
+	if err = AddWatermarkAnnotation(xRefTable, 1, `(C) \ DRAFT`, [3]float64{1, 0, 0}, 0.3); err != nil {
+		t.Fatalf("TestAddWatermarkAnnotation: %v\n", err)
+	}
+
+	if aa, err = xRefTable.PageAnnotations(1); err != nil || len(aa) != 2 {
+		t.Fatalf("TestAddWatermarkAnnotation: expected 2 annotations: %v\n", err)
+	}
+
+	if s := aa[1].Dict.StringEntry("Contents"); s == nil || *s != `\(C\) \\ DRAFT` {
+		t.Errorf("TestAddWatermarkAnnotation: unexpected Contents: %v\n", s)
+	}
+
+	if sd, err = xRefTable.DereferenceStreamDict(aa[1].Dict.PDFDictEntry("AP").Dict["N"]); err != nil || sd == nil {
+		t.Fatalf("TestAddWatermarkAnnotation: missing appearance: %v\n", err)
+	}
+
+	if b, err = streamContent(sd); err != nil {
+		t.Fatalf("TestAddWatermarkAnnotation: %v\n", err)
+	}
+
+	if !strings.Contains(string(b), `(\(C\) \\ DRAFT) Tj`) {
+		t.Errorf("TestAddWatermarkAnnotation: unexpected appearance: %s\n", b)
+	}
+}
+
+func TestGroupAnnotationsByReplyThread(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	note := func(contents, date string, irt *PDFIndirectRef) PDFDict {
+		d := PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":         PDFName("Annot"),
+				"Subtype":      PDFName("Text"),
+				"Rect":         NewRectangle(10, 10, 30, 30),
+				"Contents":     PDFStringLiteral(contents),
+				"CreationDate": PDFStringLiteral(date),
+			},
+		}
+		if irt != nil {
+			d.Insert("IRT", *irt)
+		}
+		return d
+	}
+
+	root := addAnnotForTest(t, xRefTable, 1, note("root", "D:20180301100000Z", nil))
+	addAnnotForTest(t, xRefTable, 1, note("standalone1", "D:20180301090000Z", nil))
+
+	// The second reply precedes the first one in the Annots array.
+	reply1 := note("reply1", "D:20180301110000+02'00'", &root)
+	reply1IndRef, err := xRefTable.IndRefForNewObject(reply1)
+	if err != nil {
+		t.Fatalf("TestGroupAnnotationsByReplyThread: %v\n", err)
+	}
+	addAnnotForTest(t, xRefTable, 1, note("reply2", "D:20180301100500Z", reply1IndRef))
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+	pageDict.Update("Annots", append(*pageDict.PDFArrayEntry("Annots"), *reply1IndRef))
+
+	addAnnotForTest(t, xRefTable, 2, note("standalone2", "D:20180302090000Z", nil))
+
+	groups, err := GroupAnnotationsByReplyThread(xRefTable)
+	if err != nil {
+		t.Fatalf("TestGroupAnnotationsByReplyThread: %v\n", err)
+	}
+
+	var got [][]string
+	for _, g := range groups {
+		var ss []string
+		for _, d := range g {
+			ss = append(ss, *d.StringEntry("Contents"))
+		}
+		got = append(got, ss)
+	}
+
+	// reply1 was created at 09:00 UT, prior to reply2.
+	want := "[[root reply1 reply2] [standalone1] [standalone2]]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("TestGroupAnnotationsByReplyThread: got %v, want %s\n", got, want)
+	}
+}
+
+func TestReplyThreads(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	note := func(author, contents, date string) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":         PDFName("Annot"),
+				"Subtype":      PDFName("Text"),
+				"Rect":         NewRectangle(10, 10, 30, 30),
+				"T":            PDFStringLiteral(author),
+				"Subj":         PDFStringLiteral("Review"),
+				"Contents":     PDFStringLiteral(contents),
+				"CreationDate": PDFStringLiteral(date),
+			},
+		}
+	}
+
+	reply := func(d PDFDict, irt PDFIndirectRef, rt string) PDFDict {
+		d.Insert("IRT", irt)
+		if rt != "" {
+			d.Insert("RT", PDFName(rt))
+		}
+		return d
+	}
+
+	other := addAnnotForTest(t, xRefTable, 2, note("Ann", "elsewhere", "D:20180301080000Z"))
+
+	root := addAnnotForTest(t, xRefTable, 1, note("Ann", "root", "D:20180301100000Z"))
+	answer := addAnnotForTest(t, xRefTable, 1, reply(note("Bob", "answer", "D:20180301120000Z"), root, ""))
+	addAnnotForTest(t, xRefTable, 1, reply(note("Cid", "group", "D:20180301110000Z"), root, "Group"))
+	addAnnotForTest(t, xRefTable, 1, reply(note("Ann", "thanks", "D:20180301130000Z"), answer, "R"))
+	addAnnotForTest(t, xRefTable, 1, reply(note("Bob", "orphan", "D:20180301090000Z"), other, ""))
+
+	// Two annotations replying to each other.
+	cycle1 := addAnnotForTest(t, xRefTable, 1, note("Cid", "cycle1", "D:20180302100000Z"))
+	cycle2 := addAnnotForTest(t, xRefTable, 1, reply(note("Ann", "cycle2", "D:20180302110000Z"), cycle1, ""))
+	d, err := xRefTable.DereferenceDict(cycle1)
+	if err != nil {
+		t.Fatalf("TestReplyThreads: %v\n", err)
+	}
+	d.Insert("IRT", cycle2)
+
+	rt, err := ReplyThreads(xRefTable, 1)
+	if err != nil {
+		t.Fatalf("TestReplyThreads: %v\n", err)
+	}
+
+	var format func(rt []ReplyThread) string
+
+	format = func(rt []ReplyThread) string {
+		var ss []string
+		for _, n := range rt {
+			s := n.Author + ":" + n.Contents
+			if n.RT != "" {
+				s += "(" + n.RT + ")"
+			}
+			if len(n.Replies) > 0 {
+				s += format(n.Replies)
+			}
+			ss = append(ss, s)
+		}
+		return fmt.Sprint(ss)
+	}
+
+	want := "[Bob:orphan Ann:root[Cid:group(Group) Bob:answer(R)[Ann:thanks(R)]] Cid:cycle1[Ann:cycle2(R)]]"
+	if got := format(rt); got != want {
+		t.Errorf("TestReplyThreads: got %s, want %s\n", got, want)
+	}
+
+	if rt[1].ObjNr != root.ObjectNumber.Value() || rt[1].Subject != "Review" || rt[1].Created.Hour() != 10 {
+		t.Errorf("TestReplyThreads: unexpected root: %+v\n", rt[1])
+	}
+
+	if _, err = ReplyThreads(xRefTable, 3); err == nil {
+		t.Errorf("TestReplyThreads: expected error for invalid page\n")
+	}
+}
+
+func TestFixSwappedQuadPoints(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := highlightAnnotForTest()
+	addAnnotForTest(t, xRefTable, 1, d)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	swapped := highlightAnnotForTest()
+	swapped.Update("QuadPoints", NewNumberArray(10, 10, 110, 10, 10, 30, 110, 30))
+	indRef := addAnnotForTest(t, xRefTable, 1, swapped)
+
+	// Swapped QuadPoints are only detected in relaxed mode.
+	doTestValidateAnnotOK(t, xRefTable, swapped, ValidationStrict)
+	if len(xRefTable.ValidationWarnings()) > 0 {
+		t.Errorf("TestFixSwappedQuadPoints: unexpected warnings: %v\n", xRefTable.ValidationWarnings())
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, swapped, ValidationRelaxed)
+	if len(xRefTable.ValidationWarnings()) != 1 {
+		t.Fatalf("TestFixSwappedQuadPoints: expected 1 warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+
+	n, err := FixSwappedQuadPoints(xRefTable)
+	if err != nil {
+		t.Fatalf("TestFixSwappedQuadPoints: %v\n", err)
+	}
+	if n != 1 {
+		t.Errorf("TestFixSwappedQuadPoints: expected 1 fixed annotation, got %d\n", n)
+	}
+
+	want := []float64{10, 30, 110, 30, 10, 10, 110, 10}
+	got := numbersForTest(t, xRefTable, indRef, "QuadPoints")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("TestFixSwappedQuadPoints: expected %v, got %v\n", want, got)
+	}
+}
+
+func TestGetAnnotationParentField(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	newField := func(d PDFDict) PDFIndirectRef {
+		indRef, err := xRefTable.IndRefForNewObject(d)
+		if err != nil {
+			t.Fatalf("TestGetAnnotationParentField: %v\n", err)
+		}
+		return *indRef
+	}
+
+	section := newField(PDFDict{Dict: map[string]PDFObject{"T": PDFStringLiteral("section1")}})
+
+	name := newField(PDFDict{
+		Dict: map[string]PDFObject{
+			"FT":     PDFName("Tx"),
+			"T":      PDFStringLiteral("name"),
+			"Parent": section,
+		},
+	})
+
+	widget := func(d PDFDict) PDFDict {
+		d.Insert("Type", PDFName("Annot"))
+		d.Insert("Subtype", PDFName("Widget"))
+		d.Insert("Rect", NewRectangle(10, 10, 110, 30))
+		return d
+	}
+
+	for i, tt := range []struct {
+		widget PDFDict
+		field  *PDFIndirectRef
+		name   string
+	}{
+		// Widget as kid of a nested field.
+		{widget(PDFDict{Dict: map[string]PDFObject{"Parent": name}}), &name, "section1.name"},
+		// Widget merged with a nested field.
+		{widget(PDFDict{Dict: map[string]PDFObject{"FT": PDFName("Tx"), "T": PDFStringLiteral("email"), "Parent": section}}), nil, "section1.email"},
+		// Widget merged with a top level field.
+		{widget(PDFDict{Dict: map[string]PDFObject{"FT": PDFName("Tx"), "T": PDFStringLiteral("date")}}), nil, "date"},
+	} {
+
+		indRef := addAnnotForTest(t, xRefTable, 1, tt.widget)
+
+		field, fieldName, err := GetAnnotationParentField(xRefTable, indRef.ObjectNumber.Value())
+		if err != nil {
+			t.Fatalf("TestGetAnnotationParentField %d: %v\n", i, err)
+		}
+
+		if fieldName != tt.name {
+			t.Errorf("TestGetAnnotationParentField %d: expected %s, got %s\n", i, tt.name, fieldName)
+		}
+
+		want := tt.widget
+		if tt.field != nil {
+			d, _ := xRefTable.DereferenceDict(*tt.field)
+			want = *d
+		}
+
+		if field.PDFString() != want.PDFString() {
+			t.Errorf("TestGetAnnotationParentField %d: unexpected field %s\n", i, field)
+		}
+	}
+
+	square := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	if _, _, err := GetAnnotationParentField(xRefTable, square.ObjectNumber.Value()); err == nil {
+		t.Errorf("TestGetAnnotationParentField: Square annotation => not ok!\n")
+	}
+}
+
+func TestCheckAnnotationPageConsistency(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	_, page2 := pageForTest(t, xRefTable, 2)
+
+	addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	addAnnotForTest(t, xRefTable, 2, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+
+	// Listed by page 1 but claiming to live on page 2.
+	d := squareAnnotForTest(NewRectangle(60, 10, 100, 50))
+	d.Insert("P", page2)
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	ii, err := CheckAnnotationPageConsistency(xRefTable)
+	if err != nil {
+		t.Fatalf("TestCheckAnnotationPageConsistency: %v\n", err)
+	}
+
+	want := Inconsistency{PageNr: 1, ObjNr: indRef.ObjectNumber.Value(), PPageNr: 2}
+
+	if len(ii) != 1 || ii[0] != want {
+		t.Errorf("TestCheckAnnotationPageConsistency: expected %v, got %v\n", want, ii)
+	}
+}
+
+func TestPageAnnotations(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	indRef := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewNumberArray(200, 200, 100, 100)))
+
+	pageDict, pageIndRef := pageForTest(t, xRefTable, 1)
+
+	direct := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Highlight"),
+			"Rect":    NewNumberArray(10, 10, 50, 20),
+			"NM":      PDFStringLiteral("hl1"),
+			"P":       pageIndRef,
+		},
+	}
+
+	corrupt := PDFDict{
+		Dict: map[string]PDFObject{
+			"Subtype": PDFName("Foo"),
+			"Rect":    NewNumberArray(0, 0),
+		},
+	}
+
+	pageDict.Update("Annots", append(*pageDict.PDFArrayEntry("Annots"), nil, direct, corrupt))
+
+	aa, err := xRefTable.PageAnnotations(1)
+	if err != nil {
+		t.Fatalf("TestPageAnnotations: %v\n", err)
+	}
+
+	if len(aa) != 3 {
+		t.Fatalf("TestPageAnnotations: want 3 annotations, got %d\n", len(aa))
+	}
+
+	a := aa[0]
+	if a.Subtype != AnnotSquare || a.ObjNr != indRef.ObjectNumber.Value() || a.PageNr != 1 || a.Contents != "Square Annotation" {
+		t.Fatalf("TestPageAnnotations: unexpected square annotation: %s\n", a)
+	}
+	if a.Rect == nil || a.Rect.LL.X != 100 || a.Rect.UR.Y != 200 {
+		t.Fatalf("TestPageAnnotations: want normalized Rect, got %v\n", a.Rect)
+	}
+
+	a = aa[1]
+	if a.Subtype != AnnotHighlight || a.ObjNr != 0 || a.NM != "hl1" || a.Dict.Dict["NM"] == nil {
+		t.Fatalf("TestPageAnnotations: unexpected highlight annotation: %s\n", a)
+	}
+
+	a = aa[2]
+	if a.Subtype != AnnotUnknown || a.Rect != nil {
+		t.Fatalf("TestPageAnnotations: unexpected corrupt annotation: %s\n", a)
+	}
+
+	if aa, err = xRefTable.PageAnnotations(2); err != nil || len(aa) != 0 {
+		t.Fatalf("TestPageAnnotations: want no annotations for page 2, got %d %v\n", len(aa), err)
+	}
+
+	if _, err = xRefTable.PageAnnotations(3); err == nil {
+		t.Fatalf("TestPageAnnotations: want error for invalid page\n")
+	}
+}
+
+func TestAnnotationFlags(t *testing.T) {
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+
+	f := AnnotationFlagsOf(&d)
+	if f != 0 || f.Print() || f.Hidden() {
+		t.Fatalf("TestAnnotationFlags: expected no flags, got %s\n", f)
+	}
+
+	// Bit positions 2, 3 and 8 as of table 165.
+	d.Insert("F", PDFInteger(2+4+128))
+
+	f = AnnotationFlagsOf(&d)
+	if !f.Hidden() || !f.Print() || !f.Locked() || f.NoView() || f.ReadOnly() || f.LockedContents() {
+		t.Errorf("TestAnnotationFlags: unexpected flags: %s\n", f)
+	}
+
+	if f.String() != "Hidden|Print|Locked" {
+		t.Errorf("TestAnnotationFlags: unexpected String: %s\n", f)
+	}
+
+	// Print only.
+	f = f.With(AnnotFlagHidden|AnnotFlagLocked, false).With(AnnotFlagNoView, true)
+	SetAnnotationFlags(&d, f)
+
+	if i := d.IntEntry("F"); i == nil || *i != 4+32 {
+		t.Errorf("TestAnnotationFlags: expected F 36, got %v\n", i)
+	}
+
+	if f = AnnotationFlagsOf(&d); !f.Print() || !f.NoView() || f.Hidden() {
+		t.Errorf("TestAnnotationFlags: unexpected flags: %s\n", f)
+	}
+
+	if _, err := validateAnnotationDict(createAnnotTestXRef(t, 1), &d); err != nil {
+		t.Errorf("TestAnnotationFlags: %v\n", err)
+	}
+}
+
+func TestAnnotationColor(t *testing.T) {
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Delete("C")
+
+	c, err := AnnotationColor(&d)
+	if err != nil || c != nil {
+		t.Fatalf("TestAnnotationColor: expected no color, got %v %v\n", c, err)
+	}
+
+	for _, tt := range []struct {
+		arr   PDFArray
+		space string
+	}{
+		{NewNumberArray(0.5), "DeviceGray"},
+		{PDFArray{PDFInteger(1), PDFFloat(0.5), PDFInteger(0)}, "DeviceRGB"},
+		{NewNumberArray(0, 1, 1, 0), "DeviceCMYK"},
+	} {
+		d.Update("C", tt.arr)
+		c, err = AnnotationColor(&d)
+		if err != nil {
+			t.Fatalf("TestAnnotationColor: %v\n", err)
+		}
+		if c == nil || c.ColorSpace() != tt.space || len(c.Components) != len(tt.arr) {
+			t.Errorf("TestAnnotationColor: expected %s, got %v\n", tt.space, c)
+		}
+	}
+
+	// An empty array means transparent.
+	d.Update("IC", PDFArray{})
+	if c, err = AnnotationInteriorColor(&d); err != nil || c != nil {
+		t.Errorf("TestAnnotationColor: expected transparent IC, got %v %v\n", c, err)
+	}
+
+	for _, arr := range []PDFArray{NewNumberArray(0, 1), NewNumberArray(0, 0, 0, 0, 0), {PDFName("Red")}} {
+		d.Update("C", arr)
+		if _, err = AnnotationColor(&d); err == nil {
+			t.Errorf("TestAnnotationColor: corrupt C %v => not ok!\n", arr)
+		}
+	}
+
+	// Recolor.
+	if err = SetAnnotationColor(&d, RGBColor(1, 0.5, 0)); err != nil {
+		t.Fatalf("TestAnnotationColor: %v\n", err)
+	}
+	if c, err = AnnotationColor(&d); err != nil || c == nil || c.Components[0] != 1 || c.Components[1] != 0.5 || c.Components[2] != 0 {
+		t.Errorf("TestAnnotationColor: unexpected C: %v %v\n", c, err)
+	}
+
+	// Colors the validator rejects are refused.
+	for _, c := range []Color{RGBColor(1, 1.5, -1), {[]float64{0, 1}}, {[]float64{0, 0, 0, 0, 0}}} {
+		if err = SetAnnotationColor(&d, c); err == nil {
+			t.Errorf("TestAnnotationColor: invalid color %v => not ok!\n", c)
+		}
+	}
+
+	if err = SetAnnotationDictInteriorColor(&d, GrayColor(0.5)); err == nil {
+		t.Errorf("TestAnnotationColor: gray IC => not ok!\n")
+	}
+
+	if err = SetAnnotationDictInteriorColor(&d, RGBColor(0, 0, 1)); err != nil {
+		t.Fatalf("TestAnnotationColor: %v\n", err)
+	}
+	if c, err = AnnotationInteriorColor(&d); err != nil || c == nil || c.ColorSpace() != "DeviceRGB" {
+		t.Errorf("TestAnnotationColor: unexpected IC: %v %v\n", c, err)
+	}
+
+	if _, err = validateAnnotationDict(createAnnotTestXRef(t, 1), &d); err != nil {
+		t.Errorf("TestAnnotationColor: %v\n", err)
+	}
+
+	if err = SetAnnotationColor(&d, Color{}); err != nil {
+		t.Fatalf("TestAnnotationColor: %v\n", err)
+	}
+	if arr := d.PDFArrayEntry("C"); arr == nil || len(*arr) != 0 {
+		t.Errorf("TestAnnotationColor: expected transparent C, got %v\n", d.Dict["C"])
+	}
+}
+
+func TestGetAnnotationContentsEncoding(t *testing.T) {
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+
+	for _, tt := range []struct {
+		contents PDFObject
+		want     string
+	}{
+		{PDFHexLiteral("FEFF00480069"), "UTF-16BE"}, // "Hi" with BOM
+		{PDFStringLiteral("Gr\\374\\337e"), "PDFDocEncoding"},
+		{PDFStringLiteral("Hello"), "ASCII"},
+	} {
+		d.Update("Contents", tt.contents)
+
+		enc, err := GetAnnotationContentsEncoding(&d)
+		if err != nil {
+			t.Fatalf("TestGetAnnotationContentsEncoding: %v\n", err)
+		}
+
+		if enc != tt.want {
+			t.Errorf("TestGetAnnotationContentsEncoding: %s: want %s, got %s\n", tt.contents, tt.want, enc)
+		}
+	}
+
+	d.Delete("Contents")
+	if _, err := GetAnnotationContentsEncoding(&d); err == nil {
+		t.Errorf("TestGetAnnotationContentsEncoding: expected error for missing Contents\n")
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// BrokenAppearance describes a problem of an annotation appearance stream likely to break rendering.
+type BrokenAppearance struct {
+	PageNr      int    // page of the annotation
+	ObjNr       int    // annotation, 0 for annotation dicts embedded directly into the Annots array
+	Appearance  string // N, R or D
+	StreamObjNr int    // appearance stream, 0 for direct streams
+	Problem     string
+}
+
+func (ba BrokenAppearance) String() string {
+	return fmt.Sprintf("page %d obj#%d %s appearance obj#%d: %s", ba.PageNr, ba.ObjNr, ba.Appearance, ba.StreamObjNr, ba.Problem)
+}
+
+// contentResourceCategories maps content stream operators using named resources to their resource category.
+var contentResourceCategories = map[string]string{
+	"Tf": "Font",
+	"Do": "XObject",
+	"gs": "ExtGState",
+	"sh": "Shading",
+}
+
+// appearanceStreamProblems returns all problems of an appearance stream likely to break rendering.
+func appearanceStreamProblems(xRefTable *XRefTable, sd *PDFStreamDict) ([]string, error) {
+
+	var pp []string
+
+	if st := sd.Subtype(); st == nil || *st != "Form" {
+		pp = append(pp, "not a form XObject")
+	}
+
+	if l := sd.IntEntry("Length"); l != nil && sd.Raw != nil && *l != len(sd.Raw) {
+		pp = append(pp, fmt.Sprintf("Length %d does not match stream length %d", *l, len(sd.Raw)))
+	}
+
+	if bbox, err := numbers(xRefTable, sd.Dict["BBox"]); err != nil || len(bbox) != 4 {
+		pp = append(pp, "corrupt BBox")
+	} else if bbox[0] == bbox[2] || bbox[1] == bbox[3] {
+		pp = append(pp, "zero area BBox")
+	}
+
+	if m, err := formMatrix(xRefTable, sd); err != nil {
+		pp = append(pp, "corrupt Matrix")
+	} else if m[0]*m[3]-m[1]*m[2] == 0 {
+		pp = append(pp, "singular Matrix")
+	}
+
+	b, err := streamContent(sd)
+	if err != nil {
+		return append(pp, "undecodable content"), nil
+	}
+
+	tokens, err := contentOperators(b)
+	if err != nil {
+		return append(pp, fmt.Sprintf("corrupt content: %v", err)), nil
+	}
+
+	resources, err := xRefTable.DereferenceDict(sd.Dict["Resources"])
+	if err != nil {
+		return nil, err
+	}
+
+	depth := 0
+	missing := StringSet{}
+
+	for _, t := range tokens {
+
+		switch t.op {
+		case "q":
+			depth++
+		case "Q":
+			depth--
+		}
+
+		if depth < 0 {
+			pp = append(pp, "unbalanced q/Q: Q without q")
+			depth = 0
+		}
+
+		category, found := contentResourceCategories[t.op]
+		if !found || t.name == "" {
+			continue
+		}
+
+		key := category + "/" + t.name
+		if missing[key] {
+			continue
+		}
+
+		var d *PDFDict
+		if resources != nil {
+			if d, err = xRefTable.DereferenceDict(resources.Dict[category]); err != nil {
+				return nil, err
+			}
+		}
+
+		if d == nil || d.Dict[t.name] == nil {
+			missing[key] = true
+			pp = append(pp, fmt.Sprintf("missing resource %s", key))
+		}
+	}
+
+	if depth > 0 {
+		pp = append(pp, fmt.Sprintf("unbalanced q/Q: %d q without Q", depth))
+	}
+
+	return pp, nil
+}
+
+// DetectBrokenAppearances reports problems of annotation appearance streams likely to break rendering.
+// Nothing gets fixed.
+func DetectBrokenAppearances(xRefTable *XRefTable) ([]BrokenAppearance, error) {
+
+	var bb []BrokenAppearance
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		objNr := 0
+		if indRef != nil {
+			objNr = indRef.ObjectNumber.Value()
+		}
+
+		return visitAppearanceStreams(xRefTable, annotDict, func(key string, apIndRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+			pp, err := appearanceStreamProblems(xRefTable, sd)
+			if err != nil {
+				return errors.Wrapf(err, "DetectBrokenAppearances: obj#%d", objNr)
+			}
+
+			streamObjNr := 0
+			if apIndRef != nil {
+				streamObjNr = apIndRef.ObjectNumber.Value()
+			}
+
+			for _, p := range pp {
+				bb = append(bb, BrokenAppearance{PageNr: pageNr, ObjNr: objNr, Appearance: key, StreamObjNr: streamObjNr, Problem: p})
+			}
+
+			return nil
+		})
+	})
+
+	return bb, err
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"testing"
+)
+
+func TestDetectBrokenAppearances(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	stamp := func(apIndRef PDFIndirectRef) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Stamp"),
+				"Rect":    NewRectangle(10, 10, 60, 60),
+				"AP":      PDFDict{Dict: map[string]PDFObject{"N": apIndRef}},
+			},
+		}
+	}
+
+	// Healthy
+	ap := formForTest(t, xRefTable, "q 1 0 0 RG 0 0 m 50 50 l S Q", NewRectangle(0, 0, 50, 50), nil)
+	addAnnotForTest(t, xRefTable, 1, stamp(ap))
+
+	// Font resource missing
+	ap = formForTest(t, xRefTable, "BT /Helv 12 Tf (Approved) Tj ET", NewRectangle(0, 0, 50, 50), nil)
+	indRef1 := addAnnotForTest(t, xRefTable, 1, stamp(ap))
+
+	// Zero area BBox
+	ap = formForTest(t, xRefTable, "0 0 m 50 0 l S", NewRectangle(0, 0, 50, 0), nil)
+	indRef2 := addAnnotForTest(t, xRefTable, 2, stamp(ap))
+
+	bb, err := DetectBrokenAppearances(xRefTable)
+	if err != nil {
+		t.Fatalf("TestDetectBrokenAppearances: %v\n", err)
+	}
+
+	if len(bb) != 2 {
+		t.Fatalf("TestDetectBrokenAppearances: expected 2 problems, got %v\n", bb)
+	}
+
+	if bb[0].PageNr != 1 || bb[0].ObjNr != indRef1.ObjectNumber.Value() || bb[0].Problem != "missing resource Font/Helv" {
+		t.Errorf("TestDetectBrokenAppearances: unexpected problem: %s\n", bb[0])
+	}
+
+	if bb[1].PageNr != 2 || bb[1].ObjNr != indRef2.ObjectNumber.Value() || bb[1].Problem != "zero area BBox" {
+		t.Errorf("TestDetectBrokenAppearances: unexpected problem: %s\n", bb[1])
+	}
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"bytes"
+	"encoding/hex"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -347,3 +350,125 @@ func AttachRemove(xRefTable *XRefTable, files StringSet) (ok bool, err error) {
 
 	return ok, err
 }
+
+// Attachment is a file attached to a page by a FileAttachment annotation.
+type Attachment struct {
+	Name     string    // File name taken from the file specification.
+	PageNr   int       // Page the annotation belongs to.
+	ObjNr    int       // Annotation, 0 for annotation dicts embedded directly into the Annots array.
+	MIMEType string    // Subtype of the embedded file stream, if any.
+	Embedded bool      // false for external files referred to by the file specification.
+	Reader   io.Reader // Decoded content of an embedded file, nil for external files.
+}
+
+// decodeNameEscapes resolves the #xx escape sequences of a name, see 7.3.5
+func decodeNameEscapes(s string) string {
+
+	var b []byte
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if c, err := hex.DecodeString(s[i+1 : i+3]); err == nil {
+				b = append(b, c[0])
+				i += 2
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+
+	return string(b)
+}
+
+// attachment returns the file attached by a FileAttachment annotation.
+func attachment(xRefTable *XRefTable, annotDict *PDFDict) (*Attachment, error) {
+
+	obj, err := xRefTable.Dereference(annotDict.Dict["FS"])
+	if err != nil || obj == nil {
+		return nil, errors.New("missing FS")
+	}
+
+	d, ok := obj.(PDFDict)
+	if !ok {
+		// A file specification string referring to an external file.
+		if _, err := stringBytes(obj); err != nil {
+			return nil, errors.Errorf("corrupt FS: %v", obj)
+		}
+		return &Attachment{Name: decodedTextString(xRefTable, obj)}, nil
+	}
+
+	a := &Attachment{}
+
+	for _, k := range []string{"UF", "F", "Unix", "DOS", "Mac"} {
+		if a.Name = decodedTextString(xRefTable, d.Dict[k]); a.Name != "" {
+			break
+		}
+	}
+
+	if _, found := d.Find("EF"); !found {
+		return a, nil
+	}
+
+	sd, err := decodedFileSpecStreamDict(xRefTable, a.Name, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if sd == nil {
+		return nil, errors.Errorf("%s: missing or unsupported embedded file stream", a.Name)
+	}
+
+	a.Embedded = true
+	a.Reader = bytes.NewReader(sd.Content)
+
+	if st := sd.Subtype(); st != nil {
+		a.MIMEType = decodeNameEscapes(*st)
+	}
+
+	return a, nil
+}
+
+// ExtractAttachments returns the files attached to the pages pageNrs by FileAttachment annotations
+// in page order or those of all pages if pageNrs is empty.
+// The content of embedded files is decoded, external files are returned without content.
+func ExtractAttachments(xRefTable *XRefTable, pageNrs []int) ([]Attachment, error) {
+
+	pages := IntSet{}
+	for _, pageNr := range pageNrs {
+		pages[pageNr] = true
+	}
+
+	var aa []Attachment
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if len(pages) > 0 && !pages[pageNr] {
+			return nil
+		}
+
+		if st := annotDict.Subtype(); st == nil || *st != "FileAttachment" {
+			return nil
+		}
+
+		a, err := attachment(xRefTable, annotDict)
+		if err != nil {
+			return errors.Wrapf(err, "ExtractAttachments: page %d", pageNr)
+		}
+
+		a.PageNr = pageNr
+
+		if indRef != nil {
+			a.ObjNr = indRef.ObjectNumber.Value()
+		}
+
+		aa = append(aa, *a)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aa, nil
+}
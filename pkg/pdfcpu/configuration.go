@@ -75,6 +75,15 @@ type Configuration struct {
 	// Validate against ISO-32000: strict or relaxed
 	ValidationMode int
 
+	// Collects non fatal issues as validation warnings instead of aborting strict validation.
+	CollectValidationWarnings bool
+
+	// Makes strict validation reject PrinterMark annotations lacking the NoZoom and NoRotate flags.
+	StrictPrinterMarks bool
+
+	// Makes strict validation reject widget kids of a field sharing a Rect on the same page.
+	StrictWidgetRects bool
+
 	// End of line char sequence for writing.
 	Eol string
 
@@ -0,0 +1,320 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Content stream tokenizing, see 7.8.2 Content Streams.
+
+// contentStreamOperators is the set of all content stream operators, see Annex A.
+var contentStreamOperators = map[string]bool{
+	"b": true, "B": true, "b*": true, "B*": true, "BDC": true, "BI": true, "BMC": true, "BT": true, "BX": true,
+	"c": true, "cm": true, "CS": true, "cs": true, "d": true, "d0": true, "d1": true, "Do": true, "DP": true,
+	"EI": true, "EMC": true, "ET": true, "EX": true, "f": true, "F": true, "f*": true, "G": true, "g": true,
+	"gs": true, "h": true, "i": true, "ID": true, "j": true, "J": true, "K": true, "k": true, "l": true,
+	"m": true, "M": true, "MP": true, "n": true, "q": true, "Q": true, "re": true, "RG": true, "rg": true,
+	"ri": true, "s": true, "S": true, "SC": true, "sc": true, "SCN": true, "scn": true, "sh": true,
+	"T*": true, "Tc": true, "Td": true, "TD": true, "Tf": true, "Tj": true, "TJ": true, "TL": true,
+	"Tm": true, "Tr": true, "Ts": true, "Tw": true, "Tz": true, "v": true, "w": true, "W": true, "W*": true,
+	"y": true, "'": true, "\"": true,
+}
+
+// paintingOperators is the set of content stream operators producing marks on the page.
+var paintingOperators = map[string]bool{
+	"b": true, "B": true, "b*": true, "B*": true, "Do": true, "EI": true, "f": true, "F": true, "f*": true,
+	"s": true, "S": true, "sh": true, "Tj": true, "TJ": true, "'": true, "\"": true,
+}
+
+// contentStreamOperatorNames maps the content stream operators to themselves.
+var contentStreamOperatorNames = func() map[string]string {
+	m := map[string]string{}
+	for op := range contentStreamOperators {
+		m[op] = op
+	}
+	return m
+}()
+
+func isKeywordOperand(tok []byte) bool {
+	s := string(tok)
+	return s == "true" || s == "false" || s == "null"
+}
+
+func isWhitespace(c byte) bool {
+	return c == 0x00 || c == 0x09 || c == 0x0A || c == 0x0C || c == 0x0D || c == 0x20
+}
+
+func isContentDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// contentToken is a content stream operator along with its position and a digest of its operands.
+type contentToken struct {
+	op       string
+	pos      int
+	operands []float64 // numeric operands including numbers within arrays
+	name     string    // last name operand
+	strLen   int       // accumulated byte length of all string operands
+}
+
+// skipInlineImageData returns the position following the EI operator terminating inline image data starting at i.
+func skipInlineImageData(b []byte, i int) (int, error) {
+
+	for j := i; j+1 < len(b); j++ {
+		if b[j] == 'E' && b[j+1] == 'I' && j > 0 && isWhitespace(b[j-1]) && (j+2 == len(b) || isWhitespace(b[j+2])) {
+			return j + 2, nil
+		}
+	}
+
+	return 0, errors.New("skipInlineImageData: missing EI")
+}
+
+// contentBuffers holds the buffers used for tokenizing a content stream.
+type contentBuffers struct {
+	tokens   []contentToken
+	operands []float64 // backing array for the operands of all tokens
+}
+
+// contentBufferPool provides reusable buffers for tokenizing content streams during validation.
+// Tokens taken from pooled buffers must not escape the function returning the buffers to the pool.
+var contentBufferPool = sync.Pool{New: func() interface{} { return &contentBuffers{} }}
+
+// contentOperators returns all operators of a content stream in order of appearance.
+func contentOperators(b []byte) ([]contentToken, error) {
+	return tokenizeContent(b, &contentBuffers{})
+}
+
+// tokenizeContent returns all operators of a content stream in order of appearance
+// using the buffers of buf, which get updated for reuse.
+func tokenizeContent(b []byte, buf *contentBuffers) ([]contentToken, error) {
+
+	var (
+		name   string
+		strLen int
+	)
+
+	tokens := buf.tokens[:0]
+	operands := buf.operands[:0]
+	start := 0
+
+	defer func() {
+		buf.tokens, buf.operands = tokens, operands
+	}()
+
+	for i := 0; i < len(b); {
+
+		c := b[i]
+
+		switch {
+
+		case isWhitespace(c):
+			i++
+
+		case c == '%':
+			// comment
+			for i < len(b) && b[i] != 0x0A && b[i] != 0x0D {
+				i++
+			}
+
+		case c == '(':
+			j := balancedParenthesesPrefix(string(b[i:]))
+			if j < 0 {
+				return nil, errors.Errorf("contentOperators: unbalanced string at %d", i)
+			}
+			if bb, err := Unescape(string(b[i+1 : i+j])); err == nil {
+				strLen += len(bb)
+			}
+			i += j + 1
+
+		case c == '<' && i+1 < len(b) && b[i+1] == '<', c == '>' && i+1 < len(b) && b[i+1] == '>':
+			i += 2
+
+		case c == '<':
+			j := bytes.IndexByte(b[i:], '>')
+			if j < 0 {
+				return nil, errors.Errorf("contentOperators: unterminated hex string at %d", i)
+			}
+			// j-1 hex digits, a missing final digit is assumed to be 0.
+			strLen += j / 2
+			i += j + 1
+
+		case c == '[' || c == ']' || c == '{' || c == '}':
+			i++
+
+		case c == '/':
+			i++
+			j := i
+			for i < len(b) && !isWhitespace(b[i]) && !isContentDelimiter(b[i]) {
+				i++
+			}
+			name = string(b[j:i])
+
+		default:
+			j := i
+			for i < len(b) && !isWhitespace(b[i]) && !isContentDelimiter(b[i]) {
+				i++
+			}
+			if i == j {
+				// Stray delimiter.
+				return nil, errors.Errorf("contentOperators: unexpected %q at %d", c, i)
+			}
+
+			if c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.' || isKeywordOperand(b[j:i]) {
+				// operand
+				if f, err := strconv.ParseFloat(string(b[j:i]), 64); err == nil {
+					operands = append(operands, f)
+				}
+				continue
+			}
+
+			// Avoid allocating the names of well known operators.
+			tok, ok := contentStreamOperatorNames[string(b[j:i])]
+			if !ok {
+				tok = string(b[j:i])
+			}
+
+			var ops []float64
+			if len(operands) > start {
+				ops = operands[start:len(operands):len(operands)]
+			}
+
+			tokens = append(tokens, contentToken{op: tok, pos: j, operands: ops, name: name, strLen: strLen})
+			start, name, strLen = len(operands), "", 0
+
+			if tok == "ID" {
+				// Skip the single white-space character following ID and the image data.
+				var err error
+				if i, err = skipInlineImageData(b, i+1); err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, contentToken{op: "EI", pos: i - 2})
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+// unknownContentOperator returns the first operator of a content stream not defined in ISO 32000.
+// Operators within compatibility sections (BX/EX) are ignored.
+func unknownContentOperator(b []byte) (*contentToken, error) {
+
+	buf := contentBufferPool.Get().(*contentBuffers)
+	defer contentBufferPool.Put(buf)
+
+	tokens, err := tokenizeContent(b, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	compat := 0
+
+	for _, t := range tokens {
+
+		switch t.op {
+		case "BX":
+			compat++
+		case "EX":
+			if compat > 0 {
+				compat--
+			}
+		}
+
+		if compat == 0 && !contentStreamOperators[t.op] {
+			// t is a copy, its operands refer to the pooled buffer though.
+			t.operands = append([]float64(nil), t.operands...)
+			return &t, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// undefinedExtGState returns the first gs operator of a content stream
+// referring to a graphics state parameter dict not defined by extGStates.
+func undefinedExtGState(b []byte, extGStates *PDFDict) (*contentToken, error) {
+
+	buf := contentBufferPool.Get().(*contentBuffers)
+	defer contentBufferPool.Put(buf)
+
+	tokens, err := tokenizeContent(b, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tokens {
+
+		if t.op != "gs" {
+			continue
+		}
+
+		if extGStates != nil {
+			if _, found := extGStates.Find(t.name); found {
+				continue
+			}
+		}
+
+		t.operands = nil
+		return &t, nil
+	}
+
+	return nil, nil
+}
+
+// paintsContent returns true if a content stream contains at least one painting operator.
+func paintsContent(b []byte) (bool, error) {
+
+	buf := contentBufferPool.Get().(*contentBuffers)
+	defer contentBufferPool.Put(buf)
+
+	tokens, err := tokenizeContent(b, buf)
+	if err != nil {
+		return false, err
+	}
+
+	for _, t := range tokens {
+		if paintingOperators[t.op] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// streamContent returns the decoded content of a stream.
+func streamContent(sd *PDFStreamDict) ([]byte, error) {
+
+	if sd.Content != nil {
+		return sd.Content, nil
+	}
+
+	if sd.FilterPipeline == nil {
+		return sd.Raw, nil
+	}
+
+	err := decodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return sd.Content, nil
+}
@@ -55,6 +55,10 @@ func NewPDFContext(fileName string, file *os.File, config *Configuration) (*PDFC
 		NewWriteContext(config.Eol),
 	}
 
+	ctx.CollectWarnings = config.CollectValidationWarnings
+	ctx.XRefTable.StrictPrinterMarks = config.StrictPrinterMarks
+	ctx.XRefTable.StrictWidgetRects = config.StrictWidgetRects
+
 	return ctx, nil
 }
 
@@ -174,6 +178,8 @@ type ReadContext struct {
 
 	UsingXRefStreams bool   // File is using xref streams.
 	XRefStreams      IntSet // All object numbers of any xref streams found.
+
+	OffsetLastXRefSection int64 // Offset of the xref section referenced by startxref.
 }
 
 func newReadContext(fileName string, file *os.File, fileSize int64) *ReadContext {
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/hhrutter/pdfcpu/pkg/filter"
+	"github.com/pkg/errors"
 )
 
 // Functions needed to create a test.pdf that gets used for validation testing (see process_test.go)
@@ -292,19 +293,30 @@ func createPolyLineAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef,
 	return xRefTable.IndRefForNewObject(d)
 }
 
+// quadPointsForRect returns the QuadPoints array covering an annotation rect.
+func quadPointsForRect(xRefTable *XRefTable, annotRect *PDFArray) (PDFArray, error) {
+
+	f, err := numbers(xRefTable, *annotRect)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f) != 4 {
+		return nil, errors.Errorf("quadPointsForRect: corrupt rect: %v", *annotRect)
+	}
+
+	qp := ComputeAnnotationQuadFromRect([4]float64{f[0], f[1], f[2], f[3]})
+
+	return NewNumberArray(qp[:]...), nil
+}
+
 func createHighlightAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef, annotRect *PDFArray) (*PDFIndirectRef, error) {
 
 	// Create a quad points array corresponding to the annot rect.
-	ar := *annotRect
-	qp := PDFArray{}
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[3])
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[3])
+	qp, err := quadPointsForRect(xRefTable, annotRect)
+	if err != nil {
+		return nil, err
+	}
 
 	optionalContentGroupDict := PDFDict{
 		Dict: map[string]PDFObject{
@@ -344,17 +356,11 @@ func createHighlightAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef,
 
 func createUnderlineAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef, annotRect *PDFArray) (*PDFIndirectRef, error) {
 
-	// Create a quad points array corresponding to annot rect.
-	ar := *annotRect
-	qp := PDFArray{}
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[3])
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[3])
+	// Create a quad points array corresponding to the annot rect.
+	qp, err := quadPointsForRect(xRefTable, annotRect)
+	if err != nil {
+		return nil, err
+	}
 
 	d := PDFDict{
 		Dict: map[string]PDFObject{
@@ -374,17 +380,11 @@ func createUnderlineAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef,
 
 func createSquigglyAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef, annotRect *PDFArray) (*PDFIndirectRef, error) {
 
-	// Create a quad points array corresponding to annot rect.
-	ar := *annotRect
-	qp := PDFArray{}
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[3])
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[3])
+	// Create a quad points array corresponding to the annot rect.
+	qp, err := quadPointsForRect(xRefTable, annotRect)
+	if err != nil {
+		return nil, err
+	}
 
 	d := PDFDict{
 		Dict: map[string]PDFObject{
@@ -404,17 +404,11 @@ func createSquigglyAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef,
 
 func createStrikeOutAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef, annotRect *PDFArray) (*PDFIndirectRef, error) {
 
-	// Create a quad points array corresponding to annot rect.
-	ar := *annotRect
-	qp := PDFArray{}
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[3])
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[3])
+	// Create a quad points array corresponding to the annot rect.
+	qp, err := quadPointsForRect(xRefTable, annotRect)
+	if err != nil {
+		return nil, err
+	}
 
 	d := PDFDict{
 		Dict: map[string]PDFObject{
@@ -844,7 +838,7 @@ func createPrinterMarkAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRe
 			"P":        *pageIndRef,
 			"Border":   NewIntegerArray(0, 0, 3),
 			"C":        NewNumberArray(0.2, 0.8, 0.5),
-			"F":        PDFInteger(0),
+			"F":        PDFInteger(annotFlagNoZoom | annotFlagNoRotate),
 			"AP": PDFDict{
 				Dict: map[string]PDFObject{
 					"N": *indRef,
@@ -957,17 +951,11 @@ func create3DAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef, annotR
 
 func createRedactAnnotation(xRefTable *XRefTable, pageIndRef *PDFIndirectRef, annotRect *PDFArray) (*PDFIndirectRef, error) {
 
-	// Create a quad points array corresponding to annot rect.
-	ar := *annotRect
-	qp := PDFArray{}
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[1])
-	qp = append(qp, ar[2])
-	qp = append(qp, ar[3])
-	qp = append(qp, ar[0])
-	qp = append(qp, ar[3])
+	// Create a quad points array corresponding to the annot rect.
+	qp, err := quadPointsForRect(xRefTable, annotRect)
+	if err != nil {
+		return nil, err
+	}
 
 	d := PDFDict{
 		Dict: map[string]PDFObject{
@@ -0,0 +1,422 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Resolving destinations, see 12.3.2 Destinations.
+
+// DanglingDest is a destination of an annotation that does not resolve to a page of the document.
+type DanglingDest struct {
+	PageNr int    // page of the annotation
+	ObjNr  int    // annotation, 0 for annotation dicts embedded directly into the Annots array
+	Dest   string // the unresolved destination
+	Reason string
+}
+
+func (d DanglingDest) String() string {
+	return fmt.Sprintf("page %d obj#%d: %s: %s", d.PageNr, d.ObjNr, d.Dest, d.Reason)
+}
+
+// nameTreeValue returns the value for key of the name tree rooted at obj.
+func nameTreeValue(xRefTable *XRefTable, obj PDFObject, key string, visited IntSet) (PDFObject, error) {
+
+	if indRef, ok := obj.(PDFIndirectRef); ok {
+		if visited[indRef.ObjectNumber.Value()] {
+			return nil, errors.New("nameTreeValue: cycle detected")
+		}
+		visited[indRef.ObjectNumber.Value()] = true
+	}
+
+	d, err := xRefTable.DereferenceDict(obj)
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	if arr, err := xRefTable.DereferenceArray(d.Dict["Names"]); err != nil || arr != nil {
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(*arr); i += 2 {
+			if k, err := stringValue(xRefTable, (*arr)[i]); err == nil && k != nil && *k == key {
+				return (*arr)[i+1], nil
+			}
+		}
+		return nil, nil
+	}
+
+	kids, err := xRefTable.DereferenceArray(d.Dict["Kids"])
+	if err != nil || kids == nil {
+		return nil, err
+	}
+
+	for _, kid := range *kids {
+		v, err := nameTreeValue(xRefTable, kid, key, visited)
+		if err != nil || v != nil {
+			return v, err
+		}
+	}
+
+	return nil, nil
+}
+
+// namedDestination returns the destination for name looking into the Dests dict of the catalog (PDF 1.1)
+// as well as the Dests name tree.
+func namedDestination(xRefTable *XRefTable, name string) (PDFObject, error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	dests, err := xRefTable.DereferenceDict(rootDict.Dict["Dests"])
+	if err != nil {
+		return nil, err
+	}
+	if dests != nil {
+		if obj, found := dests.Find(name); found && obj != nil {
+			return obj, nil
+		}
+	}
+
+	names, err := xRefTable.DereferenceDict(rootDict.Dict["Names"])
+	if err != nil || names == nil {
+		return nil, err
+	}
+
+	obj, found := names.Find("Dests")
+	if !found || obj == nil {
+		return nil, nil
+	}
+
+	return nameTreeValue(xRefTable, obj, name, IntSet{})
+}
+
+// resolveDestination returns the explicit destination array for dest.
+func resolveDestination(xRefTable *XRefTable, dest PDFObject) (*PDFArray, error) {
+
+	obj, err := xRefTable.Dereference(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+
+	case PDFName:
+		obj, err = namedDestination(xRefTable, o.Value())
+
+	case PDFStringLiteral, PDFHexLiteral:
+		var s *string
+		if s, err = stringValue(xRefTable, o); err == nil {
+			obj, err = namedDestination(xRefTable, *s)
+		}
+
+	case PDFArray:
+		return &o, nil
+
+	default:
+		return nil, errors.Errorf("resolveDestination: invalid destination: %v", obj)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if obj == nil {
+		return nil, errors.Errorf("resolveDestination: unknown named destination: %s", dest)
+	}
+
+	obj, err = xRefTable.Dereference(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// A named destination is a destination array or a dict with a D entry.
+	if d, ok := obj.(PDFDict); ok {
+		if obj, err = xRefTable.Dereference(d.Dict["D"]); err != nil {
+			return nil, err
+		}
+	}
+
+	arr, ok := obj.(PDFArray)
+	if !ok {
+		return nil, errors.Errorf("resolveDestination: corrupt named destination: %s", dest)
+	}
+
+	return &arr, nil
+}
+
+// destinationPageDict returns the page dict an explicit destination refers to.
+func destinationPageDict(xRefTable *XRefTable, arr PDFArray) (*PDFDict, error) {
+
+	if len(arr) < 2 {
+		return nil, errors.New("destinationPageDict: corrupt destination")
+	}
+
+	indRef, ok := arr[0].(PDFIndirectRef)
+	if !ok {
+		return nil, errors.New("destinationPageDict: destination must refer to a page object")
+	}
+
+	d, err := xRefTable.DereferenceDict(indRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if d == nil || d.Type() == nil || *d.Type() != "Page" {
+		return nil, errors.Errorf("destinationPageDict: obj#%d is not a page", indRef.ObjectNumber.Value())
+	}
+
+	return d, nil
+}
+
+// destFitParams maps the fit modes of explicit destinations to their number of parameters, see Table 151.
+var destFitParams = map[string]int{
+	"XYZ":   3, // left top zoom
+	"Fit":   0,
+	"FitH":  1, // top
+	"FitV":  1, // left
+	"FitR":  4, // left bottom right top
+	"FitB":  0,
+	"FitBH": 1, // top
+	"FitBV": 1, // left
+}
+
+// destinationPageNr returns the page number for the page entry of an explicit destination
+// which is either a page object or an integer page index for remote destinations.
+func destinationPageNr(xRefTable *XRefTable, obj PDFObject) (int, error) {
+
+	pageNr := 0
+	pageCount := 0
+
+	err := visitPages(xRefTable, func(i int, indRef PDFIndirectRef, d *PDFDict) error {
+		if ir, ok := obj.(PDFIndirectRef); ok && ir.ObjectNumber == indRef.ObjectNumber {
+			pageNr = i
+		}
+		pageCount = i
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch o := obj.(type) {
+
+	case PDFIndirectRef:
+		if pageNr == 0 {
+			return 0, errors.Errorf("destinationPageNr: obj#%d is not a page", o.ObjectNumber.Value())
+		}
+
+	case PDFInteger:
+		if o.Value() < 0 || o.Value() >= pageCount {
+			return 0, errors.Errorf("destinationPageNr: page index %d out of range", o.Value())
+		}
+		pageNr = o.Value() + 1
+
+	default:
+		return 0, errors.Errorf("destinationPageNr: invalid page: %v", obj)
+	}
+
+	return pageNr, nil
+}
+
+// ResolveDestination returns the page number, the fit mode and its parameters for dest
+// which is either an explicit destination or a named destination defined by the Dests dict
+// of the catalog or the Dests name tree. Null parameters are returned as NaN.
+func ResolveDestination(xRefTable *XRefTable, dest PDFObject) (pageNr int, fit string, params []float64, err error) {
+
+	arr, err := resolveDestination(xRefTable, dest)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	if len(*arr) < 2 {
+		return 0, "", nil, errors.Errorf("ResolveDestination: corrupt destination: %s", arr)
+	}
+
+	pageNr, err = destinationPageNr(xRefTable, (*arr)[0])
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	obj, err := xRefTable.Dereference((*arr)[1])
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	name, ok := obj.(PDFName)
+	if !ok {
+		return 0, "", nil, errors.Errorf("ResolveDestination: invalid fit mode: %v", obj)
+	}
+
+	fit = name.Value()
+
+	n, ok := destFitParams[fit]
+	if !ok {
+		return 0, "", nil, errors.Errorf("ResolveDestination: unknown fit mode: %s", fit)
+	}
+
+	// Missing trailing parameters are treated as null.
+	if len(*arr)-2 > n {
+		return 0, "", nil, errors.Errorf("ResolveDestination: too many parameters for %s: %s", fit, arr)
+	}
+
+	params = make([]float64, n)
+
+	for i := range params {
+
+		params[i] = math.NaN()
+
+		if i+2 >= len(*arr) {
+			continue
+		}
+
+		o, err := xRefTable.Dereference((*arr)[i+2])
+		if err != nil {
+			return 0, "", nil, err
+		}
+
+		switch o := o.(type) {
+		case nil:
+		case PDFInteger:
+			params[i] = float64(o.Value())
+		case PDFFloat:
+			params[i] = o.Value()
+		default:
+			return 0, "", nil, errors.Errorf("ResolveDestination: invalid parameter for %s: %v", fit, o)
+		}
+	}
+
+	return pageNr, fit, params, nil
+}
+
+// visitActions calls f for every action dict of the action chain rooted at obj following Next.
+func visitActions(xRefTable *XRefTable, obj PDFObject, f func(d PDFDict)) error {
+	return visitActionsOnce(xRefTable, obj, IntSet{}, f)
+}
+
+// visitActionsOnce calls f for every action dict of the action chain rooted at obj following Next
+// skipping indirect actions already recorded in visited.
+// Sharing visited across several chains visits an action referenced by more than one chain only once.
+func visitActionsOnce(xRefTable *XRefTable, obj PDFObject, visited IntSet, f func(d PDFDict)) error {
+
+	var visitAction func(obj PDFObject) error
+
+	visitAction = func(obj PDFObject) error {
+
+		if indRef, ok := obj.(PDFIndirectRef); ok {
+			if visited[indRef.ObjectNumber.Value()] {
+				return nil
+			}
+			visited[indRef.ObjectNumber.Value()] = true
+		}
+
+		o, err := xRefTable.Dereference(obj)
+		if err != nil || o == nil {
+			return err
+		}
+
+		if arr, ok := o.(PDFArray); ok {
+			// Next may be an array of actions.
+			for _, v := range arr {
+				if err = visitAction(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		d, ok := o.(PDFDict)
+		if !ok {
+			return nil
+		}
+
+		f(d)
+
+		return visitAction(d.Dict["Next"])
+	}
+
+	return visitAction(obj)
+}
+
+// annotationDestinations returns all destinations of an annotation reached via Dest or GoTo actions.
+func annotationDestinations(xRefTable *XRefTable, annotDict *PDFDict) ([]PDFObject, error) {
+
+	var dests []PDFObject
+
+	if obj, found := annotDict.Find("Dest"); found && obj != nil {
+		dests = append(dests, obj)
+	}
+
+	err := visitActions(xRefTable, annotDict.Dict["A"], func(d PDFDict) {
+		if s := d.NameEntry("S"); s != nil && *s == "GoTo" {
+			if obj, found := d.Find("D"); found && obj != nil {
+				dests = append(dests, obj)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dests, nil
+}
+
+// CheckAnnotationDestinations returns all destinations of Link and Widget annotations
+// that do not resolve to a page of the document.
+func CheckAnnotationDestinations(xRefTable *XRefTable) ([]DanglingDest, error) {
+
+	var dd []DanglingDest
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if st := annotDict.Subtype(); st == nil || *st != "Link" && *st != "Widget" {
+			return nil
+		}
+
+		dests, err := annotationDestinations(xRefTable, annotDict)
+		if err != nil {
+			return err
+		}
+
+		objNr := 0
+		if indRef != nil {
+			objNr = indRef.ObjectNumber.Value()
+		}
+
+		for _, dest := range dests {
+
+			arr, err := resolveDestination(xRefTable, dest)
+			if err == nil {
+				_, err = destinationPageDict(xRefTable, *arr)
+			}
+
+			if err != nil {
+				dd = append(dd, DanglingDest{PageNr: pageNr, ObjNr: objNr, Dest: dest.String(), Reason: err.Error()})
+			}
+		}
+
+		return nil
+	})
+
+	return dd, err
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"math"
+	"testing"
+)
+
+func linkAnnotForTest(dest PDFObject, action *PDFDict) PDFDict {
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Link"),
+			"Rect":    NewRectangle(10, 10, 100, 30),
+		},
+	}
+
+	if dest != nil {
+		d.Insert("Dest", dest)
+	}
+
+	if action != nil {
+		d.Insert("A", *action)
+	}
+
+	return d
+}
+
+func TestCheckAnnotationDestinations(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	_, page1 := pageForTest(t, xRefTable, 1)
+	_, page2 := pageForTest(t, xRefTable, 2)
+
+	destsIndRef, err := xRefTable.IndRefForNewObject(PDFDict{
+		Dict: map[string]PDFObject{
+			"Names": PDFArray{PDFStringLiteral("chap1"), PDFArray{page1, PDFName("Fit")}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestCheckAnnotationDestinations: %v\n", err)
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestCheckAnnotationDestinations: %v\n", err)
+	}
+
+	rootDict.Insert("Names", PDFDict{Dict: map[string]PDFObject{"Dests": *destsIndRef}})
+
+	// Named destination
+	addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(PDFStringLiteral("chap1"), nil))
+
+	// Explicit destination
+	addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(PDFArray{page2, PDFName("FitH"), PDFInteger(600)}, nil))
+
+	// GoTo action referring to an unknown named destination.
+	action := PDFDict{
+		Dict: map[string]PDFObject{
+			"S": PDFName("GoTo"),
+			"D": PDFStringLiteral("chap2"),
+		},
+	}
+	indRef := addAnnotForTest(t, xRefTable, 2, linkAnnotForTest(nil, &action))
+
+	dd, err := CheckAnnotationDestinations(xRefTable)
+	if err != nil {
+		t.Fatalf("TestCheckAnnotationDestinations: %v\n", err)
+	}
+
+	if len(dd) != 1 {
+		t.Fatalf("TestCheckAnnotationDestinations: expected 1 dangling destination, got %v\n", dd)
+	}
+
+	if dd[0].PageNr != 2 || dd[0].ObjNr != indRef.ObjectNumber.Value() || dd[0].Dest != "(chap2)" {
+		t.Errorf("TestCheckAnnotationDestinations: unexpected dangling destination: %s\n", dd[0])
+	}
+}
+
+func TestResolveDestination(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 3)
+
+	_, page1 := pageForTest(t, xRefTable, 1)
+	_, page2 := pageForTest(t, xRefTable, 2)
+	_, page3 := pageForTest(t, xRefTable, 3)
+
+	destsIndRef, err := xRefTable.IndRefForNewObject(PDFDict{
+		Dict: map[string]PDFObject{
+			"Names": PDFArray{
+				PDFStringLiteral("chap1"), PDFArray{page1, PDFName("Fit")},
+				PDFStringLiteral("chap2"), PDFDict{Dict: map[string]PDFObject{"D": PDFArray{page2, PDFName("FitH"), PDFInteger(500)}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestResolveDestination: %v\n", err)
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestResolveDestination: %v\n", err)
+	}
+
+	rootDict.Insert("Names", PDFDict{Dict: map[string]PDFObject{"Dests": *destsIndRef}})
+	rootDict.Insert("Dests", PDFDict{Dict: map[string]PDFObject{"appendix": PDFArray{page3, PDFName("FitR"), PDFInteger(0), PDFInteger(0), PDFFloat(200.5), PDFInteger(300)}}})
+
+	for _, tt := range []struct {
+		dest   PDFObject
+		pageNr int
+		fit    string
+		params []float64
+	}{
+		{PDFStringLiteral("chap1"), 1, "Fit", []float64{}},
+		{PDFStringLiteral("chap2"), 2, "FitH", []float64{500}},
+		{PDFName("appendix"), 3, "FitR", []float64{0, 0, 200.5, 300}},
+		{PDFArray{page2, PDFName("XYZ"), nil, PDFInteger(400), PDFFloat(1.5)}, 2, "XYZ", []float64{math.NaN(), 400, 1.5}},
+		{PDFArray{PDFInteger(2), PDFName("FitBV")}, 3, "FitBV", []float64{math.NaN()}},
+	} {
+
+		pageNr, fit, params, err := ResolveDestination(xRefTable, tt.dest)
+		if err != nil {
+			t.Fatalf("TestResolveDestination(%s): %v\n", tt.dest, err)
+		}
+
+		if pageNr != tt.pageNr || fit != tt.fit || len(params) != len(tt.params) {
+			t.Fatalf("TestResolveDestination(%s): want %d %s %v, got %d %s %v\n", tt.dest, tt.pageNr, tt.fit, tt.params, pageNr, fit, params)
+		}
+
+		for i, f := range tt.params {
+			if f != params[i] && !(math.IsNaN(f) && math.IsNaN(params[i])) {
+				t.Fatalf("TestResolveDestination(%s): want %v, got %v\n", tt.dest, tt.params, params)
+			}
+		}
+	}
+
+	for _, dest := range []PDFObject{
+		PDFStringLiteral("chap3"),
+		PDFArray{PDFInteger(3), PDFName("Fit")},
+		PDFArray{*destsIndRef, PDFName("Fit")},
+		PDFArray{page1, PDFName("FitX")},
+		PDFArray{page1, PDFName("FitH"), PDFInteger(1), PDFInteger(2)},
+	} {
+		if _, _, _, err := ResolveDestination(xRefTable, dest); err == nil {
+			t.Fatalf("TestResolveDestination(%s): expected error\n", dest)
+		}
+	}
+}
+
+func TestValidateDestinationPageIndex(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	_, page2 := pageForTest(t, xRefTable, 2)
+
+	// Set during validation of the page tree.
+	xRefTable.PageCount = 2
+
+	goTo := func(s string, dest PDFArray) *PDFDict {
+		d := PDFDict{Dict: map[string]PDFObject{"S": PDFName(s), "D": dest}}
+		if s == "GoToR" {
+			d.Insert("F", PDFStringLiteral("other.pdf"))
+		}
+		return &d
+	}
+
+	for _, d := range []PDFDict{
+		linkAnnotForTest(PDFArray{page2, PDFName("Fit")}, nil),
+		linkAnnotForTest(PDFArray{PDFInteger(1), PDFName("Fit")}, nil),
+		linkAnnotForTest(nil, goTo("GoTo", PDFArray{PDFInteger(0), PDFName("Fit")})),
+		// The page index refers to the remote document.
+		linkAnnotForTest(nil, goTo("GoToR", PDFArray{PDFInteger(5), PDFName("Fit")})),
+	} {
+		doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+	}
+
+	for _, d := range []PDFDict{
+		linkAnnotForTest(PDFArray{PDFInteger(2), PDFName("Fit")}, nil),
+		linkAnnotForTest(PDFArray{PDFInteger(-1), PDFName("Fit")}, nil),
+		linkAnnotForTest(nil, goTo("GoTo", PDFArray{PDFInteger(5), PDFName("FitH"), PDFInteger(600)})),
+	} {
+		doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+		doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+	}
+
+	if n := len(xRefTable.ValidationWarnings()); n != 3 {
+		t.Errorf("TestValidateDestinationPageIndex: expected 3 warnings, got %d\n", n)
+	}
+}
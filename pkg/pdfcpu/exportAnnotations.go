@@ -0,0 +1,243 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Functions for exporting annotations.
+
+// decodedTextString returns the decoded text string of obj or "" if obj is missing or corrupt.
+func decodedTextString(xRefTable *XRefTable, obj PDFObject) string {
+
+	o, err := xRefTable.Dereference(obj)
+	if err != nil || o == nil {
+		return ""
+	}
+
+	runes, err := textStringRunes(o)
+	if err != nil {
+		return ""
+	}
+
+	return string(runes)
+}
+
+// colorString returns the color components of obj separated by blanks.
+func colorString(xRefTable *XRefTable, obj PDFObject) string {
+
+	f, err := numbers(xRefTable, obj)
+	if err != nil {
+		return ""
+	}
+
+	ss := make([]string, len(f))
+	for i, c := range f {
+		ss[i] = strconv.FormatFloat(c, 'f', -1, 64)
+	}
+
+	return strings.Join(ss, " ")
+}
+
+// AnnotationsToCSV writes a CSV record for every annotation of the document to w.
+// Columns: page, objNr, subtype, author, created, modified, color, contents.
+// objNr is empty for annotation dicts embedded directly into a page's Annots array.
+// Records are terminated by CRLF as required by RFC 4180.
+func AnnotationsToCSV(xRefTable *XRefTable, w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+
+	err := cw.Write([]string{"page", "objNr", "subtype", "author", "created", "modified", "color", "contents"})
+	if err != nil {
+		return err
+	}
+
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		var objNr, subtype string
+
+		if indRef != nil {
+			objNr = strconv.Itoa(indRef.ObjectNumber.Value())
+		}
+
+		if st := annotDict.Subtype(); st != nil {
+			subtype = *st
+		}
+
+		return cw.Write([]string{
+			strconv.Itoa(pageNr),
+			objNr,
+			subtype,
+			decodedTextString(xRefTable, annotDict.Dict["T"]),
+			decodedTextString(xRefTable, annotDict.Dict["CreationDate"]),
+			decodedTextString(xRefTable, annotDict.Dict["M"]),
+			colorString(xRefTable, annotDict.Dict["C"]),
+			decodedTextString(xRefTable, annotDict.Dict["Contents"]),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// positions returns the coordinate pairs of f.
+func positions(f []float64) [][]float64 {
+
+	pp := make([][]float64, 0, len(f)/2)
+	for i := 0; i+1 < len(f); i += 2 {
+		pp = append(pp, []float64{f[i], f[i+1]})
+	}
+
+	return pp
+}
+
+// closedRing returns the linear ring for the polygon vertices f.
+func closedRing(f []float64) [][]float64 {
+
+	pp := positions(f)
+	if len(pp) > 0 && (pp[0][0] != pp[len(pp)-1][0] || pp[0][1] != pp[len(pp)-1][1]) {
+		pp = append(pp, pp[0])
+	}
+
+	return pp
+}
+
+// annotationGeometry returns the GeoJSON geometry of an annotation in page coordinates
+// or nil for annotations without a GeoJSON representation.
+func annotationGeometry(xRefTable *XRefTable, annotDict *PDFDict) (*geoJSONGeometry, error) {
+
+	st := annotDict.Subtype()
+	if st == nil {
+		return nil, nil
+	}
+
+	entryName := map[string]string{
+		"Text":     "Rect",
+		"Square":   "Rect",
+		"Line":     "L",
+		"PolyLine": "Vertices",
+		"Polygon":  "Vertices",
+	}[*st]
+
+	if entryName == "" {
+		return nil, nil
+	}
+
+	f, err := numbers(xRefTable, annotDict.Dict[entryName])
+	if err != nil {
+		return nil, err
+	}
+
+	if entryName == "Rect" {
+		if len(f) != 4 {
+			return nil, errors.Errorf("annotationGeometry: %s: corrupt Rect", *st)
+		}
+		llx, lly, urx, ury := math.Min(f[0], f[2]), math.Min(f[1], f[3]), math.Max(f[0], f[2]), math.Max(f[1], f[3])
+		if *st == "Text" {
+			return &geoJSONGeometry{"Point", []float64{(llx + urx) / 2, (lly + ury) / 2}}, nil
+		}
+		f = []float64{llx, lly, urx, lly, urx, ury, llx, ury}
+	}
+
+	if len(f) < 4 || len(f)%2 != 0 {
+		return nil, errors.Errorf("annotationGeometry: %s: corrupt %s", *st, entryName)
+	}
+
+	if *st == "Line" || *st == "PolyLine" {
+		return &geoJSONGeometry{"LineString", positions(f)}, nil
+	}
+
+	if len(f) < 6 {
+		return nil, errors.Errorf("annotationGeometry: %s: corrupt %s", *st, entryName)
+	}
+
+	return &geoJSONGeometry{"Polygon", [][][]float64{closedRing(f)}}, nil
+}
+
+// ExportAnnotationsGeoJSON writes the geometry of the annotations of page pageNr as GeoJSON FeatureCollection to w.
+// Text annotations map to a Point at the center of their Rect, Line and PolyLine annotations to a LineString
+// and Polygon and Square annotations to a Polygon, all in page coordinates.
+// Feature properties are subtype, color (the components of C) and contents.
+// All other annotations are skipped.
+func ExportAnnotationsGeoJSON(xRefTable *XRefTable, pageNr int, w io.Writer) error {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return err
+	}
+
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	err = visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		g, err := annotationGeometry(xRefTable, annotDict)
+		if err != nil || g == nil {
+			return err
+		}
+
+		color, err := numbers(xRefTable, annotDict.Dict["C"])
+		if err != nil || color == nil {
+			color = []float64{}
+		}
+
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: *g,
+			Properties: map[string]interface{}{
+				"subtype":  *annotDict.Subtype(),
+				"color":    color,
+				"contents": decodedTextString(xRefTable, annotDict.Dict["Contents"]),
+			},
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(fc)
+}
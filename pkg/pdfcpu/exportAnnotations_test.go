@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestAnnotationsToCSV(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("T", PDFStringLiteral("Reviewer"))
+	d.Insert("CreationDate", PDFStringLiteral("D:20180101120000Z"))
+	d.Insert("M", PDFStringLiteral("D:20180102120000Z"))
+	d.Update("C", NewNumberArray(1, 0.5, 0))
+	d.Update("Contents", PDFStringLiteral("Move left, \"a bit\""))
+	addAnnotForTest(t, xRefTable, 1, d)
+
+	// UTF-16BE "Zoë" with a line break.
+	d = squareAnnotForTest(NewRectangle(20, 20, 60, 60))
+	d.Insert("T", PDFHexLiteral("feff005a006f00eb"))
+	d.Update("Contents", PDFStringLiteral("first line\\nsecond line"))
+	addAnnotForTest(t, xRefTable, 2, d)
+
+	var buf bytes.Buffer
+
+	if err := AnnotationsToCSV(xRefTable, &buf); err != nil {
+		t.Fatalf("TestAnnotationsToCSV: %v\n", err)
+	}
+
+	want := "page,objNr,subtype,author,created,modified,color,contents\r\n" +
+		"1,%d,Square,Reviewer,D:20180101120000Z,D:20180102120000Z,1 0.5 0,\"Move left, \"\"a bit\"\"\"\r\n" +
+		"2,%d,Square,Zoë,,,1 0 0,\"first line\r\nsecond line\"\r\n"
+
+	objNrs := []int{}
+	for pageNr := 1; pageNr <= 2; pageNr++ {
+		pageDict, _ := pageForTest(t, xRefTable, pageNr)
+		indRef := (*pageDict.PDFArrayEntry("Annots"))[0].(PDFIndirectRef)
+		objNrs = append(objNrs, indRef.ObjectNumber.Value())
+	}
+
+	want = fmt.Sprintf(want, objNrs[0], objNrs[1])
+
+	if got := buf.String(); got != want {
+		t.Errorf("TestAnnotationsToCSV:\ngot:\n%s\nwant:\n%s\n", got, want)
+	}
+}
+
+func TestExportAnnotationsGeoJSON(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	polygon := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Polygon"),
+			"Rect":     NewRectangle(10, 10, 100, 100),
+			"Vertices": NewNumberArray(10, 10, 100, 10, 55, 100),
+			"C":        NewNumberArray(0, 0, 1),
+			"Contents": PDFStringLiteral("Room 1"),
+		},
+	}
+	addAnnotForTest(t, xRefTable, 1, polygon)
+
+	// Links have no GeoJSON representation.
+	addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(nil, nil))
+
+	var buf bytes.Buffer
+
+	if err := ExportAnnotationsGeoJSON(xRefTable, 1, &buf); err != nil {
+		t.Fatalf("TestExportAnnotationsGeoJSON: %v\n", err)
+	}
+
+	want := `{"type":"FeatureCollection","features":[{"type":"Feature",` +
+		`"geometry":{"type":"Polygon","coordinates":[[[10,10],[100,10],[55,100],[10,10]]]},` +
+		`"properties":{"color":[0,0,1],"contents":"Room 1","subtype":"Polygon"}}]}` + "\n"
+
+	if got := buf.String(); got != want {
+		t.Errorf("TestExportAnnotationsGeoJSON:\ngot:\n%s\nwant:\n%s\n", got, want)
+	}
+
+	if err := ExportAnnotationsGeoJSON(xRefTable, 2, &buf); err == nil {
+		t.Errorf("TestExportAnnotationsGeoJSON: expected error for missing page\n")
+	}
+}
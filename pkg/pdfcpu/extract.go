@@ -17,6 +17,9 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hhrutter/pdfcpu/pkg/filter"
@@ -191,3 +194,153 @@ func ExtractContentData(ctx *PDFContext, objNr int) (data []byte, err error) {
 // 	// TODO
 // 	return nil, nil
 // }
+
+// formImages collects the image XObjects used by a form XObject including nested forms.
+func formImages(xRefTable *XRefTable, sd *PDFStreamDict, images map[int]*PDFStreamDict, visited IntSet) error {
+
+	obj, found := sd.Find("Resources")
+	if !found || obj == nil {
+		return nil
+	}
+
+	resDict, err := xRefTable.DereferenceDict(obj)
+	if err != nil || resDict == nil {
+		return err
+	}
+
+	obj, found = resDict.Find("XObject")
+	if !found || obj == nil {
+		return nil
+	}
+
+	xObjDict, err := xRefTable.DereferenceDict(obj)
+	if err != nil || xObjDict == nil {
+		return err
+	}
+
+	for _, v := range xObjDict.Dict {
+
+		indRef, ok := v.(PDFIndirectRef)
+		if !ok {
+			continue
+		}
+
+		objNr := indRef.ObjectNumber.Value()
+		if visited[objNr] {
+			continue
+		}
+		visited[objNr] = true
+
+		xObj, err := xRefTable.DereferenceStreamDict(indRef)
+		if err != nil {
+			return err
+		}
+		if xObj == nil || xObj.Subtype() == nil {
+			continue
+		}
+
+		switch *xObj.Subtype() {
+
+		case "Image":
+			images[objNr] = xObj
+
+		case "Form":
+			err = formImages(xRefTable, xObj, images, visited)
+			if err != nil {
+				return err
+			}
+
+		}
+	}
+
+	return nil
+}
+
+// writeAnnotationImage writes an image XObject to disk.
+// Flate encoded and unfiltered images get decoded, DCT and JPX encoded images are passed through.
+func writeAnnotationImage(xRefTable *XRefTable, filename string, sd *PDFStreamDict, objNr int) (string, error) {
+
+	fpl := sd.FilterPipeline
+
+	if fpl == nil {
+		sd.Content = sd.Raw
+		return writeFlateEncodedImage(xRefTable, filename, sd, objNr)
+	}
+
+	// Ignore filter chains with length > 1
+	if len(fpl) > 1 {
+		log.Info.Printf("writeAnnotationImage: ignore obj# %d, more than 1 filter\n", objNr)
+		return "", nil
+	}
+
+	switch fpl[0].Name {
+
+	case filter.Flate, filter.DCT, filter.JPX:
+		return WriteImage(xRefTable, filename, sd, objNr)
+
+	}
+
+	log.Info.Printf("writeAnnotationImage: ignore obj# %d, unsupported filter %s\n", objNr, fpl[0].Name)
+
+	return "", nil
+}
+
+// ExtractAnnotationImages writes all images used within annotation appearance streams into outDir
+// and returns the file names written.
+func ExtractAnnotationImages(xRefTable *XRefTable, outDir string) ([]string, error) {
+
+	var fileNames []string
+
+	visited := IntSet{}
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		images := map[int]*PDFStreamDict{}
+
+		err := visitAppearanceStreams(xRefTable, annotDict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+			if indRef != nil {
+				objNr := indRef.ObjectNumber.Value()
+				if visited[objNr] {
+					return nil
+				}
+				visited[objNr] = true
+			}
+			return formImages(xRefTable, sd, images, visited)
+		})
+		if err != nil {
+			return err
+		}
+
+		var objNrs []int
+		for objNr := range images {
+			objNrs = append(objNrs, objNr)
+		}
+		sort.Ints(objNrs)
+
+		for _, objNr := range objNrs {
+
+			filename := filepath.Join(outDir, fmt.Sprintf("annot_%d_%d", pageNr, objNr))
+
+			fn, err := writeAnnotationImage(xRefTable, filename, images[objNr], objNr)
+			if err != nil {
+				if err == ErrUnsupportedColorSpace || err == ErrUnsupported16BPC {
+					log.Info.Printf("ExtractAnnotationImages: ignore obj# %d: %v\n", objNr, err)
+					continue
+				}
+				return err
+			}
+
+			if fn != "" {
+				fileNames = append(fileNames, fn)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fileNames, nil
+}
@@ -0,0 +1,611 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Forms Data Format, see 12.7.8
+
+var reFDFObject = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parseFDFStream parses the stream data following the stream dict d.
+// s starts right after the keyword "stream". Returns the stream dict and the remainder of s.
+func parseFDFStream(d PDFDict, s string) (*PDFStreamDict, string, error) {
+
+	// The keyword stream is followed by CRLF or LF.
+	if strings.HasPrefix(s, "\r\n") {
+		s = s[2:]
+	} else if strings.HasPrefix(s, "\n") {
+		s = s[1:]
+	}
+
+	var l int
+
+	if i := d.IntEntry("Length"); i != nil && *i <= len(s) {
+		l = *i
+	} else {
+		// Length is missing or an indirect object.
+		l = strings.Index(s, "endstream")
+		if l < 0 {
+			return nil, "", errors.New("parseFDFStream: missing endstream")
+		}
+		l = len(strings.TrimRight(s[:l], "\r\n"))
+	}
+
+	streamLength := int64(l)
+	sd := NewPDFStreamDict(d, 0, &streamLength, nil, nil)
+	sd.Raw = []byte(s[:l])
+
+	i := strings.Index(s[l:], "endstream")
+	if i < 0 {
+		return nil, "", errors.New("parseFDFStream: missing endstream")
+	}
+
+	return &sd, s[l+i+len("endstream"):], nil
+}
+
+// parseFDF parses the body and trailer of an FDF file.
+// Returns a table of all objects along with the FDF dict of the catalog.
+func parseFDF(b []byte) (*XRefTable, *PDFDict, error) {
+
+	s := string(b)
+
+	if !strings.HasPrefix(s, "%FDF-") {
+		return nil, nil, errors.New("parseFDF: missing FDF header")
+	}
+
+	xRefTable := newXRefTable(ValidationRelaxed)
+
+	size := 1
+	xRefTable.Size = &size
+
+	for {
+		m := reFDFObject.FindStringSubmatchIndex(s)
+		if m == nil {
+			break
+		}
+
+		objNr, _ := strconv.Atoi(s[m[2]:m[3]])
+		genNr, _ := strconv.Atoi(s[m[4]:m[5]])
+
+		s = s[m[1]:]
+
+		obj, err := parseObject(&s)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "parseFDF: obj#%d", objNr)
+		}
+
+		s, _ = trimLeftSpace(s)
+
+		if d, ok := obj.(PDFDict); ok && strings.HasPrefix(s, "stream") {
+			var sd *PDFStreamDict
+			if sd, s, err = parseFDFStream(d, s[len("stream"):]); err != nil {
+				return nil, nil, errors.Wrapf(err, "parseFDF: obj#%d", objNr)
+			}
+			obj = *sd
+		}
+
+		i := strings.Index(s, "endobj")
+		if i < 0 {
+			return nil, nil, errors.Errorf("parseFDF: obj#%d missing endobj", objNr)
+		}
+		s = s[i+len("endobj"):]
+
+		xRefTable.Table[objNr] = &XRefTableEntry{Generation: &genNr, Object: obj}
+
+		if objNr >= size {
+			size = objNr + 1
+		}
+	}
+
+	// Streams may refer to their filters indirectly.
+	ctx := &PDFContext{XRefTable: xRefTable}
+
+	for objNr, entry := range xRefTable.Table {
+
+		sd, ok := entry.Object.(PDFStreamDict)
+		if !ok {
+			continue
+		}
+
+		fpl, err := pdfFilterPipeline(ctx, sd.PDFDict)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "parseFDF: obj#%d", objNr)
+		}
+
+		sd.FilterPipeline = fpl
+		entry.Object = sd
+	}
+
+	i := strings.LastIndex(s, "trailer")
+	if i < 0 {
+		return nil, nil, errors.New("parseFDF: missing trailer")
+	}
+	s = s[i+len("trailer"):]
+
+	obj, err := parseObject(&s)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parseFDF: corrupt trailer")
+	}
+
+	trailer, ok := obj.(PDFDict)
+	if !ok {
+		return nil, nil, errors.New("parseFDF: corrupt trailer")
+	}
+
+	rootDict, err := xRefTable.DereferenceDict(trailer.Dict["Root"])
+	if err != nil || rootDict == nil {
+		return nil, nil, errors.New("parseFDF: missing catalog")
+	}
+
+	fdfDict, err := xRefTable.DereferenceDict(rootDict.Dict["FDF"])
+	if err != nil || fdfDict == nil {
+		return nil, nil, errors.New("parseFDF: missing FDF dict")
+	}
+
+	return xRefTable, fdfDict, nil
+}
+
+// objectCopier copies objects between xref tables preserving the structure of indirect references.
+type objectCopier struct {
+	from, to *XRefTable
+	indRefs  map[int]PDFIndirectRef // object numbers in from mapped to indirect references in to
+}
+
+func (c *objectCopier) copyObject(obj PDFObject) (PDFObject, error) {
+
+	switch o := obj.(type) {
+
+	case PDFIndirectRef:
+		objNr := o.ObjectNumber.Value()
+		if indRef, found := c.indRefs[objNr]; found {
+			return indRef, nil
+		}
+
+		v, err := c.from.Dereference(o)
+		if err != nil {
+			return nil, err
+		}
+
+		// Register the copy before copying its value to break reference cycles.
+		indRef, err := c.to.IndRefForNewObject(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.indRefs[objNr] = *indRef
+
+		v, err = c.copyObject(v)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, _ := c.to.FindTableEntryForIndRef(indRef)
+		entry.Object = v
+
+		return *indRef, nil
+
+	case PDFDict:
+		d := NewPDFDict()
+		for k, v := range o.Dict {
+			v, err := c.copyObject(v)
+			if err != nil {
+				return nil, err
+			}
+			d.Insert(k, v)
+		}
+		return d, nil
+
+	case PDFStreamDict:
+		d, err := c.copyObject(o.PDFDict)
+		if err != nil {
+			return nil, err
+		}
+		sd := o
+		sd.PDFDict = d.(PDFDict)
+		return sd, nil
+
+	case PDFArray:
+		a := make(PDFArray, len(o))
+		for i, v := range o {
+			v, err := c.copyObject(v)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = v
+		}
+		return a, nil
+	}
+
+	return obj, nil
+}
+
+// deleteCopies removes all copied objects from the target table.
+func (c *objectCopier) deleteCopies() {
+	for _, indRef := range c.indRefs {
+		c.to.DeleteObject(indRef.ObjectNumber.Value())
+	}
+}
+
+// ImportAnnotationsFromFDF adds all annotations of the FDF file read from r to the corresponding pages.
+// FDF identifies pages by their zero based page index.
+func ImportAnnotationsFromFDF(xRefTable *XRefTable, r io.Reader) error {
+
+	_, err := ImportFDF(xRefTable, r)
+
+	return err
+}
+
+// ImportFDF adds all annotations of the FDF file read from r to the pages identified by their zero based Page index
+// and returns the number of imported annotations. All entries including T, Contents and CreationDate are taken over,
+// P gets set to the target page. Each annotation is validated before any page gets modified,
+// so either all or none of the annotations are imported. Errors identify the failing entry of the FDF Annots array.
+func ImportFDF(xRefTable *XRefTable, r io.Reader) (int, error) {
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	fdfTable, fdfDict, err := parseFDF(b)
+	if err != nil {
+		return 0, err
+	}
+
+	annots, err := fdfTable.DereferenceArray(fdfDict.Dict["Annots"])
+	if err != nil || annots == nil {
+		return 0, errors.New("ImportFDF: missing Annots")
+	}
+
+	count, err := pageCount(xRefTable)
+	if err != nil {
+		return 0, err
+	}
+
+	c := &objectCopier{from: fdfTable, to: xRefTable, indRefs: map[int]PDFIndirectRef{}}
+
+	type annot struct {
+		pageNr int
+		indRef PDFIndirectRef
+	}
+
+	var aa []annot
+
+	for i, v := range *annots {
+
+		d, err := fdfTable.DereferenceDict(v)
+		if err != nil || d == nil {
+			c.deleteCopies()
+			return 0, errors.Errorf("ImportFDF: Annots[%d]: corrupt annotation", i)
+		}
+
+		page := d.IntEntry("Page")
+		if page == nil {
+			c.deleteCopies()
+			return 0, errors.Errorf("ImportFDF: Annots[%d]: missing Page", i)
+		}
+
+		if *page < 0 || *page >= count {
+			c.deleteCopies()
+			return 0, errors.Errorf("ImportFDF: Annots[%d]: Page %d out of range, page count: %d", i, *page, count)
+		}
+
+		if _, ok := v.(PDFIndirectRef); !ok {
+			// Turn direct annotation dicts into indirect objects.
+			indRef, err := fdfTable.IndRefForNewObject(*d)
+			if err != nil {
+				c.deleteCopies()
+				return 0, err
+			}
+			v = *indRef
+		}
+
+		obj, err := c.copyObject(v)
+		if err != nil {
+			c.deleteCopies()
+			return 0, err
+		}
+
+		aa = append(aa, annot{pageNr: *page + 1, indRef: obj.(PDFIndirectRef)})
+	}
+
+	// Validate all annotations before touching any page.
+	pageDicts := make([]*PDFDict, len(aa))
+
+	for i, a := range aa {
+
+		pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, a.pageNr)
+		if err == nil {
+			d, _ := xRefTable.DereferenceDict(a.indRef)
+			d.Delete("Page")
+			d.Update("P", *pageIndRef)
+			_, err = validateAnnotationDict(xRefTable, d)
+		}
+
+		if err != nil {
+			c.deleteCopies()
+			return 0, errors.Wrapf(err, "ImportFDF: Annots[%d]", i)
+		}
+
+		pageDicts[i] = pageDict
+	}
+
+	for i, a := range aa {
+		if err = appendAnnotation(xRefTable, pageDicts[i], a.indRef); err != nil {
+			return i, err
+		}
+	}
+
+	return len(aa), nil
+}
+
+// fdfExcludedAnnotTypes lists the annotation types not allowed in the Annots array of an FDF dict, see Table 243.
+var fdfExcludedAnnotTypes = []string{"Link", "Movie", "Widget", "PrinterMark", "Screen", "TrapNet"}
+
+// fdfField is a node of the field hierarchy of an FDF file.
+type fdfField struct {
+	name  string
+	value PDFObject
+	kids  []*fdfField
+}
+
+func (f *fdfField) kid(name string) *fdfField {
+
+	for _, k := range f.kids {
+		if k.name == name {
+			return k
+		}
+	}
+
+	k := &fdfField{name: name}
+	f.kids = append(f.kids, k)
+
+	return k
+}
+
+// fields returns the FDF field dicts for the kids of f, see Table 246.
+func (f *fdfField) fields() (PDFArray, error) {
+
+	arr := PDFArray{}
+
+	for _, k := range f.kids {
+
+		t, err := textStringObject(k.name)
+		if err != nil {
+			return nil, err
+		}
+
+		d := NewPDFDict()
+		d.Insert("T", t)
+
+		if k.value != nil {
+			d.Insert("V", k.value)
+		}
+
+		if len(k.kids) > 0 {
+			kids, err := k.fields()
+			if err != nil {
+				return nil, err
+			}
+			d.Insert("Kids", kids)
+		}
+
+		arr = append(arr, d)
+	}
+
+	return arr, nil
+}
+
+// fdfAnnotation returns a copy of annotDict suitable for FDF where Page replaces P.
+// References to annotations not contained in exported get dropped.
+func fdfAnnotation(c *objectCopier, annotDict *PDFDict, pageNr int, exported IntSet) (PDFObject, error) {
+
+	d := NewPDFDict()
+
+	for k, v := range annotDict.Dict {
+
+		if k == "P" {
+			continue
+		}
+
+		if k == "Popup" || k == "IRT" || k == "Parent" {
+			if indRef, ok := v.(PDFIndirectRef); ok && !exported[indRef.ObjectNumber.Value()] {
+				continue
+			}
+		}
+
+		d.Insert(k, v)
+	}
+
+	d.Insert("Page", PDFInteger(pageNr-1))
+
+	return c.copyObject(d)
+}
+
+// ExportFDF writes all annotations of the document along with the values of all form fields as an FDF file to w, see 12.7.8
+// Link, Movie, Widget, PrinterMark, Screen and TrapNet annotations are not allowed in FDF and get skipped.
+// Pages are identified by their zero based page index.
+// Rect is kept in default user space which is independent of the page rotation.
+// Field values are exported for all fields having widget annotations using the partial field names of the field hierarchy.
+func ExportFDF(xRefTable *XRefTable, w io.Writer) error {
+
+	size := 1
+	fdfTable := newXRefTable(ValidationRelaxed)
+	fdfTable.Size = &size
+
+	rootIndRef, err := fdfTable.IndRefForNewObject(nil)
+	if err != nil {
+		return err
+	}
+
+	c := &objectCopier{from: xRefTable, to: fdfTable, indRefs: map[int]PDFIndirectRef{}}
+
+	type annot struct {
+		pageNr int
+		indRef *PDFIndirectRef
+		dict   *PDFDict
+	}
+
+	var (
+		aa      []annot
+		widgets []annot
+	)
+
+	exported := IntSet{}
+
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		a := annot{pageNr, indRef, annotDict}
+
+		st := annotDict.Subtype()
+		if st != nil && *st == "Widget" {
+			widgets = append(widgets, a)
+		}
+
+		if st == nil || memberOf(*st, fdfExcludedAnnotTypes) {
+			return nil
+		}
+
+		if indRef != nil {
+			exported[indRef.ObjectNumber.Value()] = true
+		}
+
+		aa = append(aa, a)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Register all annotations up front in order to preserve references between them.
+	for _, a := range aa {
+		if a.indRef == nil {
+			continue
+		}
+		indRef, err := fdfTable.IndRefForNewObject(nil)
+		if err != nil {
+			return err
+		}
+		c.indRefs[a.indRef.ObjectNumber.Value()] = *indRef
+	}
+
+	annots := PDFArray{}
+
+	for _, a := range aa {
+
+		obj, err := fdfAnnotation(c, a.dict, a.pageNr, exported)
+		if err != nil {
+			return err
+		}
+
+		if a.indRef == nil {
+			indRef, err := fdfTable.IndRefForNewObject(obj)
+			if err != nil {
+				return err
+			}
+			annots = append(annots, *indRef)
+			continue
+		}
+
+		indRef := c.indRefs[a.indRef.ObjectNumber.Value()]
+		entry, _ := fdfTable.FindTableEntryForIndRef(&indRef)
+		entry.Object = obj
+
+		annots = append(annots, indRef)
+	}
+
+	root := &fdfField{}
+	seen := map[string]bool{}
+
+	for _, a := range widgets {
+
+		objNr := 0
+		if a.indRef != nil {
+			objNr = a.indRef.ObjectNumber.Value()
+		}
+
+		_, names, v, err := widgetField(xRefTable, objNr, a.dict)
+		if err != nil {
+			return errors.Wrap(err, "ExportFDF")
+		}
+
+		name := strings.Join(names, ".")
+		if len(names) == 0 || v == nil || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		f := root
+		for _, n := range names {
+			f = f.kid(n)
+		}
+
+		if f.value, err = c.copyObject(v); err != nil {
+			return err
+		}
+	}
+
+	fdfDict := NewPDFDict()
+
+	if len(annots) > 0 {
+		fdfDict.Insert("Annots", annots)
+	}
+
+	if len(root.kids) > 0 {
+		fields, err := root.fields()
+		if err != nil {
+			return err
+		}
+		fdfDict.Insert("Fields", fields)
+	}
+
+	entry, _ := fdfTable.FindTableEntryForIndRef(rootIndRef)
+	entry.Object = PDFDict{Dict: map[string]PDFObject{"FDF": fdfDict}}
+
+	objNrs := make([]int, 0, len(fdfTable.Table))
+	for objNr := range fdfTable.Table {
+		objNrs = append(objNrs, objNr)
+	}
+	sort.Ints(objNrs)
+
+	var b bytes.Buffer
+
+	b.WriteString("%FDF-1.2\n%\xE2\xE3\xCF\xD3\n")
+
+	for _, objNr := range objNrs {
+		if err := writeIncrementalObject(&b, objNr, fdfTable.Table[objNr]); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(&b, "trailer\n<< /Root %s >>\n%%%%EOF\n", rootIndRef.PDFString())
+
+	_, err = w.Write(b.Bytes())
+
+	return err
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testFDF = `%FDF-1.2
+%âãÏÓ
+1 0 obj
+<< /FDF << /Annots [2 0 R 3 0 R] >> >>
+endobj
+2 0 obj
+<< /Type /Annot /Subtype /Square /Page 0 /Rect [10 10 60 60] /C [1 0 0] /T (Reviewer)
+   /Contents (Check margin) /AP << /N 4 0 R >> >>
+endobj
+3 0 obj
+<< /Type /Annot /Subtype /Text /Page 1 /Rect [100 100 120 120] /Contents (Typo) /Name /Comment >>
+endobj
+4 0 obj
+<< /Type /XObject /Subtype /Form /BBox [0 0 50 50] /Length 15 >>
+stream
+0 0 m 50 50 l S
+endstream
+endobj
+trailer
+<< /Root 1 0 R >>
+%%EOF
+`
+
+func TestImportAnnotationsFromFDF(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	if err := ImportAnnotationsFromFDF(xRefTable, strings.NewReader(testFDF)); err != nil {
+		t.Fatalf("TestImportAnnotationsFromFDF: %v\n", err)
+	}
+
+	for pageNr, subtype := range map[int]string{1: "Square", 2: "Text"} {
+
+		pageDict, pageIndRef := pageForTest(t, xRefTable, pageNr)
+
+		arr := pageDict.PDFArrayEntry("Annots")
+		if arr == nil || len(*arr) != 1 {
+			t.Fatalf("TestImportAnnotationsFromFDF: page %d: expected 1 annotation\n", pageNr)
+		}
+
+		d, err := xRefTable.DereferenceDict((*arr)[0])
+		if err != nil {
+			t.Fatalf("TestImportAnnotationsFromFDF: %v\n", err)
+		}
+
+		if *d.Subtype() != subtype {
+			t.Errorf("TestImportAnnotationsFromFDF: page %d: got %s, want %s\n", pageNr, *d.Subtype(), subtype)
+		}
+
+		if _, found := d.Find("Page"); found {
+			t.Errorf("TestImportAnnotationsFromFDF: page %d: Page not removed\n", pageNr)
+		}
+
+		if p := d.IndirectRefEntry("P"); p == nil || *p != pageIndRef {
+			t.Errorf("TestImportAnnotationsFromFDF: page %d: P not set\n", pageNr)
+		}
+
+		if subtype != "Square" {
+			continue
+		}
+
+		var content []byte
+		err = visitAppearanceStreams(xRefTable, d, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+			content, err = streamContent(sd)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("TestImportAnnotationsFromFDF: %v\n", err)
+		}
+		if string(content) != "0 0 m 50 50 l S" {
+			t.Errorf("TestImportAnnotationsFromFDF: unexpected appearance: %q\n", content)
+		}
+	}
+
+	// Page 3 does not exist.
+	fdf := strings.Replace(testFDF, "/Page 1", "/Page 2", 1)
+	if err := ImportAnnotationsFromFDF(xRefTable, strings.NewReader(fdf)); err == nil {
+		t.Errorf("TestImportAnnotationsFromFDF: expected error for invalid page\n")
+	}
+}
+
+func TestImportAnnotationsFromFDFDirectAnnot(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	// A direct annotation dict needs a new object number in the FDF table before it can be copied.
+	fdf := strings.Replace(testFDF, "[2 0 R 3 0 R]", "[<< /Type /Annot /Subtype /Text /Page 0 /Rect [0 0 20 20] /Contents (Note) >>]", 1)
+
+	if err := ImportAnnotationsFromFDF(xRefTable, strings.NewReader(fdf)); err != nil {
+		t.Fatalf("TestImportAnnotationsFromFDFDirectAnnot: %v\n", err)
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	arr := pageDict.PDFArrayEntry("Annots")
+	if arr == nil || len(*arr) != 1 {
+		t.Fatalf("TestImportAnnotationsFromFDFDirectAnnot: expected 1 annotation, got %v\n", pageDict.Dict["Annots"])
+	}
+
+	if _, ok := (*arr)[0].(PDFIndirectRef); !ok {
+		t.Errorf("TestImportAnnotationsFromFDFDirectAnnot: expected indirect annotation, got %v\n", (*arr)[0])
+	}
+}
+
+func TestImportFDF(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	// A direct annotation dict in addition to the indirect ones.
+	fdf := strings.Replace(testFDF, "[2 0 R 3 0 R]", "[2 0 R 3 0 R << /Type /Annot /Subtype /Text /Page 0 /Rect [0 0 20 20] /T (Ed) /Contents (Note) >>]", 1)
+
+	n, err := ImportFDF(xRefTable, strings.NewReader(fdf))
+	if err != nil {
+		t.Fatalf("TestImportFDF: %v\n", err)
+	}
+
+	if n != 3 {
+		t.Fatalf("TestImportFDF: want 3 annotations, got %d\n", n)
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	arr := pageDict.PDFArrayEntry("Annots")
+	if arr == nil || len(*arr) != 2 {
+		t.Fatalf("TestImportFDF: want 2 annotations on page 1, got %v\n", pageDict.Dict["Annots"])
+	}
+
+	d, err := xRefTable.DereferenceDict((*arr)[1])
+	if err != nil {
+		t.Fatalf("TestImportFDF: %v\n", err)
+	}
+
+	if s := decodedTextString(xRefTable, d.Dict["T"]); s != "Ed" {
+		t.Errorf("TestImportFDF: want T Ed, got %s\n", s)
+	}
+
+	// Page 2 does not exist.
+	fdf = strings.Replace(testFDF, "/Page 1", "/Page 2", 1)
+
+	n, err = ImportFDF(xRefTable, strings.NewReader(fdf))
+	if err == nil || !strings.Contains(err.Error(), "Annots[1]") {
+		t.Fatalf("TestImportFDF: want error for Annots[1], got %v\n", err)
+	}
+
+	if n != 0 {
+		t.Errorf("TestImportFDF: want 0 annotations, got %d\n", n)
+	}
+
+	if arr := pageDict.PDFArrayEntry("Annots"); len(*arr) != 2 {
+		t.Errorf("TestImportFDF: page 1 modified by failed import\n")
+	}
+}
+
+func TestExportFDF(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	page2, _ := pageForTest(t, xRefTable, 2)
+	page2.Insert("Rotate", PDFInteger(90))
+
+	author, err := textStringObject("Jürgen Müller")
+	if err != nil {
+		t.Fatalf("TestExportFDF: %v\n", err)
+	}
+
+	square := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	square.Insert("T", author)
+	square.Update("Contents", PDFStringLiteral(`Line 1\rLine 2\nLine 3`))
+	square.Insert("CreationDate", PDFStringLiteral("D:20180301120000Z"))
+	square.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, "0 0 40 40 re S", NewRectangle(0, 0, 40, 40), nil)}})
+	squareIndRef := addAnnotForTest(t, xRefTable, 2, square)
+
+	popupIndRef := addAnnotForTest(t, xRefTable, 2, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(60, 10, 160, 60),
+			"Parent":  squareIndRef,
+		},
+	})
+	square.Insert("Popup", popupIndRef)
+
+	addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(PDFArray{PDFInteger(0), PDFName("Fit")}, nil))
+
+	// A widget of the terminal field person.name along with a merged field without value.
+	parentIndRef, err := xRefTable.IndRefForNewObject(PDFDict{
+		Dict: map[string]PDFObject{
+			"T": PDFStringLiteral("person"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestExportFDF: %v\n", err)
+	}
+
+	fieldIndRef, err := xRefTable.IndRefForNewObject(PDFDict{
+		Dict: map[string]PDFObject{
+			"FT":     PDFName("Tx"),
+			"T":      PDFStringLiteral("name"),
+			"V":      author,
+			"Parent": *parentIndRef,
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestExportFDF: %v\n", err)
+	}
+
+	widget := widgetForTest("Tx", 0, NewRectangle(100, 100, 200, 120))
+	widget.Delete("T")
+	widget.Delete("FT")
+	widget.Insert("Parent", *fieldIndRef)
+	addAnnotForTest(t, xRefTable, 1, widget)
+	addAnnotForTest(t, xRefTable, 1, widgetForTest("Btn", 0, NewRectangle(100, 200, 120, 220)))
+
+	var b bytes.Buffer
+
+	if err = ExportFDF(xRefTable, &b); err != nil {
+		t.Fatalf("TestExportFDF: %v\n", err)
+	}
+
+	fdfTable, fdfDict, err := parseFDF(b.Bytes())
+	if err != nil {
+		t.Fatalf("TestExportFDF: %v\n%s\n", err, b.String())
+	}
+
+	annots, err := fdfTable.DereferenceArray(fdfDict.Dict["Annots"])
+	if err != nil || annots == nil || len(*annots) != 2 {
+		t.Fatalf("TestExportFDF: want 2 annotations, got %v\n", fdfDict.Dict["Annots"])
+	}
+
+	d, err := fdfTable.DereferenceDict((*annots)[0])
+	if err != nil {
+		t.Fatalf("TestExportFDF: %v\n", err)
+	}
+
+	if _, found := d.Find("P"); found {
+		t.Errorf("TestExportFDF: P not removed\n")
+	}
+
+	if page := d.IntEntry("Page"); page == nil || *page != 1 {
+		t.Errorf("TestExportFDF: want Page 1, got %v\n", d.Dict["Page"])
+	}
+
+	if rect := fmt.Sprint(d.Dict["Rect"]); rect != fmt.Sprint(NewRectangle(10, 10, 50, 50)) {
+		t.Errorf("TestExportFDF: unexpected Rect %s\n", rect)
+	}
+
+	for k, want := range map[string]string{"T": "Jürgen Müller", "Contents": "Line 1\rLine 2\nLine 3", "CreationDate": "D:20180301120000Z"} {
+		if got := decodedTextString(fdfTable, d.Dict[k]); got != want {
+			t.Errorf("TestExportFDF: %s: want %q, got %q\n", k, want, got)
+		}
+	}
+
+	popup, err := fdfTable.DereferenceDict((*annots)[1])
+	if err != nil {
+		t.Fatalf("TestExportFDF: %v\n", err)
+	}
+
+	if indRef := popup.IndirectRefEntry("Parent"); indRef == nil || *indRef != (*annots)[0] {
+		t.Errorf("TestExportFDF: Popup Parent not preserved: %v\n", popup.Dict["Parent"])
+	}
+
+	fields, err := fdfTable.DereferenceArray(fdfDict.Dict["Fields"])
+	if err != nil || fields == nil || len(*fields) != 1 {
+		t.Fatalf("TestExportFDF: want 1 field, got %v\n", fdfDict.Dict["Fields"])
+	}
+
+	person := (*fields)[0].(PDFDict)
+	if name := decodedTextString(fdfTable, person.Dict["T"]); name != "person" {
+		t.Errorf("TestExportFDF: want field person, got %s\n", name)
+	}
+
+	kids := person.PDFArrayEntry("Kids")
+	if kids == nil || len(*kids) != 1 {
+		t.Fatalf("TestExportFDF: want 1 kid, got %v\n", person.Dict["Kids"])
+	}
+
+	name := (*kids)[0].(PDFDict)
+	if v := decodedTextString(fdfTable, name.Dict["V"]); v != "Jürgen Müller" {
+		t.Errorf("TestExportFDF: unexpected field value %q\n", v)
+	}
+
+	// Round trip
+	target := createAnnotTestXRef(t, 2)
+
+	if err = ImportAnnotationsFromFDF(target, &b); err != nil {
+		t.Fatalf("TestExportFDF: %v\n", err)
+	}
+
+	page2, _ = pageForTest(t, target, 2)
+	if arr := page2.PDFArrayEntry("Annots"); arr == nil || len(*arr) != 2 {
+		t.Fatalf("TestExportFDF: want 2 imported annotations, got %v\n", page2.Dict["Annots"])
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// flattenable returns true if annotDict is neither a Popup nor a hidden annotation.
+func flattenable(annotDict *PDFDict) bool {
+
+	if st := annotDict.Subtype(); st == nil || *st == "Popup" {
+		return false
+	}
+
+	f := annotDict.IntEntry("F")
+
+	return f == nil || *f&(annotFlagHidden|annotFlagNoView) == 0
+}
+
+// flattenedAppearance returns the normal appearance stream of annotDict along with
+// the matrix placing it onto the annotation rectangle.
+// Returns nil if annotDict lacks a normal appearance.
+func flattenedAppearance(xRefTable *XRefTable, annotDict *PDFDict) (*PDFIndirectRef, matrix, error) {
+
+	obj, err := normalAppearance(xRefTable, annotDict)
+	if err != nil || obj == nil {
+		return nil, identMatrix, err
+	}
+
+	indRef, ok := obj.(PDFIndirectRef)
+	if !ok {
+		return nil, identMatrix, nil
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(indRef)
+	if err != nil || sd == nil {
+		return nil, identMatrix, err
+	}
+
+	f, err := numbers(xRefTable, annotDict.Dict["Rect"])
+	if err != nil || len(f) != 4 {
+		return nil, identMatrix, errors.New("flattenedAppearance: corrupt Rect")
+	}
+
+	rect := types.NewRectangle(math.Min(f[0], f[2]), math.Min(f[1], f[3]), math.Max(f[0], f[2]), math.Max(f[1], f[3]))
+
+	m, err := appearanceRectMatrix(xRefTable, sd, rect)
+	if err != nil {
+		return nil, identMatrix, err
+	}
+
+	return &indRef, m, nil
+}
+
+// flattenedResources returns a copy of the effective resources of pageDict
+// along with its XObject resources ready to take additional forms.
+func flattenedResources(xRefTable *XRefTable, pageDict *PDFDict) (*PDFDict, *PDFDict, error) {
+
+	obj, err := inheritableAttr(xRefTable, *pageDict, "Resources")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resDict := NewPDFDict()
+
+	if d, err := xRefTable.DereferenceDict(obj); err != nil {
+		return nil, nil, err
+	} else if d != nil {
+		resDict = copyDict(*d)
+	}
+
+	xObjDict := NewPDFDict()
+
+	if d, err := xRefTable.DereferenceDict(resDict.Dict["XObject"]); err != nil {
+		return nil, nil, err
+	} else if d != nil {
+		xObjDict = copyDict(*d)
+	}
+
+	resDict.Update("XObject", xObjDict)
+
+	return &resDict, &xObjDict, nil
+}
+
+// newContentStream creates a new content stream for b.
+func newContentStream(xRefTable *XRefTable, b []byte) (*PDFIndirectRef, error) {
+
+	sd := &PDFStreamDict{PDFDict: NewPDFDict(), Content: b}
+
+	err := encodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return xRefTable.IndRefForNewObject(*sd)
+}
+
+// FlattenAnnotations renders the normal appearances of the annotations of page pageNr
+// into the page content and removes the flattened annotations along with their Popup annotations.
+// Hidden annotations (F: Hidden, NoView) and Popup annotations do not get flattened.
+// Annotations lacking a normal appearance remain on the page and get reported as validation warnings.
+func FlattenAnnotations(xRefTable *XRefTable, pageNr int) error {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return err
+	}
+
+	resDict, xObjDict, err := flattenedResources(xRefTable, pageDict)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+
+	i := 0
+
+	err = visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if !flattenable(annotDict) {
+			return nil
+		}
+
+		apIndRef, m, err := flattenedAppearance(xRefTable, annotDict)
+		if err != nil || apIndRef == nil {
+			objNr := 0
+			if indRef != nil {
+				objNr = indRef.ObjectNumber.Value()
+			}
+			if err == nil {
+				err = errors.New("missing normal appearance")
+			}
+			xRefTable.addWarning("FlattenAnnotations: page %d obj#%d %s: %v", pageNr, objNr, *annotDict.Subtype(), err)
+			return nil
+		}
+
+		var name string
+		for ; ; i++ {
+			name = "Annot" + strconv.Itoa(i)
+			if _, found := xObjDict.Find(name); !found {
+				break
+			}
+		}
+
+		xObjDict.Insert(name, *apIndRef)
+
+		fmt.Fprintf(&b, "q %.4f %.4f %.4f %.4f %.4f %.4f cm /%s Do Q\n", m[0][0], m[0][1], m[1][0], m[1][1], m[2][0], m[2][1], name)
+
+		return nil
+	})
+
+	if err != nil || b.Len() == 0 {
+		return err
+	}
+
+	pageDict.Update("Resources", *resDict)
+
+	content := b.Bytes()
+
+	// Isolate the existing content from the flattened appearances.
+	var contents PDFArray
+
+	obj, found := pageDict.Find("Contents")
+	if found && obj != nil {
+
+		o, err := xRefTable.Dereference(obj)
+		if err != nil {
+			return err
+		}
+
+		indRef, err := newContentStream(xRefTable, []byte("q\n"))
+		if err != nil {
+			return err
+		}
+
+		contents = PDFArray{*indRef}
+		if arr, ok := o.(PDFArray); ok {
+			contents = append(contents, arr...)
+		} else {
+			contents = append(contents, obj)
+		}
+
+		content = append([]byte("Q\n"), content...)
+	}
+
+	indRef, err := newContentStream(xRefTable, content)
+	if err != nil {
+		return err
+	}
+
+	pageDict.Update("Contents", append(contents, *indRef))
+
+	_, err = removeAnnotations(xRefTable, func(i int, d *PDFDict) bool {
+		if i != pageNr {
+			return false
+		}
+		if !flattenable(d) {
+			return false
+		}
+		apIndRef, _, err := flattenedAppearance(xRefTable, d)
+		return err == nil && apIndRef != nil
+	})
+
+	return err
+}
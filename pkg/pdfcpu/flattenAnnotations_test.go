@@ -0,0 +1,129 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlattenAnnotations(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	stampAP := formForTest(t, xRefTable, "1 0 0 rg 0 0 100 50 re f", NewRectangle(0, 0, 100, 50), nil)
+
+	stampIndRef := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Stamp"),
+			"Rect":    NewRectangle(100, 100, 300, 200),
+			"AP":      PDFDict{Dict: map[string]PDFObject{"N": stampAP}},
+		},
+	})
+
+	popupIndRef := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(300, 100, 400, 200),
+			"Parent":  stampIndRef,
+		},
+	})
+
+	stamp, _ := xRefTable.DereferenceDict(stampIndRef)
+	stamp.Insert("Popup", popupIndRef)
+
+	hidden := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	hidden.Insert("F", PDFInteger(annotFlagHidden))
+	hidden.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, "0 0 40 40 re S", NewRectangle(0, 0, 40, 40), nil)}})
+	addAnnotForTest(t, xRefTable, 1, hidden)
+
+	freeTextIndRef := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("FreeText"),
+			"Rect":     NewRectangle(10, 300, 200, 350),
+			"Contents": PDFStringLiteral("No appearance"),
+			"DA":       PDFStringLiteral("/Helv 10 Tf 0 g"),
+		},
+	})
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	contentCount := 0
+	if obj, found := pageDict.Find("Contents"); found {
+		contentCount = 1
+		if arr, ok := obj.(PDFArray); ok {
+			contentCount = len(arr)
+		}
+	}
+
+	if err := FlattenAnnotations(xRefTable, 1); err != nil {
+		t.Fatalf("TestFlattenAnnotations: %v\n", err)
+	}
+
+	aa, err := xRefTable.PageAnnotations(1)
+	if err != nil {
+		t.Fatalf("TestFlattenAnnotations: %v\n", err)
+	}
+
+	if len(aa) != 2 || aa[0].Subtype != AnnotSquare || aa[1].Subtype != AnnotFreeText {
+		t.Fatalf("TestFlattenAnnotations: expected hidden Square and FreeText to remain, got %v\n", aa)
+	}
+
+	for _, objNr := range []int{stampIndRef.ObjectNumber.Value(), popupIndRef.ObjectNumber.Value()} {
+		if entry, found := xRefTable.Find(objNr); found && !entry.Free {
+			t.Errorf("TestFlattenAnnotations: obj#%d not freed\n", objNr)
+		}
+	}
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "missing normal appearance") ||
+		!strings.Contains(warnings[0].Msg, "obj#"+freeTextIndRef.ObjectNumber.String()) {
+		t.Errorf("TestFlattenAnnotations: expected warning for FreeText, got %v\n", warnings)
+	}
+
+	res := pageDict.PDFDictEntry("Resources")
+	if res == nil || res.PDFDictEntry("XObject") == nil {
+		t.Fatalf("TestFlattenAnnotations: missing XObject resources\n")
+	}
+
+	if indRef := res.PDFDictEntry("XObject").IndirectRefEntry("Annot0"); indRef == nil || indRef.ObjectNumber != stampAP.ObjectNumber {
+		t.Errorf("TestFlattenAnnotations: Annot0 does not refer to the stamp appearance\n")
+	}
+
+	contents := pageDict.PDFArrayEntry("Contents")
+	if contents == nil || len(*contents) != contentCount+2 {
+		t.Fatalf("TestFlattenAnnotations: expected %d content streams, got %v\n", contentCount+2, pageDict.Dict["Contents"])
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict((*contents)[len(*contents)-1])
+	if err != nil {
+		t.Fatalf("TestFlattenAnnotations: %v\n", err)
+	}
+
+	b, err := streamContent(sd)
+	if err != nil {
+		t.Fatalf("TestFlattenAnnotations: %v\n", err)
+	}
+
+	// Rect 200x100 at 100,100 for a 100x50 BBox.
+	if want := "Q\nq 2.0000 0.0000 0.0000 2.0000 100.0000 100.0000 cm /Annot0 Do Q\n"; string(b) != want {
+		t.Errorf("TestFlattenAnnotations: expected %q, got %q\n", want, b)
+	}
+}
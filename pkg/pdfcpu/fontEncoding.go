@@ -0,0 +1,164 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Character coverage of the predefined simple font encodings, see Annex D.
+
+// Characters beyond printable ASCII.
+const (
+	standardEncodingExtra = "¡¢£⁄¥ƒ§¤“«‹›ﬁﬂ–†‡·¶•‚„”»…‰¿´ˆ˜¯˘˙¨˚¸˝˛ˇ—ÆªŁØŒºæıłøœß‘’"
+	winAnsiEncodingExtra  = "€‚ƒ„…†‡ˆ‰Š‹ŒŽ‘’“”•–—˜™š›œžŸ"
+	macRomanEncodingExtra = "ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ"
+)
+
+func isPrintableASCII(r rune) bool {
+	return r >= 0x20 && r <= 0x7E
+}
+
+// encodingCovers returns true if the predefined encoding encName contains a glyph for r.
+func encodingCovers(encName string, r rune) bool {
+
+	if isPrintableASCII(r) {
+		return true
+	}
+
+	switch encName {
+
+	case "StandardEncoding":
+		return strings.ContainsRune(standardEncodingExtra, r)
+
+	case "WinAnsiEncoding":
+		// The upper half is Latin-1 except for 0x80-0x9F.
+		return r >= 0xA0 && r <= 0xFF || strings.ContainsRune(winAnsiEncodingExtra, r)
+
+	case "MacRomanEncoding":
+		return strings.ContainsRune(macRomanEncodingExtra, r)
+
+	}
+
+	return false
+}
+
+// glyphNameRune returns the character for the few glyph names that may be resolved without a glyph list.
+func glyphNameRune(glyphName string) (rune, bool) {
+
+	if utf8.RuneCountInString(glyphName) == 1 {
+		r, _ := utf8.DecodeRuneInString(glyphName)
+		return r, true
+	}
+
+	if strings.HasPrefix(glyphName, "uni") && len(glyphName) == 7 {
+		i, err := strconv.ParseUint(glyphName[3:], 16, 16)
+		if err == nil {
+			return rune(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// fontEncodingCoverage describes the characters a simple font is able to render.
+type fontEncodingCoverage struct {
+	baseEncoding string
+	differences  map[rune]bool
+}
+
+func (c fontEncodingCoverage) covers(r rune) bool {
+	return c.differences[r] || encodingCovers(c.baseEncoding, r)
+}
+
+// simpleFontCoverage returns the encoding coverage of a simple font
+// or nil if the coverage cannot be determined.
+func simpleFontCoverage(xRefTable *XRefTable, fontDict *PDFDict) (*fontEncodingCoverage, error) {
+
+	subtype := fontDict.Subtype()
+	if subtype == nil {
+		return nil, nil
+	}
+
+	switch *subtype {
+	case "Type1", "MMType1", "TrueType":
+	default:
+		// Composite fonts are not restricted to 256 glyphs, Type3 glyphs are arbitrary.
+		return nil, nil
+	}
+
+	obj, found := fontDict.Find("Encoding")
+	if !found || obj == nil {
+		baseFont := fontDict.NameEntry("BaseFont")
+		if *subtype == "Type1" && baseFont != nil && *baseFont != "Symbol" && *baseFont != "ZapfDingbats" {
+			// A non symbolic standard font uses StandardEncoding.
+			return &fontEncodingCoverage{baseEncoding: "StandardEncoding"}, nil
+		}
+		// Built-in encoding.
+		return nil, nil
+	}
+
+	obj, err := xRefTable.Dereference(obj)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+
+	case PDFName:
+		return &fontEncodingCoverage{baseEncoding: o.Value()}, nil
+
+	case PDFDict:
+		c := &fontEncodingCoverage{baseEncoding: "StandardEncoding", differences: map[rune]bool{}}
+		if n := o.NameEntry("BaseEncoding"); n != nil {
+			c.baseEncoding = *n
+		}
+		arr, err := xRefTable.DereferenceArray(o.Dict["Differences"])
+		if err != nil {
+			return nil, err
+		}
+		if arr != nil {
+			for _, v := range *arr {
+				if n, ok := v.(PDFName); ok {
+					if r, ok := glyphNameRune(n.Value()); ok {
+						c.differences[r] = true
+					}
+				}
+			}
+		}
+		return c, nil
+
+	}
+
+	return nil, nil
+}
+
+// PDFDocEncoding characters for the codes 0x80 - 0xA0, 0x9F is undefined.
+const pdfDocEncodingUpper = "•†‡…—–ƒ⁄‹›−‰„“”‘’‚™ﬁﬂŁŒŠŸŽıłœšž�€"
+
+// pdfDocEncodingRune returns the character for a PDFDocEncoding code.
+// Apart from 0x80 - 0xA0 PDFDocEncoding matches Latin-1 for all printable characters.
+func pdfDocEncodingRune(b byte) rune {
+
+	if b < 0x80 || b > 0xA0 {
+		return rune(b)
+	}
+
+	return []rune(pdfDocEncodingUpper)[b-0x80]
+}
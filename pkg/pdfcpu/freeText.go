@@ -0,0 +1,477 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Rendering FreeText annotations, see 12.5.6.6 and 12.7.3.4
+
+// standardFontFamilies maps CSS font families to the regular, bold, italic and bold italic standard fonts.
+var standardFontFamilies = map[string][4]string{
+	"helvetica":       {"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"},
+	"arial":           {"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"},
+	"sans-serif":      {"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"},
+	"times":           {"Times-Roman", "Times-Bold", "Times-Italic", "Times-BoldItalic"},
+	"times new roman": {"Times-Roman", "Times-Bold", "Times-Italic", "Times-BoldItalic"},
+	"serif":           {"Times-Roman", "Times-Bold", "Times-Italic", "Times-BoldItalic"},
+	"courier":         {"Courier", "Courier-Bold", "Courier-Oblique", "Courier-BoldOblique"},
+	"courier new":     {"Courier", "Courier-Bold", "Courier-Oblique", "Courier-BoldOblique"},
+	"monospace":       {"Courier", "Courier-Bold", "Courier-Oblique", "Courier-BoldOblique"},
+}
+
+// freeTextStyle is the text style of a FreeText annotation.
+type freeTextStyle struct {
+	family       string  // CSS font family list, "" for the font of DA
+	bold, italic bool    // only honored along with family
+	size         float64 // 0 for the font size of DA
+	color        string  // fill color operator, "" for the color of DA
+	q            int     // quadding
+}
+
+// cssColor returns the fill color operator for a CSS color given as #rrggbb or #rgb.
+func cssColor(s string) string {
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+
+	if len(s) != 6 {
+		return ""
+	}
+
+	var c [3]float64
+
+	for i := range c {
+		v, err := strconv.ParseUint(s[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return ""
+		}
+		c[i] = float64(v) / 255
+	}
+
+	return fmt.Sprintf("%.3f %.3f %.3f rg", c[0], c[1], c[2])
+}
+
+// cssFontSize returns the font size of a CSS length given in pt.
+func cssFontSize(s string) float64 {
+
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "pt"), 64)
+	if err != nil || f <= 0 {
+		return 0
+	}
+
+	return f
+}
+
+// applyCSS updates st with the declarations of the CSS inline style s, see Table 225.
+func (st *freeTextStyle) applyCSS(s string) {
+
+	for _, decl := range strings.Split(s, ";") {
+
+		i := strings.Index(decl, ":")
+		if i < 0 {
+			continue
+		}
+
+		k, v := strings.ToLower(strings.TrimSpace(decl[:i])), strings.TrimSpace(decl[i+1:])
+
+		switch k {
+
+		case "font":
+			// Shorthand listing style, weight, size and family in any order.
+			var family []string
+			for _, t := range strings.Fields(v) {
+				switch {
+				case t == "bold":
+					st.bold = true
+				case t == "italic" || t == "oblique":
+					st.italic = true
+				case t == "normal":
+				case strings.HasSuffix(t, "pt") && cssFontSize(t) > 0:
+					st.size = cssFontSize(t)
+				default:
+					family = append(family, t)
+				}
+			}
+			if len(family) > 0 {
+				st.family = strings.Join(family, " ")
+			}
+
+		case "font-family":
+			st.family = v
+
+		case "font-size":
+			if f := cssFontSize(v); f > 0 {
+				st.size = f
+			}
+
+		case "font-weight":
+			n, _ := strconv.Atoi(v)
+			st.bold = v == "bold" || n >= 600
+
+		case "font-style":
+			st.italic = v == "italic" || v == "oblique"
+
+		case "color":
+			if c := cssColor(v); c != "" {
+				st.color = c
+			}
+
+		case "text-align":
+			switch v {
+			case "left":
+				st.q = 0
+			case "center":
+				st.q = 1
+			case "right":
+				st.q = 2
+			}
+		}
+	}
+}
+
+// standardFont returns the standard font for the font family list of st or "" if none applies.
+func (st *freeTextStyle) standardFont() string {
+
+	for _, f := range strings.Split(st.family, ",") {
+
+		ff, found := standardFontFamilies[strings.ToLower(strings.Trim(strings.TrimSpace(f), `'"`))]
+		if !found {
+			continue
+		}
+
+		i := 0
+		if st.bold {
+			i++
+		}
+		if st.italic {
+			i += 2
+		}
+
+		return ff[i]
+	}
+
+	return ""
+}
+
+// richText returns the paragraphs of the rich text string s along with the inline styles in effect at the beginning of its text.
+// Styles of subsequent elements are not taken into account. Paragraphs are not normalized regarding whitespace.
+func richText(s string) ([]string, []string, error) {
+
+	dec := xml.NewDecoder(strings.NewReader(s))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	var (
+		paragraphs, styles []string
+		p                  bytes.Buffer
+		started            bool
+	)
+
+	push := func() {
+		paragraphs = append(paragraphs, strings.TrimSpace(p.String()))
+		p.Reset()
+	}
+
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "richText")
+		}
+
+		switch t := t.(type) {
+
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p", "div":
+				if strings.TrimSpace(p.String()) != "" {
+					push()
+				}
+			case "br":
+				push()
+			}
+			if !started {
+				for _, a := range t.Attr {
+					if a.Name.Local == "style" {
+						styles = append(styles, a.Value)
+					}
+				}
+			}
+
+		case xml.EndElement:
+			if t.Name.Local == "p" || t.Name.Local == "div" {
+				push()
+			}
+
+		case xml.CharData:
+			// Whitespace gets collapsed when wrapping.
+			p.Write(t)
+			if strings.TrimSpace(string(t)) != "" {
+				started = true
+			}
+		}
+	}
+
+	if strings.TrimSpace(p.String()) != "" {
+		push()
+	}
+
+	return paragraphs, styles, nil
+}
+
+// wrapText breaks the paragraph s into lines not exceeding width w using the metrics of fontName at fontSize.
+// Words wider than w get a line of their own.
+func wrapText(s string, fontName string, fontSize, w float64) []string {
+
+	var lines []string
+
+	line := ""
+
+	for _, word := range strings.Fields(s) {
+
+		l := word
+		if line != "" {
+			l = line + " " + word
+		}
+
+		if line != "" && textWidth(singleByteRunes([]rune(l)), fontName, fontSize) > w {
+			lines = append(lines, line)
+			l = word
+		}
+
+		line = l
+	}
+
+	return append(lines, line)
+}
+
+// freeTextParagraphs returns the paragraphs of a FreeText annotation taken from RC falling back to Contents
+// along with its style derived from DA, Q, DS and the inline styles of RC.
+func freeTextParagraphs(xRefTable *XRefTable, d *PDFDict) ([]string, *freeTextStyle, error) {
+
+	st := &freeTextStyle{}
+
+	if q := d.IntEntry("Q"); q != nil {
+		st.q = *q
+	}
+
+	if ds := decodedTextString(xRefTable, d.Dict["DS"]); ds != "" {
+		st.applyCSS(ds)
+	}
+
+	var rc string
+
+	if sd, err := xRefTable.DereferenceStreamDict(d.Dict["RC"]); err == nil && sd != nil {
+		b, err := streamContent(sd)
+		if err != nil {
+			return nil, nil, err
+		}
+		rc = string(b)
+	} else {
+		rc = decodedTextString(xRefTable, d.Dict["RC"])
+	}
+
+	if rc != "" {
+		paragraphs, styles, err := richText(rc)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, s := range styles {
+			st.applyCSS(s)
+		}
+		return paragraphs, st, nil
+	}
+
+	s := decodedTextString(xRefTable, d.Dict["Contents"])
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+
+	return strings.Split(s, "\n"), st, nil
+}
+
+// freeTextAppearance creates a form of size w x h rendering the text of a FreeText annotation
+// along with its background color C within the text box inset by RD.
+func freeTextAppearance(xRefTable *XRefTable, d *PDFDict, w, h float64) (*PDFIndirectRef, error) {
+
+	paragraphs, st, err := freeTextParagraphs(xRefTable, d)
+	if err != nil {
+		return nil, err
+	}
+
+	da, err := defaultAppearance(xRefTable, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if da == nil || daFontName(*da) == "" {
+		s := "/Helv 0 Tf 0 g"
+		da = &s
+	}
+
+	fontName := daFontName(*da)
+
+	size := st.size
+	if size <= 0 {
+		if m := reDAFont.FindStringSubmatch(*da); m != nil {
+			size, _ = strconv.ParseFloat(m[2], 64)
+		}
+	}
+	if size <= 0 {
+		size = 12
+	}
+
+	color := st.color
+	if color == "" {
+		color = strings.TrimSpace(reDAFont.ReplaceAllString(*da, ""))
+	}
+
+	var (
+		fontObj     PDFObject
+		metricsName string
+	)
+
+	if f := st.standardFont(); f != "" {
+		fontName = "FT0"
+		fontObj = PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":     PDFName("Font"),
+				"Subtype":  PDFName("Type1"),
+				"BaseFont": PDFName(f),
+			},
+		}
+		metricsName = f
+	} else if fontObj, metricsName, err = widgetFont(xRefTable, fontName, nil); err != nil {
+		return nil, err
+	}
+
+	resources := PDFDict{
+		Dict: map[string]PDFObject{
+			"Font": PDFDict{Dict: map[string]PDFObject{fontName: fontObj}},
+		},
+	}
+
+	// The text box is inset by RD and a padding of 2.
+	inset := [4]float64{}
+	if rd, err := numbers(xRefTable, d.Dict["RD"]); err == nil && len(rd) == 4 {
+		copy(inset[:], rd)
+	}
+
+	const pad = 2.0
+
+	x0, y0 := inset[0]+pad, inset[3]+pad
+	tw, th := w-inset[0]-inset[2]-2*pad, h-inset[1]-inset[3]-2*pad
+
+	var b bytes.Buffer
+
+	if op := colorOperator(xRefTable, d.Dict["C"], false); op != "" {
+		fmt.Fprintf(&b, "q %s %.2f %.2f %.2f %.2f re f Q\n", op, inset[0], inset[3], w-inset[0]-inset[2], h-inset[1]-inset[3])
+	}
+
+	fmt.Fprintf(&b, "q %.2f %.2f %.2f %.2f re W n\nBT /%s %.1f Tf %s\n", x0, y0, math.Max(tw, 0), math.Max(th, 0), fontName, size, color)
+
+	y := y0 + th - size
+
+	for _, p := range paragraphs {
+		for _, line := range wrapText(p, metricsName, size, tw) {
+
+			s := singleByteRunes([]rune(line))
+
+			x := x0
+			switch st.q {
+			case 1:
+				x += (tw - textWidth(s, metricsName, size)) / 2
+			case 2:
+				x += tw - textWidth(s, metricsName, size)
+			}
+
+			e, _ := Escape(string(s))
+			fmt.Fprintf(&b, "1 0 0 1 %.2f %.2f Tm (%s) Tj\n", x, y, *e)
+
+			y -= 1.2 * size
+		}
+	}
+
+	b.WriteString("ET Q\n")
+
+	return newWidgetForm(xRefTable, w, h, b.String(), &resources)
+}
+
+// freeTextOnlyEntries are the entries of a FreeText annotation not applicable to a Stamp annotation.
+var freeTextOnlyEntries = []string{"DA", "DS", "Q", "CL", "IT", "LE", "BE", "RD", "BS", "AS"}
+
+// ConvertFreeTextToStamp turns the FreeText annotation obj#objNr into a Stamp annotation
+// whose appearance renders the FreeText's text using the style defined by DA, Q, DS and RC, see 12.7.3.4
+// Text color, alignment, font size and standard font families are preserved, the background color C is filled.
+// RC takes precedence over Contents. Paragraphs get wrapped to the text box, the inline styles of RC
+// apply to all of the text as in effect at its beginning. Callout lines are not rendered.
+// The annotation keeps its object number, Rect and all markup entries, so replies and its Popup remain attached.
+func ConvertFreeTextToStamp(xRefTable *XRefTable, objNr int) error {
+
+	d, err := annotDictOfSubtype(xRefTable, objNr, "FreeText")
+	if err != nil {
+		return err
+	}
+
+	r, err := numbers(xRefTable, d.Dict["Rect"])
+	if err != nil || len(r) != 4 {
+		return errors.Errorf("ConvertFreeTextToStamp: obj#%d corrupt Rect", objNr)
+	}
+
+	w, h := math.Abs(r[2]-r[0]), math.Abs(r[3]-r[1])
+
+	indRef, err := freeTextAppearance(xRefTable, d, w, h)
+	if err != nil {
+		return errors.Wrapf(err, "ConvertFreeTextToStamp: obj#%d", objNr)
+	}
+
+	stamp := copyDict(*d)
+	for _, k := range freeTextOnlyEntries {
+		stamp.Delete(k)
+	}
+	stamp.Update("Subtype", PDFName("Stamp"))
+	stamp.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": *indRef}})
+
+	if err = validateAnnotationDictStamp(xRefTable, &stamp, "annotDict"); err != nil {
+		xRefTable.DeleteObject(indRef.ObjectNumber.Value())
+		return errors.Wrapf(err, "ConvertFreeTextToStamp: obj#%d", objNr)
+	}
+
+	for _, k := range freeTextOnlyEntries {
+		if _, found := d.Find(k); found {
+			setAnnotationEntry(xRefTable, objNr, d, k, nil)
+		}
+	}
+	setAnnotationEntry(xRefTable, objNr, d, "Subtype", PDFName("Stamp"))
+	setAnnotationEntry(xRefTable, objNr, d, "AP", stamp.Dict["AP"])
+
+	return nil
+}
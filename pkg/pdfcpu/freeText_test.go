@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRichText(t *testing.T) {
+
+	rc := `<?xml version="1.0"?><body xmlns="http://www.w3.org/1999/xhtml" style="font-size:10pt">
+<p style="color:#00FF00">Hello <span style="font-weight:bold">rich</span>
+ world</p><p>Caf&eacute;<br/>au lait</p></body>`
+
+	paragraphs, styles, err := richText(rc)
+	if err != nil {
+		t.Fatalf("TestRichText: %v\n", err)
+	}
+
+	want := []string{"Hello rich\n world", "Café", "au lait"}
+	if !reflect.DeepEqual(paragraphs, want) {
+		t.Errorf("TestRichText: want %q, got %q\n", want, paragraphs)
+	}
+
+	// The span style applies to rich only.
+	if want := []string{"font-size:10pt", "color:#00FF00"}; !reflect.DeepEqual(styles, want) {
+		t.Errorf("TestRichText: want styles %q, got %q\n", want, styles)
+	}
+}
+
+func TestConvertFreeTextToStamp(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	rc := `<?xml version="1.0"?><body xmlns="http://www.w3.org/1999/xhtml"><p style="text-align:right">Hello rich world</p><p>Second line</p></body>`
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("FreeText"),
+			"Rect":     NewRectangle(100, 100, 300, 160),
+			"Contents": PDFStringLiteral("Hello rich world\rSecond line"),
+			"T":        PDFStringLiteral("Reviewer"),
+			"C":        NewNumberArray(1, 1, 0),
+			"DA":       PDFStringLiteral("/Helv 0 Tf 0 0 1 rg"),
+			"DS":       PDFStringLiteral("font: Times,serif 14.0pt; text-align:center; color:#FF0000"),
+			"RC":       PDFStringLiteral(rc),
+			"Q":        PDFInteger(0),
+		},
+	}
+
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+	objNr := indRef.ObjectNumber.Value()
+
+	reply := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Text"),
+			"Rect":     NewRectangle(10, 10, 30, 30),
+			"Contents": PDFStringLiteral("Agreed"),
+			"IRT":      indRef,
+		},
+	})
+
+	if err := ConvertFreeTextToStamp(xRefTable, objNr); err != nil {
+		t.Fatalf("TestConvertFreeTextToStamp: %v\n", err)
+	}
+
+	stamp, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		t.Fatalf("TestConvertFreeTextToStamp: %v\n", err)
+	}
+
+	if *stamp.Subtype() != "Stamp" {
+		t.Fatalf("TestConvertFreeTextToStamp: want Stamp, got %s\n", *stamp.Subtype())
+	}
+
+	for _, k := range []string{"DA", "DS", "Q"} {
+		if _, found := stamp.Find(k); found {
+			t.Errorf("TestConvertFreeTextToStamp: %s not removed\n", k)
+		}
+	}
+
+	if s := decodedTextString(xRefTable, stamp.Dict["T"]); s != "Reviewer" {
+		t.Errorf("TestConvertFreeTextToStamp: T not preserved: %s\n", s)
+	}
+
+	// The reply still refers to the converted annotation.
+	replyDict, _ := xRefTable.DereferenceDict(reply)
+	if irt := replyDict.IndirectRefEntry("IRT"); irt == nil || irt.ObjectNumber.Value() != objNr {
+		t.Errorf("TestConvertFreeTextToStamp: reply detached\n")
+	}
+
+	var (
+		content   []byte
+		resources *PDFDict
+	)
+
+	err = visitAppearanceStreams(xRefTable, stamp, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+		resources, err = xRefTable.DereferenceDict(sd.Dict["Resources"])
+		if err != nil {
+			return err
+		}
+		content, err = streamContent(sd)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("TestConvertFreeTextToStamp: %v\n", err)
+	}
+
+	if content == nil {
+		t.Fatalf("TestConvertFreeTextToStamp: missing appearance\n")
+	}
+
+	s := string(content)
+
+	// Background C, DS color and size, the right alignment of the first paragraph's style and Times.
+	for _, want := range []string{"1.000 1.000 0.000 rg", "/FT0 14.0 Tf 1.000 0.000 0.000 rg", "(Hello rich world) Tj", "(Second line) Tj"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("TestConvertFreeTextToStamp: missing %q in content:\n%s\n", want, s)
+		}
+	}
+
+	// Text box width 200 - 2*2 padding.
+	w := textWidth([]byte("Second line"), "Times-Roman", 14)
+	if want := fmt.Sprintf("1 0 0 1 %.2f ", 198-w); !strings.Contains(s, want) {
+		t.Errorf("TestConvertFreeTextToStamp: second line not right aligned, missing %q in content:\n%s\n", want, s)
+	}
+
+	font := resources.PDFDictEntry("Font").PDFDictEntry("FT0")
+	if font == nil || *font.NameEntry("BaseFont") != "Times-Roman" {
+		t.Errorf("TestConvertFreeTextToStamp: unexpected font resources: %v\n", resources)
+	}
+
+	if err = ConvertFreeTextToStamp(xRefTable, objNr); err == nil {
+		t.Errorf("TestConvertFreeTextToStamp: Stamp annotation => not ok!\n")
+	}
+}
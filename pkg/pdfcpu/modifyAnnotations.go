@@ -0,0 +1,1443 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"math"
+	"time"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Functions for modifying the annotations of existing pages.
+
+// reflectCoords reflects a flat list of coordinates across the vertical axis x=c (horizontal)
+// or the horizontal axis y=c.
+func reflectCoords(f []float64, horizontal bool, c float64) {
+
+	i := 1
+	if horizontal {
+		i = 0
+	}
+
+	for ; i < len(f); i += 2 {
+		f[i] = 2*c - f[i]
+	}
+}
+
+func reflectCoordsEntry(xRefTable *XRefTable, objNr int, dict *PDFDict, entryName string, horizontal bool, c float64) error {
+
+	obj, found := dict.Find(entryName)
+	if !found || obj == nil {
+		return nil
+	}
+
+	f, err := numbers(xRefTable, obj)
+	if err != nil {
+		return err
+	}
+
+	reflectCoords(f, horizontal, c)
+
+	setAnnotationEntry(xRefTable, objNr, dict, entryName, NewNumberArray(f...))
+
+	return nil
+}
+
+func reflectRectEntry(xRefTable *XRefTable, objNr int, dict *PDFDict, entryName string, horizontal bool, c float64) error {
+
+	obj, found := dict.Find(entryName)
+	if !found || obj == nil {
+		return nil
+	}
+
+	f, err := numbers(xRefTable, obj)
+	if err != nil {
+		return err
+	}
+	if len(f) != 4 {
+		return errors.Errorf("reflectRectEntry: corrupt %s", entryName)
+	}
+
+	reflectCoords(f, horizontal, c)
+
+	setAnnotationEntry(xRefTable, objNr, dict, entryName, NewRectangle(math.Min(f[0], f[2]), math.Min(f[1], f[3]), math.Max(f[0], f[2]), math.Max(f[1], f[3])))
+
+	return nil
+}
+
+func reflectInkList(xRefTable *XRefTable, objNr int, dict *PDFDict, horizontal bool, c float64) error {
+
+	obj, found := dict.Find("InkList")
+	if !found || obj == nil {
+		return nil
+	}
+
+	inkList, err := xRefTable.DereferenceArray(obj)
+	if err != nil || inkList == nil {
+		return err
+	}
+
+	arr := PDFArray{}
+
+	for _, v := range *inkList {
+		f, err := numbers(xRefTable, v)
+		if err != nil {
+			return err
+		}
+		reflectCoords(f, horizontal, c)
+		arr = append(arr, NewNumberArray(f...))
+	}
+
+	setAnnotationEntry(xRefTable, objNr, dict, "InkList", arr)
+
+	return nil
+}
+
+// reflectAppearanceMatrix composes a reflection into the form matrix of an appearance stream.
+// The reflected form bounding box is fitted into the annotation rectangle, so no translation is required.
+func reflectAppearanceMatrix(xRefTable *XRefTable, sd *PDFStreamDict, horizontal bool) error {
+
+	m := []float64{1, 0, 0, 1, 0, 0}
+
+	if obj, found := sd.Find("Matrix"); found && obj != nil {
+		f, err := numbers(xRefTable, obj)
+		if err != nil {
+			return err
+		}
+		if len(f) != 6 {
+			return errors.New("reflectAppearanceMatrix: corrupt Matrix")
+		}
+		m = f
+	}
+
+	// m x [-1 0 0 1 0 0] or m x [1 0 0 -1 0 0]
+	i := 1
+	if horizontal {
+		i = 0
+	}
+	for ; i < 6; i += 2 {
+		m[i] = -m[i]
+	}
+
+	sd.Update("Matrix", NewNumberArray(m...))
+
+	return nil
+}
+
+func mirrorAnnotation(xRefTable *XRefTable, objNr int, dict *PDFDict, horizontal bool, c float64, visited IntSet) error {
+
+	err := reflectRectEntry(xRefTable, objNr, dict, "Rect", horizontal, c)
+	if err != nil {
+		return err
+	}
+
+	for _, entryName := range []string{"QuadPoints", "Vertices", "L", "CL"} {
+		err = reflectCoordsEntry(xRefTable, objNr, dict, entryName, horizontal, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = reflectInkList(xRefTable, objNr, dict, horizontal, c)
+	if err != nil {
+		return err
+	}
+
+	return visitAppearanceStreams(xRefTable, dict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+		if indRef != nil {
+			if visited[indRef.ObjectNumber.Value()] {
+				return nil
+			}
+			visited[indRef.ObjectNumber.Value()] = true
+		}
+		return reflectAppearanceMatrix(xRefTable, sd, horizontal)
+	})
+}
+
+// MirrorAnnotations reflects the geometry of all annotations of a page across the vertical center axis
+// of the media box (horizontal) or across its horizontal center axis.
+// All annotations get validated up front so that a failing annotation leaves the page untouched.
+func MirrorAnnotations(xRefTable *XRefTable, pageNr int, horizontal bool) error {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return err
+	}
+
+	mediaBox, err := pageMediaBox(xRefTable, *pageIndRef)
+	if err != nil {
+		return err
+	}
+	if mediaBox == nil {
+		return errors.Errorf("MirrorAnnotations: page %d missing MediaBox", pageNr)
+	}
+
+	c := (mediaBox.LL.Y + mediaBox.UR.Y) / 2
+	if horizontal {
+		c = (mediaBox.LL.X + mediaBox.UR.X) / 2
+	}
+
+	err = visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		_, err := validateAnnotationDict(xRefTable, annotDict)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	visited := IntSet{}
+
+	return visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		objNr := 0
+		if indRef != nil {
+			objNr = indRef.ObjectNumber.Value()
+		}
+		return mirrorAnnotation(xRefTable, objNr, annotDict, horizontal, c, visited)
+	})
+}
+
+// borderStyleDict returns the border style dict of an annotation, creating it if missing.
+func borderStyleDict(xRefTable *XRefTable, dict *PDFDict) (*PDFDict, error) {
+
+	bs, err := xRefTable.DereferenceDict(dict.Dict["BS"])
+	if err != nil {
+		return nil, err
+	}
+
+	if bs == nil {
+		bs = &PDFDict{Dict: map[string]PDFObject{"Type": PDFName("Border")}}
+		dict.Update("BS", *bs)
+	}
+
+	return bs, nil
+}
+
+// SetAnnotationDashPattern sets a dashed border style for annotation obj#objNr.
+// An empty dash array reverts to a solid border.
+func SetAnnotationDashPattern(xRefTable *XRefTable, objNr int, dash []float64) error {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return err
+	}
+
+	if len(dash) > 2 {
+		return errors.Errorf("SetAnnotationDashPattern: dash array with more than 2 elements: %v", dash)
+	}
+
+	for _, f := range dash {
+		if f <= 0 {
+			return errors.Errorf("SetAnnotationDashPattern: dash array with non positive element: %v", dash)
+		}
+	}
+
+	var old PDFObject
+	if bs, err := xRefTable.DereferenceDict(d.Dict["BS"]); err == nil && bs != nil {
+		old = copyDict(*bs)
+	}
+
+	bs, err := borderStyleDict(xRefTable, d)
+	if err != nil {
+		return err
+	}
+
+	if len(dash) == 0 {
+		bs.Update("S", PDFName("S"))
+		bs.Delete("D")
+	} else {
+		bs.Update("S", PDFName("D"))
+		bs.Update("D", NewNumberArray(dash...))
+	}
+
+	xRefTable.recordAnnotationChange(AnnotationEdited, objNr, "BS", old, copyDict(*bs))
+
+	return validateBorderStyleDict(xRefTable, d, "annotDict", "BS", OPTIONAL, V10)
+}
+
+// interiorColorSubtypes are the annotation subtypes with an interior color IC subject to SetAnnotationInteriorColor.
+var interiorColorSubtypes = []string{"Square", "Circle", "Line", "Polygon"}
+
+// SetAnnotationInteriorColor sets the interior color of the Square, Circle, Line or Polygon annotation obj#objNr
+// to rgb with components clamped to 0..1, or to transparent using an empty IC array.
+func SetAnnotationInteriorColor(xRefTable *XRefTable, objNr int, rgb [3]float64, transparent bool) error {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return err
+	}
+
+	if st := d.Subtype(); st == nil || !memberOf(*st, interiorColorSubtypes) {
+		return errors.Errorf("SetAnnotationInteriorColor: obj#%d: no interior color for subtype %v", objNr, d.Subtype())
+	}
+
+	ic := PDFArray{}
+
+	if !transparent {
+		for _, f := range rgb {
+			ic = append(ic, PDFFloat(math.Max(0, math.Min(1, f))))
+		}
+	}
+
+	setAnnotationEntry(xRefTable, objNr, d, "IC", ic)
+
+	return validateEntryIC(xRefTable, d, "annotDict", OPTIONAL, V10)
+}
+
+// RemoveAnnotationsOnPageRange removes all annotations selected by filter from the pages from through to.
+// Removal follows the rules of RemoveAnnotations: popups go along with their parents wherever they live,
+// replies become standalone, widgets get detached and unreferenced appearances get freed.
+// Returns the number of annotations selected by filter that got removed.
+func RemoveAnnotationsOnPageRange(xRefTable *XRefTable, from, to int, filter AnnotationFilter) (int, error) {
+
+	n, err := pageCount(xRefTable)
+	if err != nil {
+		return 0, err
+	}
+
+	if from < 1 || from > to || to > n {
+		return 0, errors.Errorf("RemoveAnnotationsOnPageRange: invalid page range %d-%d, page count: %d", from, to, n)
+	}
+
+	return removeAnnotations(xRefTable, func(pageNr int, d *PDFDict) bool {
+		return pageNr >= from && pageNr <= to && (filter == nil || filter(pageNr, d))
+	})
+}
+
+// collectRefs adds the object numbers of all indirect references of obj to refs.
+func collectRefs(obj PDFObject, refs IntSet) {
+
+	switch o := obj.(type) {
+
+	case PDFIndirectRef:
+		refs[o.ObjectNumber.Value()] = true
+
+	case PDFDict:
+		for _, v := range o.Dict {
+			collectRefs(v, refs)
+		}
+
+	case PDFStreamDict:
+		collectRefs(o.PDFDict, refs)
+
+	case PDFArray:
+		for _, v := range o {
+			collectRefs(v, refs)
+		}
+
+	}
+}
+
+// dropArrayRefs removes all references to objNrs from the array d[key], which may be an indirect object.
+func dropArrayRefs(xRefTable *XRefTable, d *PDFDict, key string, objNrs IntSet) error {
+
+	obj, found := d.Find(key)
+	if !found || obj == nil {
+		return nil
+	}
+
+	arr, err := xRefTable.DereferenceArray(obj)
+	if err != nil || arr == nil {
+		return err
+	}
+
+	a := PDFArray{}
+	for _, v := range *arr {
+		if indRef, ok := v.(PDFIndirectRef); ok && objNrs[indRef.ObjectNumber.Value()] {
+			continue
+		}
+		a = append(a, v)
+	}
+
+	if indRef, ok := obj.(PDFIndirectRef); ok {
+		if entry, found := xRefTable.FindTableEntryForIndRef(&indRef); found {
+			entry.Object = a
+			return nil
+		}
+	}
+
+	d.Update(key, a)
+
+	return nil
+}
+
+// detachWidgets removes the removed widget annotation dicts from the Kids of their parent fields
+// or from the Fields of the AcroForm.
+func detachWidgets(xRefTable *XRefTable, widgets []*PDFDict, objNrs IntSet) error {
+
+	if len(widgets) == 0 {
+		return nil
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	acroForm, err := xRefTable.DereferenceDict(rootDict.Dict["AcroForm"])
+	if err != nil {
+		return err
+	}
+
+	for _, d := range widgets {
+
+		parent, err := xRefTable.DereferenceDict(d.Dict["Parent"])
+		if err != nil {
+			return err
+		}
+
+		if parent != nil {
+			err = dropArrayRefs(xRefTable, parent, "Kids", objNrs)
+		} else if acroForm != nil {
+			err = dropArrayRefs(xRefTable, acroForm, "Fields", objNrs)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveAnnotations removes all annotations of the given subtypes from the pages pageNrs.
+// An empty pageNrs selects all pages, empty subtypes select all annotations.
+// Popup annotations of removed annotations are removed along with them,
+// replies (IRT) to removed annotations become standalone annotations
+// and removed widgets get detached from their fields.
+// Removed annotation objects and their appearances no longer referenced get freed.
+// Emptied Annots arrays are removed. The relative order of the remaining annotations is preserved,
+// so a trailing TrapNet annotation remains the last entry.
+// Returns the number of annotations selected by pageNrs and subtypes that got removed.
+func RemoveAnnotations(xRefTable *XRefTable, pageNrs []int, subtypes []string) (int, error) {
+
+	n, err := pageCount(xRefTable)
+	if err != nil {
+		return 0, err
+	}
+
+	pages := IntSet{}
+	for _, pageNr := range pageNrs {
+		if pageNr < 1 || pageNr > n {
+			return 0, errors.Errorf("RemoveAnnotations: invalid page number %d, page count: %d", pageNr, n)
+		}
+		pages[pageNr] = true
+	}
+
+	var filter AnnotationFilter
+	if len(subtypes) > 0 {
+		filter = AnnotationSubtypeFilter(subtypes...)
+	}
+
+	return removeAnnotations(xRefTable, func(pageNr int, d *PDFDict) bool {
+		return (len(pages) == 0 || pages[pageNr]) && (filter == nil || filter(pageNr, d))
+	})
+}
+
+// removeAnnotations removes all annotations selected, see RemoveAnnotations.
+// This is the single removal path shared by all functions removing annotations.
+func removeAnnotations(xRefTable *XRefTable, selected AnnotationFilter) (int, error) {
+
+	return removeSelectedAnnotations(xRefTable, func(pageNr int, indRef *PDFIndirectRef, d *PDFDict) bool {
+		return selected(pageNr, d)
+	})
+}
+
+// removeAnnotationsByObjNr removes the annotations objNrs, see removeAnnotations.
+func removeAnnotationsByObjNr(xRefTable *XRefTable, objNrs IntSet) (int, error) {
+
+	return removeSelectedAnnotations(xRefTable, func(pageNr int, indRef *PDFIndirectRef, d *PDFDict) bool {
+		return indRef != nil && objNrs[indRef.ObjectNumber.Value()]
+	})
+}
+
+// removeSelectedAnnotations removes all annotations selected along with their popups.
+// Replies and remaining popups lose their references to removed annotations, removed widgets get detached
+// from the AcroForm and appearances no longer referenced get freed.
+func removeSelectedAnnotations(xRefTable *XRefTable, selected func(pageNr int, indRef *PDFIndirectRef, d *PDFDict) bool) (int, error) {
+
+	removed := 0
+
+	// Object numbers of indirect annotations to be removed including their popups.
+	objNrs := IntSet{}
+
+	// Candidates for freeing once no longer referenced.
+	candidates := IntSet{}
+
+	var widgets []*PDFDict
+
+	remove := func(indRef *PDFIndirectRef, d *PDFDict) error {
+
+		if indRef != nil {
+			objNrs[indRef.ObjectNumber.Value()] = true
+		}
+
+		if popup := d.IndirectRefEntry("Popup"); popup != nil {
+			objNrs[popup.ObjectNumber.Value()] = true
+		}
+
+		if st := d.Subtype(); st != nil && *st == "Widget" {
+			widgets = append(widgets, d)
+		}
+
+		return collectAppearances(xRefTable, d, candidates)
+	}
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		if !selected(pageNr, indRef, annotDict) {
+			return nil
+		}
+		removed++
+		return remove(indRef, annotDict)
+	})
+
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	// Popups whose parent is going to be removed.
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		if indRef == nil || objNrs[indRef.ObjectNumber.Value()] {
+			return nil
+		}
+		st, parent := annotDict.Subtype(), annotDict.IndirectRefEntry("Parent")
+		if st != nil && *st == "Popup" && parent != nil && objNrs[parent.ObjectNumber.Value()] {
+			return remove(indRef, annotDict)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = visitPages(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, pageDict *PDFDict) error {
+
+		obj, _ := pageDict.Find("Annots")
+
+		arr, update, err := annotsArray(xRefTable, pageDict)
+		if err != nil || len(arr) == 0 {
+			return err
+		}
+
+		a := PDFArray{}
+
+		for _, v := range arr {
+
+			var objNr int
+			if indRef, ok := v.(PDFIndirectRef); ok {
+				objNr = indRef.ObjectNumber.Value()
+				if objNrs[objNr] {
+					continue
+				}
+			}
+
+			d, err := xRefTable.DereferenceDict(v)
+			if err != nil {
+				return err
+			}
+
+			if d != nil && objNr == 0 && selected(pageNr, nil, d) {
+				xRefTable.recordAnnotationChange(AnnotationRemoved, 0, "", nil, nil)
+				continue
+			}
+
+			if d != nil {
+				// Don't leave dangling references.
+				if irt := d.IndirectRefEntry("IRT"); irt != nil && objNrs[irt.ObjectNumber.Value()] {
+					setAnnotationEntry(xRefTable, objNr, d, "IRT", nil)
+					setAnnotationEntry(xRefTable, objNr, d, "RT", nil)
+				}
+				if popup := d.IndirectRefEntry("Popup"); popup != nil && objNrs[popup.ObjectNumber.Value()] {
+					setAnnotationEntry(xRefTable, objNr, d, "Popup", nil)
+				}
+			}
+
+			a = append(a, v)
+		}
+
+		if len(a) == len(arr) {
+			return nil
+		}
+
+		update(a)
+
+		if indRef, ok := obj.(PDFIndirectRef); ok && len(a) == 0 {
+			return xRefTable.DeleteObject(indRef.ObjectNumber.Value())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err = detachWidgets(xRefTable, widgets, objNrs); err != nil {
+		return 0, err
+	}
+
+	for objNr := range objNrs {
+		if !xRefTable.Exists(objNr) {
+			continue
+		}
+		xRefTable.recordAnnotationChange(AnnotationRemoved, objNr, "", nil, nil)
+		if err = xRefTable.DeleteObject(objNr); err != nil {
+			return 0, err
+		}
+	}
+
+	// Free appearances no longer referenced by any remaining object.
+	if err = freeUnreferenced(xRefTable, candidates); err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// collectAppearances adds the indirect appearance dict and appearance streams of annotDict to objNrs.
+func collectAppearances(xRefTable *XRefTable, annotDict *PDFDict, objNrs IntSet) error {
+
+	if indRef, ok := annotDict.Dict["AP"].(PDFIndirectRef); ok {
+		objNrs[indRef.ObjectNumber.Value()] = true
+	}
+
+	return visitAppearanceStreams(xRefTable, annotDict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+		if indRef != nil {
+			objNrs[indRef.ObjectNumber.Value()] = true
+		}
+		return nil
+	})
+}
+
+// freeUnreferenced frees all candidates no longer referenced by any other object.
+// Candidates still in use keep the objects they refer to alive.
+func freeUnreferenced(xRefTable *XRefTable, candidates IntSet) error {
+
+	refs := IntSet{}
+	for objNr, entry := range xRefTable.Table {
+		if entry.Free || candidates[objNr] {
+			continue
+		}
+		collectRefs(entry.Object, refs)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for objNr := range candidates {
+			if !refs[objNr] {
+				continue
+			}
+			delete(candidates, objNr)
+			changed = true
+			if entry, found := xRefTable.Find(objNr); found {
+				collectRefs(entry.Object, refs)
+			}
+		}
+	}
+
+	for objNr := range candidates {
+		if entry, found := xRefTable.Find(objNr); !found || entry.Free || entry.Compressed {
+			continue
+		}
+		if err := xRefTable.DeleteObject(objNr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appearanceMatrix returns the transformation from the form space of an appearance stream
+// into default user space, see 12.5.5 Algorithm 8.1
+func appearanceMatrix(xRefTable *XRefTable, sd *PDFStreamDict, rect types.Rectangle) (matrix, error) {
+
+	f, err := formMatrix(xRefTable, sd)
+	if err != nil {
+		return identMatrix, err
+	}
+
+	a, err := appearanceRectMatrix(xRefTable, sd, rect)
+	if err != nil {
+		return identMatrix, err
+	}
+
+	return newMatrix(f).multiply(a), nil
+}
+
+// appearanceRectMatrix returns the matrix A of Algorithm 8.1 mapping the transformed BBox
+// of an appearance stream onto rect.
+func appearanceRectMatrix(xRefTable *XRefTable, sd *PDFStreamDict, rect types.Rectangle) (matrix, error) {
+
+	tb, err := transformedBBox(xRefTable, sd)
+	if err != nil {
+		return identMatrix, err
+	}
+
+	if tb.Width() == 0 || tb.Height() == 0 {
+		return identMatrix, errors.New("appearanceMatrix: empty BBox")
+	}
+
+	a := translationMatrix(-tb.LL.X, -tb.LL.Y).
+		multiply(scaleMatrix(rect.Width()/tb.Width(), rect.Height()/tb.Height())).
+		multiply(translationMatrix(rect.LL.X, rect.LL.Y))
+
+	return a, nil
+}
+
+// CropAnnotationAppearanceToBBox tightens the BBox of all appearance streams of annotation obj#objNr
+// to the bounds of their drawn content. Rect shrinks accordingly so the appearance keeps its position
+// and size on the page. Only Matrix entries preserving axis alignment are supported.
+func CropAnnotationAppearanceToBBox(xRefTable *XRefTable, objNr int) error {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return err
+	}
+
+	f, err := numbers(xRefTable, d.Dict["Rect"])
+	if err != nil || len(f) != 4 {
+		return errors.Errorf("CropAnnotationAppearanceToBBox: obj#%d corrupt Rect", objNr)
+	}
+	rect := types.NewRectangle(math.Min(f[0], f[2]), math.Min(f[1], f[3]), math.Max(f[0], f[2]), math.Max(f[1], f[3]))
+
+	type appearance struct {
+		sd *PDFStreamDict
+		m  matrix
+	}
+
+	var (
+		aa      []appearance
+		newRect *types.Rectangle
+	)
+
+	err = visitAppearanceStreams(xRefTable, d, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+		m, err := appearanceMatrix(xRefTable, sd, rect)
+		if err != nil {
+			return err
+		}
+
+		if m[0][1] != 0 || m[1][0] != 0 {
+			if m[0][0] != 0 || m[1][1] != 0 {
+				return errors.Errorf("CropAnnotationAppearanceToBBox: obj#%d unsupported Matrix for %s appearance", objNr, key)
+			}
+		}
+
+		r, err := contentBounds(xRefTable, sd)
+		if err != nil {
+			return err
+		}
+
+		if r != nil {
+			newRect = unionRect(newRect, transformRect(m, *r))
+		}
+
+		aa = append(aa, appearance{sd, m})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if newRect == nil {
+		// Nothing to crop.
+		return nil
+	}
+
+	for _, a := range aa {
+
+		inv, err := invertMatrix(a.m)
+		if err != nil {
+			return err
+		}
+
+		bbox := transformRect(inv, *newRect)
+		a.sd.Update("BBox", NewRectangle(bbox.LL.X, bbox.LL.Y, bbox.UR.X, bbox.UR.Y))
+	}
+
+	setAnnotationEntry(xRefTable, objNr, d, "Rect", NewRectangle(newRect.LL.X, newRect.LL.Y, newRect.UR.X, newRect.UR.Y))
+
+	return nil
+}
+
+// SetAnnotationCreationDate sets the creation date of the markup annotation obj#objNr.
+func SetAnnotationCreationDate(xRefTable *XRefTable, objNr int, t time.Time) error {
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		return err
+	}
+
+	if !isMarkupAnnotation(d) {
+		return errors.Errorf("SetAnnotationCreationDate: obj#%d is not a markup annotation: %s", objNr, *d.Subtype())
+	}
+
+	setAnnotationEntry(xRefTable, objNr, d, "CreationDate", DateStringLiteral(t))
+
+	return nil
+}
+
+// ShiftAnnotationDatesBy shifts the dates CreationDate and M of all annotations by d preserving their timezones.
+// Unparseable dates are skipped. Returns the number of annotations changed.
+func ShiftAnnotationDatesBy(xRefTable *XRefTable, d time.Duration) (int, error) {
+
+	changed := 0
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		objNr := 0
+		if indRef != nil {
+			objNr = indRef.ObjectNumber.Value()
+		}
+
+		shifted := false
+
+		for _, entryName := range []string{"CreationDate", "M"} {
+
+			s, err := stringValue(xRefTable, annotDict.Dict[entryName])
+			if err != nil || s == nil {
+				continue
+			}
+
+			t, ok := parseDate(*s)
+			if !ok {
+				continue
+			}
+
+			setAnnotationEntry(xRefTable, objNr, annotDict, entryName, DateStringLiteral(t.Add(d)))
+			shifted = true
+		}
+
+		if shifted {
+			changed++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
+
+// CombineInkStrokes merges the Ink annotations objNrs of a single page into a new Ink annotation
+// whose InkList concatenates all paths in order of objNrs and whose Rect is the union of all rectangles.
+// The new annotation takes over the style of the first annotation, but no appearance and no Popup.
+// The original annotations get removed along with their Popup annotations.
+// Returns the object number of the new annotation.
+func CombineInkStrokes(xRefTable *XRefTable, objNrs []int) (int, error) {
+
+	if len(objNrs) < 2 {
+		return 0, errors.New("CombineInkStrokes: need at least 2 annotations")
+	}
+
+	var (
+		inkList PDFArray
+		rect    []float64
+		pageNr  int
+		first   *PDFDict
+	)
+
+	seen := IntSet{}
+
+	for _, objNr := range objNrs {
+
+		if seen[objNr] {
+			return 0, errors.Errorf("CombineInkStrokes: duplicate obj#%d", objNr)
+		}
+		seen[objNr] = true
+
+		d, err := annotDictOfSubtype(xRefTable, objNr, "Ink")
+		if err != nil {
+			return 0, err
+		}
+
+		i, err := annotPageNr(xRefTable, objNr)
+		if err != nil {
+			return 0, err
+		}
+
+		if first == nil {
+			first, pageNr = d, i
+		} else if i != pageNr {
+			return 0, errors.Errorf("CombineInkStrokes: obj#%d is on page %d, want page %d", objNr, i, pageNr)
+		}
+
+		arr, err := xRefTable.DereferenceArray(d.Dict["InkList"])
+		if err != nil || arr == nil {
+			return 0, errors.Errorf("CombineInkStrokes: obj#%d corrupt InkList", objNr)
+		}
+
+		inkList = append(inkList, *arr...)
+
+		f, err := numbers(xRefTable, d.Dict["Rect"])
+		if err != nil || len(f) != 4 {
+			return 0, errors.Errorf("CombineInkStrokes: obj#%d corrupt Rect", objNr)
+		}
+
+		llx, lly, urx, ury := math.Min(f[0], f[2]), math.Min(f[1], f[3]), math.Max(f[0], f[2]), math.Max(f[1], f[3])
+
+		if rect == nil {
+			rect = []float64{llx, lly, urx, ury}
+			continue
+		}
+
+		rect = []float64{math.Min(rect[0], llx), math.Min(rect[1], lly), math.Max(rect[2], urx), math.Max(rect[3], ury)}
+	}
+
+	d := copyDict(*first)
+	d.Update("InkList", inkList)
+	d.Update("Rect", NewNumberArray(rect...))
+
+	for _, k := range []string{"AP", "AS", "Popup", "NM", "IRT", "RT"} {
+		d.Delete(k)
+	}
+
+	if _, err := validateAnnotationDict(xRefTable, &d); err != nil {
+		return 0, err
+	}
+
+	indRef, err := addAnnotation(xRefTable, pageNr, d)
+	if err != nil {
+		return 0, err
+	}
+
+	// Remove the merged annotations along with their popups and appearances.
+	if _, err = removeAnnotationsByObjNr(xRefTable, seen); err != nil {
+		return 0, err
+	}
+
+	return indRef.ObjectNumber.Value(), nil
+}
+
+// normalAppearance returns the normal appearance stream of annotDict as selected by its appearance state.
+func normalAppearance(xRefTable *XRefTable, annotDict *PDFDict) (PDFObject, error) {
+
+	ap, err := xRefTable.DereferenceDict(annotDict.Dict["AP"])
+	if err != nil || ap == nil {
+		return nil, err
+	}
+
+	obj, found := ap.Find("N")
+	if !found || obj == nil {
+		return nil, nil
+	}
+
+	o, err := xRefTable.Dereference(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	d, ok := o.(PDFDict)
+	if !ok {
+		return obj, nil
+	}
+
+	// N is a subdictionary of appearance states.
+	as := annotDict.NameEntry("AS")
+	if as == nil {
+		return nil, nil
+	}
+
+	return d.Dict[*as], nil
+}
+
+// MaskAnnotationsForPrinting makes the printed output of all pages match their on screen markup.
+// The Print flag gets set for all visible markup annotations and cleared for Popup and hidden annotations.
+// Appearance dicts of markup annotations are reduced to the normal appearance currently shown.
+func MaskAnnotationsForPrinting(xRefTable *XRefTable) error {
+
+	return visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		objNr := 0
+		if indRef != nil {
+			objNr = indRef.ObjectNumber.Value()
+		}
+
+		f := 0
+		if i := annotDict.IntEntry("F"); i != nil {
+			f = *i
+		}
+
+		st := annotDict.Subtype()
+		markup := isMarkupAnnotation(annotDict)
+		screenOnly := (st != nil && *st == "Popup") || f&annotFlagHidden > 0
+
+		switch {
+
+		case screenOnly && f&annotFlagPrint > 0:
+			setAnnotationEntry(xRefTable, objNr, annotDict, "F", PDFInteger(f&^annotFlagPrint))
+
+		case markup && !screenOnly && f&annotFlagPrint == 0:
+			setAnnotationEntry(xRefTable, objNr, annotDict, "F", PDFInteger(f|annotFlagPrint))
+
+		}
+
+		if !markup || screenOnly {
+			return nil
+		}
+
+		ap, err := xRefTable.DereferenceDict(annotDict.Dict["AP"])
+		if err != nil || ap == nil {
+			return err
+		}
+
+		if ap.Len() == 1 {
+			if sd, err := xRefTable.DereferenceStreamDict(ap.Dict["N"]); err == nil && sd != nil {
+				// Already flat.
+				return nil
+			}
+		}
+
+		n, err := normalAppearance(xRefTable, annotDict)
+		if err != nil {
+			return err
+		}
+
+		if n == nil {
+			// No appearance to be printed.
+			setAnnotationEntry(xRefTable, objNr, annotDict, "AP", nil)
+		} else {
+			setAnnotationEntry(xRefTable, objNr, annotDict, "AP", PDFDict{Dict: map[string]PDFObject{"N": n}})
+		}
+
+		if _, found := annotDict.Find("AS"); found {
+			setAnnotationEntry(xRefTable, objNr, annotDict, "AS", nil)
+		}
+
+		return nil
+	})
+}
+
+// cmykColor converts a DeviceGray or DeviceRGB color to DeviceCMYK, see 10.4.2
+func cmykColor(f []float64) []float64 {
+
+	if len(f) == 1 {
+		return []float64{0, 0, 0, 1 - f[0]}
+	}
+
+	k := 1 - math.Max(f[0], math.Max(f[1], f[2]))
+	if k == 1 {
+		return []float64{0, 0, 0, 1}
+	}
+
+	return []float64{(1 - f[0] - k) / (1 - k), (1 - f[1] - k) / (1 - k), (1 - f[2] - k) / (1 - k), k}
+}
+
+// ConvertAnnotationColorsToCMYK converts the gray and RGB colors C and IC of all annotations selected by filter to CMYK.
+// Appearance streams are not touched. Returns the number of annotations changed.
+func ConvertAnnotationColorsToCMYK(xRefTable *XRefTable, filter AnnotationFilter) (int, error) {
+
+	changed := 0
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if filter != nil && !filter(pageNr, annotDict) {
+			return nil
+		}
+
+		objNr := 0
+		if indRef != nil {
+			objNr = indRef.ObjectNumber.Value()
+		}
+
+		converted := false
+
+		for _, entryName := range []string{"C", "IC"} {
+
+			obj, found := annotDict.Find(entryName)
+			if !found || obj == nil {
+				continue
+			}
+
+			f, err := numbers(xRefTable, obj)
+			if err != nil {
+				return err
+			}
+
+			switch len(f) {
+
+			case 0, 4:
+				// Transparent or CMYK already.
+				continue
+
+			case 1, 3:
+				setAnnotationEntry(xRefTable, objNr, annotDict, entryName, NewNumberArray(cmykColor(f)...))
+				converted = true
+
+			default:
+				return errors.Errorf("ConvertAnnotationColorsToCMYK: page %d obj#%d corrupt %s: %v", pageNr, objNr, entryName, f)
+			}
+		}
+
+		if !converted {
+			return nil
+		}
+
+		changed++
+
+		_, err := validateAnnotationDict(xRefTable, annotDict)
+
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
+
+// annotationObjects returns the object numbers of all annotations along with their Popup annotations,
+// appearance dicts and appearance streams in page order.
+// Objects stored in object streams are not included.
+func annotationObjects(xRefTable *XRefTable) ([]int, error) {
+
+	var objNrs []int
+
+	seen := IntSet{}
+
+	add := func(obj PDFObject) {
+
+		indRef, ok := obj.(PDFIndirectRef)
+		if !ok {
+			return
+		}
+
+		objNr := indRef.ObjectNumber.Value()
+		if seen[objNr] {
+			return
+		}
+		seen[objNr] = true
+
+		if entry, found := xRefTable.Find(objNr); found && !entry.Free && !entry.Compressed {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if indRef != nil {
+			add(*indRef)
+		}
+
+		add(annotDict.Dict["Popup"])
+		add(annotDict.Dict["AP"])
+
+		return visitAppearanceStreams(xRefTable, annotDict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+			if indRef != nil {
+				add(*indRef)
+			}
+			return nil
+		})
+	})
+
+	return objNrs, err
+}
+
+// renumberRefs returns obj with all indirect references replaced according to m.
+// Dicts and arrays get copied, so obj remains unchanged.
+func renumberRefs(obj PDFObject, m map[int]PDFIndirectRef) PDFObject {
+
+	switch o := obj.(type) {
+
+	case PDFIndirectRef:
+		if indRef, found := m[o.ObjectNumber.Value()]; found {
+			return indRef
+		}
+
+	case PDFDict:
+		d := NewPDFDict()
+		for k, v := range o.Dict {
+			d.Dict[k] = renumberRefs(v, m)
+		}
+		return d
+
+	case PDFStreamDict:
+		sd := o
+		sd.PDFDict = renumberRefs(o.PDFDict, m).(PDFDict)
+		return sd
+
+	case PDFArray:
+		a := make(PDFArray, len(o))
+		for i, v := range o {
+			a[i] = renumberRefs(v, m)
+		}
+		return a
+
+	}
+
+	return obj
+}
+
+// renumberDictRefs replaces the indirect references of all entries of dict obj#objNr according to m in place.
+// Changes to annotation dicts get recorded.
+func renumberDictRefs(xRefTable *XRefTable, objNr int, dict *PDFDict, annot bool, m map[int]PDFIndirectRef) {
+
+	for k, v := range dict.Dict {
+
+		refs := IntSet{}
+		collectRefs(v, refs)
+
+		changed := false
+		for r := range refs {
+			if _, found := m[r]; found {
+				changed = true
+				break
+			}
+		}
+
+		if !changed {
+			continue
+		}
+
+		if annot {
+			setAnnotationEntry(xRefTable, objNr, dict, k, renumberRefs(v, m))
+			continue
+		}
+
+		dict.Dict[k] = renumberRefs(v, m)
+	}
+}
+
+// RenumberAnnotations moves all annotations along with their Popup annotations and appearance streams
+// into a contiguous range of object numbers as low as possible, reusing the numbers of free objects.
+// All references get updated accordingly and free objects at the end of the table are dropped.
+// Returns the number of objects renumbered.
+func RenumberAnnotations(xRefTable *XRefTable) (int, error) {
+
+	objNrs, err := annotationObjects(xRefTable)
+	if err != nil || len(objNrs) == 0 {
+		return 0, err
+	}
+
+	annots := IntSet{}
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		if indRef != nil {
+			annots[indRef.ObjectNumber.Value()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	candidates := xRefTable.freeObjects()
+	for _, objNr := range objNrs {
+		candidates[objNr] = true
+	}
+
+	size := *xRefTable.Size
+
+	// Find the lowest range of free or annotation object numbers, possibly extending the table.
+	start := 1
+	for i := start; i < start+len(objNrs) && i < size; i++ {
+		if !candidates[i] {
+			start = i + 1
+		}
+	}
+
+	inRange := func(objNr int) bool { return objNr >= start && objNr < start+len(objNrs) }
+
+	m := map[int]PDFIndirectRef{}
+
+	target := start
+
+	for _, objNr := range objNrs {
+
+		if inRange(objNr) {
+			continue
+		}
+
+		for target < size && !xRefTable.Table[target].Free {
+			target++
+		}
+
+		entry := xRefTable.Table[objNr]
+
+		gen := 0
+
+		if target < size {
+			gen = *xRefTable.Table[target].Generation
+			if err = xRefTable.UndeleteObject(target); err != nil {
+				return 0, err
+			}
+		} else {
+			*xRefTable.Size++
+		}
+
+		xRefTable.Table[target] = &XRefTableEntry{Generation: &gen, Object: entry.Object}
+		m[objNr] = *NewPDFIndirectRef(target, gen)
+
+		target++
+	}
+
+	if len(m) == 0 {
+		return 0, nil
+	}
+
+	// Annotations get recorded as removed under their old and added under their new object number.
+	for _, objNr := range objNrs {
+		if indRef, moved := m[objNr]; moved && annots[objNr] {
+			xRefTable.recordAnnotationChange(AnnotationRemoved, objNr, "", nil, nil)
+			xRefTable.recordAnnotationChange(AnnotationAdded, indRef.ObjectNumber.Value(), "", nil, nil)
+			annots[indRef.ObjectNumber.Value()] = true
+		}
+	}
+
+	for objNr, entry := range xRefTable.Table {
+
+		if entry.Free || entry.Object == nil {
+			continue
+		}
+
+		if _, moved := m[objNr]; moved {
+			// Gets deleted below.
+			continue
+		}
+
+		switch o := entry.Object.(type) {
+
+		case PDFDict:
+			renumberDictRefs(xRefTable, objNr, &o, annots[objNr], m)
+
+		case PDFStreamDict:
+			renumberDictRefs(xRefTable, objNr, &o.PDFDict, false, m)
+
+		default:
+			entry.Object = renumberRefs(entry.Object, m)
+
+		}
+	}
+
+	for objNr := range m {
+		if err = xRefTable.DeleteObject(objNr); err != nil {
+			return 0, err
+		}
+	}
+
+	// Drop free objects at the end of the table.
+	for n := *xRefTable.Size - 1; n > 0; n-- {
+
+		entry, found := xRefTable.Find(n)
+		if found && !entry.Free {
+			break
+		}
+
+		if found {
+			if err = xRefTable.UndeleteObject(n); err != nil {
+				return 0, err
+			}
+			delete(xRefTable.Table, n)
+		}
+
+		*xRefTable.Size--
+	}
+
+	return len(m), nil
+}
+
+// annotationOpacity returns the constant opacity of annotDict for key CA or ca.
+func annotationOpacity(xRefTable *XRefTable, annotDict *PDFDict, key string) (float64, bool) {
+
+	obj, found := annotDict.Find(key)
+	if !found || obj == nil {
+		return 1, false
+	}
+
+	return xRefTable.DereferenceNumber(obj), true
+}
+
+// emptyAppearance returns true if none of the normal appearance streams of annotDict paints anything.
+// Missing appearances are not considered empty since viewers may generate them.
+func emptyAppearance(xRefTable *XRefTable, annotDict *PDFDict) bool {
+
+	found, painted := false, false
+
+	err := visitAppearanceStreams(xRefTable, annotDict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+		if key != "N" || painted {
+			return nil
+		}
+
+		found = true
+
+		b, err := streamContent(sd)
+		if err != nil {
+			// Unsupported filter.
+			painted = true
+			return nil
+		}
+
+		painted, err = paintsContent(b)
+		if err != nil {
+			painted = true
+		}
+
+		return nil
+	})
+
+	return err == nil && found && !painted
+}
+
+// invisibleAnnotation returns true for an annotation unable to render, see TrimAnnotationsToVisible.
+func invisibleAnnotation(xRefTable *XRefTable, annotDict *PDFDict) bool {
+
+	st := annotDict.Subtype()
+	if st == nil {
+		return false
+	}
+
+	if ca, found := annotationOpacity(xRefTable, annotDict, "CA"); found && ca == 0 {
+		if fill, found := annotationOpacity(xRefTable, annotDict, "ca"); !found || fill == 0 {
+			return true
+		}
+	}
+
+	// Widgets may get shown by form actions.
+	if f := AnnotationFlagsOf(annotDict); *st != "Widget" && f.Hidden() && !f.Print() {
+		return true
+	}
+
+	// Viewers render an icon for these regardless of their appearance, links are invisible anyway.
+	// Invisible signature fields are stored as Widgets with a Rect of zero area.
+	if memberOf(*st, []string{"Text", "FileAttachment", "Sound", "Link", "Widget", "Popup"}) {
+		return false
+	}
+
+	if r, err := numbers(xRefTable, annotDict.Dict["Rect"]); err == nil && len(r) == 4 && (r[0] == r[2] || r[1] == r[3]) {
+		return true
+	}
+
+	return emptyAppearance(xRefTable, annotDict)
+}
+
+// TrimAnnotationsToVisible removes all annotations unable to render:
+// zero opacity, hidden unless printed and, for annotations without a default icon,
+// a Rect of zero area or an appearance not painting anything. Popups of removed annotations are removed along with them.
+// Returns the number of annotations removed, see RemoveAnnotations.
+func TrimAnnotationsToVisible(xRefTable *XRefTable) (int, error) {
+
+	return removeAnnotations(xRefTable, func(pageNr int, annotDict *PDFDict) bool {
+		return invisibleAnnotation(xRefTable, annotDict)
+	})
+}
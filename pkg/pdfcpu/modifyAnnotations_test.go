@@ -0,0 +1,1010 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hhrutter/pdfcpu/pkg/types"
+)
+
+// numbersForTest returns the number array entry of an annotation.
+func numbersForTest(t *testing.T, xRefTable *XRefTable, indRef PDFIndirectRef, entryName string) []float64 {
+
+	d, err := xRefTable.DereferenceDict(indRef)
+	if err != nil {
+		t.Fatalf("numbersForTest: %v\n", err)
+	}
+
+	f, err := numbers(xRefTable, d.Dict[entryName])
+	if err != nil {
+		t.Fatalf("numbersForTest: %v\n", err)
+	}
+
+	return f
+}
+
+func TestMirrorAnnotations(t *testing.T) {
+
+	// MediaBox: 0 0 400 600
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	apIndRef := formForTest(t, xRefTable, "0 0 m 100 50 l S", NewRectangle(0, 0, 100, 50), nil)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Line"),
+			"Rect":    NewRectangle(100, 100, 200, 150),
+			"L":       NewNumberArray(100, 100, 200, 150),
+			"AP":      PDFDict{Dict: map[string]PDFObject{"N": apIndRef}},
+		},
+	}
+
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	err := MirrorAnnotations(xRefTable, 1, true)
+	if err != nil {
+		t.Fatalf("TestMirrorAnnotations: %v\n", err)
+	}
+
+	l := numbersForTest(t, xRefTable, indRef, "L")
+	if l[0] != 300 || l[1] != 100 || l[2] != 200 || l[3] != 150 {
+		t.Errorf("TestMirrorAnnotations: unexpected L: %v\n", l)
+	}
+
+	r := numbersForTest(t, xRefTable, indRef, "Rect")
+	if r[0] != 200 || r[1] != 100 || r[2] != 300 || r[3] != 150 {
+		t.Errorf("TestMirrorAnnotations: unexpected Rect: %v\n", r)
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(apIndRef)
+	if err != nil {
+		t.Fatalf("TestMirrorAnnotations: %v\n", err)
+	}
+
+	m, err := numbers(xRefTable, sd.Dict["Matrix"])
+	if err != nil {
+		t.Fatalf("TestMirrorAnnotations: %v\n", err)
+	}
+	if m[0] != -1 || m[3] != 1 {
+		t.Errorf("TestMirrorAnnotations: unexpected Matrix: %v\n", m)
+	}
+
+	// Mirroring twice restores the original geometry.
+	err = MirrorAnnotations(xRefTable, 1, true)
+	if err != nil {
+		t.Fatalf("TestMirrorAnnotations: %v\n", err)
+	}
+
+	l = numbersForTest(t, xRefTable, indRef, "L")
+	if l[0] != 100 || l[2] != 200 {
+		t.Errorf("TestMirrorAnnotations: unexpected L: %v\n", l)
+	}
+
+	// An invalid annotation leaves the page untouched.
+	invalid := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	invalid.Insert("F", PDFName("Print"))
+	addAnnotForTest(t, xRefTable, 1, invalid)
+
+	if err = MirrorAnnotations(xRefTable, 1, true); err == nil {
+		t.Fatalf("TestMirrorAnnotations: invalid annotation => not ok!\n")
+	}
+
+	l = numbersForTest(t, xRefTable, indRef, "L")
+	if l[0] != 100 || l[2] != 200 {
+		t.Errorf("TestMirrorAnnotations: page partially mirrored, L: %v\n", l)
+	}
+}
+
+func TestSetAnnotationDashPattern(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	indRef := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	objNr := indRef.ObjectNumber.Value()
+
+	borderStyle := func() *PDFDict {
+		d, err := annotDict(xRefTable, objNr)
+		if err != nil {
+			t.Fatalf("TestSetAnnotationDashPattern: %v\n", err)
+		}
+		bs := d.PDFDictEntry("BS")
+		if bs == nil {
+			t.Fatalf("TestSetAnnotationDashPattern: missing BS\n")
+		}
+		return bs
+	}
+
+	err := SetAnnotationDashPattern(xRefTable, objNr, []float64{3, 2})
+	if err != nil {
+		t.Fatalf("TestSetAnnotationDashPattern: %v\n", err)
+	}
+
+	bs := borderStyle()
+	if s := bs.NameEntry("S"); s == nil || *s != "D" {
+		t.Errorf("TestSetAnnotationDashPattern: expected S=D, got %v\n", s)
+	}
+	if f, _ := numbers(xRefTable, bs.Dict["D"]); len(f) != 2 || f[0] != 3 || f[1] != 2 {
+		t.Errorf("TestSetAnnotationDashPattern: unexpected D: %v\n", f)
+	}
+
+	err = SetAnnotationDashPattern(xRefTable, objNr, nil)
+	if err != nil {
+		t.Fatalf("TestSetAnnotationDashPattern: %v\n", err)
+	}
+
+	bs = borderStyle()
+	if s := bs.NameEntry("S"); s == nil || *s != "S" {
+		t.Errorf("TestSetAnnotationDashPattern: expected S=S, got %v\n", s)
+	}
+	if _, found := bs.Find("D"); found {
+		t.Errorf("TestSetAnnotationDashPattern: D not cleared\n")
+	}
+
+	if err = SetAnnotationDashPattern(xRefTable, objNr, []float64{3, 0}); err == nil {
+		t.Errorf("TestSetAnnotationDashPattern: zero dash => not ok!\n")
+	}
+
+	if err = SetAnnotationDashPattern(xRefTable, objNr, []float64{3, 2, 1}); err == nil {
+		t.Errorf("TestSetAnnotationDashPattern: 3 element dash => not ok!\n")
+	}
+}
+
+func TestSetAnnotationInteriorColor(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	indRef := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	objNr := indRef.ObjectNumber.Value()
+
+	err := SetAnnotationInteriorColor(xRefTable, objNr, [3]float64{0.2, 1.5, -1}, false)
+	if err != nil {
+		t.Fatalf("TestSetAnnotationInteriorColor: %v\n", err)
+	}
+
+	if f := numbersForTest(t, xRefTable, indRef, "IC"); fmt.Sprint(f) != "[0.2 1 0]" {
+		t.Errorf("TestSetAnnotationInteriorColor: want clamped IC [0.2 1 0], got %v\n", f)
+	}
+
+	if err = SetAnnotationInteriorColor(xRefTable, objNr, [3]float64{}, true); err != nil {
+		t.Fatalf("TestSetAnnotationInteriorColor: %v\n", err)
+	}
+
+	if f := numbersForTest(t, xRefTable, indRef, "IC"); len(f) != 0 {
+		t.Errorf("TestSetAnnotationInteriorColor: want transparent IC, got %v\n", f)
+	}
+
+	d, err := annotDict(xRefTable, objNr)
+	if err != nil {
+		t.Fatalf("TestSetAnnotationInteriorColor: %v\n", err)
+	}
+	doTestValidateAnnotOK(t, xRefTable, *d, ValidationStrict)
+
+	ink := addAnnotForTest(t, xRefTable, 1, inkAnnotForTest(NewRectangle(0, 0, 100, 100), NewNumberArray(10, 10, 20, 20)))
+	if err = SetAnnotationInteriorColor(xRefTable, ink.ObjectNumber.Value(), [3]float64{1, 0, 0}, false); err == nil {
+		t.Errorf("TestSetAnnotationInteriorColor: expected error for Ink annotation\n")
+	}
+}
+
+func highlightAnnotForTest() PDFDict {
+
+	return PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":       PDFName("Annot"),
+			"Subtype":    PDFName("Highlight"),
+			"Rect":       NewRectangle(10, 10, 110, 30),
+			"QuadPoints": NewNumberArray(10, 30, 110, 30, 10, 10, 110, 10),
+		},
+	}
+}
+
+func TestRemoveAnnotationsOnPageRange(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 4)
+
+	for pageNr := 1; pageNr <= 4; pageNr++ {
+		addAnnotForTest(t, xRefTable, pageNr, highlightAnnotForTest())
+		addAnnotForTest(t, xRefTable, pageNr, squareAnnotForTest(NewRectangle(10, 50, 50, 90)))
+	}
+
+	n, err := RemoveAnnotationsOnPageRange(xRefTable, 2, 3, AnnotationSubtypeFilter("Highlight"))
+	if err != nil {
+		t.Fatalf("TestRemoveAnnotationsOnPageRange: %v\n", err)
+	}
+
+	if n != 2 {
+		t.Errorf("TestRemoveAnnotationsOnPageRange: expected 2 removed annotations, got %d\n", n)
+	}
+
+	for pageNr, want := range []int{2, 1, 1, 2} {
+
+		pageDict, _ := pageForTest(t, xRefTable, pageNr+1)
+
+		got := 0
+		if arr := pageDict.PDFArrayEntry("Annots"); arr != nil {
+			got = len(*arr)
+		}
+
+		if got != want {
+			t.Errorf("TestRemoveAnnotationsOnPageRange: page %d: expected %d annotations, got %d\n", pageNr+1, want, got)
+		}
+	}
+
+	if _, err = RemoveAnnotationsOnPageRange(xRefTable, 3, 5, nil); err == nil {
+		t.Errorf("TestRemoveAnnotationsOnPageRange: invalid page range => not ok!\n")
+	}
+
+	// A popup living on another page and a reply must not be left dangling.
+	square := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	squareIndRef := addAnnotForTest(t, xRefTable, 1, square)
+
+	popupIndRef := addAnnotForTest(t, xRefTable, 2, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(60, 10, 160, 60),
+			"Parent":  squareIndRef,
+		},
+	})
+	square.Insert("Popup", popupIndRef)
+
+	reply := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Text"),
+			"Rect":     NewRectangle(10, 60, 30, 80),
+			"Contents": PDFStringLiteral("Reply"),
+			"IRT":      squareIndRef,
+		},
+	}
+	addAnnotForTest(t, xRefTable, 2, reply)
+
+	if n, err = RemoveAnnotationsOnPageRange(xRefTable, 1, 1, AnnotationSubtypeFilter("Square")); err != nil || n != 2 {
+		t.Fatalf("TestRemoveAnnotationsOnPageRange: expected 2 removed annotations, got %d %v\n", n, err)
+	}
+
+	if entry, found := xRefTable.Find(popupIndRef.ObjectNumber.Value()); found && !entry.Free {
+		t.Errorf("TestRemoveAnnotationsOnPageRange: popup not freed\n")
+	}
+
+	aa, err := xRefTable.PageAnnotations(2)
+	if err != nil {
+		t.Fatalf("TestRemoveAnnotationsOnPageRange: %v\n", err)
+	}
+
+	ss := []string{}
+	for _, a := range aa {
+		ss = append(ss, a.Subtype.String())
+	}
+
+	if got := strings.Join(ss, " "); got != "Square Text" {
+		t.Errorf("TestRemoveAnnotationsOnPageRange: page 2: expected \"Square Text\", got %q\n", got)
+	}
+
+	if _, found := reply.Find("IRT"); found {
+		t.Errorf("TestRemoveAnnotationsOnPageRange: dangling IRT\n")
+	}
+}
+
+func TestRemoveAnnotations(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 3)
+
+	linkAnnot := func(apIndRef PDFIndirectRef) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Link"),
+				"Rect":    NewRectangle(10, 100, 60, 120),
+				"AP":      PDFDict{Dict: map[string]PDFObject{"N": apIndRef}},
+			},
+		}
+	}
+
+	squareAP := formForTest(t, xRefTable, "0 0 40 40 re S", NewRectangle(0, 0, 40, 40), nil)
+	sharedAP := formForTest(t, xRefTable, "0 0 50 20 re S", NewRectangle(0, 0, 50, 20), nil)
+
+	square := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	square.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": squareAP}})
+	squareIndRef := addAnnotForTest(t, xRefTable, 1, square)
+
+	popupIndRef := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(60, 10, 160, 60),
+			"Parent":  squareIndRef,
+		},
+	})
+	square.Insert("Popup", popupIndRef)
+
+	replyIndRef := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Text"),
+			"Rect":     NewRectangle(10, 60, 30, 80),
+			"Contents": PDFStringLiteral("Reply"),
+			"IRT":      squareIndRef,
+			"RT":       PDFName("R"),
+		},
+	})
+
+	addAnnotForTest(t, xRefTable, 1, linkAnnot(sharedAP))
+	addAnnotForTest(t, xRefTable, 2, linkAnnot(sharedAP))
+	addAnnotForTest(t, xRefTable, 2, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("TrapNet"),
+			"Rect":    NewRectangle(0, 0, 10, 10),
+		},
+	})
+
+	// A direct annotation dict.
+	pageDict, _ := pageForTest(t, xRefTable, 3)
+	pageDict.Insert("Annots", PDFArray{linkAnnot(sharedAP)})
+
+	freed := func(objNr int) bool {
+		entry, found := xRefTable.Find(objNr)
+		return !found || entry.Free
+	}
+
+	n, err := RemoveAnnotations(xRefTable, []int{1, 3}, []string{"Square", "Link"})
+	if err != nil {
+		t.Fatalf("TestRemoveAnnotations: %v\n", err)
+	}
+
+	if n != 3 {
+		t.Errorf("TestRemoveAnnotations: expected 3 removed annotations, got %d\n", n)
+	}
+
+	for _, objNr := range []int{squareIndRef.ObjectNumber.Value(), popupIndRef.ObjectNumber.Value(), squareAP.ObjectNumber.Value()} {
+		if !freed(objNr) {
+			t.Errorf("TestRemoveAnnotations: obj#%d not freed\n", objNr)
+		}
+	}
+
+	if freed(sharedAP.ObjectNumber.Value()) {
+		t.Errorf("TestRemoveAnnotations: shared appearance obj#%d freed\n", sharedAP.ObjectNumber.Value())
+	}
+
+	reply, err := xRefTable.DereferenceDict(replyIndRef)
+	if err != nil || reply == nil {
+		t.Fatalf("TestRemoveAnnotations: missing reply: %v\n", err)
+	}
+
+	if _, found := reply.Find("IRT"); found {
+		t.Errorf("TestRemoveAnnotations: dangling IRT\n")
+	}
+
+	for pageNr, want := range []string{"Text", "Link TrapNet", ""} {
+
+		aa, err := xRefTable.PageAnnotations(pageNr + 1)
+		if err != nil {
+			t.Fatalf("TestRemoveAnnotations: %v\n", err)
+		}
+
+		ss := []string{}
+		for _, a := range aa {
+			ss = append(ss, a.Subtype.String())
+		}
+
+		if got := strings.Join(ss, " "); got != want {
+			t.Errorf("TestRemoveAnnotations: page %d: expected %q, got %q\n", pageNr+1, want, got)
+		}
+	}
+
+	pageDict, _ = pageForTest(t, xRefTable, 3)
+	if _, found := pageDict.Find("Annots"); found {
+		t.Errorf("TestRemoveAnnotations: empty Annots not removed\n")
+	}
+
+	// TrapNet remains the last entry.
+	if n, err = RemoveAnnotations(xRefTable, nil, []string{"Link"}); err != nil || n != 1 {
+		t.Fatalf("TestRemoveAnnotations: expected 1 removed Link, got %d %v\n", n, err)
+	}
+
+	if !freed(sharedAP.ObjectNumber.Value()) {
+		t.Errorf("TestRemoveAnnotations: orphaned appearance obj#%d not freed\n", sharedAP.ObjectNumber.Value())
+	}
+
+	if _, err = RemoveAnnotations(xRefTable, []int{4}, nil); err == nil {
+		t.Errorf("TestRemoveAnnotations: invalid page number => not ok!\n")
+	}
+}
+
+// drawnPageBoundsForTest returns the bounds of the content drawn by appearance sd of annotation indRef in default user space.
+func drawnPageBoundsForTest(t *testing.T, xRefTable *XRefTable, indRef PDFIndirectRef, sd *PDFStreamDict) []float64 {
+
+	f := numbersForTest(t, xRefTable, indRef, "Rect")
+
+	m, err := appearanceMatrix(xRefTable, sd, types.NewRectangle(f[0], f[1], f[2], f[3]))
+	if err != nil {
+		t.Fatalf("drawnPageBoundsForTest: %v\n", err)
+	}
+
+	r, err := contentBounds(xRefTable, sd)
+	if err != nil || r == nil {
+		t.Fatalf("drawnPageBoundsForTest: missing content bounds: %v\n", err)
+	}
+
+	b := transformRect(m, *r)
+
+	return []float64{b.LL.X, b.LL.Y, b.UR.X, b.UR.Y}
+}
+
+func TestCropAnnotationAppearanceToBBox(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	for _, tt := range []struct {
+		content  string
+		rect     PDFArray
+		wantBBox []float64
+		wantRect []float64
+		name     string
+	}{
+		{"0 0 1 rg 50 20 40 30 re f", NewRectangle(100, 100, 300, 200), []float64{50, 20, 90, 50}, []float64{150, 120, 190, 150}, "fill"},
+		{"0 0 1 rg 50 20 40 30 re f", NewRectangle(100, 100, 200, 150), []float64{50, 20, 90, 50}, []float64{125, 110, 145, 125}, "scaled fill"},
+		{"2 w 10 10 m 20 10 l S", NewRectangle(100, 100, 300, 200), []float64{9, 9, 21, 11}, []float64{109, 109, 121, 111}, "stroke"},
+		{"q 1 0 0 1 100 50 cm 0 0 20 10 re f Q", NewRectangle(0, 0, 200, 100), []float64{100, 50, 120, 60}, []float64{100, 50, 120, 60}, "cm"},
+	} {
+
+		apIndRef := formForTest(t, xRefTable, tt.content, NewRectangle(0, 0, 200, 100), nil)
+
+		d := PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Stamp"),
+				"Rect":    tt.rect,
+				"AP":      PDFDict{Dict: map[string]PDFObject{"N": apIndRef}},
+			},
+		}
+
+		indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+		sd, err := xRefTable.DereferenceStreamDict(apIndRef)
+		if err != nil {
+			t.Fatalf("TestCropAnnotationAppearanceToBBox %s: %v\n", tt.name, err)
+		}
+
+		before := drawnPageBoundsForTest(t, xRefTable, indRef, sd)
+
+		if err := CropAnnotationAppearanceToBBox(xRefTable, indRef.ObjectNumber.Value()); err != nil {
+			t.Fatalf("TestCropAnnotationAppearanceToBBox %s: %v\n", tt.name, err)
+		}
+
+		// The drawing keeps its size and position on the page.
+		after := drawnPageBoundsForTest(t, xRefTable, indRef, sd)
+
+		for i := 0; i < 4; i++ {
+			if math.Abs(before[i]-after[i]) > 0.001 {
+				t.Errorf("TestCropAnnotationAppearanceToBBox %s: drawn bounds %v, want %v\n", tt.name, after, before)
+				break
+			}
+		}
+
+		bbox, _ := numbers(xRefTable, sd.Dict["BBox"])
+		rect := numbersForTest(t, xRefTable, indRef, "Rect")
+
+		for i := 0; i < 4; i++ {
+			if math.Abs(bbox[i]-tt.wantBBox[i]) > 0.001 {
+				t.Errorf("TestCropAnnotationAppearanceToBBox %s: BBox %v, want %v\n", tt.name, bbox, tt.wantBBox)
+				break
+			}
+		}
+
+		for i := 0; i < 4; i++ {
+			if math.Abs(rect[i]-tt.wantRect[i]) > 0.001 {
+				t.Errorf("TestCropAnnotationAppearanceToBBox %s: Rect %v, want %v\n", tt.name, rect, tt.wantRect)
+				break
+			}
+		}
+	}
+}
+
+func TestSetAnnotationCreationDate(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	indRef := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	objNr := indRef.ObjectNumber.Value()
+
+	ts := time.Date(2018, time.March, 7, 14, 30, 5, 0, time.FixedZone("EST", -5*60*60))
+
+	if err := SetAnnotationCreationDate(xRefTable, objNr, ts); err != nil {
+		t.Fatalf("TestSetAnnotationCreationDate: %v\n", err)
+	}
+
+	d, _ := xRefTable.DereferenceDict(indRef)
+
+	s := d.StringEntry("CreationDate")
+	if s == nil || *s != "D:20180307143005-05'00'" {
+		t.Fatalf("TestSetAnnotationCreationDate: unexpected CreationDate: %v\n", s)
+	}
+
+	if !validateDate(*s) {
+		t.Errorf("TestSetAnnotationCreationDate: invalid date: %s\n", *s)
+	}
+
+	// Link annotations are no markup annotations.
+	indRef = addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(nil, nil))
+
+	if err := SetAnnotationCreationDate(xRefTable, indRef.ObjectNumber.Value(), ts); err == nil {
+		t.Errorf("TestSetAnnotationCreationDate: expected error for Link annotation\n")
+	}
+}
+
+func TestShiftAnnotationDatesBy(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("CreationDate", PDFStringLiteral("D:20180307233005-05'00'"))
+	d.Insert("M", PDFStringLiteral("D:20180308"))
+	indRef1 := addAnnotForTest(t, xRefTable, 1, d)
+
+	// Unparseable dates get skipped.
+	d = squareAnnotForTest(NewRectangle(60, 60, 90, 90))
+	d.Insert("M", PDFStringLiteral("yesterday"))
+	indRef2 := addAnnotForTest(t, xRefTable, 1, d)
+
+	i, err := ShiftAnnotationDatesBy(xRefTable, time.Hour)
+	if err != nil {
+		t.Fatalf("TestShiftAnnotationDatesBy: %v\n", err)
+	}
+
+	if i != 1 {
+		t.Fatalf("TestShiftAnnotationDatesBy: want 1 annotation changed, got %d\n", i)
+	}
+
+	for _, tc := range []struct {
+		indRef          PDFIndirectRef
+		entryName, want string
+	}{
+		{indRef1, "CreationDate", "D:20180308003005-05'00'"},
+		{indRef1, "M", "D:20180308010000+00'00'"},
+		{indRef2, "M", "yesterday"},
+	} {
+		d, _ := xRefTable.DereferenceDict(tc.indRef)
+		if s := d.StringEntry(tc.entryName); s == nil || *s != tc.want {
+			t.Errorf("TestShiftAnnotationDatesBy: %s: want %s, got %v\n", tc.entryName, tc.want, s)
+		}
+	}
+}
+
+func TestMaskAnnotationsForPrinting(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	on := formForTest(t, xRefTable, "0 0 100 20 re f", NewRectangle(0, 0, 100, 20), nil)
+	off := formForTest(t, xRefTable, "", NewRectangle(0, 0, 100, 20), nil)
+
+	d := highlightAnnotForTest()
+	d.Insert("AS", PDFName("On"))
+	d.Insert("AP", PDFDict{
+		Dict: map[string]PDFObject{
+			"N": PDFDict{Dict: map[string]PDFObject{"On": on, "Off": off}},
+			"D": off,
+		},
+	})
+	highlight := addAnnotForTest(t, xRefTable, 1, d)
+
+	d = squareAnnotForTest(NewRectangle(10, 50, 50, 90))
+	d.Insert("F", PDFInteger(annotFlagHidden|annotFlagPrint))
+	hidden := addAnnotForTest(t, xRefTable, 1, d)
+
+	popup := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(120, 10, 220, 60),
+			"Parent":  highlight,
+			"F":       PDFInteger(annotFlagPrint),
+		},
+	})
+
+	// An annotation without Subtype must not break the walk.
+	addAnnotForTest(t, xRefTable, 1, PDFDict{Dict: map[string]PDFObject{"Rect": NewRectangle(0, 0, 10, 10)}})
+
+	if err := MaskAnnotationsForPrinting(xRefTable); err != nil {
+		t.Fatalf("TestMaskAnnotationsForPrinting: %v\n", err)
+	}
+
+	flags := func(indRef PDFIndirectRef) (int, *PDFDict) {
+		d, err := annotDict(xRefTable, indRef.ObjectNumber.Value())
+		if err != nil {
+			t.Fatalf("TestMaskAnnotationsForPrinting: %v\n", err)
+		}
+		f := d.IntEntry("F")
+		if f == nil {
+			return 0, d
+		}
+		return *f, d
+	}
+
+	f, d1 := flags(highlight)
+	if f&annotFlagPrint == 0 {
+		t.Errorf("TestMaskAnnotationsForPrinting: Highlight does not print\n")
+	}
+
+	ap := d1.PDFDictEntry("AP")
+	if ap == nil || ap.Len() != 1 || ap.IndirectRefEntry("N") == nil || *ap.IndirectRefEntry("N") != on {
+		t.Errorf("TestMaskAnnotationsForPrinting: Highlight appearance not flattened: %v\n", ap)
+	}
+
+	if _, found := d1.Find("AS"); found {
+		t.Errorf("TestMaskAnnotationsForPrinting: Highlight AS not removed\n")
+	}
+
+	if f, _ = flags(popup); f&annotFlagPrint > 0 {
+		t.Errorf("TestMaskAnnotationsForPrinting: Popup prints\n")
+	}
+
+	if f, _ = flags(hidden); f&annotFlagPrint > 0 || f&annotFlagHidden == 0 {
+		t.Errorf("TestMaskAnnotationsForPrinting: hidden annotation prints: F=%d\n", f)
+	}
+}
+
+func TestConvertAnnotationColorsToCMYK(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("IC", NewNumberArray(0.5))
+	square := addAnnotForTest(t, xRefTable, 1, d)
+
+	d = squareAnnotForTest(NewRectangle(60, 10, 100, 50))
+	d.Update("C", NewNumberArray(0, 0, 0, 1))
+	addAnnotForTest(t, xRefTable, 1, d)
+
+	circle := squareAnnotForTest(NewRectangle(10, 60, 50, 100))
+	circle.Update("Subtype", PDFName("Circle"))
+	addAnnotForTest(t, xRefTable, 1, circle)
+
+	n, err := ConvertAnnotationColorsToCMYK(xRefTable, AnnotationSubtypeFilter("Square"))
+	if err != nil {
+		t.Fatalf("TestConvertAnnotationColorsToCMYK: %v\n", err)
+	}
+
+	if n != 1 {
+		t.Errorf("TestConvertAnnotationColorsToCMYK: expected 1 changed annotation, got %d\n", n)
+	}
+
+	for entryName, want := range map[string][]float64{"C": {0, 1, 1, 0}, "IC": {0, 0, 0, 0.5}} {
+		got := numbersForTest(t, xRefTable, square, entryName)
+		if len(got) != len(want) {
+			t.Fatalf("TestConvertAnnotationColorsToCMYK: %s: expected %v, got %v\n", entryName, want, got)
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-9 {
+				t.Errorf("TestConvertAnnotationColorsToCMYK: %s: expected %v, got %v\n", entryName, want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestRenumberAnnotations(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	annotWithAppearance := func(pageNr int, d PDFDict) PDFIndirectRef {
+		form := formForTest(t, xRefTable, "0 0 10 10 re f", NewRectangle(0, 0, 10, 10), nil)
+		d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": form}})
+		return addAnnotForTest(t, xRefTable, pageNr, d)
+	}
+
+	removed := annotWithAppearance(1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	square := annotWithAppearance(1, squareAnnotForTest(NewRectangle(60, 10, 100, 50)))
+
+	popup := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(120, 10, 220, 60),
+			"Parent":  square,
+		},
+	})
+	d, _ := xRefTable.DereferenceDict(square)
+	d.Insert("Popup", popup)
+
+	highlight := annotWithAppearance(2, highlightAnnotForTest())
+
+	// Some object referring to an annotation.
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestRenumberAnnotations: %v\n", err)
+	}
+	rootDict.Insert("Test", PDFArray{highlight})
+
+	// Leave some gaps.
+	if _, err = removeAnnotationsByObjNr(xRefTable, IntSet{removed.ObjectNumber.Value(): true}); err != nil {
+		t.Fatalf("TestRenumberAnnotations: %v\n", err)
+	}
+
+	n, err := RenumberAnnotations(xRefTable)
+	if err != nil {
+		t.Fatalf("TestRenumberAnnotations: %v\n", err)
+	}
+	if n == 0 {
+		t.Errorf("TestRenumberAnnotations: nothing renumbered\n")
+	}
+
+	if err = xRefTable.EnsureValidFreeList(); err != nil {
+		t.Fatalf("TestRenumberAnnotations: %v\n", err)
+	}
+
+	objNrs, err := annotationObjects(xRefTable)
+	if err != nil {
+		t.Fatalf("TestRenumberAnnotations: %v\n", err)
+	}
+
+	if len(objNrs) != 5 {
+		t.Fatalf("TestRenumberAnnotations: expected 5 annotation objects, got %v\n", objNrs)
+	}
+
+	min, max := objNrs[0], objNrs[0]
+	for _, objNr := range objNrs {
+		if objNr < min {
+			min = objNr
+		}
+		if objNr > max {
+			max = objNr
+		}
+	}
+
+	if max-min+1 != len(objNrs) {
+		t.Errorf("TestRenumberAnnotations: annotation objects not contiguous: %v\n", objNrs)
+	}
+
+	for objNr := range xRefTable.freeObjects() {
+		if objNr > max {
+			t.Errorf("TestRenumberAnnotations: free obj#%d at end of table\n", objNr)
+		}
+	}
+
+	// All references have been updated.
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		_, err := validateAnnotationDict(xRefTable, annotDict)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("TestRenumberAnnotations: %v\n", err)
+	}
+
+	for _, entryName := range []string{"Popup", "Parent"} {
+		found := false
+		visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, d *PDFDict) error {
+			if ir := d.IndirectRefEntry(entryName); ir != nil {
+				if _, err := annotDict(xRefTable, ir.ObjectNumber.Value()); err != nil {
+					t.Errorf("TestRenumberAnnotations: dangling %s: %v\n", entryName, err)
+				}
+				found = true
+			}
+			return nil
+		})
+		if !found {
+			t.Errorf("TestRenumberAnnotations: %s lost\n", entryName)
+		}
+	}
+
+	ir := rootDict.PDFArrayEntry("Test")
+	if ir == nil {
+		t.Fatalf("TestRenumberAnnotations: Test lost\n")
+	}
+	if d, err := annotDict(xRefTable, (*ir)[0].(PDFIndirectRef).ObjectNumber.Value()); err != nil || *d.Subtype() != "Highlight" {
+		t.Errorf("TestRenumberAnnotations: dangling reference %v: %v\n", (*ir)[0], err)
+	}
+}
+
+func inkAnnotForTest(rect PDFArray, paths ...PDFArray) PDFDict {
+
+	inkList := PDFArray{}
+	for _, path := range paths {
+		inkList = append(inkList, path)
+	}
+
+	return PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Ink"),
+			"Rect":    rect,
+			"InkList": inkList,
+			"C":       NewNumberArray(0, 0, 1),
+		},
+	}
+}
+
+func TestCombineInkStrokes(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	d := inkAnnotForTest(NewRectangle(10, 10, 50, 50), NewNumberArray(10, 10, 50, 50))
+	d.Insert("BS", PDFDict{Dict: map[string]PDFObject{"W": PDFInteger(3)}})
+	ink1 := addAnnotForTest(t, xRefTable, 1, d)
+
+	popup := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(200, 200, 300, 300),
+			"Parent":  ink1,
+		},
+	})
+	d.Insert("Popup", popup)
+
+	d = inkAnnotForTest(NewRectangle(60, 5, 80, 40), NewNumberArray(60, 5, 80, 40), NewNumberArray(60, 40, 80, 5))
+	ap := formForTest(t, xRefTable, "0 0 m 20 35 l S", NewRectangle(0, 0, 20, 35), nil)
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": ap}})
+	ink2 := addAnnotForTest(t, xRefTable, 1, d)
+	ink3 := addAnnotForTest(t, xRefTable, 1, inkAnnotForTest(NewRectangle(20, 30, 40, 90), NewNumberArray(20, 30, 40, 90)))
+	square := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(100, 100, 150, 150)))
+	other := addAnnotForTest(t, xRefTable, 2, inkAnnotForTest(NewRectangle(10, 10, 50, 50), NewNumberArray(10, 10, 50, 50)))
+
+	objNrs := []int{ink1.ObjectNumber.Value(), ink2.ObjectNumber.Value(), ink3.ObjectNumber.Value()}
+
+	if _, err := CombineInkStrokes(xRefTable, append(objNrs, square.ObjectNumber.Value())); err == nil {
+		t.Fatalf("TestCombineInkStrokes: expected error for Square annotation\n")
+	}
+
+	if _, err := CombineInkStrokes(xRefTable, append(objNrs, other.ObjectNumber.Value())); err == nil {
+		t.Fatalf("TestCombineInkStrokes: expected error for annotation on another page\n")
+	}
+
+	objNr, err := CombineInkStrokes(xRefTable, objNrs)
+	if err != nil {
+		t.Fatalf("TestCombineInkStrokes: %v\n", err)
+	}
+
+	aa, err := xRefTable.PageAnnotations(1)
+	if err != nil {
+		t.Fatalf("TestCombineInkStrokes: %v\n", err)
+	}
+
+	if len(aa) != 2 || aa[0].ObjNr != square.ObjectNumber.Value() || aa[1].ObjNr != objNr {
+		t.Fatalf("TestCombineInkStrokes: unexpected annotations: %v\n", aa)
+	}
+
+	ink := aa[1].Dict
+
+	inkList := ink.PDFArrayEntry("InkList")
+	if inkList == nil || len(*inkList) != 4 {
+		t.Fatalf("TestCombineInkStrokes: want 4 paths, got %v\n", inkList)
+	}
+
+	if f, _ := numbers(xRefTable, (*inkList)[2]); len(f) != 4 || f[1] != 40 {
+		t.Errorf("TestCombineInkStrokes: unexpected third path: %v\n", f)
+	}
+
+	if r := aa[1].Rect; r == nil || r.LL.X != 10 || r.LL.Y != 5 || r.UR.X != 80 || r.UR.Y != 90 {
+		t.Errorf("TestCombineInkStrokes: unexpected Rect: %v\n", r)
+	}
+
+	if ink.PDFDictEntry("BS") == nil || ink.Dict["Popup"] != nil {
+		t.Errorf("TestCombineInkStrokes: unexpected style: %v\n", ink)
+	}
+
+	for _, objNr := range append(objNrs, popup.ObjectNumber.Value(), ap.ObjectNumber.Value()) {
+		if entry, found := xRefTable.Find(objNr); found && !entry.Free {
+			t.Errorf("TestCombineInkStrokes: obj#%d not freed\n", objNr)
+		}
+	}
+}
+
+func TestTrimAnnotationsToVisible(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	highlight := func(opacity float64) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":       PDFName("Annot"),
+				"Subtype":    PDFName("Highlight"),
+				"Rect":       NewRectangle(10, 100, 210, 120),
+				"QuadPoints": NewNumberArray(10, 120, 210, 120, 10, 100, 210, 100),
+				"C":          NewNumberArray(1, 1, 0),
+				"CA":         PDFFloat(opacity),
+			},
+		}
+	}
+
+	visible := addAnnotForTest(t, xRefTable, 1, highlight(0.5))
+	transparent := addAnnotForTest(t, xRefTable, 1, highlight(0))
+
+	popup := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Popup"),
+			"Rect":    NewRectangle(210, 100, 310, 160),
+			"Parent":  transparent,
+		},
+	})
+	d, _ := xRefTable.DereferenceDict(transparent)
+	d.Insert("Popup", popup)
+
+	addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 10, 50)))
+
+	hidden := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	hidden.Insert("F", PDFInteger(annotFlagHidden))
+	addAnnotForTest(t, xRefTable, 1, hidden)
+
+	empty := formForTest(t, xRefTable, "q Q", NewRectangle(0, 0, 40, 40), nil)
+
+	square := squareAnnotForTest(NewRectangle(60, 10, 100, 50))
+	square.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": empty}})
+	addAnnotForTest(t, xRefTable, 1, square)
+
+	// Viewers display the icon of a note regardless.
+	note := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Text"),
+			"Rect":    NewRectangle(300, 300, 320, 320),
+			"AP":      PDFDict{Dict: map[string]PDFObject{"N": empty}},
+		},
+	})
+
+	// An invisible signature field.
+	sig := addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Widget"),
+			"FT":      PDFName("Sig"),
+			"T":       PDFStringLiteral("Signature1"),
+			"Rect":    NewRectangle(0, 0, 0, 0),
+			"F":       PDFInteger(annotFlagPrint),
+		},
+	})
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestTrimAnnotationsToVisible: %v\n", err)
+	}
+	rootDict.Insert("AcroForm", PDFDict{Dict: map[string]PDFObject{"Fields": PDFArray{sig}}})
+
+	i, err := TrimAnnotationsToVisible(xRefTable)
+	if err != nil {
+		t.Fatalf("TestTrimAnnotationsToVisible: %v\n", err)
+	}
+
+	if i != 4 {
+		t.Errorf("TestTrimAnnotationsToVisible: want 4 removed annotations, got %d\n", i)
+	}
+
+	aa, err := xRefTable.PageAnnotations(1)
+	if err != nil {
+		t.Fatalf("TestTrimAnnotationsToVisible: %v\n", err)
+	}
+
+	if len(aa) != 3 || aa[0].ObjNr != visible.ObjectNumber.Value() || aa[1].ObjNr != note.ObjectNumber.Value() || aa[2].ObjNr != sig.ObjectNumber.Value() {
+		t.Errorf("TestTrimAnnotationsToVisible: unexpected remaining annotations: %v\n", aa)
+	}
+
+	acroForm := rootDict.PDFDictEntry("AcroForm")
+	if fields := acroForm.PDFArrayEntry("Fields"); fields == nil || len(*fields) != 1 {
+		t.Errorf("TestTrimAnnotationsToVisible: signature field detached: %v\n", acroForm)
+	}
+
+	if entry, found := xRefTable.Find(popup.ObjectNumber.Value()); found && !entry.Free {
+		t.Errorf("TestTrimAnnotationsToVisible: popup obj#%d not removed\n", popup.ObjectNumber.Value())
+	}
+}
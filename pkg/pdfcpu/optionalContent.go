@@ -0,0 +1,437 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Evaluating the visibility of optional content, see 8.11.2
+
+// ocgObjNr returns the object number of the optional content group referenced by obj.
+func ocgObjNr(xRefTable *XRefTable, obj PDFObject) (int, error) {
+
+	indRef, ok := obj.(PDFIndirectRef)
+	if !ok {
+		return 0, errors.Errorf("ocgObjNr: optional content group must be an indirect reference: %v", obj)
+	}
+
+	d, err := xRefTable.DereferenceDict(indRef)
+	if err != nil || d == nil {
+		return 0, errors.Errorf("ocgObjNr: corrupt optional content group obj#%d", indRef.ObjectNumber.Value())
+	}
+
+	if t := d.Type(); t == nil || *t != "OCG" {
+		return 0, errors.Errorf("ocgObjNr: obj#%d is not an optional content group", indRef.ObjectNumber.Value())
+	}
+
+	return indRef.ObjectNumber.Value(), nil
+}
+
+// visibilityExpression evaluates the visibility expression obj against the enabled groups onGroups, see 8.11.2.2
+// All operands get evaluated in order to detect malformed expressions.
+// path holds the object numbers of the indirect arrays currently being evaluated.
+func visibilityExpression(xRefTable *XRefTable, obj PDFObject, onGroups map[int]bool, path IntSet) (bool, error) {
+
+	if indRef, ok := obj.(PDFIndirectRef); ok {
+
+		o, err := xRefTable.Dereference(indRef)
+		if err != nil {
+			return false, err
+		}
+
+		if _, ok := o.(PDFArray); !ok {
+			objNr, err := ocgObjNr(xRefTable, indRef)
+			if err != nil {
+				return false, err
+			}
+			return onGroups[objNr], nil
+		}
+
+		objNr := indRef.ObjectNumber.Value()
+		if path[objNr] {
+			return false, errors.Errorf("visibilityExpression: cycle at obj#%d", objNr)
+		}
+		path[objNr] = true
+		defer delete(path, objNr)
+
+		obj = o
+	}
+
+	arr, ok := obj.(PDFArray)
+	if !ok || len(arr) < 2 {
+		return false, errors.Errorf("visibilityExpression: corrupt expression: %v", obj)
+	}
+
+	op, ok := arr[0].(PDFName)
+	if !ok || !memberOf(op.Value(), []string{"And", "Or", "Not"}) {
+		return false, errors.Errorf("visibilityExpression: invalid operator: %v", arr[0])
+	}
+
+	if op == "Not" && len(arr) != 2 {
+		return false, errors.Errorf("visibilityExpression: Not takes exactly one operand: %v", arr)
+	}
+
+	visible := op == "And"
+
+	for _, v := range arr[1:] {
+
+		b, err := visibilityExpression(xRefTable, v, onGroups, path)
+		if err != nil {
+			return false, err
+		}
+
+		switch op {
+		case "And":
+			visible = visible && b
+		case "Or":
+			visible = visible || b
+		case "Not":
+			visible = !b
+		}
+	}
+
+	return visible, nil
+}
+
+// OCMDVisible returns true if content belonging to the optional content membership dict ocmd is visible
+// given the optional content groups enabled in onGroups, which is keyed by object number.
+// A visibility expression VE takes precedence over the visibility policy P applied to OCGs.
+// P defaults to AnyOn. An OCMD without groups has no effect on visibility.
+func OCMDVisible(xRefTable *XRefTable, ocmd *PDFDict, onGroups map[int]bool) (bool, error) {
+
+	if ve, found := ocmd.Find("VE"); found && ve != nil {
+		arr, err := xRefTable.DereferenceArray(ve)
+		if err != nil {
+			return false, err
+		}
+		if arr != nil && len(*arr) > 0 {
+			return visibilityExpression(xRefTable, ve, onGroups, IntSet{})
+		}
+	}
+
+	obj, err := xRefTable.Dereference(ocmd.Dict["OCGs"])
+	if err != nil {
+		return false, err
+	}
+
+	var groups PDFArray
+
+	switch o := obj.(type) {
+
+	case nil:
+
+	case PDFDict:
+		groups = PDFArray{ocmd.Dict["OCGs"]}
+
+	case PDFArray:
+		groups = o
+
+	default:
+		return false, errors.Errorf("OCMDVisible: corrupt OCGs: %v", o)
+	}
+
+	var on, off int
+
+	for _, v := range groups {
+
+		if v == nil {
+			continue
+		}
+
+		objNr, err := ocgObjNr(xRefTable, v)
+		if err != nil {
+			return false, err
+		}
+
+		if onGroups[objNr] {
+			on++
+		} else {
+			off++
+		}
+	}
+
+	if on+off == 0 {
+		return true, nil
+	}
+
+	p := "AnyOn"
+	if n := ocmd.NameEntry("P"); n != nil {
+		p = *n
+	}
+
+	switch p {
+
+	case "AllOn":
+		return off == 0, nil
+
+	case "AnyOn":
+		return on > 0, nil
+
+	case "AnyOff":
+		return off > 0, nil
+
+	case "AllOff":
+		return on == 0, nil
+	}
+
+	return false, errors.Errorf("OCMDVisible: invalid visibility policy: %s", p)
+}
+
+// ocProperties returns the optional content properties dict of the catalog.
+func ocProperties(xRefTable *XRefTable) (*PDFDict, error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	return xRefTable.DereferenceDict(rootDict.Dict["OCProperties"])
+}
+
+// defaultOnGroups returns the optional content groups enabled by the default configuration, keyed by object number.
+func defaultOnGroups(xRefTable *XRefTable) (map[int]bool, error) {
+
+	m := map[int]bool{}
+
+	ocProps, err := ocProperties(xRefTable)
+	if err != nil || ocProps == nil {
+		return m, err
+	}
+
+	ocgs, err := xRefTable.DereferenceArray(ocProps.Dict["OCGs"])
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := xRefTable.DereferenceDict(ocProps.Dict["D"])
+	if err != nil {
+		return nil, err
+	}
+
+	baseState := "ON"
+	if d != nil {
+		if n := d.NameEntry("BaseState"); n != nil {
+			baseState = *n
+		}
+	}
+
+	if ocgs != nil && baseState == "ON" {
+		for _, v := range *ocgs {
+			if indRef, ok := v.(PDFIndirectRef); ok {
+				m[indRef.ObjectNumber.Value()] = true
+			}
+		}
+	}
+
+	if d == nil {
+		return m, nil
+	}
+
+	for _, key := range []string{"ON", "OFF"} {
+
+		arr, err := xRefTable.DereferenceArray(d.Dict[key])
+		if err != nil {
+			return nil, err
+		}
+		if arr == nil {
+			continue
+		}
+
+		for _, v := range *arr {
+			if indRef, ok := v.(PDFIndirectRef); ok {
+				m[indRef.ObjectNumber.Value()] = key == "ON"
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// withoutOCGs returns arr without references to the optional content groups objNrs.
+func withoutOCGs(arr PDFArray, objNrs IntSet) PDFArray {
+
+	a := PDFArray{}
+
+	for _, v := range arr {
+		if indRef, ok := v.(PDFIndirectRef); ok && objNrs[indRef.ObjectNumber.Value()] {
+			continue
+		}
+		a = append(a, v)
+	}
+
+	return a
+}
+
+// SetLayerVisibility sets the visibility of the optional content groups named ocgName in the default configuration D
+// of the optional content properties of the catalog by moving them between its ON and OFF arrays, see 8.11.4.3
+// D gets created if missing. Turning a group on turns off all other groups sharing a radio button group with it.
+// A ViewState of the group's usage dict gets updated too, since viewers applying usage application dicts take precedence.
+func SetLayerVisibility(xRefTable *XRefTable, ocgName string, visible bool) error {
+
+	ocProps, err := ocProperties(xRefTable)
+	if err != nil {
+		return err
+	}
+
+	if ocProps == nil {
+		return errors.Errorf("SetLayerVisibility: unknown layer: %s", ocgName)
+	}
+
+	ocgs, err := xRefTable.DereferenceArray(ocProps.Dict["OCGs"])
+	if err != nil || ocgs == nil {
+		return errors.New("SetLayerVisibility: corrupt OCProperties: missing OCGs")
+	}
+
+	var indRefs []PDFIndirectRef
+
+	for _, v := range *ocgs {
+
+		indRef, ok := v.(PDFIndirectRef)
+		if !ok {
+			continue
+		}
+
+		ocg, err := xRefTable.DereferenceDict(indRef)
+		if err != nil || ocg == nil {
+			return errors.Errorf("SetLayerVisibility: corrupt optional content group obj#%d", indRef.ObjectNumber.Value())
+		}
+
+		if decodedTextString(xRefTable, ocg.Dict["Name"]) == ocgName {
+			indRefs = append(indRefs, indRef)
+		}
+	}
+
+	if len(indRefs) == 0 {
+		return errors.Errorf("SetLayerVisibility: unknown layer: %s", ocgName)
+	}
+
+	d, err := xRefTable.DereferenceDict(ocProps.Dict["D"])
+	if err != nil {
+		return err
+	}
+
+	if d == nil {
+		dd := NewPDFDict()
+		d = &dd
+		ocProps.Update("D", dd)
+	}
+
+	objNrs := IntSet{}
+	for _, indRef := range indRefs {
+		objNrs[indRef.ObjectNumber.Value()] = true
+	}
+
+	// The groups get moved from one of the arrays ON and OFF to the other.
+	to, from := "ON", "OFF"
+	if !visible {
+		to, from = from, to
+	}
+
+	// Groups sharing a radio button group with a group being turned on get turned off.
+	turnOff := map[int]PDFIndirectRef{}
+
+	if visible {
+
+		rbGroups, err := xRefTable.DereferenceArray(d.Dict["RBGroups"])
+		if err != nil {
+			return err
+		}
+
+		if rbGroups != nil {
+			for _, v := range *rbGroups {
+
+				rbGroup, err := xRefTable.DereferenceArray(v)
+				if err != nil || rbGroup == nil {
+					continue
+				}
+
+				if len(withoutOCGs(*rbGroup, objNrs)) == len(*rbGroup) {
+					continue
+				}
+
+				for _, o := range *rbGroup {
+					if indRef, ok := o.(PDFIndirectRef); ok && !objNrs[indRef.ObjectNumber.Value()] {
+						turnOff[indRef.ObjectNumber.Value()] = indRef
+					}
+				}
+			}
+		}
+	}
+
+	var arrs [2]PDFArray
+
+	for i, key := range []string{to, from} {
+		arr, err := xRefTable.DereferenceArray(d.Dict[key])
+		if err != nil {
+			return err
+		}
+		if arr != nil {
+			arrs[i] = *arr
+		}
+	}
+
+	excluded := IntSet{}
+	for objNr := range objNrs {
+		excluded[objNr] = true
+	}
+
+	var ii []int
+	for objNr := range turnOff {
+		excluded[objNr] = true
+		ii = append(ii, objNr)
+	}
+	sort.Ints(ii)
+
+	toArr := withoutOCGs(arrs[0], excluded)
+	fromArr := withoutOCGs(arrs[1], excluded)
+
+	for _, indRef := range indRefs {
+		toArr = append(toArr, indRef)
+	}
+
+	// Only happens when turning groups on.
+	for _, objNr := range ii {
+		fromArr = append(fromArr, turnOff[objNr])
+	}
+
+	d.Update(to, toArr)
+	d.Update(from, fromArr)
+
+	for _, indRef := range indRefs {
+
+		ocg, _ := xRefTable.DereferenceDict(indRef)
+
+		usage, err := xRefTable.DereferenceDict(ocg.Dict["Usage"])
+		if err != nil || usage == nil {
+			continue
+		}
+
+		view, err := xRefTable.DereferenceDict(usage.Dict["View"])
+		if err != nil || view == nil {
+			continue
+		}
+
+		if _, found := view.Find("ViewState"); found {
+			view.Update("ViewState", PDFName(to))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"testing"
+)
+
+func ocgForTest(t *testing.T, xRefTable *XRefTable, name string) PDFIndirectRef {
+
+	indRef, err := xRefTable.IndRefForNewObject(PDFDict{
+		Dict: map[string]PDFObject{
+			"Type": PDFName("OCG"),
+			"Name": PDFStringLiteral(name),
+		},
+	})
+	if err != nil {
+		t.Fatalf("ocgForTest: %v\n", err)
+	}
+
+	return *indRef
+}
+
+func TestOCMDVisible(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	a, b, c := ocgForTest(t, xRefTable, "A"), ocgForTest(t, xRefTable, "B"), ocgForTest(t, xRefTable, "C")
+
+	// A and C are on, B is off.
+	onGroups := map[int]bool{a.ObjectNumber.Value(): true, c.ObjectNumber.Value(): true}
+
+	nested, err := xRefTable.IndRefForNewObject(PDFArray{PDFName("Not"), b})
+	if err != nil {
+		t.Fatalf("TestOCMDVisible: %v\n", err)
+	}
+
+	for i, tt := range []struct {
+		ocgs PDFObject
+		p    string
+		ve   PDFArray
+		want bool
+	}{
+		// Default policy AnyOn
+		{PDFArray{a, b}, "", nil, true},
+		{b, "", nil, false},
+		{PDFArray{a, b}, "AllOn", nil, false},
+		{PDFArray{a, c}, "AllOn", nil, true},
+		{PDFArray{a, b}, "AnyOff", nil, true},
+		{PDFArray{a, b}, "AllOff", nil, false},
+		// No groups
+		{nil, "AllOn", nil, true},
+		// VE takes precedence over OCGs and P.
+		{PDFArray{b}, "AllOn", PDFArray{PDFName("And"), a, *nested}, true},
+		{nil, "", PDFArray{PDFName("And"), a, PDFArray{PDFName("Or"), b, PDFArray{PDFName("Not"), c}}}, false},
+		{nil, "", PDFArray{PDFName("Or"), b, PDFArray{PDFName("Not"), PDFArray{PDFName("And"), b, c}}}, true},
+		// An empty VE gets ignored.
+		{PDFArray{b}, "AllOff", PDFArray{}, true},
+	} {
+
+		d := PDFDict{Dict: map[string]PDFObject{"Type": PDFName("OCMD")}}
+
+		if tt.ocgs != nil {
+			d.Insert("OCGs", tt.ocgs)
+		}
+
+		if tt.p != "" {
+			d.Insert("P", PDFName(tt.p))
+		}
+
+		if tt.ve != nil {
+			d.Insert("VE", tt.ve)
+		}
+
+		visible, err := OCMDVisible(xRefTable, &d, onGroups)
+		if err != nil {
+			t.Fatalf("TestOCMDVisible %d: %v\n", i, err)
+		}
+
+		if visible != tt.want {
+			t.Errorf("TestOCMDVisible %d: want %t, got %t\n", i, tt.want, visible)
+		}
+	}
+
+	for i, ve := range []PDFArray{
+		{PDFName("Not"), a, b},
+		{PDFName("Xor"), a, b},
+		{PDFName("And"), PDFInteger(1)},
+	} {
+
+		d := PDFDict{Dict: map[string]PDFObject{"Type": PDFName("OCMD"), "VE": ve}}
+
+		if _, err := OCMDVisible(xRefTable, &d, onGroups); err == nil {
+			t.Errorf("TestOCMDVisible: invalid VE %d => not ok!\n", i)
+		}
+
+		if err := validateOptionalContentMembershipDict(xRefTable, &d, V16); err == nil {
+			t.Errorf("TestOCMDVisible: validation of invalid VE %d => not ok!\n", i)
+		}
+	}
+}
+
+func TestSetLayerVisibility(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	if err := SetLayerVisibility(xRefTable, "A", false); err == nil {
+		t.Fatalf("TestSetLayerVisibility: missing OCProperties => not ok!\n")
+	}
+
+	a, b, c := ocgForTest(t, xRefTable, "A"), ocgForTest(t, xRefTable, "B"), ocgForTest(t, xRefTable, "C")
+
+	ocgA, _ := xRefTable.DereferenceDict(a)
+	ocgA.Insert("Usage", PDFDict{Dict: map[string]PDFObject{"View": PDFDict{Dict: map[string]PDFObject{"ViewState": PDFName("ON")}}}})
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestSetLayerVisibility: %v\n", err)
+	}
+
+	ocProps := PDFDict{Dict: map[string]PDFObject{"OCGs": PDFArray{a, b, c}}}
+	rootDict.Insert("OCProperties", ocProps)
+
+	visible := func(ocg PDFIndirectRef) bool {
+		onGroups, err := defaultOnGroups(xRefTable)
+		if err != nil {
+			t.Fatalf("TestSetLayerVisibility: %v\n", err)
+		}
+		// Content of an annotation whose OC entry refers to an OCMD.
+		ocmd := PDFDict{Dict: map[string]PDFObject{"Type": PDFName("OCMD"), "OCGs": ocg}}
+		v, err := OCMDVisible(xRefTable, &ocmd, onGroups)
+		if err != nil {
+			t.Fatalf("TestSetLayerVisibility: %v\n", err)
+		}
+		return v
+	}
+
+	// D gets created.
+	if err = SetLayerVisibility(xRefTable, "A", false); err != nil {
+		t.Fatalf("TestSetLayerVisibility: %v\n", err)
+	}
+
+	if ocProps.PDFDictEntry("D") == nil {
+		t.Fatalf("TestSetLayerVisibility: missing D\n")
+	}
+
+	if visible(a) || !visible(b) {
+		t.Errorf("TestSetLayerVisibility: A should be hidden, B visible\n")
+	}
+
+	if s := ocgA.PDFDictEntry("Usage").PDFDictEntry("View").NameEntry("ViewState"); s == nil || *s != "OFF" {
+		t.Errorf("TestSetLayerVisibility: ViewState not updated: %v\n", s)
+	}
+
+	// Turning on A turns off B sharing a radio button group with A.
+	d := ocProps.PDFDictEntry("D")
+	d.Insert("BaseState", PDFName("OFF"))
+	d.Insert("RBGroups", PDFArray{PDFArray{a, b}})
+
+	if err = SetLayerVisibility(xRefTable, "B", true); err != nil {
+		t.Fatalf("TestSetLayerVisibility: %v\n", err)
+	}
+
+	if err = SetLayerVisibility(xRefTable, "A", true); err != nil {
+		t.Fatalf("TestSetLayerVisibility: %v\n", err)
+	}
+
+	if !visible(a) || visible(b) || visible(c) {
+		t.Errorf("TestSetLayerVisibility: only A should be visible, D: %v\n", d)
+	}
+
+	if on := d.PDFArrayEntry("ON"); on == nil || len(*on) != 1 {
+		t.Errorf("TestSetLayerVisibility: unexpected ON: %v\n", d.Dict["ON"])
+	}
+
+	if err = SetLayerVisibility(xRefTable, "D", true); err == nil {
+		t.Errorf("TestSetLayerVisibility: unknown layer => not ok!\n")
+	}
+}
@@ -979,6 +979,8 @@ func readXRefTable(ctx *PDFContext) (err error) {
 		return
 	}
 
+	ctx.Read.OffsetLastXRefSection = *offset
+
 	err = buildXRefTableStartingAt(ctx, offset)
 	if err == io.EOF {
 		return errors.Wrap(err, "readXRefTable: unexpected eof")
@@ -0,0 +1,762 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hhrutter/pdfcpu/pkg/fonts/metrics"
+	"github.com/hhrutter/pdfcpu/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Applying redactions, see 12.5.6.23 Redaction Annotations.
+
+// annotationAreas returns the areas covered by an annotation: the quadrilaterals of QuadPoints falling back to Rect.
+func annotationAreas(xRefTable *XRefTable, annotDict *PDFDict) ([]types.Rectangle, error) {
+
+	rr, err := QuadPoints(annotDict)
+	if err != nil || len(rr) > 0 {
+		return rr, err
+	}
+
+	f, err := numbers(xRefTable, annotDict.Dict["Rect"])
+	if err != nil {
+		return nil, err
+	}
+	if len(f) != 4 {
+		return nil, errors.New("annotationAreas: corrupt Rect")
+	}
+
+	return []types.Rectangle{boundingBox(f)}, nil
+}
+
+// intersectsAny returns true if r overlaps any of areas.
+func intersectsAny(r types.Rectangle, areas []types.Rectangle) bool {
+
+	for _, a := range areas {
+		if r.LL.X < a.UR.X && a.LL.X < r.UR.X && r.LL.Y < a.UR.Y && a.LL.Y < r.UR.Y {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pageContent returns the concatenated decoded content streams of a page dict.
+func pageContent(xRefTable *XRefTable, pageDict *PDFDict) ([]byte, error) {
+
+	obj, found := pageDict.Find("Contents")
+	if !found || obj == nil {
+		return nil, nil
+	}
+
+	o, err := xRefTable.Dereference(obj)
+	if err != nil || o == nil {
+		return nil, err
+	}
+
+	var arr PDFArray
+
+	switch o := o.(type) {
+
+	case PDFStreamDict:
+		arr = PDFArray{obj}
+
+	case PDFArray:
+		arr = o
+
+	default:
+		return nil, errors.Errorf("pageContent: corrupt Contents: %v", o)
+	}
+
+	var b bytes.Buffer
+
+	for _, v := range arr {
+
+		sd, err := xRefTable.DereferenceStreamDict(v)
+		if err != nil {
+			return nil, err
+		}
+		if sd == nil {
+			continue
+		}
+
+		c, err := streamContent(sd)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(c)
+		b.WriteString("\n")
+	}
+
+	return b.Bytes(), nil
+}
+
+// glyphWidths provides the glyph widths of a font resource in text space units for a font size of 1.
+type glyphWidths struct {
+	twoByte   bool      // Composite fonts are assumed to use 2 byte codes.
+	dw        float64   // Default width of composite fonts.
+	firstChar int       // First code covered by widths.
+	widths    []float64 // Widths of simple fonts.
+	metrics   string    // Standard font metrics for codes not covered by widths.
+}
+
+func newGlyphWidths(xRefTable *XRefTable, fonts *PDFDict, name string) *glyphWidths {
+
+	gw := &glyphWidths{dw: 1, metrics: "Helvetica"}
+
+	if fonts == nil {
+		return gw
+	}
+
+	d, err := xRefTable.DereferenceDict(fonts.Dict[name])
+	if err != nil || d == nil {
+		return gw
+	}
+
+	if st := d.Subtype(); st != nil && *st == "Type0" {
+		gw.twoByte = true
+		if arr, err := xRefTable.DereferenceArray(d.Dict["DescendantFonts"]); err == nil && arr != nil && len(*arr) > 0 {
+			if cidFont, err := xRefTable.DereferenceDict((*arr)[0]); err == nil && cidFont != nil {
+				if dw, found := cidFont.Find("DW"); found {
+					gw.dw = xRefTable.DereferenceNumber(dw) / 1000
+				}
+			}
+		}
+		return gw
+	}
+
+	if bf := d.NameEntry("BaseFont"); bf != nil && memberOf(*bf, metrics.FontNames()) {
+		gw.metrics = *bf
+	}
+
+	if w, err := numbers(xRefTable, d.Dict["Widths"]); err == nil && len(w) > 0 {
+		for i := range w {
+			w[i] /= 1000
+		}
+		gw.widths = w
+		gw.firstChar = int(xRefTable.DereferenceNumber(d.Dict["FirstChar"]))
+	}
+
+	return gw
+}
+
+func (gw *glyphWidths) width(code int) float64 {
+
+	if gw.twoByte {
+		return gw.dw
+	}
+
+	if i := code - gw.firstChar; i >= 0 && i < len(gw.widths) {
+		return gw.widths[i]
+	}
+
+	return float64(metrics.CharWidth(gw.metrics, code)) / 1000
+}
+
+// locationState is the part of the graphics state relevant for locating text and images.
+type locationState struct {
+	ctm                                     matrix
+	font                                    *glyphWidths
+	fontSize, charSpace, wordSpace, leading float64
+	hScale, rise                            float64
+}
+
+// textLocator tracks the state required for locating glyphs, images and forms
+// while walking the operators of a content stream.
+type textLocator struct {
+	xRefTable *XRefTable
+	fonts     *PDFDict
+	cache     map[string]*glyphWidths
+	gs        locationState
+	stack     []locationState
+	tm, tlm   matrix
+}
+
+func newTextLocator(xRefTable *XRefTable, resources *PDFDict) (*textLocator, error) {
+
+	tl := &textLocator{
+		xRefTable: xRefTable,
+		cache:     map[string]*glyphWidths{},
+		gs:        locationState{ctm: identMatrix, font: newGlyphWidths(xRefTable, nil, ""), hScale: 1},
+		tm:        identMatrix,
+		tlm:       identMatrix,
+	}
+
+	if resources != nil {
+		fonts, err := xRefTable.DereferenceDict(resources.Dict["Font"])
+		if err != nil {
+			return nil, err
+		}
+		tl.fonts = fonts
+	}
+
+	return tl, nil
+}
+
+func (tl *textLocator) nextLine(tx, ty float64) {
+	tl.tlm = translationMatrix(tx, ty).multiply(tl.tlm)
+	tl.tm = tl.tlm
+}
+
+// update applies the state changes of operator t.
+// ' and " move to the next line and " sets word and character spacing before their text gets shown.
+func (tl *textLocator) update(t contentToken) {
+
+	o := t.operands
+	gs := &tl.gs
+
+	switch t.op {
+
+	case "q":
+		tl.stack = append(tl.stack, *gs)
+
+	case "Q":
+		if len(tl.stack) > 0 {
+			*gs, tl.stack = tl.stack[len(tl.stack)-1], tl.stack[:len(tl.stack)-1]
+		}
+
+	case "cm":
+		if len(o) == 6 {
+			gs.ctm = newMatrix(o).multiply(gs.ctm)
+		}
+
+	case "BT":
+		tl.tm, tl.tlm = identMatrix, identMatrix
+
+	case "Tf":
+		if len(o) == 1 {
+			gw, found := tl.cache[t.name]
+			if !found {
+				gw = newGlyphWidths(tl.xRefTable, tl.fonts, t.name)
+				tl.cache[t.name] = gw
+			}
+			gs.font, gs.fontSize = gw, o[0]
+		}
+
+	case "Tc", "Tw", "Tz", "TL", "Ts":
+		if len(o) == 1 {
+			switch t.op {
+			case "Tc":
+				gs.charSpace = o[0]
+			case "Tw":
+				gs.wordSpace = o[0]
+			case "Tz":
+				gs.hScale = o[0] / 100
+			case "TL":
+				gs.leading = o[0]
+			case "Ts":
+				gs.rise = o[0]
+			}
+		}
+
+	case "Tm":
+		if len(o) == 6 {
+			tl.tlm = newMatrix(o)
+			tl.tm = tl.tlm
+		}
+
+	case "Td", "TD":
+		if len(o) == 2 {
+			if t.op == "TD" {
+				gs.leading = -o[1]
+			}
+			tl.nextLine(o[0], o[1])
+		}
+
+	case "T*", "'":
+		tl.nextLine(0, -gs.leading)
+
+	case "\"":
+		if len(o) == 2 {
+			gs.wordSpace, gs.charSpace = o[0], o[1]
+		}
+		tl.nextLine(0, -gs.leading)
+	}
+}
+
+// textOperands returns the string operand of Tj, ' and " or the array operand of TJ
+// as a list of strings and kerning numbers.
+func textOperands(op string, b []byte) ([]PDFObject, error) {
+
+	var last PDFObject
+
+	s := string(b)
+
+	for {
+		obj, err := parseObject(&s)
+		if err == errBufNotAvailable {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		last = obj
+	}
+
+	switch o := last.(type) {
+
+	case PDFStringLiteral, PDFHexLiteral:
+		if op != "TJ" {
+			return []PDFObject{o}, nil
+		}
+
+	case PDFArray:
+		if op == "TJ" {
+			return o, nil
+		}
+	}
+
+	return nil, errors.Errorf("textOperands: invalid operand for %s: %s", op, b)
+}
+
+// showText shows the text operands of a text showing operator advancing tm.
+// glyph gets called for each glyph with its code, its horizontal displacement tx and its bounds in device space
+// assuming an ascent of 1 em and a descent of 0.25 em. kern gets called for each positioning number.
+func showText(elems []PDFObject, gs *locationState, tm *matrix, glyph func(g []byte, tx float64, r types.Rectangle), kern func(n float64)) error {
+
+	scale := gs.fontSize * gs.hScale
+
+	for _, e := range elems {
+
+		switch e := e.(type) {
+
+		case PDFInteger, PDFFloat:
+			n := 0.
+			if i, ok := e.(PDFInteger); ok {
+				n = float64(i.Value())
+			} else {
+				n = e.(PDFFloat).Value()
+			}
+			*tm = translationMatrix(-n/1000*scale, 0).multiply(*tm)
+			if kern != nil {
+				kern(n)
+			}
+
+		case PDFStringLiteral, PDFHexLiteral:
+			bb, err := stringBytes(e)
+			if err != nil {
+				return err
+			}
+
+			step := 1
+			if gs.font.twoByte {
+				step = 2
+			}
+
+			for j := 0; j+step <= len(bb); j += step {
+
+				code := int(bb[j])
+				if step == 2 {
+					code = code<<8 | int(bb[j+1])
+				}
+
+				w0 := gs.font.width(code)
+
+				tx := w0*gs.fontSize + gs.charSpace
+				if step == 1 && code == 32 {
+					tx += gs.wordSpace
+				}
+				tx *= gs.hScale
+
+				r := types.NewRectangle(0, gs.rise-0.25*gs.fontSize, w0*scale, gs.rise+gs.fontSize)
+
+				glyph(bb[j:j+step], tx, transformRect(tm.multiply(gs.ctm), r))
+
+				*tm = translationMatrix(tx, 0).multiply(*tm)
+			}
+
+		default:
+			return errors.Errorf("showText: invalid TJ element: %v", e)
+		}
+	}
+
+	return nil
+}
+
+// redactText shows the text operands of a text showing operator using tm and returns a TJ operator
+// showing all glyphs not intersecting any of areas, which get replaced by horizontal displacements.
+// Returns "" if no glyph intersects areas.
+func redactText(elems []PDFObject, gs *locationState, tm *matrix, areas []types.Rectangle) (string, error) {
+
+	var (
+		kept    PDFArray
+		run     []byte
+		removed bool
+	)
+
+	flush := func() {
+		if len(run) > 0 {
+			kept = append(kept, PDFHexLiteral(hex.EncodeToString(run)))
+			run = nil
+		}
+	}
+
+	kern := func(n float64) {
+		flush()
+		if i := len(kept) - 1; i >= 0 {
+			if f, ok := kept[i].(PDFFloat); ok {
+				kept[i] = PDFFloat(f.Value() + n)
+				return
+			}
+		}
+		kept = append(kept, PDFFloat(n))
+	}
+
+	scale := gs.fontSize * gs.hScale
+
+	err := showText(elems, gs, tm, func(g []byte, tx float64, r types.Rectangle) {
+		if intersectsAny(r, areas) && scale != 0 {
+			removed = true
+			kern(-tx * 1000 / scale)
+		} else {
+			run = append(run, g...)
+		}
+	}, kern)
+	if err != nil {
+		return "", err
+	}
+
+	if !removed {
+		return "", nil
+	}
+
+	flush()
+
+	return kept.PDFString() + " TJ", nil
+}
+
+// redactContent returns content b stripped of all glyphs, images and forms intersecting any of areas.
+// Forms get removed as a whole, since they may be shared with other pages.
+func redactContent(xRefTable *XRefTable, b []byte, resources *PDFDict, areas []types.Rectangle) ([]byte, error) {
+
+	tokens, err := contentOperators(b)
+	if err != nil {
+		return nil, err
+	}
+
+	tl, err := newTextLocator(xRefTable, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out                    bytes.Buffer
+		cursor, prevEnd, biPos int
+	)
+
+	// cut replaces b[from:to] by s.
+	cut := func(from, to int, s string) {
+		out.Write(b[cursor:from])
+		out.WriteString(" " + s + " ")
+		cursor = to
+	}
+
+	for _, t := range tokens {
+
+		from, to := prevEnd, t.pos+len(t.op)
+		prevEnd = to
+
+		tl.update(t)
+
+		o := t.operands
+
+		switch t.op {
+
+		case "Tj", "TJ", "'", "\"":
+			prefix := ""
+			if t.op == "\"" && len(o) == 2 {
+				prefix = fmt.Sprintf("%s Tw %s Tc ", strconv.FormatFloat(o[0], 'f', -1, 64), strconv.FormatFloat(o[1], 'f', -1, 64))
+			}
+			if t.op == "'" || t.op == "\"" {
+				prefix += "T* "
+			}
+
+			elems, err := textOperands(t.op, b[from:t.pos])
+			if err != nil {
+				return nil, err
+			}
+
+			s, err := redactText(elems, &tl.gs, &tl.tm, areas)
+			if err != nil {
+				return nil, err
+			}
+
+			if s != "" {
+				cut(from, to, prefix+s)
+			}
+
+		case "BI":
+			biPos = t.pos
+
+		case "EI":
+			// Inline images occupy the unit square.
+			if intersectsAny(transformRect(tl.gs.ctm, types.NewRectangle(0, 0, 1, 1)), areas) {
+				cut(biPos, to, "")
+			}
+
+		case "Do":
+			r, err := xObjectBounds(xRefTable, resources, t.name)
+			if err != nil {
+				return nil, err
+			}
+			if intersectsAny(transformRect(tl.gs.ctm, r), areas) {
+				cut(from, to, "")
+			}
+		}
+	}
+
+	out.Write(b[cursor:])
+
+	return out.Bytes(), nil
+}
+
+// repeatedText returns the content filling a w x h form with lines of repeated text s using the default appearance da.
+// A zero font size in da defaults to 10.
+func repeatedText(s []byte, da, fontName string, w, h float64) string {
+
+	size := 0.
+	if m := reDAFont.FindStringSubmatch(da); m != nil {
+		size, _ = strconv.ParseFloat(m[2], 64)
+	}
+
+	if size <= 0 {
+		size = 10
+	}
+
+	da = reDAFont.ReplaceAllString(da, fmt.Sprintf("/${1} %.1f Tf", size))
+
+	s = append(s, ' ')
+
+	tw := textWidth(s, fontName, size)
+	if tw <= 0 {
+		return ""
+	}
+
+	e, _ := Escape(string(bytes.Repeat(s, int(math.Ceil(w/tw)))))
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "BT %s %.2f TL 0 %.2f Td\n", da, 1.2*size, h-size)
+
+	for y := h - size; y > -size; y -= 1.2 * size {
+		fmt.Fprintf(&b, "(%s) Tj T*\n", *e)
+	}
+
+	b.WriteString("ET\n")
+
+	return b.String()
+}
+
+// redactionOverlay returns the content painting the overlay of a Redact annotation onto its redacted areas:
+// the form XObject RO or a fill using the interior color IC along with OverlayText.
+// Required form XObjects get added to xObjDict.
+func redactionOverlay(xRefTable *XRefTable, annotDict *PDFDict, areas []types.Rectangle, xObjDict *PDFDict) (string, error) {
+
+	f, err := numbers(xRefTable, annotDict.Dict["Rect"])
+	if err != nil || len(f) != 4 {
+		return "", errors.New("redactionOverlay: corrupt Rect")
+	}
+	rect := boundingBox(f)
+
+	xObjName := func() string {
+		for i := 0; ; i++ {
+			name := "Redact" + strconv.Itoa(i)
+			if _, found := xObjDict.Find(name); !found {
+				return name
+			}
+		}
+	}
+
+	var b bytes.Buffer
+
+	// RO, if present, takes precedence over IC, OverlayText and Repeat.
+	if indRef := annotDict.IndirectRefEntry("RO"); indRef != nil {
+
+		sd, err := xRefTable.DereferenceStreamDict(*indRef)
+		if err != nil || sd == nil {
+			return "", err
+		}
+
+		m, err := appearanceRectMatrix(xRefTable, sd, rect)
+		if err != nil {
+			return "", err
+		}
+
+		name := xObjName()
+		xObjDict.Insert(name, *indRef)
+
+		fmt.Fprintf(&b, "q %.4f %.4f %.4f %.4f %.4f %.4f cm /%s Do Q\n", m[0][0], m[0][1], m[1][0], m[1][1], m[2][0], m[2][1], name)
+
+		return b.String(), nil
+	}
+
+	if op := colorOperator(xRefTable, annotDict.Dict["IC"], false); op != "" {
+		for _, r := range areas {
+			fmt.Fprintf(&b, "q %s %.2f %.2f %.2f %.2f re f Q\n", op, r.LL.X, r.LL.Y, r.Width(), r.Height())
+		}
+	}
+
+	s := pdfDocBytes(annotDict.Dict["OverlayText"])
+	if len(s) == 0 {
+		return b.String(), nil
+	}
+
+	da, err := defaultAppearance(xRefTable, annotDict)
+	if err != nil {
+		return "", err
+	}
+
+	if da == nil || daFontName(*da) == "" {
+		s := "/Helv 0 Tf 0 g"
+		da = &s
+	}
+
+	fontName := daFontName(*da)
+
+	fontObj, metricsName, err := widgetFont(xRefTable, fontName, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resources := PDFDict{
+		Dict: map[string]PDFObject{
+			"Font": PDFDict{Dict: map[string]PDFObject{fontName: fontObj}},
+		},
+	}
+
+	w, h := rect.Width(), rect.Height()
+
+	var content string
+
+	if repeat := annotDict.BooleanEntry("Repeat"); repeat != nil && *repeat {
+		content = repeatedText(s, *da, metricsName, w, h)
+	} else {
+		q := 0
+		if i := annotDict.IntEntry("Q"); i != nil {
+			q = *i
+		}
+		content = widgetText(s, *da, metricsName, w, h, 0, q)
+	}
+
+	indRef, err := newWidgetForm(xRefTable, w, h, content, &resources)
+	if err != nil {
+		return "", err
+	}
+
+	name := xObjName()
+	xObjDict.Insert(name, *indRef)
+
+	fmt.Fprintf(&b, "q 1 0 0 1 %.2f %.2f cm /%s Do Q\n", rect.LL.X, rect.LL.Y, name)
+
+	return b.String(), nil
+}
+
+// ApplyRedactions applies all Redact annotations of page pageNr and returns the number of applied redactions.
+// Glyphs, images and form XObjects intersecting the QuadPoints of a redaction, or its Rect if QuadPoints is missing,
+// get removed from the page content. Glyph widths are taken from the font resources of the page.
+// The remaining text keeps its position. Partially covered images and forms get removed as a whole.
+// Each redacted region is painted using the overlay RO or the interior color IC along with OverlayText
+// honoring DA, Q and Repeat. Finally the Redact annotations get removed along with their Popup annotations.
+func ApplyRedactions(xRefTable *XRefTable, pageNr int) (int, error) {
+
+	pageDict, pageIndRef, err := pageDictAndIndRef(xRefTable, pageNr)
+	if err != nil {
+		return 0, err
+	}
+
+	type redaction struct {
+		dict  *PDFDict
+		areas []types.Rectangle
+	}
+
+	var (
+		redactions []redaction
+		areas      []types.Rectangle
+	)
+
+	err = visitPageAnnots(xRefTable, pageNr, *pageIndRef, pageDict, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if st := annotDict.Subtype(); st == nil || *st != "Redact" {
+			return nil
+		}
+
+		rr, err := annotationAreas(xRefTable, annotDict)
+		if err != nil {
+			return errors.Wrapf(err, "ApplyRedactions: page %d", pageNr)
+		}
+
+		redactions = append(redactions, redaction{annotDict, rr})
+		areas = append(areas, rr...)
+
+		return nil
+	})
+	if err != nil || len(redactions) == 0 {
+		return 0, err
+	}
+
+	resDict, xObjDict, err := flattenedResources(xRefTable, pageDict)
+	if err != nil {
+		return 0, err
+	}
+
+	b, err := pageContent(xRefTable, pageDict)
+	if err != nil {
+		return 0, err
+	}
+
+	if b, err = redactContent(xRefTable, b, resDict, areas); err != nil {
+		return 0, err
+	}
+
+	var overlay bytes.Buffer
+
+	for _, r := range redactions {
+		s, err := redactionOverlay(xRefTable, r.dict, r.areas, xObjDict)
+		if err != nil {
+			return 0, err
+		}
+		overlay.WriteString(s)
+	}
+
+	// Isolate the redacted content from the overlays.
+	content := append([]byte("q\n"), b...)
+	content = append(content, "\nQ\n"...)
+	content = append(content, overlay.Bytes()...)
+
+	indRef, err := newContentStream(xRefTable, content)
+	if err != nil {
+		return 0, err
+	}
+
+	pageDict.Update("Contents", *indRef)
+
+	if xObjDict.Len() > 0 {
+		pageDict.Update("Resources", *resDict)
+	}
+
+	return removeAnnotations(xRefTable, func(i int, d *PDFDict) bool {
+		st := d.Subtype()
+		return i == pageNr && st != nil && *st == "Redact"
+	})
+}
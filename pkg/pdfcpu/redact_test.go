@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyRedactions(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	imgIndRef, err := xRefTable.IndRefForNewObject(PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":             PDFName("XObject"),
+				"Subtype":          PDFName("Image"),
+				"Width":            PDFInteger(1),
+				"Height":           PDFInteger(1),
+				"ColorSpace":       PDFName("DeviceGray"),
+				"BitsPerComponent": PDFInteger(8),
+			},
+		},
+		Content: []byte{0x80},
+	})
+	if err != nil {
+		t.Fatalf("TestApplyRedactions: %v\n", err)
+	}
+
+	pageDict.PDFDictEntry("Resources").Insert("XObject", PDFDict{Dict: map[string]PDFObject{"Im0": *imgIndRef}})
+
+	// Helvetica 12: "Secret" spans 20 .. 54.68
+	content := "BT /F1 12 Tf 20 500 Td (Secret Public) Tj ET\n" +
+		"q 50 0 0 50 100 300 cm /Im0 Do Q\n" +
+		"q 50 0 0 50 300 300 cm /Im0 Do Q\n"
+
+	indRef, err := newContentStream(xRefTable, []byte(content))
+	if err != nil {
+		t.Fatalf("TestApplyRedactions: %v\n", err)
+	}
+	pageDict.Update("Contents", *indRef)
+
+	redact := func(rect PDFArray) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Redact"),
+				"Rect":    rect,
+			},
+		}
+	}
+
+	d := redact(NewRectangle(15, 490, 54, 520))
+	d.Insert("QuadPoints", NewNumberArray(15, 515, 54, 515, 15, 495, 54, 495))
+	addAnnotForTest(t, xRefTable, 1, d)
+
+	d = redact(NewRectangle(90, 290, 120, 310))
+	d.Insert("IC", NewNumberArray(1, 0, 0))
+	d.Insert("OverlayText", PDFStringLiteral("REDACTED"))
+	d.Insert("DA", PDFStringLiteral("/Helv 0 Tf 0 g"))
+	addAnnotForTest(t, xRefTable, 1, d)
+
+	addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+
+	n, err := ApplyRedactions(xRefTable, 1)
+	if err != nil {
+		t.Fatalf("TestApplyRedactions: %v\n", err)
+	}
+
+	if n != 2 {
+		t.Fatalf("TestApplyRedactions: want 2 redactions, got %d\n", n)
+	}
+
+	if arr := pageDict.PDFArrayEntry("Annots"); arr == nil || len(*arr) != 1 {
+		t.Fatalf("TestApplyRedactions: want 1 remaining annotation, got %v\n", pageDict.Dict["Annots"])
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(pageDict.Dict["Contents"])
+	if err != nil {
+		t.Fatalf("TestApplyRedactions: %v\n", err)
+	}
+
+	b, err := streamContent(sd)
+	if err != nil {
+		t.Fatalf("TestApplyRedactions: %v\n", err)
+	}
+	s := string(b)
+
+	// "Secret" gets replaced by a displacement of its width, " Public" remains in place.
+	for _, want := range []string{"[-2890.00 <205075626c6963>] TJ", "300 300 cm /Im0 Do", "1.000 0.000 0.000 rg 90.00 290.00 30.00 20.00 re f", "/Redact0 Do"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("TestApplyRedactions: missing %q in content:\n%s\n", want, s)
+		}
+	}
+
+	for _, unwanted := range []string{"Secret", "100 300 cm /Im0 Do"} {
+		if strings.Contains(s, unwanted) {
+			t.Errorf("TestApplyRedactions: unexpected %q in content:\n%s\n", unwanted, s)
+		}
+	}
+
+	if _, err = contentOperators(b); err != nil {
+		t.Errorf("TestApplyRedactions: corrupt content: %v\n", err)
+	}
+
+	xObjDict := pageDict.PDFDictEntry("Resources").PDFDictEntry("XObject")
+	if xObjDict == nil || xObjDict.IndirectRefEntry("Redact0") == nil {
+		t.Errorf("TestApplyRedactions: missing overlay form: %v\n", pageDict.Dict["Resources"])
+	}
+
+	if n, err = ApplyRedactions(xRefTable, 1); err != nil || n != 0 {
+		t.Errorf("TestApplyRedactions: want no redactions, got %d %v\n", n, err)
+	}
+}
@@ -0,0 +1,360 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hhrutter/pdfcpu/pkg/log"
+)
+
+// AnnotStatus represents the outcome of validating an annotation.
+type AnnotStatus int
+
+// The possible outcomes of validating an annotation.
+const (
+	AnnotOK AnnotStatus = iota
+	AnnotFixed
+	AnnotUnfixable
+)
+
+func (s AnnotStatus) String() string {
+
+	switch s {
+	case AnnotOK:
+		return "ok"
+	case AnnotFixed:
+		return "fixed"
+	case AnnotUnfixable:
+		return "unfixable"
+	}
+
+	return ""
+}
+
+// AnnotReportEntry describes the validation result for a single annotation.
+type AnnotReportEntry struct {
+	PageNr  int
+	ObjNr   int // 0 for annotation dicts embedded directly into the Annots array.
+	Subtype string
+	Status  AnnotStatus
+	Entry   string // The offending entry, if known.
+	Msg     string
+}
+
+func (e AnnotReportEntry) String() string {
+
+	s := fmt.Sprintf("page %d obj#%d %s: %s", e.PageNr, e.ObjNr, e.Subtype, e.Status)
+
+	if e.Status != AnnotOK {
+		s += fmt.Sprintf(" entry=%s: %s", e.Entry, e.Msg)
+	}
+
+	return s
+}
+
+// AnnotReport enumerates the validation results for all annotations of a document.
+type AnnotReport []AnnotReportEntry
+
+// Count returns the number of annotations with status s.
+func (r AnnotReport) Count(s AnnotStatus) int {
+
+	i := 0
+
+	for _, e := range r {
+		if e.Status == s {
+			i++
+		}
+	}
+
+	return i
+}
+
+func (r AnnotReport) String() string {
+
+	var logStr []string
+
+	for _, e := range r {
+		logStr = append(logStr, e.String())
+	}
+
+	return strings.Join(logStr, "\n")
+}
+
+// annotFixer repairs a specific entry of annotation dict obj#objNr and returns true if anything was changed.
+// All changes get recorded via setAnnotationEntry.
+type annotFixer struct {
+	entry string
+	fix   func(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool
+}
+
+func fixAnnotEntryType(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool {
+
+	obj, found := dict.Find("Type")
+	if !found {
+		return false
+	}
+
+	if o, _ := xRefTable.Dereference(obj); o != nil {
+		if n, ok := o.(PDFName); ok && n == "Annot" {
+			return false
+		}
+	}
+
+	setAnnotationEntry(xRefTable, objNr, dict, "Type", PDFName("Annot"))
+
+	return true
+}
+
+func fixAnnotEntryP(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool {
+
+	obj, found := dict.Find("P")
+	if !found {
+		return false
+	}
+
+	if indRef, ok := obj.(PDFIndirectRef); ok {
+		d, err := xRefTable.DereferenceDict(indRef)
+		if err == nil && d != nil && d.Type() != nil && *d.Type() == "Page" {
+			return false
+		}
+	}
+
+	setAnnotationEntry(xRefTable, objNr, dict, "P", pageIndRef)
+
+	return true
+}
+
+// fixOptionalEntry removes an optional entry if it fails given validation.
+func fixOptionalEntry(xRefTable *XRefTable, objNr int, dict *PDFDict, entryName string, valid func(PDFObject) bool) bool {
+
+	obj, found := dict.Find(entryName)
+	if !found {
+		return false
+	}
+
+	o, err := xRefTable.Dereference(obj)
+	if err == nil && o != nil && valid(o) {
+		return false
+	}
+
+	setAnnotationEntry(xRefTable, objNr, dict, entryName, nil)
+
+	return true
+}
+
+func isNumberArray(o PDFObject) (PDFArray, bool) {
+
+	arr, ok := o.(PDFArray)
+	if !ok {
+		return nil, false
+	}
+
+	for _, v := range arr {
+		switch v.(type) {
+		case PDFInteger, PDFFloat:
+		default:
+			return nil, false
+		}
+	}
+
+	return arr, true
+}
+
+func fixAnnotEntryBorder(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool {
+
+	// Missing Border defaults to [0 0 1].
+	return fixOptionalEntry(xRefTable, objNr, dict, "Border", func(o PDFObject) bool {
+		arr, ok := isNumberArray(o)
+		return ok && validateBorderArrayLength(arr)
+	})
+}
+
+func fixAnnotEntryC(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool {
+
+	return fixOptionalEntry(xRefTable, objNr, dict, "C", func(o PDFObject) bool {
+		_, ok := isNumberArray(o)
+		return ok
+	})
+}
+
+func fixAnnotEntryF(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool {
+
+	obj, found := dict.Find("F")
+	if !found {
+		return false
+	}
+
+	// Real world flags sometimes come as floats.
+	if f, ok := obj.(PDFFloat); ok {
+		setAnnotationEntry(xRefTable, objNr, dict, "F", PDFInteger(int(f.Value())))
+		return true
+	}
+
+	return fixOptionalEntry(xRefTable, objNr, dict, "F", func(o PDFObject) bool {
+		_, ok := o.(PDFInteger)
+		return ok
+	})
+}
+
+func isString(o PDFObject) bool {
+
+	switch o.(type) {
+	case PDFStringLiteral, PDFHexLiteral:
+		return true
+	}
+
+	return false
+}
+
+func fixAnnotEntryNM(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool {
+	return fixOptionalEntry(xRefTable, objNr, dict, "NM", isString)
+}
+
+func fixAnnotEntryM(xRefTable *XRefTable, objNr int, dict *PDFDict, pageIndRef PDFIndirectRef) bool {
+	return fixOptionalEntry(xRefTable, objNr, dict, "M", isString)
+}
+
+var annotFixers = []annotFixer{
+	{"Type", fixAnnotEntryType},
+	{"P", fixAnnotEntryP},
+	{"Border", fixAnnotEntryBorder},
+	{"C", fixAnnotEntryC},
+	{"F", fixAnnotEntryF},
+	{"NM", fixAnnotEntryNM},
+	{"M", fixAnnotEntryM},
+}
+
+var reErrEntry = regexp.MustCompile(`entry=(\S+)`)
+
+// errEntry extracts the offending entry name from a validation error.
+func errEntry(err error) string {
+
+	m := reErrEntry.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(m[1], ".")
+}
+
+func validateAndFixAnnot(xRefTable *XRefTable, objNr int, pageIndRef PDFIndirectRef, dict *PDFDict) (AnnotStatus, string, string) {
+
+	_, err := validateAnnotationDict(xRefTable, dict)
+	if err == nil {
+		return AnnotOK, "", ""
+	}
+
+	msg := strings.TrimSpace(err.Error())
+
+	var fixed []string
+
+	for _, f := range annotFixers {
+		if f.fix(xRefTable, objNr, dict, pageIndRef) {
+			log.Debug.Printf("validateAndFixAnnot: fixed entry %s\n", f.entry)
+			fixed = append(fixed, f.entry)
+		}
+	}
+
+	if len(fixed) == 0 {
+		return AnnotUnfixable, errEntry(err), msg
+	}
+
+	_, err = validateAnnotationDict(xRefTable, dict)
+	if err != nil {
+		return AnnotUnfixable, errEntry(err), strings.TrimSpace(err.Error())
+	}
+
+	return AnnotFixed, strings.Join(fixed, ","), msg
+}
+
+// ValidateAndFixAnnots validates all annotations of a document, repairs the issues it can
+// and returns a report listing the status of every annotation.
+func ValidateAndFixAnnots(xRefTable *XRefTable) (AnnotReport, error) {
+
+	var report AnnotReport
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, dict *PDFDict) error {
+
+		e := AnnotReportEntry{PageNr: pageNr}
+
+		if indRef != nil {
+			e.ObjNr = indRef.ObjectNumber.Value()
+		}
+
+		if st := dict.Subtype(); st != nil {
+			e.Subtype = *st
+		}
+
+		e.Status, e.Entry, e.Msg = validateAndFixAnnot(xRefTable, e.ObjNr, pageIndRef, dict)
+
+		report = append(report, e)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// FixSwappedQuadPoints reorders the QuadPoints of text markup annotations listing the lower edge
+// of their quadrilaterals first, see quadPointsSwapped. Returns the number of annotations fixed.
+func FixSwappedQuadPoints(xRefTable *XRefTable) (int, error) {
+
+	fixed := 0
+
+	filter := AnnotationSubtypeFilter("Highlight", "Underline", "Squiggly", "StrikeOut")
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, dict *PDFDict) error {
+
+		if !filter(pageNr, dict) {
+			return nil
+		}
+
+		f, err := numbers(xRefTable, dict.Dict["QuadPoints"])
+		if err != nil || !quadPointsSwapped(f) {
+			return err
+		}
+
+		for i := 0; i < len(f); i += 8 {
+			for j := i; j < i+4; j++ {
+				f[j], f[j+4] = f[j+4], f[j]
+			}
+		}
+
+		objNr := 0
+		if indRef != nil {
+			objNr = indRef.ObjectNumber.Value()
+		}
+
+		setAnnotationEntry(xRefTable, objNr, dict, "QuadPoints", NewNumberArray(f...))
+		fixed++
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return fixed, nil
+}
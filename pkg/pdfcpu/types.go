@@ -180,10 +180,15 @@ func DateStringLiteral(t time.Time) PDFStringLiteral {
 
 	_, tz := t.Zone()
 
-	dateStr := fmt.Sprintf("D:%d%02d%02d%02d%02d%02d+%02d'%02d'",
+	sign := '+'
+	if tz < 0 {
+		sign, tz = '-', -tz
+	}
+
+	dateStr := fmt.Sprintf("D:%d%02d%02d%02d%02d%02d%c%02d'%02d'",
 		t.Year(), t.Month(), t.Day(),
 		t.Hour(), t.Minute(), t.Second(),
-		tz/60/60, tz/60%60)
+		sign, tz/60/60, tz/60%60)
 
 	return PDFStringLiteral(dateStr)
 }
@@ -0,0 +1,219 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// uriBase returns the base URI defined by the URI dict of the catalog.
+func uriBase(xRefTable *XRefTable) (*url.URL, error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := xRefTable.DereferenceDict(rootDict.Dict["URI"])
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	s := decodedTextString(xRefTable, d.Dict["Base"])
+	if s == "" {
+		return nil, nil
+	}
+
+	base, err := url.Parse(s)
+	if err != nil {
+		// An unusable base leaves relative URIs unresolved.
+		return nil, nil
+	}
+
+	return base, nil
+}
+
+// resolveURI resolves a relative uri against base.
+func resolveURI(base *url.URL, uri string) string {
+
+	if base == nil {
+		return uri
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || u.IsAbs() {
+		return uri
+	}
+
+	return base.ResolveReference(u).String()
+}
+
+// annotationURIs returns the URIs of all URI actions of an annotation reached via A including chained actions and PA.
+func annotationURIs(xRefTable *XRefTable, annotDict *PDFDict) ([]string, error) {
+
+	var uris []string
+
+	f := func(d PDFDict) {
+		if s := d.NameEntry("S"); s == nil || *s != "URI" {
+			return
+		}
+		if uri := decodedTextString(xRefTable, d.Dict["URI"]); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+
+	for _, key := range []string{"A", "PA"} {
+		if err := visitActions(xRefTable, annotDict.Dict[key], f); err != nil {
+			return nil, err
+		}
+	}
+
+	return uris, nil
+}
+
+// ExtractURIs returns the target URIs of the URI actions of all annotations by page number.
+// Relative URIs get resolved against the Base entry of the catalog URI dict.
+// Pages without URIs are omitted.
+func ExtractURIs(xRefTable *XRefTable) (map[int][]string, error) {
+
+	base, err := uriBase(xRefTable)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[int][]string{}
+
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		uris, err := annotationURIs(xRefTable, annotDict)
+		if err != nil {
+			return err
+		}
+
+		for _, uri := range uris {
+			m[pageNr] = append(m[pageNr], resolveURI(base, uri))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// rewriteURI applies f to the URI entry of the URI action dict d.
+// An indirect URI string gets updated in place unless already visited.
+func rewriteURI(xRefTable *XRefTable, d PDFDict, f func(old string) (new string, changed bool), visited IntSet) (bool, error) {
+
+	obj, found := d.Find("URI")
+	if !found {
+		return false, nil
+	}
+
+	indRef, ok := obj.(PDFIndirectRef)
+	if ok {
+		if visited[indRef.ObjectNumber.Value()] {
+			return false, nil
+		}
+		visited[indRef.ObjectNumber.Value()] = true
+	}
+
+	uri, changed := f(decodedTextString(xRefTable, obj))
+	if !changed {
+		return false, nil
+	}
+
+	if uri == "" {
+		return false, errors.New("RewriteURIs: empty URI")
+	}
+
+	s, err := Escape(uri)
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		entry, found := xRefTable.FindTableEntryForIndRef(&indRef)
+		if !found {
+			return false, errors.Errorf("RewriteURIs: missing obj#%d", indRef.ObjectNumber.Value())
+		}
+		entry.Object = PDFStringLiteral(*s)
+		return true, nil
+	}
+
+	d.Update("URI", PDFStringLiteral(*s))
+
+	return true, nil
+}
+
+// RewriteURIs applies f to the URI of every URI action of all Link annotations
+// including chained actions and PA and returns the number of changed URIs.
+// f is called with the URI as stored and must not produce an empty URI.
+// Annotations, actions and URI strings shared by several Links are rewritten once.
+func RewriteURIs(xRefTable *XRefTable, f func(old string) (new string, changed bool)) (int, error) {
+
+	i := 0
+
+	// Object numbers of all annotations, actions and URI strings visited so far.
+	visited := IntSet{}
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+
+		if st := annotDict.Subtype(); st == nil || *st != "Link" {
+			return nil
+		}
+
+		if indRef != nil {
+			if visited[indRef.ObjectNumber.Value()] {
+				return nil
+			}
+			visited[indRef.ObjectNumber.Value()] = true
+		}
+
+		var err error
+
+		g := func(d PDFDict) {
+			if err != nil {
+				return
+			}
+			if s := d.NameEntry("S"); s == nil || *s != "URI" {
+				return
+			}
+			var changed bool
+			if changed, err = rewriteURI(xRefTable, d, f, visited); changed {
+				i++
+			}
+		}
+
+		for _, key := range []string{"A", "PA"} {
+			if e := visitActionsOnce(xRefTable, annotDict.Dict[key], visited, g); e != nil {
+				return e
+			}
+			if err != nil {
+				return errors.Wrapf(err, "page %d", pageNr)
+			}
+		}
+
+		return nil
+	})
+
+	return i, err
+}
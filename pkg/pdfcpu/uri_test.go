@@ -0,0 +1,171 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func uriActionForTest(uri string, next PDFObject) PDFDict {
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type": PDFName("Action"),
+			"S":    PDFName("URI"),
+			"URI":  PDFStringLiteral(uri),
+		},
+	}
+
+	if next != nil {
+		d.Insert("Next", next)
+	}
+
+	return d
+}
+
+func TestExtractURIs(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 3)
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestExtractURIs: %v\n", err)
+	}
+
+	rootDict.Insert("URI", PDFDict{Dict: map[string]PDFObject{"Base": PDFStringLiteral("http://example.com/docs/")}})
+
+	// URI action followed by a chained relative URI action.
+	next := uriActionForTest("faq.html", nil)
+	action := uriActionForTest("https://golang.org", next)
+	addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(nil, &action))
+
+	// GoTo action and a URI action for the enclosing link annotation.
+	_, page1 := pageForTest(t, xRefTable, 1)
+	action = PDFDict{
+		Dict: map[string]PDFObject{
+			"S": PDFName("GoTo"),
+			"D": PDFArray{page1, PDFName("Fit")},
+		},
+	}
+	d := linkAnnotForTest(nil, &action)
+	d.Insert("PA", uriActionForTest("../index.html", nil))
+	addAnnotForTest(t, xRefTable, 2, d)
+
+	m, err := ExtractURIs(xRefTable)
+	if err != nil {
+		t.Fatalf("TestExtractURIs: %v\n", err)
+	}
+
+	want := map[int][]string{
+		1: {"https://golang.org", "http://example.com/docs/faq.html"},
+		2: {"http://example.com/index.html"},
+	}
+
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("TestExtractURIs: want %v, got %v\n", want, m)
+	}
+}
+
+func TestRewriteURIs(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	uriIndRef, err := xRefTable.IndRefForNewObject(PDFStringLiteral("http://old.example.com/b"))
+	if err != nil {
+		t.Fatalf("TestRewriteURIs: %v\n", err)
+	}
+
+	// Direct URI followed by a chained action referring to an indirect URI.
+	next := uriActionForTest("", nil)
+	next.Update("URI", *uriIndRef)
+	action := uriActionForTest("http://old.example.com/a", next)
+	addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(nil, &action))
+
+	other := uriActionForTest("https://golang.org", nil)
+	addAnnotForTest(t, xRefTable, 1, linkAnnotForTest(nil, &other))
+
+	migrate := func(old string) (string, bool) {
+		if !strings.HasPrefix(old, "http://old.example.com/") {
+			return old, false
+		}
+		return strings.Replace(old, "http://old.example.com/", "https://new.example.com/", 1), true
+	}
+
+	i, err := RewriteURIs(xRefTable, migrate)
+	if err != nil {
+		t.Fatalf("TestRewriteURIs: %v\n", err)
+	}
+
+	if i != 2 {
+		t.Fatalf("TestRewriteURIs: want 2 changed URIs, got %d\n", i)
+	}
+
+	m, err := ExtractURIs(xRefTable)
+	if err != nil {
+		t.Fatalf("TestRewriteURIs: %v\n", err)
+	}
+
+	want := []string{"https://new.example.com/a", "https://new.example.com/b", "https://golang.org"}
+	if !reflect.DeepEqual(m[1], want) {
+		t.Fatalf("TestRewriteURIs: want %v, got %v\n", want, m[1])
+	}
+
+	if _, ok := next.Dict["URI"].(PDFIndirectRef); !ok {
+		t.Fatalf("TestRewriteURIs: indirect URI replaced by %v\n", next.Dict["URI"])
+	}
+
+	if _, err = RewriteURIs(xRefTable, func(old string) (string, bool) { return "", true }); err == nil {
+		t.Fatalf("TestRewriteURIs: expected error for empty URI\n")
+	}
+}
+
+func TestRewriteURIsSharedAction(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	actionIndRef, err := xRefTable.IndRefForNewObject(uriActionForTest("http://a.com", nil))
+	if err != nil {
+		t.Fatalf("TestRewriteURIsSharedAction: %v\n", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		d := linkAnnotForTest(nil, nil)
+		d.Insert("A", *actionIndRef)
+		addAnnotForTest(t, xRefTable, 1, d)
+	}
+
+	i, err := RewriteURIs(xRefTable, func(old string) (string, bool) { return old + "/x", true })
+	if err != nil {
+		t.Fatalf("TestRewriteURIsSharedAction: %v\n", err)
+	}
+
+	if i != 1 {
+		t.Errorf("TestRewriteURIsSharedAction: want 1 changed URI, got %d\n", i)
+	}
+
+	m, err := ExtractURIs(xRefTable)
+	if err != nil {
+		t.Fatalf("TestRewriteURIsSharedAction: %v\n", err)
+	}
+
+	want := []string{"http://a.com/x", "http://a.com/x"}
+	if !reflect.DeepEqual(m[1], want) {
+		t.Fatalf("TestRewriteURIsSharedAction: want %v, got %v\n", want, m[1])
+	}
+}
@@ -183,3 +183,25 @@ func HexLiteralToString(hexString string) (string, error) {
 	// if no acceptable UTF16 encoding found, just return decoded hexstring.
 	return string(b), nil
 }
+
+// textStringObject returns a text string object for s, see 7.9.2.2
+// 7 bit strings result in a string literal, all other strings get encoded as UTF-16BE.
+func textStringObject(s string) (PDFObject, error) {
+
+	for _, r := range s {
+		if r >= utf8.RuneSelf {
+			b := []byte{0xFE, 0xFF}
+			for _, c := range utf16.Encode([]rune(s)) {
+				b = append(b, byte(c>>8), byte(c))
+			}
+			return PDFHexLiteral(hex.EncodeToString(b)), nil
+		}
+	}
+
+	e, err := Escape(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return PDFStringLiteral(*e), nil
+}
@@ -17,6 +17,10 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/pkg/errors"
 )
 
@@ -76,6 +80,25 @@ func validateAppearanceDictEntry(xRefTable *XRefTable, obj PDFObject) error {
 	return err
 }
 
+// validateAppearanceDictKeys ensures an appearance dict contains the entries N, R and D only.
+func validateAppearanceDictKeys(xRefTable *XRefTable, dict *PDFDict) error {
+
+	var keys []string
+	for k := range dict.Dict {
+		if !memberOf(k, []string{"N", "R", "D"}) {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sort.Strings(keys)
+
+	return xRefTable.reportNonFatal("validateAppearanceDict: unexpected entries: %s", strings.Join(keys, ","))
+}
+
 func validateAppearanceDict(xRefTable *XRefTable, obj PDFObject) error {
 
 	// see 12.5.5 Appearance Streams
@@ -85,6 +108,11 @@ func validateAppearanceDict(xRefTable *XRefTable, obj PDFObject) error {
 		return err
 	}
 
+	err = validateAppearanceDictKeys(xRefTable, dict)
+	if err != nil {
+		return err
+	}
+
 	// Normal Appearance
 	obj, ok := dict.Find("N")
 	if !ok {
@@ -180,7 +208,29 @@ func validateAcroFieldDictEntries(xRefTable *XRefTable, dict *PDFDict, terminalN
 		return nil, err
 	}
 
-	return outFieldType, nil
+	// Q, optional, integer, quadding for fields containing variable text
+	ft := inFieldType
+	if fieldType != nil {
+		ft = fieldType
+	}
+	err = validateAcroFieldQuadding(xRefTable, dict, dictName, ft)
+
+	return outFieldType, err
+}
+
+// validateAcroFieldQuadding ensures Q is only used by fields containing variable text: text fields and choice fields.
+func validateAcroFieldQuadding(xRefTable *XRefTable, dict *PDFDict, dictName string, fieldType *PDFName) error {
+
+	q, err := validateIntegerEntry(xRefTable, dict, dictName, "Q", OPTIONAL, V10, validateQ)
+	if err != nil || q == nil || fieldType == nil {
+		return err
+	}
+
+	if memberOf(fieldType.Value(), []string{"Tx", "Ch"}) {
+		return nil
+	}
+
+	return xRefTable.reportNonFatal("validateAcroFieldQuadding: dict=%s entry=Q not allowed for field type %s", dictName, fieldType)
 }
 
 func validateAcroFieldDict(xRefTable *XRefTable, indRef *PDFIndirectRef, inFieldType *PDFName) error {
@@ -225,7 +275,12 @@ func validateAcroFieldDict(xRefTable *XRefTable, indRef *PDFIndirectRef, inField
 
 		}
 
-		return nil
+		err = validateAcroFieldWidgetRects(xRefTable, arr)
+		if err != nil {
+			return err
+		}
+
+		return validateRadioKidAppearances(xRefTable, dict, arr)
 	}
 
 	// dict represents a terminal field and must have Subtype "Widget"
@@ -246,6 +301,125 @@ func validateAcroFieldDict(xRefTable *XRefTable, indRef *PDFIndirectRef, inField
 	return err
 }
 
+// validateAcroFieldWidgetRects ensures no two widget kids of a field share a Rect on the same page.
+func validateAcroFieldWidgetRects(xRefTable *XRefTable, kids *PDFArray) error {
+
+	seen := map[string]int{}
+
+	for _, value := range *kids {
+
+		indRef := value.(PDFIndirectRef)
+
+		dict, err := xRefTable.DereferenceDict(indRef)
+		if err != nil || dict == nil || dict.Subtype() == nil || *dict.Subtype() != "Widget" {
+			continue
+		}
+
+		r, err := numbers(xRefTable, dict.Dict["Rect"])
+		if err != nil || len(r) != 4 {
+			continue
+		}
+
+		pageObjNr := 0
+		if p := dict.IndirectRefEntry("P"); p != nil {
+			pageObjNr = p.ObjectNumber.Value()
+		}
+
+		key := fmt.Sprintf("%d %.2f %.2f %.2f %.2f", pageObjNr, r[0], r[1], r[2], r[3])
+
+		objNr, found := seen[key]
+		if !found {
+			seen[key] = indRef.ObjectNumber.Value()
+			continue
+		}
+
+		if err := xRefTable.reportOptIn(xRefTable.StrictWidgetRects, "validateAcroFieldWidgetRects: widgets obj#%d and obj#%d share Rect %v", objNr, indRef.ObjectNumber.Value(), r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateRadioKidAppearances reports widget kids of a radio button field
+// sharing the normal appearance of different on states as a non fatal issue.
+// Visually identical on states commonly share one form XObject.
+func validateRadioKidAppearances(xRefTable *XRefTable, dict *PDFDict, kids *PDFArray) error {
+
+	ft, err := inheritableAttr(xRefTable, *dict, "FT")
+	if err != nil {
+		return err
+	}
+
+	ff, err := inheritableAttr(xRefTable, *dict, "Ff")
+	if err != nil {
+		return err
+	}
+
+	if ft, ok := ft.(PDFName); !ok || ft != "Btn" {
+		return nil
+	}
+
+	if ff, ok := ff.(PDFInteger); !ok || ff.Value()&fieldFlagRadio == 0 {
+		return nil
+	}
+
+	type onState struct {
+		kidObjNr int
+		name     string
+	}
+
+	seen := map[int]onState{}
+
+	for _, value := range *kids {
+
+		indRef := value.(PDFIndirectRef)
+
+		d, err := xRefTable.DereferenceDict(indRef)
+		if err != nil || d == nil {
+			continue
+		}
+
+		ap, err := xRefTable.DereferenceDict(d.Dict["AP"])
+		if err != nil || ap == nil {
+			continue
+		}
+
+		n, err := xRefTable.DereferenceDict(ap.Dict["N"])
+		if err != nil || n == nil {
+			continue
+		}
+
+		for state, obj := range n.Dict {
+
+			formIndRef, ok := obj.(PDFIndirectRef)
+			if !ok || state == "Off" {
+				continue
+			}
+
+			objNr := formIndRef.ObjectNumber.Value()
+
+			other, found := seen[objNr]
+			if !found {
+				seen[objNr] = onState{indRef.ObjectNumber.Value(), state}
+				continue
+			}
+
+			if other.name == state {
+				continue
+			}
+
+			err = xRefTable.reportNonFatal("validateRadioKidAppearances: widgets obj#%d and obj#%d share appearance obj#%d for on states %s and %s",
+				other.kidObjNr, indRef.ObjectNumber.Value(), objNr, other.name, state)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func validateAcroFormFields(xRefTable *XRefTable, obj PDFObject) error {
 
 	arr, err := xRefTable.DereferenceArray(obj)
@@ -393,6 +567,81 @@ func validateAcroFormEntryDR(xRefTable *XRefTable, dict *PDFDict) error {
 	return err
 }
 
+// hasFieldValue returns true for a non empty field value.
+func hasFieldValue(xRefTable *XRefTable, obj PDFObject) bool {
+
+	o, err := xRefTable.Dereference(obj)
+	if err != nil || o == nil {
+		return false
+	}
+
+	switch o := o.(type) {
+
+	case PDFStringLiteral:
+		return len(o.Value()) > 0
+
+	case PDFHexLiteral:
+		return len(o.Value()) > 0
+
+	case PDFName:
+		return o.Value() != "Off"
+
+	case PDFArray:
+		return len(o) > 0
+
+	case PDFStreamDict:
+		return true
+
+	}
+
+	return false
+}
+
+// validateAcroFormWidgetAppearances ensures all widgets of fields carrying a value have an appearance dict.
+func validateAcroFormWidgetAppearances(xRefTable *XRefTable, obj PDFObject, inheritedValue PDFObject) error {
+
+	arr, err := xRefTable.DereferenceArray(obj)
+	if err != nil || arr == nil {
+		return err
+	}
+
+	for _, value := range *arr {
+
+		indRef, ok := value.(PDFIndirectRef)
+		if !ok {
+			continue
+		}
+
+		dict, err := xRefTable.DereferenceDict(indRef)
+		if err != nil || dict == nil {
+			return err
+		}
+
+		v := inheritedValue
+		if o, found := dict.Find("V"); found {
+			v = o
+		}
+
+		if kids, found := dict.Find("Kids"); found {
+			err = validateAcroFormWidgetAppearances(xRefTable, kids, v)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, found := dict.Find("AP"); found || !hasFieldValue(xRefTable, v) {
+			continue
+		}
+
+		if err := xRefTable.reportNonFatal("validateAcroForm: NeedAppearances is false but widget obj#%d with value lacks AP", indRef.ObjectNumber); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func validateAcroForm(xRefTable *XRefTable, rootDict *PDFDict, required bool, sinceVersion PDFVersion) error {
 
 	// => 12.7.2 Interactive Form Dictionary
@@ -422,11 +671,19 @@ func validateAcroForm(xRefTable *XRefTable, rootDict *PDFDict, required bool, si
 	dictName := "acroFormDict"
 
 	// NeedAppearances: optional, boolean
-	_, err = validateBooleanEntry(xRefTable, dict, dictName, "NeedAppearances", OPTIONAL, V10, nil)
+	needAppearances, err := validateBooleanEntry(xRefTable, dict, dictName, "NeedAppearances", OPTIONAL, V10, nil)
 	if err != nil {
 		return err
 	}
 
+	// Without NeedAppearances viewers rely on the appearance streams of widgets.
+	if needAppearances == nil || !needAppearances.Value() {
+		err = validateAcroFormWidgetAppearances(xRefTable, obj, nil)
+		if err != nil {
+			return err
+		}
+	}
+
 	// SigFlags: optional, since 1.3, integer
 	_, err = validateIntegerEntry(xRefTable, dict, dictName, "SigFlags", OPTIONAL, V13, nil)
 	if err != nil {
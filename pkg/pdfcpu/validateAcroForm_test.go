@@ -0,0 +1,330 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAcroFormNeedAppearances(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	field := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Widget"),
+			"FT":      PDFName("Tx"),
+			"T":       PDFStringLiteral("name"),
+			"V":       PDFStringLiteral("John"),
+			"Rect":    NewRectangle(10, 10, 110, 30),
+		},
+	}
+
+	indRef := addAnnotForTest(t, xRefTable, 1, field)
+
+	acroForm := PDFDict{
+		Dict: map[string]PDFObject{
+			"Fields": PDFArray{indRef},
+		},
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestValidateAcroFormNeedAppearances: %v\n", err)
+	}
+
+	rootDict.Insert("AcroForm", acroForm)
+
+	xRefTable.ValidationMode = ValidationStrict
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err == nil {
+		t.Errorf("TestValidateAcroFormNeedAppearances: widget without AP => not ok!\n")
+	}
+
+	xRefTable.ValidationMode = ValidationRelaxed
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateAcroFormNeedAppearances: %v\n", err)
+	}
+	if len(xRefTable.ValidationWarnings()) != 1 {
+		t.Errorf("TestValidateAcroFormNeedAppearances: expected 1 warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+
+	// Viewers generate the appearance.
+	acroForm.Insert("NeedAppearances", PDFBoolean(true))
+
+	xRefTable.ValidationMode = ValidationStrict
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateAcroFormNeedAppearances: %v\n", err)
+	}
+}
+
+func TestValidateAcroFieldWidgetRects(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	widget := func() PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Widget"),
+				"Rect":    NewRectangle(10, 10, 110, 30),
+			},
+		}
+	}
+
+	kid1 := addAnnotForTest(t, xRefTable, 1, widget())
+	kid2 := addAnnotForTest(t, xRefTable, 1, widget())
+
+	field := PDFDict{
+		Dict: map[string]PDFObject{
+			"FT":   PDFName("Tx"),
+			"T":    PDFStringLiteral("name"),
+			"Kids": PDFArray{kid1, kid2},
+		},
+	}
+
+	fieldIndRef, err := xRefTable.IndRefForNewObject(field)
+	if err != nil {
+		t.Fatalf("TestValidateAcroFieldWidgetRects: %v\n", err)
+	}
+
+	for _, kid := range []PDFIndirectRef{kid1, kid2} {
+		d, _ := xRefTable.DereferenceDict(kid)
+		d.Insert("Parent", *fieldIndRef)
+	}
+
+	acroForm := PDFDict{
+		Dict: map[string]PDFObject{
+			"Fields":          PDFArray{*fieldIndRef},
+			"NeedAppearances": PDFBoolean(true),
+		},
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestValidateAcroFieldWidgetRects: %v\n", err)
+	}
+
+	rootDict.Insert("AcroForm", acroForm)
+
+	// Warn by default, even in strict mode.
+	xRefTable.ValidationMode = ValidationStrict
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateAcroFieldWidgetRects: %v\n", err)
+	}
+	if len(xRefTable.ValidationWarnings()) != 1 {
+		t.Errorf("TestValidateAcroFieldWidgetRects: expected 1 warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+
+	xRefTable.StrictWidgetRects = true
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err == nil {
+		t.Errorf("TestValidateAcroFieldWidgetRects: duplicate widget => not ok!\n")
+	}
+
+	xRefTable.ValidationMode = ValidationRelaxed
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateAcroFieldWidgetRects: %v\n", err)
+	}
+	if len(xRefTable.ValidationWarnings()) != 2 {
+		t.Errorf("TestValidateAcroFieldWidgetRects: expected 2 warnings, got %v\n", xRefTable.ValidationWarnings())
+	}
+
+	// Moving one widget resolves the conflict.
+	d, _ := xRefTable.DereferenceDict(kid2)
+	d.Update("Rect", NewRectangle(10, 40, 110, 60))
+
+	xRefTable.ValidationMode = ValidationStrict
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateAcroFieldWidgetRects: %v\n", err)
+	}
+}
+
+func TestValidateAcroFieldQuadding(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+	xRefTable.ValidationMode = ValidationStrict
+
+	btn := PDFName("Btn")
+
+	for _, tt := range []struct {
+		fieldType   string
+		inFieldType *PDFName
+		q           int
+		ok          bool
+	}{
+		{"Tx", nil, 1, true},
+		{"Tx", nil, 3, false},
+		{"Ch", nil, 2, true},
+		{"Btn", nil, 1, false},
+		{"", &btn, 1, false}, // checkbox kid inheriting its field type
+	} {
+
+		field := PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Widget"),
+				"T":       PDFStringLiteral("field"),
+				"Q":       PDFInteger(tt.q),
+				"Rect":    NewRectangle(10, 10, 110, 30),
+			},
+		}
+
+		if tt.fieldType != "" {
+			field.Insert("FT", PDFName(tt.fieldType))
+		}
+
+		_, err := validateAcroFieldDictEntries(xRefTable, &field, true, tt.inFieldType)
+		if tt.ok && err != nil {
+			t.Errorf("TestValidateAcroFieldQuadding: FT=%s Q=%d: %v\n", tt.fieldType, tt.q, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("TestValidateAcroFieldQuadding: FT=%s Q=%d: valid => not ok!\n", tt.fieldType, tt.q)
+		}
+	}
+
+	// Collecting warnings lets strict validation continue.
+	xRefTable.CollectWarnings = true
+
+	field := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Widget"),
+			"FT":      PDFName("Btn"),
+			"T":       PDFStringLiteral("field"),
+			"Q":       PDFInteger(1),
+			"Rect":    NewRectangle(10, 10, 110, 30),
+		},
+	}
+
+	if _, err := validateAcroFieldDictEntries(xRefTable, &field, true, nil); err != nil {
+		t.Errorf("TestValidateAcroFieldQuadding: %v\n", err)
+	}
+
+	if warnings := xRefTable.ValidationWarnings(); len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "entry=Q not allowed") {
+		t.Errorf("TestValidateAcroFieldQuadding: expected Q warning, got: %v\n", warnings)
+	}
+}
+
+func TestValidateRadioKidAppearances(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	on := formForTest(t, xRefTable, "0 0 20 20 re f", NewRectangle(0, 0, 20, 20), nil)
+	off := formForTest(t, xRefTable, "0 0 20 20 re S", NewRectangle(0, 0, 20, 20), nil)
+
+	radio := func(state string, x float64) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Widget"),
+				"Rect":    NewRectangle(x, 10, x+20, 30),
+				"AS":      PDFName("Off"),
+				"AP": PDFDict{
+					Dict: map[string]PDFObject{
+						"N": PDFDict{Dict: map[string]PDFObject{state: on, "Off": off}},
+					},
+				},
+			},
+		}
+	}
+
+	kid1 := addAnnotForTest(t, xRefTable, 1, radio("card1", 10))
+	kid2 := addAnnotForTest(t, xRefTable, 1, radio("card2", 40))
+
+	field := PDFDict{
+		Dict: map[string]PDFObject{
+			"FT":   PDFName("Btn"),
+			"Ff":   PDFInteger(fieldFlagRadio),
+			"T":    PDFStringLiteral("card"),
+			"Kids": PDFArray{kid1, kid2},
+		},
+	}
+
+	fieldIndRef, err := xRefTable.IndRefForNewObject(field)
+	if err != nil {
+		t.Fatalf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+
+	for _, kid := range []PDFIndirectRef{kid1, kid2} {
+		d, _ := xRefTable.DereferenceDict(kid)
+		d.Insert("Parent", *fieldIndRef)
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+
+	rootDict.Insert("AcroForm", PDFDict{Dict: map[string]PDFObject{"Fields": PDFArray{*fieldIndRef}}})
+
+	xRefTable.ValidationMode = ValidationStrict
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err == nil {
+		t.Errorf("TestValidateRadioKidAppearances: shared on appearance => not ok!\n")
+	}
+
+	xRefTable.ValidationMode = ValidationRelaxed
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+	if len(xRefTable.ValidationWarnings()) != 1 {
+		t.Errorf("TestValidateRadioKidAppearances: expected 1 warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+
+	xRefTable.ValidationMode = ValidationStrict
+	xRefTable.CollectWarnings = true
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+	if len(xRefTable.ValidationWarnings()) != 2 {
+		t.Errorf("TestValidateRadioKidAppearances: expected 2 warnings, got %v\n", xRefTable.ValidationWarnings())
+	}
+	xRefTable.CollectWarnings = false
+
+	// A distinct on appearance resolves the conflict.
+	d, _ := xRefTable.DereferenceDict(kid2)
+	on2 := formForTest(t, xRefTable, "0 0 20 20 re f", NewRectangle(0, 0, 20, 20), nil)
+	d.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": PDFDict{Dict: map[string]PDFObject{"card2": on2, "Off": off}}}})
+
+	xRefTable.ValidationMode = ValidationStrict
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+
+	// The demo form shares one on appearance between its radio buttons.
+	xRefTable, err = CreateAcroFormDemoXRef()
+	if err != nil {
+		t.Fatalf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+
+	if rootDict, err = xRefTable.Catalog(); err != nil {
+		t.Fatalf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+
+	xRefTable.ValidationMode = ValidationRelaxed
+	if err = validateAcroForm(xRefTable, rootDict, OPTIONAL, V12); err != nil {
+		t.Errorf("TestValidateRadioKidAppearances: %v\n", err)
+	}
+
+	found := false
+	for _, w := range xRefTable.ValidationWarnings() {
+		found = found || strings.Contains(w.Msg, "validateRadioKidAppearances")
+	}
+	if !found {
+		t.Errorf("TestValidateRadioKidAppearances: expected shared appearance warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+}
@@ -25,7 +25,7 @@ func validateGoToActionDict(xRefTable *XRefTable, dict *PDFDict, dictName string
 	// see 12.6.4.2 Go-To Actions
 
 	// D, required, name, byte string or array
-	return validateDestinationEntry(xRefTable, dict, dictName, "D", REQUIRED, V10)
+	return validateDestinationEntry(xRefTable, dict, dictName, "D", REQUIRED, V10, false)
 }
 
 func validateGoToRActionDict(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
@@ -38,8 +38,15 @@ func validateGoToRActionDict(xRefTable *XRefTable, dict *PDFDict, dictName strin
 		return err
 	}
 
+	checkAbsoluteFileSpecEntry(xRefTable, dict, dictName, "F")
+
 	// D, required, name, byte string or array
-	err = validateDestinationEntry(xRefTable, dict, dictName, "D", REQUIRED, V10)
+	err = validateDestinationEntry(xRefTable, dict, dictName, "D", REQUIRED, V10, true)
+	if err != nil {
+		return err
+	}
+
+	err = validateRemoteDestinationPage(xRefTable, dict, dictName)
 	if err != nil {
 		return err
 	}
@@ -50,6 +57,23 @@ func validateGoToRActionDict(xRefTable *XRefTable, dict *PDFDict, dictName strin
 	return err
 }
 
+// validateRemoteDestinationPage ensures an explicit destination D of a remote go-to action
+// specifies its page by page number, since it can't refer to a page object of this document.
+func validateRemoteDestinationPage(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	arr, err := xRefTable.DereferenceArray(dict.Dict["D"])
+	if err != nil || arr == nil || len(*arr) == 0 {
+		// Named destination.
+		return nil
+	}
+
+	if _, ok := (*arr)[0].(PDFInteger); ok {
+		return nil
+	}
+
+	return xRefTable.reportNonFatal("validateRemoteDestinationPage: dict=%s entry=D page must be a page number: %v", dictName, (*arr)[0])
+}
+
 func validateTargetDictEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, required bool, sinceVersion PDFVersion) error {
 
 	// table 202
@@ -100,7 +124,7 @@ func validateGoToEActionDict(xRefTable *XRefTable, dict *PDFDict, dictName strin
 	}
 
 	// D, required, name, byte string or array
-	err = validateDestinationEntry(xRefTable, dict, dictName, "D", REQUIRED, V10)
+	err = validateDestinationEntry(xRefTable, dict, dictName, "D", REQUIRED, V10, true)
 	if err != nil {
 		return err
 	}
@@ -155,6 +179,8 @@ func validateLaunchActionDict(xRefTable *XRefTable, dict *PDFDict, dictName stri
 		return err
 	}
 
+	checkAbsoluteFileSpecEntry(xRefTable, dict, dictName, "F")
+
 	// Win, optional, dict
 	winDict, err := validateDictEntry(xRefTable, dict, dictName, "Win", OPTIONAL, V10, nil)
 	if err != nil {
@@ -17,7 +17,12 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"encoding/hex"
+	"math"
+	"regexp"
+
 	"github.com/hhrutter/pdfcpu/pkg/log"
+	"github.com/hhrutter/pdfcpu/pkg/types"
 	"github.com/pkg/errors"
 )
 
@@ -64,17 +69,38 @@ func validateBorderEffectDictEntry(xRefTable *XRefTable, dict *PDFDict, dictName
 	dictName = "borderEffectDict"
 
 	// S, optional, name, S or C
-	_, err = validateNameEntry(xRefTable, d, dictName, "S", OPTIONAL, V10, func(s string) bool { return s == "S" || s == "C" })
+	n, err := validateNameEntry(xRefTable, d, dictName, "S", OPTIONAL, V10, func(s string) bool { return s == "S" || s == "C" })
 	if err != nil {
 		return err
 	}
 
-	// I, optional, number in the range 0 to 2
-	_, err = validateNumberEntry(xRefTable, d, dictName, "I", OPTIONAL, V10, func(f float64) bool { return 0 <= f && f <= 2 }) // validation missing
-	if err != nil {
+	// I, optional, number in the range 0 to 2, meaningful for the cloudy effect only
+	i, err := validateNumberEntry(xRefTable, d, dictName, "I", OPTIONAL, V10, nil)
+	if err != nil || i == nil {
+		return err
+	}
+
+	if n == nil || *n == "S" {
+		xRefTable.addWarning("validateBorderEffectDictEntry: dict=%s entry=I meaningless for solid border effect", dictName)
+		if xRefTable.ValidationMode == ValidationRelaxed {
+			d.Delete("I")
+		}
+		return nil
+	}
+
+	f := xRefTable.DereferenceNumber(i)
+	if f >= 0 && f <= 2 {
+		return nil
+	}
+
+	if err := xRefTable.reportNonFatal("validateBorderEffectDictEntry: dict=%s entry=I %f out of range", dictName, f); err != nil {
 		return err
 	}
 
+	if xRefTable.ValidationMode == ValidationRelaxed {
+		d.Update("I", PDFFloat(math.Max(0, math.Min(f, 2))))
+	}
+
 	return nil
 }
 
@@ -96,10 +122,16 @@ func validateBorderStyleDict(xRefTable *XRefTable, dict *PDFDict, dictName, entr
 	}
 
 	// W, optional, number, border width in points
-	_, err = validateNumberEntry(xRefTable, d, dictName, "W", OPTIONAL, V10, nil)
+	w, err := validateNumberEntry(xRefTable, d, dictName, "W", OPTIONAL, V10, nil)
 	if err != nil {
 		return err
 	}
+	if w != nil {
+		err = validateBorderWidth(xRefTable, dict, dictName, w)
+		if err != nil {
+			return err
+		}
+	}
 
 	// S, optional, name, border style
 	validate := func(s string) bool { return memberOf(s, []string{"S", "D", "B", "I", "U", "A"}) }
@@ -114,6 +146,33 @@ func validateBorderStyleDict(xRefTable *XRefTable, dict *PDFDict, dictName, entr
 	return err
 }
 
+// validateBorderWidth ensures a border width is not negative and
+// warns about widths exceeding the dimensions of the annotation's page.
+func validateBorderWidth(xRefTable *XRefTable, annotDict *PDFDict, dictName string, obj PDFObject) error {
+
+	w := xRefTable.DereferenceNumber(obj)
+
+	if w < 0 {
+		if err := xRefTable.reportNonFatal("validateBorderWidth: dict=%s entry=W negative border width: %f", dictName, w); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Fall back to the maximum page size.
+	maxWidth := 14400.
+
+	if mediaBox, err := pageMediaBox(xRefTable, annotDict.Dict["P"]); err == nil && mediaBox != nil {
+		maxWidth = math.Max(mediaBox.Width(), mediaBox.Height())
+	}
+
+	if w > maxWidth {
+		xRefTable.addWarning("validateBorderWidth: dict=%s entry=W border width %f exceeds page dimensions", dictName, w)
+	}
+
+	return nil
+}
+
 func validateIconFitDictEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, required bool, sinceVersion PDFVersion) error {
 
 	// see table 247
@@ -230,6 +289,12 @@ func validateAppearanceCharacteristicsDictEntry(xRefTable *XRefTable, dict *PDFD
 	return err
 }
 
+// textAnnotationStates maps the state models of Text annotations to their states, see table 172.
+var textAnnotationStates = map[string][]string{
+	"Marked": {"Marked", "Unmarked"},
+	"Review": {"Accepted", "Rejected", "Cancelled", "Completed", "None"},
+}
+
 func validateAnnotationDictText(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
 
 	// see 12.5.6.4
@@ -247,17 +312,30 @@ func validateAnnotationDictText(xRefTable *XRefTable, dict *PDFDict, dictName st
 	}
 
 	// State, optional, text string, since V1.5
-	validate := func(s string) bool { return memberOf(s, []string{"None", "Unmarked"}) }
+	validate := func(s string) bool {
+		return memberOf(s, textAnnotationStates["Marked"]) || memberOf(s, textAnnotationStates["Review"])
+	}
 	state, err := validateStringEntry(xRefTable, dict, dictName, "State", OPTIONAL, V15, validate)
 	if err != nil {
 		return err
 	}
 
 	// StateModel, text string, since V1.5
-	validate = func(s string) bool { return memberOf(s, []string{"Marked", "Review"}) }
-	_, err = validateStringEntry(xRefTable, dict, dictName, "StateModel", state != nil, V15, validate)
+	validate = func(s string) bool { return textAnnotationStates[s] != nil }
+	stateModel, err := validateStringEntry(xRefTable, dict, dictName, "StateModel", state != nil, V15, validate)
+	if err != nil || state == nil || stateModel == nil {
+		return err
+	}
 
-	return err
+	if memberOf(*state, textAnnotationStates[*stateModel]) {
+		return nil
+	}
+
+	if err := xRefTable.reportNonFatal("validateAnnotationDictText: dict=%s entry=State %s not part of state model %s", dictName, *state, *stateModel); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func validateActionOrDestination(xRefTable *XRefTable, dict *PDFDict, dictName string, sinceVersion PDFVersion) error {
@@ -277,7 +355,7 @@ func validateActionOrDestination(xRefTable *XRefTable, dict *PDFDict, dictName s
 		return err
 	}
 
-	return validateDestination(xRefTable, obj)
+	return validateDestination(xRefTable, obj, false)
 }
 
 func validateURIActionDictEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, required bool, sinceVersion PDFVersion) error {
@@ -338,17 +416,197 @@ func validateAnnotationDictLink(xRefTable *XRefTable, dict *PDFDict, dictName st
 		sinceVersion = V13
 	}
 
-	return validateBorderStyleDict(xRefTable, dict, dictName, "BS", OPTIONAL, sinceVersion)
+	err = validateBorderStyleDict(xRefTable, dict, dictName, "BS", OPTIONAL, sinceVersion)
+	if err != nil {
+		return err
+	}
+
+	validateLinkBorderColor(xRefTable, dict, dictName)
+
+	return nil
+}
+
+// validateLinkBorderColor warns about a Link with a visible border but an empty color array C,
+// which leaves the border color up to the viewer. BS takes precedence over Border.
+func validateLinkBorderColor(xRefTable *XRefTable, dict *PDFDict, dictName string) {
+
+	c, err := xRefTable.DereferenceArray(dict.Dict["C"])
+	if err != nil || c == nil || len(*c) > 0 {
+		return
+	}
+
+	var w float64
+
+	if bs, err := xRefTable.DereferenceDict(dict.Dict["BS"]); err == nil && bs != nil {
+		w = 1
+		if obj, found := bs.Find("W"); found {
+			w = xRefTable.DereferenceNumber(obj)
+		}
+	} else if f, err := numbers(xRefTable, dict.Dict["Border"]); err == nil && len(f) >= 3 {
+		w = f[2]
+	}
+
+	if w > 0 {
+		xRefTable.addWarning("validateLinkBorderColor: dict=%s visible border of width %.2f with empty entry=C", dictName, w)
+	}
+}
+
+var reDAFont = regexp.MustCompile(`/(\S+)\s+([-+]?[\d.]+)\s+Tf`)
+
+// daFontName returns the font resource name set by a default appearance string.
+func daFontName(da string) string {
+
+	m := reDAFont.FindStringSubmatch(da)
+	if m == nil {
+		return ""
+	}
+
+	return m[1]
+}
+
+func fontResource(xRefTable *XRefTable, resources PDFObject, fontName string) (*PDFDict, error) {
+
+	d, err := xRefTable.DereferenceDict(resources)
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	fonts, err := xRefTable.DereferenceDict(d.Dict["Font"])
+	if err != nil || fonts == nil {
+		return nil, err
+	}
+
+	return xRefTable.DereferenceDict(fonts.Dict[fontName])
+}
+
+// annotationFont returns the font dict for fontName as found in the resources
+// of the normal appearance or in the default resources of the interactive form.
+func annotationFont(xRefTable *XRefTable, dict *PDFDict, fontName string) (*PDFDict, error) {
+
+	var fontDict *PDFDict
+
+	err := visitAppearanceStreams(xRefTable, dict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+		if key != "N" || fontDict != nil {
+			return nil
+		}
+		d, err := fontResource(xRefTable, sd.Dict["Resources"], fontName)
+		fontDict = d
+		return err
+	})
+	if err != nil || fontDict != nil {
+		return fontDict, err
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	acroForm, err := xRefTable.DereferenceDict(rootDict.Dict["AcroForm"])
+	if err != nil || acroForm == nil {
+		return nil, err
+	}
+
+	return fontResource(xRefTable, acroForm.Dict["DR"], fontName)
+}
+
+// stringBytes returns the bytes of a string literal or hex literal.
+func stringBytes(obj PDFObject) ([]byte, error) {
+
+	switch o := obj.(type) {
+
+	case PDFStringLiteral:
+		return Unescape(o.Value())
+
+	case PDFHexLiteral:
+		return hex.DecodeString(o.Value())
+
+	}
+
+	return nil, errors.New("stringBytes: invalid type")
+}
+
+// textStringRunes returns the characters of a text string.
+func textStringRunes(obj PDFObject) ([]rune, error) {
+
+	b, err := stringBytes(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, _ := IsUTF16BE(b); ok {
+		s, err := decodeUTF16String(b)
+		if err != nil {
+			return nil, err
+		}
+		return []rune(s), nil
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = pdfDocEncodingRune(c)
+	}
+
+	return runes, nil
+}
+
+// validateFreeTextFontEncoding ensures the encoding of the font referenced by DA is able to render Contents.
+func validateFreeTextFontEncoding(xRefTable *XRefTable, dict *PDFDict, dictName, da string) error {
+
+	fontName := daFontName(da)
+	if fontName == "" {
+		return nil
+	}
+
+	obj, err := xRefTable.Dereference(dict.Dict["Contents"])
+	if err != nil || obj == nil {
+		return err
+	}
+
+	runes, err := textStringRunes(obj)
+	if err != nil {
+		return nil
+	}
+
+	fontDict, err := annotationFont(xRefTable, dict, fontName)
+	if err != nil || fontDict == nil {
+		return err
+	}
+
+	c, err := simpleFontCoverage(xRefTable, fontDict)
+	if err != nil || c == nil {
+		return err
+	}
+
+	for _, r := range runes {
+		if r == '\n' || r == '\r' || r == '\t' {
+			continue
+		}
+		if !c.covers(r) {
+			return errors.Errorf("validateFreeTextFontEncoding: dict=%s entry=Contents font %s (%s) lacks glyph for %q", dictName, fontName, c.baseEncoding, r)
+		}
+	}
+
+	return nil
 }
 
 func validateAnnotationDictFreeTextPart1(xRefTable *XRefTable, dict *PDFDict, dictName string, sinceVersion PDFVersion) error {
 
 	// DA, required, string
-	_, err := validateStringEntry(xRefTable, dict, dictName, "DA", REQUIRED, V10, nil)
+	// Relaxed mode tolerates a missing DA and falls back to Helvetica with auto size.
+	da, err := validateRequiredStringEntryWithFallback(xRefTable, dict, dictName, "DA", V10, nil, "/Helv 0 Tf 0 g")
 	if err != nil {
 		return err
 	}
 
+	// The font used for DA needs to be able to render Contents.
+	if xRefTable.ValidationMode == ValidationStrict {
+		err = validateFreeTextFontEncoding(xRefTable, dict, dictName, *da)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Q, optional, integer, since V1.4, 0,1,2
 	sinceVersion = V14
 	if xRefTable.ValidationMode == ValidationRelaxed {
@@ -466,8 +724,75 @@ func validateEntryMeasure(xRefTable *XRefTable, dict *PDFDict, dictName string,
 	return nil
 }
 
+// stringValue returns the value of a string or hex literal.
+func stringValue(xRefTable *XRefTable, obj PDFObject) (*string, error) {
+
+	o, err := xRefTable.Dereference(obj)
+	if err != nil || o == nil {
+		return nil, err
+	}
+
+	var s string
+
+	switch o := o.(type) {
+
+	case PDFStringLiteral:
+		s = o.Value()
+
+	case PDFHexLiteral:
+		s = o.Value()
+
+	default:
+		return nil, errors.Errorf("stringValue: invalid type: %v", o)
+	}
+
+	return &s, nil
+}
+
+// defaultAppearance returns the DA of an annotation or the DA of the interactive form.
+func defaultAppearance(xRefTable *XRefTable, dict *PDFDict) (*string, error) {
+
+	da, err := stringValue(xRefTable, dict.Dict["DA"])
+	if err != nil || da != nil {
+		return da, err
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	acroForm, err := xRefTable.DereferenceDict(rootDict.Dict["AcroForm"])
+	if err != nil || acroForm == nil {
+		return nil, err
+	}
+
+	return stringValue(xRefTable, acroForm.Dict["DA"])
+}
+
 func validateCP(s string) bool { return s == "Inline" || s == "Top" }
 
+// validateInteriorColorModel ensures the interior color IC uses the same color model as the color C.
+// An empty array means transparent and goes with any color model.
+func validateInteriorColorModel(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	c, err := numbers(xRefTable, dict.Dict["C"])
+	if err != nil || len(c) == 0 {
+		return nil
+	}
+
+	ic, err := numbers(xRefTable, dict.Dict["IC"])
+	if err != nil || len(ic) == 0 || len(ic) == len(c) {
+		return nil
+	}
+
+	if err := xRefTable.reportNonFatal("validateInteriorColorModel: dict=%s IC with %d components does not match C with %d components", dictName, len(ic), len(c)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func validateAnnotationDictLine(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
 
 	// see 12.5.6.7
@@ -500,6 +825,11 @@ func validateAnnotationDictLine(xRefTable *XRefTable, dict *PDFDict, dictName st
 		return err
 	}
 
+	err = validateInteriorColorModel(xRefTable, dict, dictName)
+	if err != nil {
+		return err
+	}
+
 	// LLE, optional, number, since V1.6, >0
 	lle, err := validateNumberEntry(xRefTable, dict, dictName, "LLE", OPTIONAL, V16, func(f float64) bool { return f > 0 })
 	if err != nil {
@@ -513,11 +843,22 @@ func validateAnnotationDictLine(xRefTable *XRefTable, dict *PDFDict, dictName st
 	}
 
 	// Cap, optional, bool, since V1.6
-	_, err = validateBooleanEntry(xRefTable, dict, dictName, "Cap", OPTIONAL, V16, nil)
+	caption, err := validateBooleanEntry(xRefTable, dict, dictName, "Cap", OPTIONAL, V16, nil)
 	if err != nil {
 		return err
 	}
 
+	// DA, the caption is rendered like FreeText.
+	if caption != nil && caption.Value() && xRefTable.ValidationMode == ValidationStrict {
+		da, err := defaultAppearance(xRefTable, dict)
+		if err != nil {
+			return err
+		}
+		if da == nil {
+			return errors.Errorf("validateAnnotationDictLine: dict=%s entry=DA required for caption", dictName)
+		}
+	}
+
 	// IT, optional, name, since V1.6
 	_, err = validateNameEntry(xRefTable, dict, dictName, "IT", OPTIONAL, V16, nil)
 	if err != nil {
@@ -568,18 +909,61 @@ func validateAnnotationDictCircleOrSquare(xRefTable *XRefTable, dict *PDFDict, d
 		return err
 	}
 
+	err = validateInteriorColorModel(xRefTable, dict, dictName)
+	if err != nil {
+		return err
+	}
+
 	// BE, optional, border effect dict, since V1.5
 	err = validateBorderEffectDictEntry(xRefTable, dict, dictName, "BE", OPTIONAL, V15)
 	if err != nil {
 		return err
 	}
 
+	err = validateCloudyBorderWidth(xRefTable, dict, dictName)
+	if err != nil {
+		return err
+	}
+
 	// RD, optional, rectangle, since V1.5
 	_, err = validateRectangleEntry(xRefTable, dict, dictName, "RD", OPTIONAL, V15, nil)
 
 	return err
 }
 
+// validateCloudyBorderWidth ensures a cloudy border effect comes with a BS border width > 0,
+// since a cloud of zero width renders nothing.
+func validateCloudyBorderWidth(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	be, err := xRefTable.DereferenceDict(dict.Dict["BE"])
+	if err != nil || be == nil {
+		return err
+	}
+
+	if s := be.NameEntry("S"); s == nil || *s != "C" {
+		return nil
+	}
+
+	bs, err := xRefTable.DereferenceDict(dict.Dict["BS"])
+	if err != nil {
+		return err
+	}
+
+	if bs != nil {
+		// W defaults to 1.
+		w, found := bs.Find("W")
+		if !found || w == nil || xRefTable.DereferenceNumber(w) > 0 {
+			return nil
+		}
+	}
+
+	if err := xRefTable.reportNonFatal("validateCloudyBorderWidth: dict=%s cloudy border effect requires BS with W > 0", dictName); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func validateEntryIT(xRefTable *XRefTable, dict *PDFDict, dictName string, required bool, sinceVersion PDFVersion) error {
 
 	// IT, optional, name, since V1.6
@@ -589,7 +973,7 @@ func validateEntryIT(xRefTable *XRefTable, dict *PDFDict, dictName string, requi
 			return s == "PolygonCloud"
 		}
 
-		if xRefTable.Version() == V17 {
+		if xRefTable.Version() >= V17 {
 			if memberOf(s, []string{"PolygonCloud", "PolyLineDimension", "PolygonDimension"}) {
 				return true
 			}
@@ -642,6 +1026,11 @@ func validateAnnotationDictPolyLine(xRefTable *XRefTable, dict *PDFDict, dictNam
 		return err
 	}
 
+	err = validateInteriorColorModel(xRefTable, dict, dictName)
+	if err != nil {
+		return err
+	}
+
 	// BE, optional, border effect dict, meaningful only for polygon annotations
 	if dictName == "Polygon" {
 		err = validateBorderEffectDictEntry(xRefTable, dict, dictName, "BE", OPTIONAL, V10)
@@ -658,9 +1047,34 @@ func validateTextMarkupAnnotation(xRefTable *XRefTable, dict *PDFDict, dictName
 	// see 12.5.6.10
 
 	// QuadPoints, required, number array, len:8
-	_, err := validateNumberArrayEntry(xRefTable, dict, dictName, "QuadPoints", REQUIRED, V10, func(a PDFArray) bool { return len(a) == 8 })
+	arr, err := validateNumberArrayEntry(xRefTable, dict, dictName, "QuadPoints", REQUIRED, V10, func(a PDFArray) bool { return len(a) == 8 })
+	if err != nil || arr == nil || xRefTable.ValidationMode == ValidationStrict {
+		return err
+	}
 
-	return err
+	if f, err := numbers(xRefTable, *arr); err == nil && quadPointsSwapped(f) {
+		xRefTable.addWarning("validateTextMarkupAnnotation: dict=%s entry=QuadPoints lower edge given before upper edge: %v", dictName, f)
+	}
+
+	return nil
+}
+
+// quadPointsSwapped returns true if all quadrilaterals of f consistently start with their lower edge.
+// Viewers expect (x1,y1) (x2,y2) to be the upper edge followed by the lower edge (x3,y3) (x4,y4)
+// and render such quadrilaterals mirrored.
+func quadPointsSwapped(f []float64) bool {
+
+	if len(f) == 0 || len(f)%8 != 0 {
+		return false
+	}
+
+	for i := 0; i < len(f); i += 8 {
+		if f[i+1] >= f[i+5] || f[i+3] >= f[i+7] {
+			return false
+		}
+	}
+
+	return true
 }
 
 func validateAnnotationDictStamp(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
@@ -722,11 +1136,22 @@ func validateAnnotationDictPopup(xRefTable *XRefTable, dict *PDFDict, dictName s
 	}
 
 	// Open, optional, boolean
-	_, err = validateBooleanEntry(xRefTable, dict, dictName, "Open", OPTIONAL, V10, nil)
+	open, err := validateBooleanEntry(xRefTable, dict, dictName, "Open", OPTIONAL, V10, nil)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// A missing Open means closed.
+	if xRefTable.ValidationMode == ValidationRelaxed && open != nil && open.Value() {
+		xRefTable.openPopups++
+	}
+
+	return nil
 }
 
+// fileAttachmentIcons are the icon names of FileAttachment annotations viewers are expected to support, see 12.5.6.15
+var fileAttachmentIcons = []string{"Graph", "GraphPushPin", "PushPin", "Paperclip", "PaperclipTag", "Tag"}
+
 func validateAnnotationDictFileAttachment(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
 
 	// see 12.5.6.15
@@ -738,9 +1163,17 @@ func validateAnnotationDictFileAttachment(xRefTable *XRefTable, dict *PDFDict, d
 	}
 
 	// Name, optional, name
-	_, err = validateNameEntry(xRefTable, dict, dictName, "Name", OPTIONAL, V10, nil)
+	name, err := validateNameEntry(xRefTable, dict, dictName, "Name", OPTIONAL, V10, nil)
+	if err != nil || name == nil || memberOf(name.Value(), fileAttachmentIcons) {
+		return err
+	}
 
-	return err
+	// A custom icon needs an appearance.
+	if obj, found := dict.Find("AP"); found && obj != nil {
+		return nil
+	}
+
+	return xRefTable.reportNonFatal("validateAnnotationDictFileAttachment: dict=%s entry=Name %s: custom icon without appearance", dictName, name.Value())
 }
 
 func validateAnnotationDictSound(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
@@ -837,17 +1270,64 @@ func validateAnnotationDictMovie(xRefTable *XRefTable, dict *PDFDict, dictName s
 	return nil
 }
 
-func validateAnnotationDictWidget(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+// validateTextStringEntryDecodable ensures an optional text string entry is
+// either PDFDocEncoded or correctly encoded UTF-16BE with byte order mark.
+func validateTextStringEntryDecodable(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string) error {
 
-	// see 12.5.6.19
+	obj, found := dict.Find(entryName)
+	if !found || obj == nil {
+		return nil
+	}
 
-	// H, optional, name
-	validate := func(s string) bool { return memberOf(s, []string{"N", "I", "O", "P", "T", "A"}) }
-	_, err := validateNameEntry(xRefTable, dict, dictName, "H", OPTIONAL, V10, validate)
-	if err != nil {
+	obj, err := xRefTable.Dereference(obj)
+	if err != nil || obj == nil {
 		return err
 	}
 
+	switch s := obj.(type) {
+
+	case PDFStringLiteral:
+		// Ensure UTF16 correctness.
+		_, err = StringLiteralToString(s.Value())
+
+	case PDFHexLiteral:
+		// Ensure UTF16 correctness.
+		_, err = HexLiteralToString(s.Value())
+
+	default:
+		return errors.Errorf("validateTextStringEntryDecodable: dict=%s entry=%s invalid type", dictName, entryName)
+
+	}
+
+	if err != nil {
+		return errors.Errorf("validateTextStringEntryDecodable: dict=%s entry=%s invalid text string: %v", dictName, entryName, err)
+	}
+
+	return nil
+}
+
+func validateAnnotationDictWidget(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	// see 12.5.6.19
+
+	// H, optional, name
+	validate := func(s string) bool { return memberOf(s, []string{"N", "I", "O", "P", "T", "A"}) }
+	_, err := validateNameEntry(xRefTable, dict, dictName, "H", OPTIONAL, V10, validate)
+	if err != nil {
+		return err
+	}
+
+	// T, optional, text string, partial field name of a merged field/widget dict.
+	// TU, optional, text string, tooltip of a merged field/widget dict.
+	if xRefTable.ValidationMode == ValidationStrict {
+		for _, entryName := range []string{"T", "TU"} {
+			err = validateTextStringEntryDecodable(xRefTable, dict, dictName, entryName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	// MK, optional, dict
 	// An appearance characteristics dictionary that shall be used in constructing
 	// a dynamic appearance stream specifying the annotation’s visual presentation on the page.dict
@@ -887,8 +1367,143 @@ func validateAnnotationDictWidget(xRefTable *XRefTable, dict *PDFDict, dictName
 	// Parent, dict, required if one of multiple children in a field.
 	// An indirect reference to the widget annotation’s parent field.
 	_, err = validateIndRefEntry(xRefTable, dict, dictName, "Parent", OPTIONAL, V10)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return validateCheckBoxAppearanceState(xRefTable, dict, dictName)
+}
+
+// checkBoxOnState returns the name of the on state of a check box widget as defined by its normal appearances.
+func checkBoxOnState(xRefTable *XRefTable, dict *PDFDict) string {
+
+	ap, err := xRefTable.DereferenceDict(dict.Dict["AP"])
+	if err != nil || ap == nil {
+		return ""
+	}
+
+	// N is a stream if the widget has no appearance states.
+	o, err := xRefTable.Dereference(ap.Dict["N"])
+	if err != nil {
+		return ""
+	}
+
+	n, ok := o.(PDFDict)
+	if !ok {
+		return ""
+	}
+
+	for k := range n.Dict {
+		if k != "Off" {
+			return k
+		}
+	}
+
+	return ""
+}
+
+// validateCheckBoxAppearanceState ensures the appearance state AS of a check box widget reflects the effective field value V:
+// AS has to be the on state if V names it and Off otherwise, see 12.7.4.2.3
+func validateCheckBoxAppearanceState(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	as := dict.NameEntry("AS")
+	if as == nil {
+		return nil
+	}
+
+	ft, err := inheritableAttr(xRefTable, *dict, "FT")
+	if err != nil {
+		return err
+	}
+	if n, ok := ft.(PDFName); !ok || n != "Btn" {
+		return nil
+	}
+
+	ff, err := inheritableAttr(xRefTable, *dict, "Ff")
+	if err != nil {
+		return err
+	}
+	if i, ok := ff.(PDFInteger); ok && i.Value()&(1<<15|1<<16) > 0 {
+		// Radio button or push button.
+		return nil
+	}
+
+	o, err := inheritableAttr(xRefTable, *dict, "V")
+	if err != nil {
+		return err
+	}
+	v, ok := o.(PDFName)
+	if !ok {
+		return nil
+	}
+
+	onState := checkBoxOnState(xRefTable, dict)
+	if onState == "" {
+		onState = v.Value()
+	}
+
+	want := "Off"
+	if v.Value() == onState {
+		want = onState
+	}
+
+	if *as == want {
+		return nil
+	}
+
+	if err := xRefTable.reportNonFatal("validateCheckBoxAppearanceState: dict=%s entry=AS %s does not match field value %s", dictName, *as, v); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// renditionDraws returns true for a media rendition with a media clip
+// or a selector rendition containing one.
+func renditionDraws(xRefTable *XRefTable, obj PDFObject) bool {
+
+	d, err := xRefTable.DereferenceDict(obj)
+	if err != nil || d == nil {
+		return false
+	}
+
+	switch s := d.NameEntry("S"); {
+
+	case s == nil:
+		return false
+
+	case *s == "MR":
+		c, found := d.Find("C")
+		return found && c != nil
+
+	case *s == "SR":
+		arr, err := xRefTable.DereferenceArray(d.Dict["R"])
+		if err != nil || arr == nil {
+			return false
+		}
+		for _, v := range *arr {
+			if renditionDraws(xRefTable, v) {
+				return true
+			}
+		}
+
+	}
+
+	return false
+}
+
+// renditionActionDraws returns true if action is a rendition action playing a media clip.
+func renditionActionDraws(xRefTable *XRefTable, action *PDFDict) bool {
+
+	if action == nil {
+		return false
+	}
+
+	if s := action.NameEntry("S"); s == nil || *s != "Rendition" {
+		return false
+	}
+
+	return renditionDraws(xRefTable, action.Dict["R"])
 }
 
 func validateAnnotationDictScreen(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
@@ -919,6 +1534,15 @@ func validateAnnotationDictScreen(xRefTable *XRefTable, dict *PDFDict, dictName
 		}
 	}
 
+	// MK is meaningless for a Screen annotation that never draws.
+	if xRefTable.ValidationMode == ValidationRelaxed {
+		_, hasMK := dict.Find("MK")
+		_, hasAP := dict.Find("AP")
+		if hasMK && !hasAP && !renditionActionDraws(xRefTable, d) {
+			xRefTable.addWarning("validateAnnotationDictScreen: dict=%s entry=MK without appearance or rendition media clip", dictName)
+		}
+	}
+
 	// AA, optional, additional-actions dict, since V1.2
 	return validateAdditionalActions(xRefTable, dict, dictName, "AA", OPTIONAL, V12, "fieldOrAnnot")
 }
@@ -934,11 +1558,18 @@ func validateAnnotationDictPrinterMark(xRefTable *XRefTable, dict *PDFDict, dict
 	}
 
 	// F, required integer, since V1.1, annotation flags
-	_, err = validateIntegerEntry(xRefTable, dict, dictName, "F", REQUIRED, V11, nil)
+	f, err := validateIntegerEntry(xRefTable, dict, dictName, "F", REQUIRED, V11, nil)
 	if err != nil {
 		return err
 	}
 
+	// Printer marks are supposed to stay fixed.
+	if f != nil && f.Value()&(annotFlagNoZoom|annotFlagNoRotate) != annotFlagNoZoom|annotFlagNoRotate {
+		if err := xRefTable.reportOptIn(xRefTable.StrictPrinterMarks, "validateAnnotationDictPrinterMark: dict=%s entry=F missing NoZoom and NoRotate flags: %d", dictName, f.Value()); err != nil {
+			return err
+		}
+	}
+
 	// AP, required, appearance dict, since V1.2
 	return validateAppearDictEntry(xRefTable, dict, dictName, REQUIRED, V12)
 }
@@ -1053,9 +1684,13 @@ func validateAnnotationDict3D(xRefTable *XRefTable, dict *PDFDict, dictName stri
 	// see 13.6.2
 
 	// AP with entry N, required
+	err := validate3DPoster(xRefTable, dict, dictName)
+	if err != nil {
+		return err
+	}
 
 	// 3DD, required, 3D stream or 3D reference dict
-	err := validateStreamDictOrDictEntry(xRefTable, dict, dictName, "3DD", REQUIRED, V16)
+	err = validateStreamDictOrDictEntry(xRefTable, dict, dictName, "3DD", REQUIRED, V16)
 	if err != nil {
 		return err
 	}
@@ -1078,12 +1713,103 @@ func validateAnnotationDict3D(xRefTable *XRefTable, dict *PDFDict, dictName stri
 	return err
 }
 
+// validate3DPoster ensures the normal appearance of a 3D annotation displayed prior to activation
+// is a form XObject with a positive BBox actually painting something.
+func validate3DPoster(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	found := false
+
+	err := visitAppearanceStreams(xRefTable, dict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+		if key != "N" {
+			return nil
+		}
+
+		found = true
+
+		if st := sd.Subtype(); st == nil || *st != "Form" {
+			return xRefTable.reportNonFatal("validate3DPoster: dict=%s entry=AP N: poster is not a form XObject", dictName)
+		}
+
+		bbox, err := numbers(xRefTable, sd.Dict["BBox"])
+		if err != nil || len(bbox) != 4 || bbox[0] == bbox[2] || bbox[1] == bbox[3] {
+			return xRefTable.reportNonFatal("validate3DPoster: dict=%s entry=AP N: poster BBox must have a positive area", dictName)
+		}
+
+		b, err := streamContent(sd)
+		if err != nil {
+			// Unsupported filter.
+			return nil
+		}
+
+		ok, err := paintsContent(b)
+		if err != nil || !ok {
+			return xRefTable.reportNonFatal("validate3DPoster: dict=%s entry=AP N: empty poster", dictName)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return xRefTable.reportNonFatal("validate3DPoster: dict=%s missing poster appearance AP N", dictName)
+	}
+
+	return nil
+}
+
+func validateAnnotationDictProjection(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	// see ISO 32000-2 12.5.6.24
+	// A projection annotation has no entries beyond those of markup annotations.
+
+	// ExData, optional, external data dict referring to a 3D measurement
+	d, err := validateDictEntry(xRefTable, dict, dictName, "ExData", OPTIONAL, V17, nil)
+	if err != nil || d == nil {
+		return err
+	}
+
+	return validateExDataDict(xRefTable, d)
+}
+
+func validateAnnotationDictRichMedia(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	// see Adobe Supplement to ISO 32000, ExtensionLevel 3, 9.6
+
+	// Subtype, required, name
+	_, err := validateNameEntry(xRefTable, dict, dictName, "Subtype", REQUIRED, V17, func(s string) bool { return s == "RichMedia" })
+	if err != nil {
+		return err
+	}
+
+	// RichMediaContent, required, RichMedia content dict
+	d, err := validateDictEntry(xRefTable, dict, dictName, "RichMediaContent", REQUIRED, V17, nil)
+	if err != nil {
+		return err
+	}
+
+	err = validateRichMediaContentDict(xRefTable, d, V17)
+	if err != nil {
+		return err
+	}
+
+	// RichMediaSettings, optional, RichMedia settings dict
+	d, err = validateDictEntry(xRefTable, dict, dictName, "RichMediaSettings", OPTIONAL, V17, nil)
+	if err != nil || d == nil {
+		return err
+	}
+
+	return validateRichMediaSettingsDict(xRefTable, d, V17)
+}
+
 func validateEntryIC(xRefTable *XRefTable, dict *PDFDict, dictName string, required bool, sinceVersion PDFVersion) error {
 
-	// IC, optional, number array, length:3 [0.0 .. 1.0]
+	// IC, optional, number array, length:3 [0.0 .. 1.0], an empty array means transparent.
 	validateICArray := func(arr PDFArray) bool {
 
-		if len(arr) != 3 {
+		if len(arr) != 0 && len(arr) != 3 {
 			return false
 		}
 
@@ -1115,6 +1841,42 @@ func validateEntryIC(xRefTable *XRefTable, dict *PDFDict, dictName string, requi
 	return err
 }
 
+// validateRedactOverlayCoverage ensures the overlay form of a Redact annotation covers all QuadPoints.
+// The transformed BBox of the overlay is positioned at the lower left corner of Rect without scaling.
+func validateRedactOverlayCoverage(xRefTable *XRefTable, dict *PDFDict, dictName string, ro *PDFStreamDict) error {
+
+	obj, found := dict.Find("QuadPoints")
+	if !found || obj == nil {
+		return nil
+	}
+
+	qp, err := numbers(xRefTable, obj)
+	if err != nil || len(qp) == 0 {
+		return err
+	}
+
+	r, err := numbers(xRefTable, dict.Dict["Rect"])
+	if err != nil || len(r) != 4 {
+		return err
+	}
+
+	bb, err := transformedBBox(xRefTable, ro)
+	if err != nil {
+		return errors.Errorf("validateRedactOverlayCoverage: dict=%s entry=RO %v", dictName, err)
+	}
+
+	rect := boundingBox(r)
+
+	coverage := types.NewRectangle(rect.LL.X, rect.LL.Y,
+		math.Min(rect.UR.X, rect.LL.X+bb.Width()), math.Min(rect.UR.Y, rect.LL.Y+bb.Height()))
+
+	if !containsRect(coverage, boundingBox(qp)) {
+		return errors.Errorf("validateRedactOverlayCoverage: dict=%s entry=RO overlay %s does not cover QuadPoints %s", dictName, coverage, boundingBox(qp))
+	}
+
+	return nil
+}
+
 func validateAnnotationDictRedact(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
 
 	// see 12.5.6.23
@@ -1132,11 +1894,19 @@ func validateAnnotationDictRedact(xRefTable *XRefTable, dict *PDFDict, dictName
 	}
 
 	// RO, optional, stream
-	_, err = validateStreamDictEntry(xRefTable, dict, dictName, "RO", OPTIONAL, V10, nil)
+	ro, err := validateStreamDictEntry(xRefTable, dict, dictName, "RO", OPTIONAL, V10, nil)
 	if err != nil {
 		return err
 	}
 
+	// The overlay needs to cover the redacted area.
+	if ro != nil && xRefTable.ValidationMode == ValidationStrict {
+		err = validateRedactOverlayCoverage(xRefTable, dict, dictName, ro)
+		if err != nil {
+			return err
+		}
+	}
+
 	// OverlayText, optional, text string
 	_, err = validateStringEntry(xRefTable, dict, dictName, "OverlayText", OPTIONAL, V10, nil)
 	if err != nil {
@@ -1170,9 +1940,17 @@ func validateExDataDict(xRefTable *XRefTable, dict *PDFDict) error {
 		return err
 	}
 
-	_, err = validateNameEntry(xRefTable, dict, dictName, "Subtype", REQUIRED, V10, func(s string) bool { return s == "Markup3D" })
+	subtype, err := validateNameEntry(xRefTable, dict, dictName, "Subtype", REQUIRED, V10, func(s string) bool { return s == "Markup3D" || s == "3DM" })
+	if err != nil {
+		return err
+	}
 
-	return err
+	// 3DM for 3D measurements of Projection annotations, since V2.0
+	if *subtype == "3DM" {
+		return xRefTable.ValidateVersion("ExData Subtype 3DM", V20)
+	}
+
+	return nil
 }
 
 func validatePopupEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, required bool, sinceVersion PDFVersion) error {
@@ -1216,6 +1994,21 @@ func validateIRTEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName s
 	return nil
 }
 
+// validateMarkupOpacities notes stroking and non stroking opacities differing substantially in relaxed mode.
+// Many generators set these inconsistently by mistake, hence this never fails.
+func validateMarkupOpacities(xRefTable *XRefTable, dictName string, ca, caNonStroking PDFObject) {
+
+	if ca == nil || caNonStroking == nil || xRefTable.ValidationMode == ValidationStrict {
+		return
+	}
+
+	stroking, nonStroking := xRefTable.DereferenceNumber(ca), xRefTable.DereferenceNumber(caNonStroking)
+
+	if math.Abs(stroking-nonStroking) > 0.5 {
+		xRefTable.addWarning("validateMarkupAnnotation: dict=%s entries CA=%.2f and ca=%.2f differ substantially", dictName, stroking, nonStroking)
+	}
+}
+
 func validateMarkupAnnotation(xRefTable *XRefTable, dict *PDFDict) error {
 
 	dictName := "markupAnnot"
@@ -1233,11 +2026,19 @@ func validateMarkupAnnotation(xRefTable *XRefTable, dict *PDFDict) error {
 	}
 
 	// CA, optional, number, since V1.4
-	_, err = validateNumberEntry(xRefTable, dict, dictName, "CA", OPTIONAL, V14, nil)
+	ca, err := validateNumberEntry(xRefTable, dict, dictName, "CA", OPTIONAL, V14, nil)
+	if err != nil {
+		return err
+	}
+
+	// ca, optional, number in [0,1], non stroking opacity.
+	caNonStroking, err := validateNumberEntry(xRefTable, dict, dictName, "ca", OPTIONAL, V14, func(f float64) bool { return f >= 0 && f <= 1 })
 	if err != nil {
 		return err
 	}
 
+	validateMarkupOpacities(xRefTable, dictName, ca, caNonStroking)
+
 	// RC, optional, text string or stream, since V1.5
 	err = validateStringOrStreamEntry(xRefTable, dict, dictName, "RC", OPTIONAL, V15)
 	if err != nil {
@@ -1326,15 +2127,144 @@ func validateAppearDictEntry(xRefTable *XRefTable, dict *PDFDict, dictName strin
 
 	if d != nil {
 		err = validateAppearanceDict(xRefTable, *d)
+		if err != nil {
+			return err
+		}
+		err = validateAppearanceStreamOperators(xRefTable, dict, dictName)
 	}
 
 	return err
 }
 
+// validateAppearanceStreamOperators ensures appearance streams use defined content stream operators
+// and ExtGState resources only and do not exceed xRefTable.MaxAppearanceStreamBytes.
+func validateAppearanceStreamOperators(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
+
+	return visitAppearanceStreams(xRefTable, dict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+		b, err := streamContent(sd)
+		if err != nil {
+			// Unsupported filter.
+			return nil
+		}
+
+		max := xRefTable.MaxAppearanceStreamBytes
+		if max > 0 && len(b) > max {
+			if err := xRefTable.reportNonFatal("validateAppearanceStreamOperators: dict=%s entry=AP %s: decoded size %d exceeds limit of %d bytes", dictName, key, len(b), max); err != nil {
+				return err
+			}
+			// Don't bother tokenizing oversized content.
+			return nil
+		}
+
+		t, err := unknownContentOperator(b)
+		if err != nil {
+			if err := xRefTable.reportNonFatal("validateAppearanceStreamOperators: dict=%s entry=AP %s: %v", dictName, key, err); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		if t == nil {
+			return validateAppearanceStreamExtGStates(xRefTable, sd, b, dictName, key)
+		}
+
+		if err := xRefTable.reportNonFatal("validateAppearanceStreamOperators: dict=%s entry=AP %s: unknown operator %q at offset %d", dictName, key, t.op, t.pos); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// validateAppearanceStreamExtGStates ensures all graphics states set by gs operators
+// of the appearance stream content b are defined in the ExtGState resources of sd.
+func validateAppearanceStreamExtGStates(xRefTable *XRefTable, sd *PDFStreamDict, b []byte, dictName, key string) error {
+
+	var extGStates *PDFDict
+
+	resDict, err := xRefTable.DereferenceDict(sd.Dict["Resources"])
+	if err == nil && resDict != nil {
+		extGStates, err = xRefTable.DereferenceDict(resDict.Dict["ExtGState"])
+	}
+	if err != nil {
+		return err
+	}
+
+	t, err := undefinedExtGState(b, extGStates)
+	if err != nil || t == nil {
+		return err
+	}
+
+	if err := xRefTable.reportNonFatal("validateAppearanceStreamOperators: dict=%s entry=AP %s: undefined ExtGState %q at offset %d", dictName, key, t.name, t.pos); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// appearanceBBoxTolerance is the distance in form space the estimated bounds of an appearance may exceed its BBox.
+const appearanceBBoxTolerance = 1.0
+
+// checkAppearanceBBox warns about appearance streams painting outside their BBox.
+// Viewers clip to BBox, so anything drawn outside is either lost or, for viewers not clipping, overpaints the page.
+// The drawn bounds are estimated from path and text extents.
+func checkAppearanceBBox(xRefTable *XRefTable, dict *PDFDict, dictName string) {
+
+	visitAppearanceStreams(xRefTable, dict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+		if max := xRefTable.MaxAppearanceStreamBytes; max > 0 && sd.StreamLength != nil && *sd.StreamLength > int64(max) {
+			return nil
+		}
+
+		bbox, r, err := drawnBounds(xRefTable, sd)
+		if err != nil || r == nil {
+			return nil
+		}
+
+		d := appearanceBBoxTolerance
+		if r.LL.X < bbox.LL.X-d || r.LL.Y < bbox.LL.Y-d || r.UR.X > bbox.UR.X+d || r.UR.Y > bbox.UR.Y+d {
+			xRefTable.addWarning("checkAppearanceBBox: dict=%s entry=AP %s: drawing %s exceeds BBox %s", dictName, key, r, bbox)
+		}
+
+		return nil
+	})
+}
+
 func validateBorderArrayLength(a PDFArray) bool {
 	return len(a) == 3 || len(a) == 4
 }
 
+// checkNoRotateAppearance warns about appearances of a NoRotate annotation of pageDict
+// whose Matrix does not compensate the page rotation, which may be inherited.
+func checkNoRotateAppearance(xRefTable *XRefTable, pageDict, dict *PDFDict, dictName string) {
+
+	if !AnnotationFlagsOf(dict).NoRotate() {
+		return
+	}
+
+	rot, err := pageRotation(xRefTable, *pageDict)
+	if err != nil || rot == 0 {
+		return
+	}
+
+	visitAppearanceStreams(xRefTable, dict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+		m, err := formMatrix(xRefTable, sd)
+		if err != nil {
+			return nil
+		}
+
+		// The Matrix has to rotate by -Rotate.
+		a := int(math.Floor(math.Atan2(m[1], m[0])*radToDeg + 0.5))
+		if (a+rot)%360 != 0 {
+			xRefTable.addWarning("checkNoRotateAppearance: dict=%s NoRotate %s appearance does not compensate page rotation %d", dictName, key, rot)
+		}
+
+		return nil
+	})
+}
+
 func validateAnnotationDictGeneral(xRefTable *XRefTable, dict *PDFDict, dictName string) (*PDFName, error) {
 
 	// Type, optional, name
@@ -1391,6 +2321,10 @@ func validateAnnotationDictGeneral(xRefTable *XRefTable, dict *PDFDict, dictName
 		return nil, err
 	}
 
+	if xRefTable.ValidationMode == ValidationRelaxed {
+		checkAppearanceBBox(xRefTable, dict, dictName)
+	}
+
 	// AS, optional, name, since V1.2
 	_, err = validateNameEntry(xRefTable, dict, dictName, "AS", OPTIONAL, V11, nil)
 	if err != nil {
@@ -1411,11 +2345,17 @@ func validateAnnotationDictGeneral(xRefTable *XRefTable, dict *PDFDict, dictName
 	}
 
 	// StructParent, optional, integer, since V1.3
-	_, err = validateIntegerEntry(xRefTable, dict, dictName, "StructParent", OPTIONAL, V13, nil)
+	structParent, err := validateIntegerEntry(xRefTable, dict, dictName, "StructParent", OPTIONAL, V13, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	if structParent != nil && xRefTable.Tagged {
+		if err = validateAnnotationStructParent(xRefTable, dictName, structParent.Value()); err != nil {
+			return nil, err
+		}
+	}
+
 	// OC, optional, content group dict or content membership dict, since V1.5
 	// Specifying the optional content properties for the annotation.
 	err = validateOptionalContent(xRefTable, dict, dictName, "OC", OPTIONAL, V15)
@@ -1430,41 +2370,52 @@ func validateAnnotationDictConcrete(xRefTable *XRefTable, dict *PDFDict, subtype
 
 	// see table 169
 
+	// Relaxed mode tolerates the frequently encountered use of annotation types
+	// in documents declaring a slightly older PDF version.
+
 	for k, v := range map[string]struct {
-		validate     func(xRefTable *XRefTable, dict *PDFDict, dictName string) error
-		sinceVersion PDFVersion
-		markup       bool
+		validate            func(xRefTable *XRefTable, dict *PDFDict, dictName string) error
+		sinceVersion        PDFVersion
+		sinceVersionRelaxed PDFVersion
+		markup              bool
 	}{
-		"Text":           {validateAnnotationDictText, V10, true},
-		"Link":           {validateAnnotationDictLink, V10, false},
-		"FreeText":       {validateAnnotationDictFreeText, V13, true},
-		"Line":           {validateAnnotationDictLine, V13, true},
-		"Polygon":        {validateAnnotationDictPolyLine, V15, true},
-		"PolyLine":       {validateAnnotationDictPolyLine, V15, true},
-		"Highlight":      {validateTextMarkupAnnotation, V13, true},
-		"Underline":      {validateTextMarkupAnnotation, V13, true},
-		"Squiggly":       {validateTextMarkupAnnotation, V14, true},
-		"StrikeOut":      {validateTextMarkupAnnotation, V13, true},
-		"Square":         {validateAnnotationDictCircleOrSquare, V13, true},
-		"Circle":         {validateAnnotationDictCircleOrSquare, V13, true},
-		"Stamp":          {validateAnnotationDictStamp, V13, true},
-		"Caret":          {validateAnnotationDictCaret, V15, true},
-		"Ink":            {validateAnnotationDictInk, V13, true},
-		"Popup":          {validateAnnotationDictPopup, V13, false},
-		"FileAttachment": {validateAnnotationDictFileAttachment, V13, true},
-		"Sound":          {validateAnnotationDictSound, V12, true},
-		"Movie":          {validateAnnotationDictMovie, V12, false},
-		"Widget":         {validateAnnotationDictWidget, V12, false},
-		"Screen":         {validateAnnotationDictScreen, V15, false},
-		"PrinterMark":    {validateAnnotationDictPrinterMark, V14, false},
-		"TrapNet":        {validateAnnotationDictTrapNet, V13, false},
-		"Watermark":      {validateAnnotationDictWatermark, V16, false},
-		"3D":             {validateAnnotationDict3D, V16, false},
-		"Redact":         {validateAnnotationDictRedact, V17, true},
+		"Text":           {validateAnnotationDictText, V10, V10, true},
+		"Link":           {validateAnnotationDictLink, V10, V10, false},
+		"FreeText":       {validateAnnotationDictFreeText, V13, V12, true},
+		"Line":           {validateAnnotationDictLine, V13, V12, true},
+		"Polygon":        {validateAnnotationDictPolyLine, V15, V13, true},
+		"PolyLine":       {validateAnnotationDictPolyLine, V15, V13, true},
+		"Highlight":      {validateTextMarkupAnnotation, V13, V12, true},
+		"Underline":      {validateTextMarkupAnnotation, V13, V12, true},
+		"Squiggly":       {validateTextMarkupAnnotation, V14, V13, true},
+		"StrikeOut":      {validateTextMarkupAnnotation, V13, V12, true},
+		"Square":         {validateAnnotationDictCircleOrSquare, V13, V12, true},
+		"Circle":         {validateAnnotationDictCircleOrSquare, V13, V12, true},
+		"Stamp":          {validateAnnotationDictStamp, V13, V12, true},
+		"Caret":          {validateAnnotationDictCaret, V15, V14, true},
+		"Ink":            {validateAnnotationDictInk, V13, V12, true},
+		"Popup":          {validateAnnotationDictPopup, V13, V12, false},
+		"FileAttachment": {validateAnnotationDictFileAttachment, V13, V12, true},
+		"Sound":          {validateAnnotationDictSound, V12, V12, true},
+		"Movie":          {validateAnnotationDictMovie, V12, V12, false},
+		"Widget":         {validateAnnotationDictWidget, V12, V12, false},
+		"Screen":         {validateAnnotationDictScreen, V15, V14, false},
+		"PrinterMark":    {validateAnnotationDictPrinterMark, V14, V13, false},
+		"TrapNet":        {validateAnnotationDictTrapNet, V13, V13, false},
+		"Watermark":      {validateAnnotationDictWatermark, V16, V15, false},
+		"3D":             {validateAnnotationDict3D, V16, V15, false},
+		"Redact":         {validateAnnotationDictRedact, V17, V16, true},
+		"RichMedia":      {validateAnnotationDictRichMedia, V17, V16, false},
+		"Projection":     {validateAnnotationDictProjection, V20, V17, true},
 	} {
 		if subtype.Value() == k {
 
-			err := xRefTable.ValidateVersion(k, v.sinceVersion)
+			sinceVersion := v.sinceVersion
+			if xRefTable.ValidationMode == ValidationRelaxed {
+				sinceVersion = v.sinceVersionRelaxed
+			}
+
+			err := xRefTable.ValidateVersion(k, sinceVersion)
 			if err != nil {
 				return err
 			}
@@ -1480,7 +2431,14 @@ func validateAnnotationDictConcrete(xRefTable *XRefTable, dict *PDFDict, subtype
 		}
 	}
 
-	return errors.Errorf("validateAnnotationDictConcrete: unsupported annotation subtype:%s\n", subtype)
+	if xRefTable.ValidationMode == ValidationStrict && !xRefTable.CollectWarnings {
+		return errors.Errorf("validateAnnotationDictConcrete: unsupported annotation subtype:%s\n", subtype)
+	}
+
+	// Tolerate vendor extensions and validate the general entries only.
+	xRefTable.addUnsupportedAnnotationSubtype(subtype.Value())
+
+	return nil
 }
 
 func validateAnnotationDictSpecial(xRefTable *XRefTable, dict *PDFDict, dictName string) error {
@@ -1512,19 +2470,47 @@ func validateAnnotationDict(xRefTable *XRefTable, dict *PDFDict) (isTrapNet bool
 	return *subtype == "TrapNet", nil
 }
 
-func validatePageAnnotations(xRefTable *XRefTable, dict *PDFDict) error {
+// validateAnnotsIndRef ensures indRef points to an object in use.
+func validateAnnotsIndRef(xRefTable *XRefTable, indRef PDFIndirectRef, pageNr int) error {
+
+	objNr := indRef.ObjectNumber.Value()
+
+	entry, found := xRefTable.Find(objNr)
+	if found && entry != nil && entry.Free {
+		return errors.Errorf("validatePageAnnotations: page %d: Annots references freed obj#%d", pageNr, objNr)
+	}
+
+	if !found || entry == nil || entry.Generation == nil || *entry.Generation != indRef.GenerationNumber.Value() {
+		return errors.Errorf("validatePageAnnotations: page %d: Annots references missing obj#%d", pageNr, objNr)
+	}
+
+	return nil
+}
+
+// maxOpenPopupsPerPage is the number of initially open popups per page tolerated without warning in relaxed mode.
+const maxOpenPopupsPerPage = 3
+
+func validatePageAnnotations(xRefTable *XRefTable, dict *PDFDict, pageNr int) error {
 
 	arr, err := validateArrayEntry(xRefTable, dict, "pageDict", "Annots", OPTIONAL, V10, nil)
 	if err != nil || arr == nil {
 		return err
 	}
 
+	if max := xRefTable.MaxAnnotationsPerPage; max > 0 && len(*arr) > max {
+		if err := xRefTable.reportNonFatal("validatePageAnnotations: page %d: %d annotations exceed limit of %d", pageNr, len(*arr), max); err != nil {
+			return err
+		}
+	}
+
 	// array of indrefs to annotation dicts.
 	var annotsDict PDFDict
 
 	// an optional TrapNetAnnotation has to be the final entry in this list.
 	hasTrapNet := false
 
+	openPopups := xRefTable.openPopups
+
 	for _, v := range *arr {
 
 		if hasTrapNet {
@@ -1535,6 +2521,11 @@ func validatePageAnnotations(xRefTable *XRefTable, dict *PDFDict) error {
 
 			log.Debug.Printf("processing annotDict %d\n", indRef.ObjectNumber)
 
+			err = validateAnnotsIndRef(xRefTable, indRef, pageNr)
+			if err != nil {
+				return err
+			}
+
 			annotsDictp, err := xRefTable.DereferenceDict(indRef)
 			if err != nil || annotsDictp == nil {
 				return errors.New("validatePageAnnotations: corrupted annotation dict")
@@ -1551,12 +2542,18 @@ func validatePageAnnotations(xRefTable *XRefTable, dict *PDFDict) error {
 			return err
 		}
 
+		checkNoRotateAppearance(xRefTable, dict, &annotsDict, "annotDict")
+	}
+
+	// Lots of initially open popups clutter the page.
+	if n := xRefTable.openPopups - openPopups; n > maxOpenPopupsPerPage {
+		xRefTable.addWarning("validatePageAnnotations: page %d has %d popups open by default", pageNr, n)
 	}
 
 	return nil
 }
 
-func validatePagesAnnotations(xRefTable *XRefTable, dict *PDFDict) error {
+func validatePagesAnnotations(xRefTable *XRefTable, dict *PDFDict, curPage *int) error {
 
 	// Get number of pages of this PDF file.
 	pageCount := dict.IntEntry("Count")
@@ -1593,13 +2590,14 @@ func validatePagesAnnotations(xRefTable *XRefTable, dict *PDFDict) error {
 
 		case "Pages":
 			// Recurse over pagetree
-			err = validatePagesAnnotations(xRefTable, d)
+			err = validatePagesAnnotations(xRefTable, d, curPage)
 			if err != nil {
 				return err
 			}
 
 		case "Page":
-			err = validatePageAnnotations(xRefTable, d)
+			*curPage++
+			err = validatePageAnnotations(xRefTable, d, *curPage)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,1442 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func doTestValidateAnnotOK(t *testing.T, xRefTable *XRefTable, d PDFDict, mode int) {
+
+	xRefTable.ValidationMode = mode
+
+	if _, err := validateAnnotationDict(xRefTable, &d); err != nil {
+		t.Errorf("validateAnnotationDict(%s) mode=%d: %v => not ok!\n", *d.Subtype(), mode, err)
+	}
+}
+
+func doTestValidateAnnotFail(t *testing.T, xRefTable *XRefTable, d PDFDict, mode int) {
+
+	xRefTable.ValidationMode = mode
+
+	if _, err := validateAnnotationDict(xRefTable, &d); err == nil {
+		t.Errorf("validateAnnotationDict(%s) mode=%d: valid => not ok!\n", *d.Subtype(), mode)
+	}
+}
+
+func TestValidateAnnotationSubtypeVersion(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	v := V13
+	xRefTable.HeaderVersion = &v
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Polygon"),
+			"Rect":     NewRectangle(10, 10, 100, 100),
+			"Vertices": NewNumberArray(10, 10, 100, 10, 55, 100),
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateUnsupportedAnnotationSubtype(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("ACME_Sticker"),
+			"Rect":     NewRectangle(10, 10, 50, 50),
+			"Contents": PDFStringLiteral("Vendor extension"),
+		},
+	}
+
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	if ss := xRefTable.UnsupportedAnnotationSubtypes(); len(ss) != 0 {
+		t.Errorf("TestValidateUnsupportedAnnotationSubtype: strict mode recorded %v\n", ss)
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	if ss := xRefTable.UnsupportedAnnotationSubtypes(); len(ss) != 1 || ss[0] != "ACME_Sticker" {
+		t.Errorf("TestValidateUnsupportedAnnotationSubtype: expected [ACME_Sticker], got %v\n", ss)
+	}
+
+	// General entries still get validated.
+	d.Update("Rect", NewNumberArray(10, 10))
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationRelaxed)
+}
+
+func TestValidateAnnotationWidgetTextStrings(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Widget"),
+			"Rect":    NewRectangle(10, 10, 100, 30),
+			"T":       PDFStringLiteral("name"),
+			"TU":      PDFHexLiteral("FEFF00540069007000700073"),
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// Lone low surrogate.
+	d.Update("TU", PDFHexLiteral("FEFFDC000041"))
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidatePageAnnotationsFreedObject(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	indRef := addAnnotForTest(t, xRefTable, 1, squareAnnotForTest(NewRectangle(60, 10, 100, 50)))
+
+	err := xRefTable.DeleteObject(indRef.ObjectNumber.Value())
+	if err != nil {
+		t.Fatalf("TestValidatePageAnnotationsFreedObject: %v\n", err)
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	err = validatePageAnnotations(xRefTable, pageDict, 1)
+	if err == nil {
+		t.Fatalf("TestValidatePageAnnotationsFreedObject: freed annotation => not ok!\n")
+	}
+
+	want := fmt.Sprintf("page 1: Annots references freed obj#%d", indRef.ObjectNumber)
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("TestValidatePageAnnotationsFreedObject: expected %q, got %q\n", want, err)
+	}
+
+	// Reference an object number beyond the xref table.
+	pageDict.Update("Annots", PDFArray{*NewPDFIndirectRef(*xRefTable.Size+10, 0)})
+
+	err = validatePageAnnotations(xRefTable, pageDict, 1)
+	if err == nil || !strings.Contains(err.Error(), "Annots references missing obj#") {
+		t.Errorf("TestValidatePageAnnotationsFreedObject: expected missing object error, got %v\n", err)
+	}
+}
+
+func TestValidateMaxAnnotationsPerPage(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+
+	for i := 0; i < 5; i++ {
+		addAnnotForTest(t, xRefTable, 2, squareAnnotForTest(NewRectangle(10, 10, 50, 50)))
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 2)
+
+	xRefTable.ValidationMode = ValidationStrict
+
+	// Unlimited by default.
+	if err := validatePageAnnotations(xRefTable, pageDict, 2); err != nil {
+		t.Fatalf("TestValidateMaxAnnotationsPerPage: %v\n", err)
+	}
+
+	xRefTable.MaxAnnotationsPerPage = 5
+
+	if err := validatePageAnnotations(xRefTable, pageDict, 2); err != nil {
+		t.Fatalf("TestValidateMaxAnnotationsPerPage: %v\n", err)
+	}
+
+	xRefTable.MaxAnnotationsPerPage = 4
+
+	err := validatePageAnnotations(xRefTable, pageDict, 2)
+	if err == nil || !strings.Contains(err.Error(), "page 2: 5 annotations exceed limit of 4") {
+		t.Fatalf("TestValidateMaxAnnotationsPerPage: expected limit error, got %v\n", err)
+	}
+
+	xRefTable.ValidationMode = ValidationRelaxed
+
+	if err := validatePageAnnotations(xRefTable, pageDict, 2); err != nil {
+		t.Fatalf("TestValidateMaxAnnotationsPerPage: %v\n", err)
+	}
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "page 2: 5 annotations exceed limit of 4") {
+		t.Errorf("TestValidateMaxAnnotationsPerPage: expected limit warning, got: %v\n", warnings)
+	}
+}
+
+func TestValidatePopupOpen(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	popup := func(open PDFObject) PDFDict {
+		d := PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Popup"),
+				"Rect":    NewRectangle(100, 100, 200, 150),
+			},
+		}
+		if open != nil {
+			d.Insert("Open", open)
+		}
+		return d
+	}
+
+	for i := 0; i < 4; i++ {
+		addAnnotForTest(t, xRefTable, 1, popup(PDFBoolean(true)))
+	}
+	addAnnotForTest(t, xRefTable, 1, popup(PDFBoolean(false)))
+	closed := addAnnotForTest(t, xRefTable, 1, popup(nil))
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	xRefTable.ValidationMode = ValidationStrict
+
+	if err := validatePageAnnotations(xRefTable, pageDict, 1); err != nil {
+		t.Fatalf("TestValidatePopupOpen: %v\n", err)
+	}
+
+	if n := xRefTable.OpenPopups(); n != 0 || len(xRefTable.ValidationWarnings()) > 0 {
+		t.Errorf("TestValidatePopupOpen: strict mode counted %d open popups\n", n)
+	}
+
+	xRefTable.ValidationMode = ValidationRelaxed
+
+	if err := validatePageAnnotations(xRefTable, pageDict, 1); err != nil {
+		t.Fatalf("TestValidatePopupOpen: %v\n", err)
+	}
+
+	if n := xRefTable.OpenPopups(); n != 4 {
+		t.Errorf("TestValidatePopupOpen: expected 4 open popups, got %d\n", n)
+	}
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "page 1 has 4 popups open by default") {
+		t.Errorf("TestValidatePopupOpen: expected open popups warning, got: %v\n", warnings)
+	}
+
+	// Validation leaves a missing Open alone.
+	d, _ := xRefTable.DereferenceDict(closed)
+	if _, found := d.Find("Open"); found {
+		t.Errorf("TestValidatePopupOpen: missing Open inserted\n")
+	}
+
+	// Open has to be a boolean.
+	d.Update("Open", PDFInteger(1))
+	doTestValidateAnnotFail(t, xRefTable, *d, ValidationRelaxed)
+}
+
+func TestValidateFreeTextFontEncoding(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	font := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Font"),
+			"Subtype":  PDFName("Type1"),
+			"BaseFont": PDFName("Helvetica"),
+			"Encoding": PDFName("WinAnsiEncoding"),
+		},
+	}
+
+	fontIndRef, err := xRefTable.IndRefForNewObject(font)
+	if err != nil {
+		t.Fatalf("TestValidateFreeTextFontEncoding: %v\n", err)
+	}
+
+	// Provide the DA font via the default resources of the interactive form.
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestValidateFreeTextFontEncoding: %v\n", err)
+	}
+
+	rootDict.Insert("AcroForm", PDFDict{
+		Dict: map[string]PDFObject{
+			"Fields": PDFArray{},
+			"DR": PDFDict{
+				Dict: map[string]PDFObject{
+					"Font": PDFDict{Dict: map[string]PDFObject{"F1": *fontIndRef}},
+				},
+			},
+		},
+	})
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("FreeText"),
+			"Rect":     NewRectangle(10, 10, 110, 30),
+			"DA":       PDFStringLiteral("/F1 12 Tf 0 g"),
+			"Contents": PDFStringLiteral("Caf\\351 \\240 5"),
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// Greek capital letter omega is not part of WinAnsiEncoding.
+	d.Update("Contents", PDFHexLiteral("FEFF03A90020006F0068006D"))
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	// Composite fonts are not restricted.
+	font.Update("Subtype", PDFName("Type0"))
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateScreenMKWithoutAppearance(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Screen"),
+			"Rect":    NewRectangle(10, 10, 110, 110),
+			"MK":      PDFDict{Dict: map[string]PDFObject{"BG": NewNumberArray(1, 1, 1)}},
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	if len(xRefTable.ValidationWarnings()) != 0 {
+		t.Errorf("TestValidateScreenMKWithoutAppearance: unexpected warnings in strict mode: %v\n", xRefTable.ValidationWarnings())
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "entry=MK") {
+		t.Errorf("TestValidateScreenMKWithoutAppearance: expected MK warning, got: %v\n", warnings)
+	}
+}
+
+func TestValidateRedactOverlayCoverage(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	roIndRef := formForTest(t, xRefTable, "0 g 0 0 100 50 re f", NewRectangle(0, 0, 100, 50), nil)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":       PDFName("Annot"),
+			"Subtype":    PDFName("Redact"),
+			"Rect":       NewRectangle(100, 100, 200, 150),
+			"QuadPoints": NewNumberArray(100, 150, 200, 150, 100, 100, 200, 100),
+			"DA":         PDFStringLiteral("/Helv 10 Tf 0 g"),
+			"RO":         roIndRef,
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// An overlay covering the lower half only.
+	d.Update("RO", formForTest(t, xRefTable, "0 g 0 0 100 25 re f", NewRectangle(0, 0, 100, 25), nil))
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateLineCaptionDA(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Line"),
+			"Rect":     NewRectangle(100, 100, 200, 150),
+			"L":        NewNumberArray(100, 100, 200, 150),
+			"Contents": PDFStringLiteral("caption"),
+			"Cap":      PDFBoolean(true),
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	d.Insert("DA", PDFStringLiteral("/Helv 10 Tf 0 g"))
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// Inherited from the interactive form.
+	d.Delete("DA")
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestValidateLineCaptionDA: %v\n", err)
+	}
+
+	rootDict.Insert("AcroForm", PDFDict{
+		Dict: map[string]PDFObject{
+			"Fields": PDFArray{},
+			"DA":     PDFStringLiteral("/Helv 10 Tf 0 g"),
+		},
+	})
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateAppearanceBBox(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	// A stroked rectangle along the edges of BBox is fine.
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, "1 w 0 0 40 40 re S", NewRectangle(0, 0, 40, 40), nil)}})
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	if warnings := xRefTable.ValidationWarnings(); len(warnings) != 0 {
+		t.Errorf("TestValidateAppearanceBBox: unexpected warnings: %v\n", warnings)
+	}
+
+	// A line drawn past BBox.
+	d.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, "0 0 m 80 40 l S", NewRectangle(0, 0, 40, 40), nil)}})
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	if warnings := xRefTable.ValidationWarnings(); len(warnings) != 0 {
+		t.Errorf("TestValidateAppearanceBBox: unexpected warnings in strict mode: %v\n", warnings)
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "exceeds BBox") {
+		t.Errorf("TestValidateAppearanceBBox: expected BBox warning, got: %v\n", warnings)
+	}
+}
+
+func TestValidateAppearanceStreamOperators(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	content := "q 1 0 0 RG [3 2] 0 d 0 0 m 40 40 l S (a \\) b) Tj <414243> Tj BX /P <</MCID 0>> foo EX Q"
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, content, NewRectangle(0, 0, 40, 40), nil)}})
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	content = "q 1 0 0 RG 0 0 m 40 40 l Sx Q"
+	d.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, content, NewRectangle(0, 0, 40, 40), nil)}})
+
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, `unknown operator "Sx"`) {
+		t.Errorf("TestValidateAppearanceStreamOperators: expected warning for Sx, got: %v\n", warnings)
+	}
+}
+
+func TestValidateAppearanceStreamSize(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	content := strings.Repeat("0 0 m 40 40 l S ", 100)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, content, NewRectangle(0, 0, 40, 40), nil)}})
+
+	// Unlimited by default.
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	xRefTable.MaxAppearanceStreamBytes = 4096
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	xRefTable.MaxAppearanceStreamBytes = 100
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "exceeds limit of 100 bytes") {
+		t.Errorf("TestValidateAppearanceStreamSize: expected size warning, got: %v\n", warnings)
+	}
+}
+
+func TestValidateAppearanceStreamExtGStates(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	content := "q /GS0 gs 1 0 0 rg 0 0 40 40 re f Q"
+
+	gs := PDFDict{Dict: map[string]PDFObject{"Type": PDFName("ExtGState"), "ca": PDFFloat(0.5)}}
+	resources := PDFDict{Dict: map[string]PDFObject{"ExtGState": PDFDict{Dict: map[string]PDFObject{"GS0": gs}}}}
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, content, NewRectangle(0, 0, 40, 40), &resources)}})
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// GS1 is not defined.
+	content = "q /GS1 gs 1 0 0 rg 0 0 40 40 re f Q"
+	d.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, content, NewRectangle(0, 0, 40, 40), &resources)}})
+
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, `undefined ExtGState "GS1"`) {
+		t.Errorf("TestValidateAppearanceStreamExtGStates: expected ExtGState warning, got: %v\n", warnings)
+	}
+
+	// Missing resources.
+	d.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, content, NewRectangle(0, 0, 40, 40), nil)}})
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateInteriorColorModel(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("IC", NewNumberArray(0, 0, 1))
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// Transparent interior.
+	d.Update("IC", PDFArray{})
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// RGB C, CMYK IC.
+	d.Update("IC", NewNumberArray(0, 0, 1, 0))
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "IC with 4 components does not match C with 3 components") {
+		t.Errorf("TestValidateInteriorColorModel: expected color model warning, got: %v\n", warnings)
+	}
+
+	line := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Line"),
+			"Rect":    NewRectangle(10, 10, 110, 20),
+			"L":       NewNumberArray(10, 15, 110, 15),
+			"LE":      NewNameArray("ClosedArrow", "None"),
+			"C":       NewNumberArray(0.5),
+			"IC":      NewNumberArray(1, 0, 0),
+		},
+	}
+
+	doTestValidateAnnotFail(t, xRefTable, line, ValidationStrict)
+
+	line.Update("IC", NewNumberArray(0.2))
+	doTestValidateAnnotOK(t, xRefTable, line, ValidationStrict)
+}
+
+func TestValidatePrinterMarkFlags(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("PrinterMark"),
+			"Rect":    NewRectangle(10, 10, 30, 30),
+			"F":       PDFInteger(annotFlagPrint),
+			"AP":      PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, "0 0 m 20 20 l S", NewRectangle(0, 0, 20, 20), nil)}},
+		},
+	}
+
+	// Warn by default, even in strict mode.
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 2 || !strings.Contains(warnings[0].Msg, "NoZoom and NoRotate") {
+		t.Errorf("TestValidatePrinterMarkFlags: expected flags warnings, got: %v\n", warnings)
+	}
+
+	xRefTable.StrictPrinterMarks = true
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	d.Update("F", PDFInteger(annotFlagPrint|annotFlagNoZoom|annotFlagNoRotate))
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateEmbeddedFileCheckSum(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	fileName := filepath.Join(outDir, "checksum.txt")
+	if err := ioutil.WriteFile(fileName, []byte("pdfcpu checksum test\n"), os.ModePerm); err != nil {
+		t.Fatalf("TestValidateEmbeddedFileCheckSum: %v\n", err)
+	}
+
+	err := AddFileAttachmentAnnotation(xRefTable, 1, [2]float64{50, 50}, fileName, "Paperclip")
+	if err != nil {
+		t.Fatalf("TestValidateEmbeddedFileCheckSum: %v\n", err)
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	d, err := xRefTable.DereferenceDict((*pageDict.PDFArrayEntry("Annots"))[0])
+	if err != nil {
+		t.Fatalf("TestValidateEmbeddedFileCheckSum: %v\n", err)
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, *d, ValidationStrict)
+
+	sd, err := xRefTable.DereferenceStreamDict(d.PDFDictEntry("FS").PDFDictEntry("EF").Dict["F"])
+	if err != nil {
+		t.Fatalf("TestValidateEmbeddedFileCheckSum: %v\n", err)
+	}
+
+	// Corrupt the checksum.
+	sd.PDFDictEntry("Params").Update("CheckSum", PDFHexLiteral("00112233445566778899aabbccddeeff"))
+
+	doTestValidateAnnotFail(t, xRefTable, *d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, *d, ValidationRelaxed)
+
+	if ww := xRefTable.ValidationWarnings(); len(ww) == 0 || !strings.Contains(ww[len(ww)-1].Msg, "checksum mismatch") {
+		t.Errorf("TestValidateEmbeddedFileCheckSum: missing checksum warning: %v\n", ww)
+	}
+}
+
+func TestValidateFileAttachmentIcon(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	fileName := filepath.Join(outDir, "icon.txt")
+	if err := ioutil.WriteFile(fileName, []byte("pdfcpu icon test\n"), os.ModePerm); err != nil {
+		t.Fatalf("TestValidateFileAttachmentIcon: %v\n", err)
+	}
+
+	err := AddFileAttachmentAnnotation(xRefTable, 1, [2]float64{50, 50}, fileName, "Tag")
+	if err != nil {
+		t.Fatalf("TestValidateFileAttachmentIcon: %v\n", err)
+	}
+
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+
+	d, err := xRefTable.DereferenceDict((*pageDict.PDFArrayEntry("Annots"))[0])
+	if err != nil {
+		t.Fatalf("TestValidateFileAttachmentIcon: %v\n", err)
+	}
+
+	d.Delete("AP")
+	doTestValidateAnnotOK(t, xRefTable, *d, ValidationStrict)
+
+	// Custom icon without appearance.
+	d.Update("Name", PDFName("Clip"))
+	doTestValidateAnnotFail(t, xRefTable, *d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, *d, ValidationRelaxed)
+
+	if ww := xRefTable.ValidationWarnings(); len(ww) == 0 || !strings.Contains(ww[len(ww)-1].Msg, "custom icon") {
+		t.Errorf("TestValidateFileAttachmentIcon: missing icon warning: %v\n", ww)
+	}
+
+	// Custom icon with appearance.
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": formForTest(t, xRefTable, "0 0 10 10 re f", NewRectangle(0, 0, 10, 10), nil)}})
+	doTestValidateAnnotOK(t, xRefTable, *d, ValidationStrict)
+}
+
+func TestValidateBorderWidth(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	_, pageIndRef := pageForTest(t, xRefTable, 1)
+
+	squareWithBorderWidth := func(w PDFObject) PDFDict {
+		d := squareAnnotForTest(NewRectangle(10, 10, 100, 100))
+		d.Insert("P", pageIndRef)
+		d.Insert("BS", PDFDict{Dict: map[string]PDFObject{"W": w, "S": PDFName("S")}})
+		return d
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, squareWithBorderWidth(PDFInteger(1)), ValidationStrict)
+	if len(xRefTable.ValidationWarnings()) != 0 {
+		t.Errorf("TestValidateBorderWidth: unexpected warnings: %v\n", xRefTable.ValidationWarnings())
+	}
+
+	doTestValidateAnnotFail(t, xRefTable, squareWithBorderWidth(PDFInteger(-1)), ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, squareWithBorderWidth(PDFFloat(-1)), ValidationRelaxed)
+
+	doTestValidateAnnotOK(t, xRefTable, squareWithBorderWidth(PDFInteger(100000)), ValidationRelaxed)
+
+	ww := xRefTable.ValidationWarnings()
+	if len(ww) != 2 || !strings.Contains(ww[1].Msg, "exceeds page dimensions") {
+		t.Errorf("TestValidateBorderWidth: unexpected warnings: %v\n", ww)
+	}
+}
+
+func TestValidateNoRotateAppearance(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 2)
+	xRefTable.ValidationMode = ValidationRelaxed
+
+	// The page inherits its rotation from the page tree, the annotation lacks P.
+	pageDict, _ := pageForTest(t, xRefTable, 1)
+	pagesDict, err := xRefTable.DereferenceDict(pageDict.Dict["Parent"])
+	if err != nil || pagesDict == nil {
+		t.Fatalf("TestValidateNoRotateAppearance: missing page tree: %v\n", err)
+	}
+	pagesDict.Insert("Rotate", PDFInteger(90))
+
+	apIndRef := formForTest(t, xRefTable, "0 0 m 20 20 l S", NewRectangle(0, 0, 20, 20), nil)
+
+	addAnnotForTest(t, xRefTable, 1, PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Text"),
+			"Rect":    NewRectangle(10, 10, 30, 30),
+			"F":       PDFInteger(annotFlagNoRotate | annotFlagNoZoom),
+			"AP":      PDFDict{Dict: map[string]PDFObject{"N": apIndRef}},
+		},
+	})
+
+	if err = validatePageAnnotations(xRefTable, pageDict, 1); err != nil {
+		t.Fatalf("TestValidateNoRotateAppearance: %v\n", err)
+	}
+
+	ww := xRefTable.ValidationWarnings()
+	if len(ww) != 1 || !strings.Contains(ww[0].Msg, "does not compensate page rotation 90") {
+		t.Fatalf("TestValidateNoRotateAppearance: expected warning, got %v\n", ww)
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(apIndRef)
+	if err != nil {
+		t.Fatalf("TestValidateNoRotateAppearance: %v\n", err)
+	}
+	sd.Insert("Matrix", NewNumberArray(0, -1, 1, 0, 0, 20))
+
+	if err = validatePageAnnotations(xRefTable, pageDict, 1); err != nil {
+		t.Fatalf("TestValidateNoRotateAppearance: %v\n", err)
+	}
+
+	if ww := xRefTable.ValidationWarnings(); len(ww) != 1 {
+		t.Errorf("TestValidateNoRotateAppearance: unexpected warnings: %v\n", ww)
+	}
+}
+
+func TestValidateTextAnnotationState(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	textWithState := func(stateModel, state string) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":       PDFName("Annot"),
+				"Subtype":    PDFName("Text"),
+				"Rect":       NewRectangle(10, 10, 30, 30),
+				"StateModel": PDFStringLiteral(stateModel),
+				"State":      PDFStringLiteral(state),
+			},
+		}
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, textWithState("Review", "Accepted"), ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, textWithState("Marked", "Unmarked"), ValidationStrict)
+	doTestValidateAnnotFail(t, xRefTable, textWithState("Marked", "Accepted"), ValidationStrict)
+	doTestValidateAnnotFail(t, xRefTable, textWithState("Review", "Approved"), ValidationStrict)
+
+	doTestValidateAnnotOK(t, xRefTable, textWithState("Marked", "Accepted"), ValidationRelaxed)
+	if len(xRefTable.ValidationWarnings()) != 1 {
+		t.Errorf("TestValidateTextAnnotationState: expected 1 warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+}
+
+func TestValidateCheckBoxAppearanceState(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	on := formForTest(t, xRefTable, "0 0 10 10 re f", NewRectangle(0, 0, 10, 10), nil)
+	off := formForTest(t, xRefTable, "", NewRectangle(0, 0, 10, 10), nil)
+
+	checkBox := func(as, v string) PDFDict {
+		return PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":    PDFName("Annot"),
+				"Subtype": PDFName("Widget"),
+				"Rect":    NewRectangle(10, 10, 20, 20),
+				"FT":      PDFName("Btn"),
+				"T":       PDFStringLiteral("cb"),
+				"V":       PDFName(v),
+				"AS":      PDFName(as),
+				"AP": PDFDict{
+					Dict: map[string]PDFObject{
+						"N": PDFDict{Dict: map[string]PDFObject{"On": on, "Off": off}},
+					},
+				},
+			},
+		}
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, checkBox("On", "On"), ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, checkBox("Off", "Off"), ValidationStrict)
+	doTestValidateAnnotFail(t, xRefTable, checkBox("Off", "On"), ValidationStrict)
+	doTestValidateAnnotFail(t, xRefTable, checkBox("On", "Off"), ValidationStrict)
+
+	// The field value is inherited from the parent field.
+	parent, err := xRefTable.IndRefForNewObject(PDFDict{
+		Dict: map[string]PDFObject{
+			"FT": PDFName("Btn"),
+			"T":  PDFStringLiteral("parent"),
+			"V":  PDFName("On"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestValidateCheckBoxAppearanceState: %v\n", err)
+	}
+
+	kid := checkBox("Off", "On")
+	kid.Delete("V")
+	kid.Delete("FT")
+	kid.Insert("Parent", *parent)
+	doTestValidateAnnotFail(t, xRefTable, kid, ValidationStrict)
+
+	// Radio buttons are not affected.
+	radio := checkBox("Off", "On")
+	radio.Insert("Ff", PDFInteger(1<<15))
+	doTestValidateAnnotOK(t, xRefTable, radio, ValidationStrict)
+
+	doTestValidateAnnotOK(t, xRefTable, checkBox("Off", "On"), ValidationRelaxed)
+	if len(xRefTable.ValidationWarnings()) != 1 {
+		t.Errorf("TestValidateCheckBoxAppearanceState: expected 1 warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+}
+
+func TestValidateMarkupOpacities(t *testing.T) {
+
+	withOpacities := func(ca, caNonStroking float64) PDFDict {
+		d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+		d.Insert("CA", PDFFloat(ca))
+		d.Insert("ca", PDFFloat(caNonStroking))
+		return d
+	}
+
+	for _, mode := range []int{ValidationStrict, ValidationRelaxed} {
+		xRefTable := createAnnotTestXRef(t, 1)
+		doTestValidateAnnotOK(t, xRefTable, withOpacities(1, 0.8), mode)
+		doTestValidateAnnotFail(t, xRefTable, withOpacities(1, 1.5), mode)
+		if len(xRefTable.ValidationWarnings()) > 0 {
+			t.Errorf("TestValidateMarkupOpacities: unexpected warnings: %v\n", xRefTable.ValidationWarnings())
+		}
+	}
+
+	// Substantially differing opacities never fail but are noted in relaxed mode.
+	xRefTable := createAnnotTestXRef(t, 1)
+	doTestValidateAnnotOK(t, xRefTable, withOpacities(1, 0.3), ValidationStrict)
+	if len(xRefTable.ValidationWarnings()) > 0 {
+		t.Errorf("TestValidateMarkupOpacities: unexpected warnings: %v\n", xRefTable.ValidationWarnings())
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, withOpacities(1, 0.3), ValidationRelaxed)
+	if len(xRefTable.ValidationWarnings()) != 1 {
+		t.Errorf("TestValidateMarkupOpacities: expected 1 warning, got %v\n", xRefTable.ValidationWarnings())
+	}
+}
+
+// validateAnnotationsForTest validates all annotations of xRefTable and returns the outcome for each of them.
+func validateAnnotationsForTest(xRefTable *XRefTable) ([]string, error) {
+
+	var results []string
+
+	err := visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		_, err := validateAnnotationDict(xRefTable, annotDict)
+		results = append(results, fmt.Sprintf("%d %v %v", pageNr, indRef, err))
+		return nil
+	})
+
+	for _, w := range xRefTable.ValidationWarnings() {
+		results = append(results, w.Msg)
+	}
+
+	return results, err
+}
+
+func TestValidateAnnotationsWithPooledBuffers(t *testing.T) {
+
+	xRefTable, err := CreateAcroFormDemoXRef()
+	if err != nil {
+		t.Fatalf("TestValidateAnnotationsWithPooledBuffers: %v\n", err)
+	}
+
+	// Pooled tokenizing yields the same tokens.
+	err = visitAnnotations(xRefTable, func(pageNr int, pageIndRef PDFIndirectRef, indRef *PDFIndirectRef, annotDict *PDFDict) error {
+		return visitAppearanceStreams(xRefTable, annotDict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+
+			b, err := streamContent(sd)
+			if err != nil {
+				return err
+			}
+
+			want, err := contentOperators(b)
+			if err != nil {
+				return err
+			}
+
+			buf := contentBufferPool.Get().(*contentBuffers)
+			defer contentBufferPool.Put(buf)
+
+			// Dirty the buffers.
+			if _, err = tokenizeContent([]byte("1 2 3 4 re 0.5 g f"), buf); err != nil {
+				return err
+			}
+
+			got, err := tokenizeContent(b, buf)
+			if err != nil {
+				return err
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("TestValidateAnnotationsWithPooledBuffers: expected %v, got %v\n", want, got)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("TestValidateAnnotationsWithPooledBuffers: %v\n", err)
+	}
+
+	// Repeated validation reusing pooled buffers yields identical results.
+	var want []string
+
+	for i := 0; i < 3; i++ {
+
+		xRefTable, err := CreateAcroFormDemoXRef()
+		if err != nil {
+			t.Fatalf("TestValidateAnnotationsWithPooledBuffers: %v\n", err)
+		}
+
+		got, err := validateAnnotationsForTest(xRefTable)
+		if err != nil {
+			t.Fatalf("TestValidateAnnotationsWithPooledBuffers: %v\n", err)
+		}
+
+		if i == 0 {
+			want = got
+			continue
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("TestValidateAnnotationsWithPooledBuffers: run %d: expected %v, got %v\n", i, want, got)
+		}
+	}
+}
+
+func BenchmarkValidateAnnotations(b *testing.B) {
+
+	xRefTable, err := CreateAcroFormDemoXRef()
+	if err != nil {
+		b.Fatalf("BenchmarkValidateAnnotations: %v\n", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		xRefTable.warnings = nil
+		if _, err := validateAnnotationsForTest(xRefTable); err != nil {
+			b.Fatalf("BenchmarkValidateAnnotations: %v\n", err)
+		}
+	}
+}
+
+func TestValidateRemoteLinkActions(t *testing.T) {
+
+	goToR := func(f PDFObject, d PDFArray) *PDFDict {
+		return &PDFDict{
+			Dict: map[string]PDFObject{
+				"S": PDFName("GoToR"),
+				"F": f,
+				"D": d,
+			},
+		}
+	}
+
+	fit := PDFArray{PDFInteger(0), PDFName("Fit")}
+
+	// Relative paths pass in both modes.
+	for _, mode := range []int{ValidationStrict, ValidationRelaxed} {
+		xRefTable := createAnnotTestXRef(t, 1)
+		doTestValidateAnnotOK(t, xRefTable, linkAnnotForTest(nil, goToR(PDFStringLiteral("docs/other.pdf"), fit)), mode)
+		if len(xRefTable.ValidationWarnings()) > 0 {
+			t.Errorf("TestValidateRemoteLinkActions: unexpected warnings: %v\n", xRefTable.ValidationWarnings())
+		}
+	}
+
+	// Remote destinations specify their page by number.
+	xRefTable := createAnnotTestXRef(t, 1)
+	_, page := pageForTest(t, xRefTable, 1)
+	doTestValidateAnnotFail(t, xRefTable, linkAnnotForTest(nil, goToR(PDFStringLiteral("other.pdf"), PDFArray{page, PDFName("Fit")})), ValidationStrict)
+
+	// Absolute paths are noted in relaxed mode.
+	fileSpec := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type": PDFName("Filespec"),
+			"F":    PDFStringLiteral("other.pdf"),
+			"UF":   PDFStringLiteral(`C:\\docs\\other.pdf`),
+		},
+	}
+
+	launch := &PDFDict{
+		Dict: map[string]PDFObject{
+			"S": PDFName("Launch"),
+			"F": PDFStringLiteral("/home/user/run.sh"),
+		},
+	}
+
+	for _, action := range []*PDFDict{goToR(PDFStringLiteral("/C/docs/other.pdf"), fit), goToR(fileSpec, fit), launch} {
+
+		xRefTable := createAnnotTestXRef(t, 1)
+
+		doTestValidateAnnotOK(t, xRefTable, linkAnnotForTest(nil, action), ValidationStrict)
+		if len(xRefTable.ValidationWarnings()) > 0 {
+			t.Errorf("TestValidateRemoteLinkActions: unexpected warnings: %v\n", xRefTable.ValidationWarnings())
+		}
+
+		doTestValidateAnnotOK(t, xRefTable, linkAnnotForTest(nil, action), ValidationRelaxed)
+		if len(xRefTable.ValidationWarnings()) != 1 {
+			t.Errorf("TestValidateRemoteLinkActions: %v: expected 1 warning, got %v\n", action, xRefTable.ValidationWarnings())
+		}
+	}
+}
+
+func TestValidateRichMediaAnnotation(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	fileSpec := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type": PDFName("Filespec"),
+			"F":    PDFStringLiteral("movie.swf"),
+		},
+	}
+
+	assets, err := xRefTable.IndRefForNewObject(PDFDict{Dict: map[string]PDFObject{"Names": PDFArray{PDFStringLiteral("movie.swf"), fileSpec}}})
+	if err != nil {
+		t.Fatalf("TestValidateRichMediaAnnotation: %v\n", err)
+	}
+
+	config := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("RichMediaConfiguration"),
+			"Subtype": PDFName("Flash"),
+			"Instances": PDFArray{
+				PDFDict{Dict: map[string]PDFObject{"Type": PDFName("RichMediaInstance"), "Subtype": PDFName("Flash")}},
+			},
+		},
+	}
+
+	content, err := xRefTable.IndRefForNewObject(PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":           PDFName("RichMediaContent"),
+			"Assets":         *assets,
+			"Configurations": PDFArray{config},
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestValidateRichMediaAnnotation: %v\n", err)
+	}
+
+	activation := PDFDict{Dict: map[string]PDFObject{"Type": PDFName("RichMediaActivation"), "Condition": PDFName("PO")}}
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":             PDFName("Annot"),
+			"Subtype":          PDFName("RichMedia"),
+			"Rect":             NewRectangle(10, 10, 210, 160),
+			"RichMediaContent": *content,
+			"RichMediaSettings": PDFDict{
+				Dict: map[string]PDFObject{
+					"Activation":   activation,
+					"Deactivation": PDFDict{Dict: map[string]PDFObject{"Condition": PDFName("PC")}},
+				},
+			},
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	activation.Update("Condition", PDFName("XX"))
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	activation.Update("Condition", PDFName("XA"))
+
+	// Direct Assets name tree.
+	c, _ := xRefTable.DereferenceDict(*content)
+	c.Update("Assets", PDFDict{Dict: map[string]PDFObject{"Names": PDFArray{PDFStringLiteral("movie.swf"), PDFInteger(1)}}})
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	c.Update("Assets", PDFDict{Dict: map[string]PDFObject{"Names": PDFArray{PDFStringLiteral("movie.swf"), fileSpec}}})
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	d.Delete("RichMediaContent")
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	// RichMedia requires PDF 1.7.
+	d.Insert("RichMediaContent", *content)
+	v := V15
+	xRefTable.HeaderVersion = &v
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationRelaxed)
+}
+
+func TestValidateProjectionAnnotation(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	v := V20
+	xRefTable.HeaderVersion = &v
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Projection"),
+			"Rect":     NewRectangle(10, 10, 100, 100),
+			"Contents": PDFStringLiteral("12.5 mm"),
+			"ExData":   PDFDict{Dict: map[string]PDFObject{"Type": PDFName("ExData"), "Subtype": PDFName("3DM")}},
+		},
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	d.Update("ExData", PDFDict{Dict: map[string]PDFObject{"Type": PDFName("ExData"), "Subtype": PDFName("GEO")}})
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	// Projection annotations are a PDF 2.0 feature.
+	d.Delete("ExData")
+	v = V17
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	// 3DM ExData follows the same version rule for Projection and other markup annotations.
+	exData := PDFDict{Dict: map[string]PDFObject{"Type": PDFName("ExData"), "Subtype": PDFName("3DM")}}
+	d.Insert("ExData", exData)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	sq := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	sq.Insert("ExData", exData)
+	doTestValidateAnnotOK(t, xRefTable, sq, ValidationRelaxed)
+	doTestValidateAnnotFail(t, xRefTable, sq, ValidationStrict)
+
+	if s := VersionString(V20); s != "2.0" {
+		t.Errorf("TestValidateProjectionAnnotation: VersionString(V20) = %s\n", s)
+	}
+}
+
+func TestValidateCloudyBorderWidth(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("BE", PDFDict{Dict: map[string]PDFObject{"S": PDFName("C"), "I": PDFInteger(1)}})
+	d.Insert("BS", PDFDict{Dict: map[string]PDFObject{"W": PDFInteger(2)}})
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	d.Update("BS", PDFDict{Dict: map[string]PDFObject{"W": PDFInteger(0)}})
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	d.Delete("BS")
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "cloudy border effect requires BS with W > 0") {
+		t.Errorf("TestValidateCloudyBorderWidth: expected cloudy border warning, got: %v\n", warnings)
+	}
+
+	// No width required for the solid border effect.
+	d.Update("BE", PDFDict{Dict: map[string]PDFObject{"S": PDFName("S")}})
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateFreeTextMissingDA(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("FreeText"),
+			"Rect":     NewRectangle(10, 10, 110, 30),
+			"Contents": PDFStringLiteral("scanned"),
+		},
+	}
+
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "required entry=DA missing") {
+		t.Errorf("TestValidateFreeTextMissingDA: expected DA warning, got: %v\n", warnings)
+	}
+
+	if da := d.StringEntry("DA"); da == nil || *da != "/Helv 0 Tf 0 g" {
+		t.Errorf("TestValidateFreeTextMissingDA: unexpected DA: %v\n", da)
+	}
+
+	// The synthesized DA passes strict validation.
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateAppearanceDictKeys(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	form := formForTest(t, xRefTable, "0 0 40 40 re f", NewRectangle(0, 0, 40, 40), nil)
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	ap := PDFDict{Dict: map[string]PDFObject{"N": form, "D": form, "R": form}}
+	d.Insert("AP", ap)
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	ap.Insert("X", form)
+
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "unexpected entries: X") {
+		t.Errorf("TestValidateAppearanceDictKeys: expected AP warning, got: %v\n", warnings)
+	}
+}
+
+func TestValidateCollectWarnings(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d1 := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("ACME_Sticker"),
+			"Rect":    NewRectangle(10, 10, 50, 50),
+		},
+	}
+
+	d2 := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d2.Insert("BE", PDFDict{Dict: map[string]PDFObject{"S": PDFName("C"), "I": PDFInteger(5)}})
+	d2.Insert("BS", PDFDict{Dict: map[string]PDFObject{"W": PDFInteger(1)}})
+
+	doTestValidateAnnotFail(t, xRefTable, d1, ValidationStrict)
+	doTestValidateAnnotFail(t, xRefTable, d2, ValidationStrict)
+
+	if warnings := xRefTable.ValidationWarnings(); len(warnings) != 0 {
+		t.Errorf("TestValidateCollectWarnings: unexpected warnings: %v\n", warnings)
+	}
+
+	xRefTable.CollectWarnings = true
+
+	doTestValidateAnnotOK(t, xRefTable, d1, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d2, ValidationStrict)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 2 ||
+		!strings.Contains(warnings[0].Msg, "unsupported annotation subtype: ACME_Sticker") ||
+		!strings.Contains(warnings[1].Msg, "entry=I 5.000000 out of range") {
+		t.Errorf("TestValidateCollectWarnings: unexpected warnings: %v\n", warnings)
+	}
+
+	// Fatal issues still abort validation.
+	d2.Update("Rect", NewNumberArray(10, 10))
+	doTestValidateAnnotFail(t, xRefTable, d2, ValidationStrict)
+}
+
+func TestValidate3DPoster(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	d := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("3D"),
+			"Rect":    NewRectangle(10, 10, 110, 110),
+			"3DD":     PDFDict{Dict: map[string]PDFObject{"Type": PDFName("3DRef")}},
+		},
+	}
+
+	poster := formForTest(t, xRefTable, "q 1 0 0 rg 0 0 100 100 re f Q", NewRectangle(0, 0, 100, 100), nil)
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": poster}})
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// Empty poster.
+	poster = formForTest(t, xRefTable, "q Q", NewRectangle(0, 0, 100, 100), nil)
+	d.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": poster}})
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "empty poster") {
+		t.Errorf("TestValidate3DPoster: expected empty poster warning, got: %v\n", warnings)
+	}
+
+	// Poster with a degenerate BBox.
+	poster = formForTest(t, xRefTable, "0 0 100 100 re f", NewRectangle(0, 0, 100, 0), nil)
+	d.Update("AP", PDFDict{Dict: map[string]PDFObject{"N": poster}})
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	// Missing poster.
+	d.Delete("AP")
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+}
+
+func TestValidateBorderEffectIntensity(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	be := PDFDict{Dict: map[string]PDFObject{"S": PDFName("C"), "I": PDFInteger(3)}}
+
+	d := squareAnnotForTest(NewRectangle(10, 10, 50, 50))
+	d.Insert("BE", be)
+	d.Insert("BS", PDFDict{Dict: map[string]PDFObject{"W": PDFInteger(1)}})
+
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	// Relaxed mode clamps the intensity.
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	if f, ok := be.Dict["I"].(PDFFloat); !ok || f.Value() != 2 {
+		t.Errorf("TestValidateBorderEffectIntensity: expected clamped I=2, got %v\n", be.Dict["I"])
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// The intensity is meaningless for the solid border effect.
+	xRefTable = createAnnotTestXRef(t, 1)
+
+	be = PDFDict{Dict: map[string]PDFObject{"S": PDFName("S"), "I": PDFInteger(1)}}
+	d.Update("BE", be)
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Msg, "entry=I meaningless for solid border effect") {
+		t.Errorf("TestValidateBorderEffectIntensity: expected solid border effect warning, got: %v\n", warnings)
+	}
+
+	if _, found := be.Find("I"); !found {
+		t.Errorf("TestValidateBorderEffectIntensity: strict mode dropped I\n")
+	}
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	if _, found := be.Find("I"); found {
+		t.Errorf("TestValidateBorderEffectIntensity: relaxed mode kept I\n")
+	}
+}
+
+func TestValidateLinkBorderColor(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	_, page1 := pageForTest(t, xRefTable, 1)
+
+	d := linkAnnotForTest(PDFArray{page1, PDFName("Fit")}, nil)
+	d.Insert("Border", NewIntegerArray(0, 0, 2))
+	d.Insert("C", PDFArray{})
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	warnings := xRefTable.ValidationWarnings()
+	if len(warnings) != 2 || !strings.Contains(warnings[1].Msg, "visible border of width 2.00 with empty entry=C") {
+		t.Errorf("TestValidateLinkBorderColor: expected border color warnings, got: %v\n", warnings)
+	}
+
+	// BS takes precedence over Border.
+	d.Insert("BS", PDFDict{Dict: map[string]PDFObject{"W": PDFInteger(0)}})
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	// A color for the visible border.
+	d.Delete("BS")
+	d.Update("C", NewNumberArray(0, 0, 1))
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	if n := len(xRefTable.ValidationWarnings()); n != 2 {
+		t.Errorf("TestValidateLinkBorderColor: expected no further warnings, got: %v\n", xRefTable.ValidationWarnings()[2:])
+	}
+}
+
+func TestValidateAnnotationStructParent(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("TestValidateAnnotationStructParent: %v\n", err)
+	}
+
+	elem := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type": PDFName("StructElem"),
+			"S":    PDFName("Link"),
+		},
+	}
+
+	elemIndRef, err := xRefTable.IndRefForNewObject(elem)
+	if err != nil {
+		t.Fatalf("TestValidateAnnotationStructParent: %v\n", err)
+	}
+
+	rootDict.Insert("StructTreeRoot", PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":       PDFName("StructTreeRoot"),
+			"ParentTree": PDFDict{Dict: map[string]PDFObject{"Nums": PDFArray{PDFInteger(0), *elemIndRef}}},
+			"RoleMap":    PDFDict{Dict: map[string]PDFObject{"Hyperlink": PDFName("Link")}},
+		},
+	})
+
+	xRefTable.Tagged = true
+
+	d := linkAnnotForTest(PDFArray{PDFInteger(0), PDFName("Fit")}, nil)
+	d.Insert("StructParent", PDFInteger(0))
+
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// Custom structure type mapped to Link.
+	elem.Update("S", PDFName("Hyperlink"))
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+
+	// A Link tagged as paragraph.
+	elem.Update("S", PDFName("P"))
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationRelaxed)
+
+	if ww := xRefTable.ValidationWarnings(); len(ww) == 0 || !strings.Contains(ww[len(ww)-1].Msg, "unsuitable structure type P") {
+		t.Errorf("TestValidateAnnotationStructParent: missing warning: %v\n", ww)
+	}
+
+	// Unknown StructParent key.
+	d.Update("StructParent", PDFInteger(1))
+	doTestValidateAnnotFail(t, xRefTable, d, ValidationStrict)
+
+	// Untagged documents are not checked.
+	xRefTable.Tagged = false
+	doTestValidateAnnotOK(t, xRefTable, d, ValidationStrict)
+}
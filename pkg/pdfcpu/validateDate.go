@@ -20,6 +20,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 func prevalidateDate(s string) (string, bool) {
@@ -329,3 +331,96 @@ func validateDate(s string) bool {
 
 // Date validates an ISO/IEC 8824 compliant date string.
 func Date(s string) bool { return validateDate(s) }
+
+// parseDate returns the time represented by an ISO/IEC 8824 compliant date string.
+// Missing fields default to the earliest possible value and a missing timezone to UT.
+func parseDate(s string) (time.Time, bool) {
+
+	if !validateDate(s) {
+		return time.Time{}, false
+	}
+
+	s, _ = prevalidateDate(s)
+
+	// Field values at positions within "D:YYYYMMDDHHmmSSOHH'mm", validateDate ensures they are numeric.
+	field := func(from, to, def int) int {
+		if len(s) < to {
+			return def
+		}
+		i, _ := strconv.Atoi(s[from:to])
+		return i
+	}
+
+	loc := time.UTC
+
+	if len(s) > 16 && s[16] != 'Z' {
+		offset := field(17, 19, 0)*60*60 + field(20, 22, 0)*60
+		if s[16] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+
+	t := time.Date(field(2, 6, 0), time.Month(field(6, 8, 1)), field(8, 10, 1),
+		field(10, 12, 0), field(12, 14, 0), field(14, 16, 0), 0, loc)
+
+	return t, true
+}
+
+// relaxedDate repairs common non-conforming variants of a date string
+// like a missing "D:" prefix or a timezone offset without apostrophes.
+func relaxedDate(s string) string {
+
+	if IsStringUTF16BE(s) {
+		utf16s, err := DecodeUTF16String(s)
+		if err != nil {
+			return s
+		}
+		s = utf16s
+	}
+
+	s = strings.TrimSpace(s)
+
+	if !strings.HasPrefix(s, "D:") {
+		s = "D:" + s
+	}
+
+	if len(s) <= 17 || strings.IndexByte("+-Z", s[16]) < 0 {
+		return s
+	}
+
+	// "HH'mm'", "HH'mm", "HHmm", "HH'" or "HH"
+	tz := strings.Replace(s[17:], "'", "", -1)
+
+	switch len(tz) {
+	case 2:
+		return s[:17] + tz + "'"
+	case 4:
+		return s[:17] + tz[:2] + "'" + tz[2:] + "'"
+	}
+
+	return s
+}
+
+// parseDateRelaxed parses a date string accepting the variants repaired by relaxedDate.
+func parseDateRelaxed(s string) (time.Time, bool) {
+
+	if t, ok := parseDate(s); ok {
+		return t, true
+	}
+
+	return parseDate(relaxedDate(s))
+}
+
+// ParsePDFDate returns the time represented by a date string of the form "D:YYYYMMDDHHmmSSOHH'mm'".
+// All fields following the year are optional.
+// Missing fields default to the earliest possible value and a missing timezone to UT.
+func ParsePDFDate(s string) (time.Time, error) {
+
+	t, ok := parseDate(s)
+	if !ok {
+		return time.Time{}, errors.Errorf("ParsePDFDate: invalid date: %q", s)
+	}
+
+	return t, nil
+}
@@ -20,7 +20,21 @@ import (
 	"github.com/pkg/errors"
 )
 
-func validateDestinationArrayFirstElement(xRefTable *XRefTable, arr *PDFArray) (PDFObject, error) {
+func validateDestinationPageIndex(xRefTable *XRefTable, i int) error {
+
+	// The overall page count is set during validation of the page tree.
+	if xRefTable.PageCount == 0 {
+		return nil
+	}
+
+	if i < 0 || i >= xRefTable.PageCount {
+		return xRefTable.reportNonFatal("validateDestinationPageIndex: page index %d out of range, page count: %d", i, xRefTable.PageCount)
+	}
+
+	return nil
+}
+
+func validateDestinationArrayFirstElement(xRefTable *XRefTable, arr *PDFArray, remote bool) (PDFObject, error) {
 
 	obj, err := xRefTable.Dereference((*arr)[0])
 	if err != nil || obj == nil {
@@ -29,7 +43,11 @@ func validateDestinationArrayFirstElement(xRefTable *XRefTable, arr *PDFArray) (
 
 	switch obj := obj.(type) {
 
-	case PDFInteger: // no further processing
+	case PDFInteger:
+		// A zero based page index. The pages of a remote document are unknown.
+		if !remote {
+			err = validateDestinationPageIndex(xRefTable, obj.Value())
+		}
 
 	case PDFDict:
 		if obj.Type() == nil || *obj.Type() != "Page" {
@@ -48,11 +66,11 @@ func validateDestinationArrayLength(arr PDFArray) bool {
 	return l == 2 || l == 3 || l == 5 || l == 6
 }
 
-func validateDestinationArray(xRefTable *XRefTable, arr *PDFArray) error {
+func validateDestinationArray(xRefTable *XRefTable, arr *PDFArray, remote bool) error {
 
 	// Validate first element: indRef of page dict or pageNumber(int) of remote doc for remote Go-to Action or nil.
 
-	obj, err := validateDestinationArrayFirstElement(xRefTable, arr)
+	obj, err := validateDestinationArrayFirstElement(xRefTable, arr, remote)
 	if err != nil || obj == nil {
 		return err
 	}
@@ -99,7 +117,7 @@ func validateDestinationArray(xRefTable *XRefTable, arr *PDFArray) error {
 	return nil
 }
 
-func validateDestinationDict(xRefTable *XRefTable, dict *PDFDict) error {
+func validateDestinationDict(xRefTable *XRefTable, dict *PDFDict, remote bool) error {
 
 	// D, required, array
 	arr, err := validateArrayEntry(xRefTable, dict, "DestinationDict", "D", REQUIRED, V10, nil)
@@ -107,10 +125,10 @@ func validateDestinationDict(xRefTable *XRefTable, dict *PDFDict) error {
 		return err
 	}
 
-	return validateDestinationArray(xRefTable, arr)
+	return validateDestinationArray(xRefTable, arr, remote)
 }
 
-func validateDestination(xRefTable *XRefTable, obj PDFObject) error {
+func validateDestination(xRefTable *XRefTable, obj PDFObject, remote bool) error {
 
 	obj, err := xRefTable.Dereference(obj)
 	if err != nil || obj == nil {
@@ -126,10 +144,10 @@ func validateDestination(xRefTable *XRefTable, obj PDFObject) error {
 		// no further processing.
 
 	case PDFDict:
-		err = validateDestinationDict(xRefTable, &obj)
+		err = validateDestinationDict(xRefTable, &obj, remote)
 
 	case PDFArray:
-		err = validateDestinationArray(xRefTable, &obj)
+		err = validateDestinationArray(xRefTable, &obj, remote)
 
 	default:
 		err = errors.New("validateDestination: unsupported PDF object")
@@ -139,7 +157,7 @@ func validateDestination(xRefTable *XRefTable, obj PDFObject) error {
 	return err
 }
 
-func validateDestinationEntry(xRefTable *XRefTable, dict *PDFDict, dictName string, entryName string, required bool, sinceVersion PDFVersion) error {
+func validateDestinationEntry(xRefTable *XRefTable, dict *PDFDict, dictName string, entryName string, required bool, sinceVersion PDFVersion, remote bool) error {
 
 	// see 12.3.2
 
@@ -148,5 +166,5 @@ func validateDestinationEntry(xRefTable *XRefTable, dict *PDFDict, dictName stri
 		return err
 	}
 
-	return validateDestination(xRefTable, obj)
+	return validateDestination(xRefTable, obj, remote)
 }
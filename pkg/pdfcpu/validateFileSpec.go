@@ -17,8 +17,13 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"bytes"
+	"crypto/md5"
 	"net/url"
+	"strings"
+	"unicode"
 
+	"github.com/hhrutter/pdfcpu/pkg/log"
 	"github.com/pkg/errors"
 )
 
@@ -143,11 +148,45 @@ func validateEmbeddedFileStreamDict(xRefTable *XRefTable, sd *PDFStreamDict) err
 		if err != nil {
 			return err
 		}
+		return validateEmbeddedFileStreamCheckSum(xRefTable, sd, obj)
 	}
 
 	return nil
 }
 
+// validateEmbeddedFileStreamCheckSum verifies the MD5 checksum of an embedded file if present.
+func validateEmbeddedFileStreamCheckSum(xRefTable *XRefTable, sd *PDFStreamDict, params PDFObject) error {
+
+	dict, err := xRefTable.DereferenceDict(params)
+	if err != nil || dict == nil {
+		return err
+	}
+
+	obj, err := xRefTable.Dereference(dict.Dict["CheckSum"])
+	if err != nil || obj == nil {
+		return err
+	}
+
+	checkSum, err := stringBytes(obj)
+	if err != nil {
+		return err
+	}
+
+	content, err := streamContent(sd)
+	if err != nil {
+		// We cannot verify what we cannot decode.
+		log.Debug.Printf("validateEmbeddedFileStreamCheckSum: skipping: %v\n", err)
+		return nil
+	}
+
+	sum := md5.Sum(content)
+	if bytes.Equal(checkSum, sum[:]) {
+		return nil
+	}
+
+	return xRefTable.reportNonFatal("validateEmbeddedFileStreamCheckSum: embedded file checksum mismatch: %x", checkSum)
+}
+
 func validateFileSpecDictEntriesEFAndRFKeys(k string) bool {
 	return k == "F" || k == "UF" || k == "DOS" || k == "Mac" || k == "Unix"
 }
@@ -463,6 +502,65 @@ func validateURLSpecification(xRefTable *XRefTable, obj PDFObject) (PDFObject, e
 	return obj, err
 }
 
+// fileSpecFileNames returns the file names of the local file specification obj.
+func fileSpecFileNames(xRefTable *XRefTable, obj PDFObject) []string {
+
+	obj, err := xRefTable.Dereference(obj)
+	if err != nil || obj == nil {
+		return nil
+	}
+
+	if d, ok := obj.(PDFDict); ok {
+
+		if fs := d.NameEntry("FS"); fs != nil && *fs == "URL" {
+			return nil
+		}
+
+		var ss []string
+
+		for _, k := range []string{"UF", "F", "DOS", "Mac", "Unix"} {
+			if b, err := stringBytes(d.Dict[k]); err == nil {
+				ss = append(ss, string(b))
+			}
+		}
+
+		return ss
+	}
+
+	if b, err := stringBytes(obj); err == nil {
+		return []string{string(b)}
+	}
+
+	return nil
+}
+
+// isAbsoluteFilePath returns true for a file name denoting an absolute path, see 7.11.2
+// This covers the PDF file specification string form as well as DOS drive letters and UNC paths.
+func isAbsoluteFilePath(s string) bool {
+
+	if strings.HasPrefix(s, "/") || strings.HasPrefix(s, `\`) || strings.HasPrefix(strings.ToLower(s), "file:") {
+		return true
+	}
+
+	return len(s) > 2 && s[1] == ':' && (s[2] == '\\' || s[2] == '/') && unicode.IsLetter(rune(s[0]))
+}
+
+// checkAbsoluteFileSpecEntry warns in relaxed mode about file specification entryName of dict referring to an absolute path.
+// Files referenced this way may expose the layout of the authoring file system and are not portable.
+func checkAbsoluteFileSpecEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string) {
+
+	if xRefTable.ValidationMode == ValidationStrict {
+		return
+	}
+
+	for _, s := range fileSpecFileNames(xRefTable, dict.Dict[entryName]) {
+		if isAbsoluteFilePath(s) {
+			xRefTable.addWarning("checkAbsoluteFileSpecEntry: dict=%s entry=%s refers to absolute file path: %s", dictName, entryName, s)
+			return
+		}
+	}
+}
+
 func validateFileSpecEntry(xRefTable *XRefTable, dict *PDFDict, dictName string, entryName string, required bool, sinceVersion PDFVersion) (PDFObject, error) {
 
 	obj, err := validateEntry(xRefTable, dict, dictName, entryName, required, sinceVersion)
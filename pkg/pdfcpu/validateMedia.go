@@ -16,6 +16,8 @@ limitations under the License.
 
 package pdfcpu
 
+import "github.com/pkg/errors"
+
 func validateMinimumBitDepthDict(xRefTable *XRefTable, dict *PDFDict, sinceVersion PDFVersion) error {
 
 	// see table 269
@@ -1092,3 +1094,210 @@ func validateRenditionDict(xRefTable *XRefTable, dict *PDFDict, sinceVersion PDF
 
 	return
 }
+
+func validateRichMediaAssets(xRefTable *XRefTable, dict *PDFDict, dictName string, sinceVersion PDFVersion) error {
+
+	// Assets, optional, name tree of embedded file specifications
+	obj, found := dict.Find("Assets")
+	if !found || obj == nil {
+		return nil
+	}
+
+	if indRef, ok := obj.(PDFIndirectRef); ok {
+		_, _, _, err := validateNameTree(xRefTable, "RichMediaAssets", indRef, true)
+		return err
+	}
+
+	d, ok := obj.(PDFDict)
+	if !ok {
+		return errors.Errorf("validateRichMediaAssets: dict=%s corrupt entry \"Assets\"", dictName)
+	}
+
+	arr, err := validateArrayEntry(xRefTable, &d, "richMediaAssetsDict", "Kids", OPTIONAL, sinceVersion, nil)
+	if err != nil {
+		return err
+	}
+
+	if arr == nil {
+		_, _, err = validateNameTreeDictNamesEntry(xRefTable, &d, "RichMediaAssets", &Node{})
+		return err
+	}
+
+	for _, obj := range *arr {
+
+		kid, ok := obj.(PDFIndirectRef)
+		if !ok {
+			return errors.New("validateRichMediaAssets: corrupt kid, should be indirect reference")
+		}
+
+		_, _, _, err = validateNameTree(xRefTable, "RichMediaAssets", kid, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRichMediaConfigurationDict(xRefTable *XRefTable, dict *PDFDict, sinceVersion PDFVersion) error {
+
+	dictName := "richMediaConfigurationDict"
+
+	// Type, optional, name
+	_, err := validateNameEntry(xRefTable, dict, dictName, "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "RichMediaConfiguration" })
+	if err != nil {
+		return err
+	}
+
+	// Subtype, optional, name
+	validateSubtype := func(s string) bool { return memberOf(s, []string{"3D", "Flash", "Sound", "Video"}) }
+	_, err = validateNameEntry(xRefTable, dict, dictName, "Subtype", OPTIONAL, sinceVersion, validateSubtype)
+	if err != nil {
+		return err
+	}
+
+	// Name, optional, text string
+	_, err = validateStringEntry(xRefTable, dict, dictName, "Name", OPTIONAL, sinceVersion, nil)
+	if err != nil {
+		return err
+	}
+
+	// Instances, optional, array of RichMedia instance dicts
+	arr, err := validateArrayEntry(xRefTable, dict, dictName, "Instances", OPTIONAL, sinceVersion, nil)
+	if err != nil || arr == nil {
+		return err
+	}
+
+	for _, obj := range *arr {
+
+		d, err := xRefTable.DereferenceDict(obj)
+		if err != nil {
+			return err
+		}
+
+		if d == nil {
+			return errors.New("validateRichMediaConfigurationDict: corrupt instance dict")
+		}
+
+		// Type, optional, name
+		_, err = validateNameEntry(xRefTable, d, "richMediaInstanceDict", "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "RichMediaInstance" })
+		if err != nil {
+			return err
+		}
+
+		// Subtype, optional, name
+		_, err = validateNameEntry(xRefTable, d, "richMediaInstanceDict", "Subtype", OPTIONAL, sinceVersion, validateSubtype)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRichMediaContentDict(xRefTable *XRefTable, dict *PDFDict, sinceVersion PDFVersion) error {
+
+	dictName := "richMediaContentDict"
+
+	// Type, optional, name
+	_, err := validateNameEntry(xRefTable, dict, dictName, "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "RichMediaContent" })
+	if err != nil {
+		return err
+	}
+
+	// Assets, optional, name tree
+	err = validateRichMediaAssets(xRefTable, dict, dictName, sinceVersion)
+	if err != nil {
+		return err
+	}
+
+	// Configurations, optional, array of RichMedia configuration dicts
+	arr, err := validateArrayEntry(xRefTable, dict, dictName, "Configurations", OPTIONAL, sinceVersion, nil)
+	if err != nil {
+		return err
+	}
+
+	if arr != nil {
+
+		for _, obj := range *arr {
+
+			d, err := xRefTable.DereferenceDict(obj)
+			if err != nil {
+				return err
+			}
+
+			if d == nil {
+				return errors.New("validateRichMediaContentDict: corrupt configuration dict")
+			}
+
+			err = validateRichMediaConfigurationDict(xRefTable, d, sinceVersion)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Views, optional, array of 3D view dicts
+	_, err = validateArrayEntry(xRefTable, dict, dictName, "Views", OPTIONAL, sinceVersion, nil)
+
+	return err
+}
+
+func validateRichMediaSettingsDict(xRefTable *XRefTable, dict *PDFDict, sinceVersion PDFVersion) error {
+
+	dictName := "richMediaSettingsDict"
+
+	// Type, optional, name
+	_, err := validateNameEntry(xRefTable, dict, dictName, "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "RichMediaSettings" })
+	if err != nil {
+		return err
+	}
+
+	// Activation, optional, RichMedia activation dict
+	d, err := validateDictEntry(xRefTable, dict, dictName, "Activation", OPTIONAL, sinceVersion, nil)
+	if err != nil {
+		return err
+	}
+
+	if d != nil {
+
+		_, err = validateNameEntry(xRefTable, d, "richMediaActivationDict", "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "RichMediaActivation" })
+		if err != nil {
+			return err
+		}
+
+		// Condition, optional, name
+		_, err = validateNameEntry(xRefTable, d, "richMediaActivationDict", "Condition", OPTIONAL, sinceVersion, func(s string) bool { return memberOf(s, []string{"XA", "PO", "PV"}) })
+		if err != nil {
+			return err
+		}
+
+		// Configuration, optional, RichMedia configuration dict
+		_, err = validateDictEntry(xRefTable, d, "richMediaActivationDict", "Configuration", OPTIONAL, sinceVersion, nil)
+		if err != nil {
+			return err
+		}
+
+		// Scripts, optional, array of file specifications
+		_, err = validateArrayEntry(xRefTable, d, "richMediaActivationDict", "Scripts", OPTIONAL, sinceVersion, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Deactivation, optional, RichMedia deactivation dict
+	d, err = validateDictEntry(xRefTable, dict, dictName, "Deactivation", OPTIONAL, sinceVersion, nil)
+	if err != nil || d == nil {
+		return err
+	}
+
+	_, err = validateNameEntry(xRefTable, d, "richMediaDeactivationDict", "Type", OPTIONAL, sinceVersion, func(s string) bool { return s == "RichMediaDeactivation" })
+	if err != nil {
+		return err
+	}
+
+	// Condition, optional, name
+	_, err = validateNameEntry(xRefTable, d, "richMediaDeactivationDict", "Condition", OPTIONAL, sinceVersion, func(s string) bool { return memberOf(s, []string{"XD", "PC", "PI"}) })
+
+	return err
+}
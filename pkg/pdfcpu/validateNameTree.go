@@ -22,7 +22,7 @@ import (
 
 func validateDestsNameTreeValue(xRefTable *XRefTable, obj PDFObject, sinceVersion PDFVersion) error {
 
-	return validateDestination(xRefTable, obj)
+	return validateDestination(xRefTable, obj, false)
 }
 
 func validateAPNameTreeValue(xRefTable *XRefTable, obj PDFObject, sinceVersion PDFVersion) error {
@@ -511,6 +511,7 @@ func validateNameTreeValue(name string, xRefTable *XRefTable, obj PDFObject) (er
 		"AlternatePresentations": {validateAlternatePresentationsNameTreeValue, V14},
 		"Renditions":             {validateRenditionsNameTreeValue, V15},
 		"IDTree":                 {validateIDTreeValue, V13},
+		"RichMediaAssets":        {validateEmbeddedFilesNameTreeValue, V17},
 	} {
 		if name == k {
 
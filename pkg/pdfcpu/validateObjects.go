@@ -216,7 +216,12 @@ func validateDateEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName
 
 	// Validation
 	if ok := validateDate(date.Value()); !ok {
-		return nil, errors.Errorf("validateDateEntry: dict=%s entry=%s invalid dict entry", dictName, entryName)
+		if !validateDate(relaxedDate(date.Value())) {
+			return nil, errors.Errorf("validateDateEntry: dict=%s entry=%s invalid dict entry", dictName, entryName)
+		}
+		if err = xRefTable.reportNonFatal("validateDateEntry: dict=%s entry=%s non-conforming date: %s", dictName, entryName, date.Value()); err != nil {
+			return nil, err
+		}
 	}
 
 	log.Debug.Printf("validateDateEntry end: entry=%s\n", entryName)
@@ -1071,6 +1076,21 @@ func validateStringEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryNam
 	return &s, nil
 }
 
+// validateRequiredStringEntryWithFallback validates a required string entry.
+// In relaxed mode a missing entry gets reported as warning and fixed by inserting fallback.
+func validateRequiredStringEntryWithFallback(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, sinceVersion PDFVersion, validate func(string) bool, fallback string) (*string, error) {
+
+	if xRefTable.ValidationMode == ValidationRelaxed {
+		if obj, found := dict.Find(entryName); !found || obj == nil {
+			xRefTable.addWarning("validateStringEntry: dict=%s required entry=%s missing, using %q", dictName, entryName, fallback)
+			dict.Update(entryName, PDFStringLiteral(fallback))
+			return &fallback, nil
+		}
+	}
+
+	return validateStringEntry(xRefTable, dict, dictName, entryName, REQUIRED, sinceVersion, validate)
+}
+
 func validateStringArrayEntry(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, required bool, sinceVersion PDFVersion, validate func(PDFArray) bool) (*PDFArray, error) {
 
 	log.Debug.Printf("validateStringArrayEntry begin: entry=%s\n", entryName)
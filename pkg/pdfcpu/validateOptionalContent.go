@@ -232,9 +232,17 @@ func validateOptionalContentMembershipDict(xRefTable *XRefTable, dict *PDFDict,
 	}
 
 	// VE, optional, array, since V1.6
-	_, err = validateArrayEntry(xRefTable, dict, dictName, "VE", OPTIONAL, V16, nil)
+	arr, err := validateArrayEntry(xRefTable, dict, dictName, "VE", OPTIONAL, V16, nil)
+	if err != nil || arr == nil || len(*arr) == 0 {
+		return err
+	}
 
-	return err
+	_, err = visibilityExpression(xRefTable, *arr, nil, IntSet{})
+	if err != nil {
+		return errors.Wrapf(err, "validateOptionalContentMembershipDict: dict=%s entry=VE", dictName)
+	}
+
+	return nil
 }
 
 func validateOptionalContent(xRefTable *XRefTable, dict *PDFDict, dictName, entryName string, required bool, sinceVersion PDFVersion) error {
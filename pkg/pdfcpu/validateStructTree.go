@@ -692,3 +692,118 @@ func validateStructTree(xRefTable *XRefTable, rootDict *PDFDict, required bool,
 
 	return nil
 }
+
+// annotationStructTypes are the standard structure types of structure elements enclosing annotations, see 14.8.4.4
+var annotationStructTypes = []string{"Annot", "Form", "Link"}
+
+// numberTreeValue returns the value for key of the number tree rooted at obj.
+func numberTreeValue(xRefTable *XRefTable, obj PDFObject, key int, visited IntSet) (PDFObject, error) {
+
+	if indRef, ok := obj.(PDFIndirectRef); ok {
+		if visited[indRef.ObjectNumber.Value()] {
+			return nil, errors.New("numberTreeValue: cycle detected")
+		}
+		visited[indRef.ObjectNumber.Value()] = true
+	}
+
+	d, err := xRefTable.DereferenceDict(obj)
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	if arr, err := xRefTable.DereferenceArray(d.Dict["Nums"]); err != nil || arr != nil {
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(*arr); i += 2 {
+			if k, ok := (*arr)[i].(PDFInteger); ok && k.Value() == key {
+				return (*arr)[i+1], nil
+			}
+		}
+		return nil, nil
+	}
+
+	kids, err := xRefTable.DereferenceArray(d.Dict["Kids"])
+	if err != nil || kids == nil {
+		return nil, err
+	}
+
+	for _, kid := range *kids {
+		v, err := numberTreeValue(xRefTable, kid, key, visited)
+		if err != nil || v != nil {
+			return v, err
+		}
+	}
+
+	return nil, nil
+}
+
+// standardStructType returns the structure type s maps to using the role map of the structure tree root.
+func standardStructType(xRefTable *XRefTable, roleMap *PDFDict, s string) string {
+
+	if roleMap == nil {
+		return s
+	}
+
+	visited := map[string]bool{}
+
+	for !visited[s] {
+		visited[s] = true
+		obj, found := roleMap.Find(s)
+		if !found {
+			break
+		}
+		o, err := xRefTable.Dereference(obj)
+		if err != nil {
+			break
+		}
+		n, ok := o.(PDFName)
+		if !ok {
+			break
+		}
+		s = n.Value()
+	}
+
+	return s
+}
+
+// validateAnnotationStructParent checks that the structure element the StructParent key of an annotation of a tagged PDF
+// refers to via the parent tree is of a structure type suitable for annotations.
+func validateAnnotationStructParent(xRefTable *XRefTable, dictName string, key int) error {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	structTreeRoot, err := xRefTable.DereferenceDict(rootDict.Dict["StructTreeRoot"])
+	if err != nil || structTreeRoot == nil {
+		return err
+	}
+
+	obj, err := numberTreeValue(xRefTable, structTreeRoot.Dict["ParentTree"], key, IntSet{})
+	if err != nil {
+		return err
+	}
+
+	d, err := xRefTable.DereferenceDict(obj)
+	if err != nil || d == nil {
+		return xRefTable.reportNonFatal("validateAnnotationStructParent: dict=%s entry=StructParent %d does not refer to a structure element", dictName, key)
+	}
+
+	s := d.NameEntry("S")
+	if s == nil {
+		return nil
+	}
+
+	roleMap, err := xRefTable.DereferenceDict(structTreeRoot.Dict["RoleMap"])
+	if err != nil {
+		return err
+	}
+
+	if st := standardStructType(xRefTable, roleMap, *s); !memberOf(st, annotationStructTypes) {
+		return xRefTable.reportNonFatal("validateAnnotationStructParent: dict=%s entry=StructParent %d: unsuitable structure type %s", dictName, key, st)
+	}
+
+	return nil
+}
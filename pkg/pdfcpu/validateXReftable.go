@@ -159,7 +159,7 @@ func validateNamedDestinations(xRefTable *XRefTable, rootDict *PDFDict, required
 	}
 
 	for _, value := range dict.Dict {
-		err = validateDestination(xRefTable, value)
+		err = validateDestination(xRefTable, value, false)
 		if err != nil {
 			return err
 		}
@@ -269,7 +269,7 @@ func validateOpenAction(xRefTable *XRefTable, rootDict *PDFDict, required bool,
 		err = validateActionDict(xRefTable, &obj)
 
 	case PDFArray:
-		err = validateDestinationArray(xRefTable, &obj)
+		err = validateDestinationArray(xRefTable, &obj, false)
 
 	default:
 		err = errors.New("validateOpenAction: unexpected object")
@@ -908,7 +908,8 @@ func validateRootObject(xRefTable *XRefTable) error {
 	}
 
 	// Validate remainder of annotations after AcroForm validation only.
-	err = validatePagesAnnotations(xRefTable, rootPageNodeDict)
+	curPage := 0
+	err = validatePagesAnnotations(xRefTable, rootPageNodeDict, &curPage)
 
 	log.Debug.Println("*** validateRootObject end ***")
 
@@ -16,7 +16,10 @@ limitations under the License.
 
 package pdfcpu
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func doTestValidateDateOK(s string, t *testing.T) {
 
@@ -83,3 +86,99 @@ func TestValidateDateCommand(t *testing.T) {
 	s = "D:20170430155901+66'A9'"
 	doTestValidateDateFail(s, t)
 }
+
+func TestParsePDFDate(t *testing.T) {
+
+	for _, tt := range []struct {
+		s       string
+		relaxed bool   // only valid in relaxed mode
+		utc     string // empty for invalid dates
+		offset  int    // timezone offset in seconds
+	}{
+		{"D:2017", false, "2017-01-01T00:00:00Z", 0},
+		{"D:20170430", false, "2017-04-30T00:00:00Z", 0},
+		{"D:201704301559", false, "2017-04-30T15:59:00Z", 0},
+		{"D:20170430155901Z", false, "2017-04-30T15:59:01Z", 0},
+		{"D:20170430155901Z00'00'", false, "2017-04-30T15:59:01Z", 0},
+		{"D:20170430155901+05'30'", false, "2017-04-30T10:29:01Z", 19800},
+		{"D:20170430155901-08'00'", false, "2017-04-30T23:59:01Z", -28800},
+		{"D:20171231230000-02'", false, "2018-01-01T01:00:00Z", -7200},
+		{"D:20170101003000+01'00'", false, "2016-12-31T23:30:00Z", 3600},
+		{"D:20170430155901+05'30", true, "2017-04-30T10:29:01Z", 19800},
+		{"D:20170430155901+0530", true, "2017-04-30T10:29:01Z", 19800},
+		{"D:20170430155901-08", true, "2017-04-30T23:59:01Z", -28800},
+		{"20170430155901+05'30'", true, "2017-04-30T10:29:01Z", 19800},
+		{"20170430", true, "2017-04-30T00:00:00Z", 0},
+		{"D:20170430155901Z01'00'", false, "", 0},
+		{"D:20170430155901+24'00'", false, "", 0},
+		{"D:20170430155901+05'60'", false, "", 0},
+		{"D:20170431", false, "", 0},
+		{"D:20170430155901+053", false, "", 0},
+	} {
+
+		got, err := ParsePDFDate(tt.s)
+
+		if tt.relaxed || tt.utc == "" {
+			if err == nil {
+				t.Errorf("TestParsePDFDate(%s): expected strict parsing error\n", tt.s)
+			}
+		} else if err != nil {
+			t.Errorf("TestParsePDFDate(%s): %v\n", tt.s, err)
+		}
+
+		if !tt.relaxed {
+			if tt.utc != "" {
+				if s := got.UTC().Format(time.RFC3339); s != tt.utc {
+					t.Errorf("TestParsePDFDate(%s): want %s, got %s\n", tt.s, tt.utc, s)
+				}
+			}
+			continue
+		}
+
+		d := NewPDFDict()
+		d.InsertString("M", tt.s)
+
+		got, found, err := AnnotationModified(&d)
+		if err != nil || !found {
+			t.Errorf("TestParsePDFDate(%s): relaxed: found=%t %v\n", tt.s, found, err)
+			continue
+		}
+
+		if s := got.UTC().Format(time.RFC3339); s != tt.utc {
+			t.Errorf("TestParsePDFDate(%s): relaxed: want %s, got %s\n", tt.s, tt.utc, s)
+		}
+
+		if _, offset := got.Zone(); offset != tt.offset {
+			t.Errorf("TestParsePDFDate(%s): relaxed: want offset %d, got %d\n", tt.s, tt.offset, offset)
+		}
+	}
+}
+
+func TestAnnotationCreated(t *testing.T) {
+
+	d := NewPDFDict()
+
+	if _, found, err := AnnotationCreated(&d); found || err != nil {
+		t.Fatalf("TestAnnotationCreated: want missing CreationDate, got found=%t %v\n", found, err)
+	}
+
+	d.Insert("CreationDate", PDFInteger(2017))
+	if _, _, err := AnnotationCreated(&d); err == nil {
+		t.Fatalf("TestAnnotationCreated: expected error for non string date\n")
+	}
+
+	d.Update("CreationDate", PDFStringLiteral("yesterday"))
+	if _, found, err := AnnotationCreated(&d); !found || err == nil {
+		t.Fatalf("TestAnnotationCreated: expected error for invalid date\n")
+	}
+
+	d.Update("CreationDate", PDFStringLiteral("D:20180102030405-03'30'"))
+	got, _, err := AnnotationCreated(&d)
+	if err != nil {
+		t.Fatalf("TestAnnotationCreated: %v\n", err)
+	}
+
+	if want := time.Date(2018, 1, 2, 6, 34, 5, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("TestAnnotationCreated: want %s, got %s\n", want, got)
+	}
+}
@@ -17,7 +17,7 @@ const (
 // PDFVersion is a type for the internal representation of PDF versions.
 type PDFVersion int
 
-// Constants for all PDF versions up to v1.7
+// Constants for all PDF versions up to v2.0
 const (
 	V10 PDFVersion = iota
 	V11
@@ -27,6 +27,7 @@ const (
 	V15
 	V16
 	V17
+	V20
 )
 
 // Version returns the PDFVersion for a version string.
@@ -49,6 +50,8 @@ func Version(versionStr string) (PDFVersion, error) {
 		return V16, nil
 	case "1.7":
 		return V17, nil
+	case "2.0":
+		return V20, nil
 	}
 
 	return -1, errors.New(versionStr)
@@ -56,5 +59,8 @@ func Version(versionStr string) (PDFVersion, error) {
 
 // VersionString returns a string representation for a given PDFVersion.
 func VersionString(version PDFVersion) string {
+	if version == V20 {
+		return "2.0"
+	}
 	return "1." + fmt.Sprintf("%d", version)
 }
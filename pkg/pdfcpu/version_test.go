@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersion20(t *testing.T) {
+
+	v, err := Version("2.0")
+	if err != nil || v != V20 {
+		t.Fatalf("TestVersion20: Version(\"2.0\") = %v, %v\n", v, err)
+	}
+
+	if s := VersionString(V20); s != "2.0" {
+		t.Fatalf("TestVersion20: VersionString(V20) = %s\n", s)
+	}
+
+	hv, err := headerVersion(strings.NewReader("%PDF-2.0\n%âãÏÓ\n"))
+	if err != nil || *hv != V20 {
+		t.Fatalf("TestVersion20: headerVersion: %v, %v\n", hv, err)
+	}
+
+	xRefTable := createAnnotTestXRef(t, 1)
+	xRefTable.HeaderVersion = hv
+
+	// V1.7 features are valid in PDF 2.0 documents.
+	redact := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":       PDFName("Annot"),
+			"Subtype":    PDFName("Redact"),
+			"Rect":       NewRectangle(10, 10, 100, 30),
+			"QuadPoints": NewNumberArray(10, 30, 100, 30, 10, 10, 100, 10),
+			"DA":         PDFStringLiteral("/Helv 10 Tf 0 g"),
+		},
+	}
+	doTestValidateAnnotOK(t, xRefTable, redact, ValidationStrict)
+
+	polygon := PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":     PDFName("Annot"),
+			"Subtype":  PDFName("Polygon"),
+			"Rect":     NewRectangle(10, 10, 100, 100),
+			"Vertices": NewNumberArray(10, 10, 100, 10, 55, 100),
+			"IT":       PDFName("PolygonDimension"),
+		},
+	}
+	doTestValidateAnnotOK(t, xRefTable, polygon, ValidationStrict)
+
+	// Relaxed mode accepts V2.0 features in PDF 1.7 documents.
+	v = V17
+	xRefTable.HeaderVersion = &v
+
+	xRefTable.ValidationMode = ValidationStrict
+	if err = xRefTable.ValidateVersion("feature", V20); err == nil {
+		t.Errorf("TestVersion20: expected error for V2.0 feature in strict mode\n")
+	}
+
+	xRefTable.ValidationMode = ValidationRelaxed
+	if err = xRefTable.ValidateVersion("feature", V20); err != nil {
+		t.Errorf("TestVersion20: %v\n", err)
+	}
+
+	v = V16
+	if err = xRefTable.ValidateVersion("feature", V20); err == nil {
+		t.Errorf("TestVersion20: expected error for V2.0 feature in a V1.6 document\n")
+	}
+}
@@ -0,0 +1,553 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hhrutter/pdfcpu/pkg/fonts/metrics"
+	"github.com/pkg/errors"
+)
+
+// Generation of appearance streams for widget annotations, see 12.7.3.3
+
+// Field flags relevant for button fields, see table 226
+const (
+	fieldFlagRadio      = 1 << 15
+	fieldFlagPushbutton = 1 << 16
+)
+
+// colorOperator returns the content stream operator setting the color c of a MK color array.
+// Returns "" for a missing or transparent color.
+func colorOperator(xRefTable *XRefTable, obj PDFObject, stroke bool) string {
+
+	c, err := numbers(xRefTable, obj)
+	if err != nil {
+		return ""
+	}
+
+	var op string
+
+	switch len(c) {
+	case 1:
+		op = "g"
+	case 3:
+		op = "rg"
+	case 4:
+		op = "k"
+	default:
+		return ""
+	}
+
+	if stroke {
+		op = strings.ToUpper(op)
+	}
+
+	var b bytes.Buffer
+	for _, f := range c {
+		fmt.Fprintf(&b, "%.3f ", f)
+	}
+	b.WriteString(op)
+
+	return b.String()
+}
+
+// widgetBorderWidth returns the border width of a widget, see 12.5.4
+func widgetBorderWidth(xRefTable *XRefTable, dict *PDFDict) float64 {
+
+	if bs, err := xRefTable.DereferenceDict(dict.Dict["BS"]); err == nil && bs != nil {
+		if w, found := bs.Find("W"); found && w != nil {
+			return xRefTable.DereferenceNumber(w)
+		}
+	}
+
+	if f, err := numbers(xRefTable, dict.Dict["Border"]); err == nil && len(f) >= 3 {
+		return f[2]
+	}
+
+	return 1
+}
+
+// widgetBackground returns the content drawing the background BG and the border BC of the MK dict mk.
+func widgetBackground(xRefTable *XRefTable, mk *PDFDict, bw, w, h float64) string {
+
+	if mk == nil {
+		return ""
+	}
+
+	var b bytes.Buffer
+
+	if op := colorOperator(xRefTable, mk.Dict["BG"], false); op != "" {
+		fmt.Fprintf(&b, "q %s 0 0 %.2f %.2f re f Q\n", op, w, h)
+	}
+
+	if op := colorOperator(xRefTable, mk.Dict["BC"], true); op != "" && bw > 0 {
+		fmt.Fprintf(&b, "q %s %.2f w %.2f %.2f %.2f %.2f re S Q\n", op, bw, bw/2, bw/2, w-bw, h-bw)
+	}
+
+	return b.String()
+}
+
+// widgetFont returns the font for the font resource name fontName of a widget's DA along with the name of the font metrics to use.
+// The font gets looked up in the default resources of the interactive form falling back to font
+// and finally to Helvetica.
+func widgetFont(xRefTable *XRefTable, fontName string, font PDFObject) (PDFObject, string, error) {
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var fontObj PDFObject
+
+	acroForm, err := xRefTable.DereferenceDict(rootDict.Dict["AcroForm"])
+	if err != nil {
+		return nil, "", err
+	}
+
+	if acroForm != nil {
+		if dr, err := xRefTable.DereferenceDict(acroForm.Dict["DR"]); err == nil && dr != nil {
+			if fonts, err := xRefTable.DereferenceDict(dr.Dict["Font"]); err == nil && fonts != nil {
+				fontObj = fonts.Dict[fontName]
+			}
+		}
+	}
+
+	if fontObj == nil {
+		fontObj = font
+	}
+
+	if fontObj == nil {
+		d := NewPDFDict()
+		d.InsertName("Type", "Font")
+		d.InsertName("Subtype", "Type1")
+		d.InsertName("BaseFont", "Helvetica")
+		fontObj = d
+	}
+
+	// Use Helvetica metrics for fonts we have no metrics for.
+	metricsName := "Helvetica"
+
+	if d, err := xRefTable.DereferenceDict(fontObj); err == nil && d != nil {
+		if bf := d.NameEntry("BaseFont"); bf != nil && memberOf(*bf, metrics.FontNames()) {
+			metricsName = *bf
+		}
+	}
+
+	return fontObj, metricsName, nil
+}
+
+// textWidth returns the width of s using the metrics of fontName at fontSize.
+func textWidth(s []byte, fontName string, fontSize float64) float64 {
+	return metrics.TextWidth(string(s), fontName, 1000) * fontSize / 1000
+}
+
+// pdfDocBytes returns the bytes of the text string obj suitable for a simple font.
+// Characters not representable in a single byte get replaced by '?'.
+func pdfDocBytes(obj PDFObject) []byte {
+
+	runes, err := textStringRunes(obj)
+	if err != nil {
+		return nil
+	}
+
+	return singleByteRunes(runes)
+}
+
+// singleByteRunes returns runes as bytes suitable for a simple font.
+// Characters not representable in a single byte get replaced by '?'.
+func singleByteRunes(runes []rune) []byte {
+
+	b := make([]byte, len(runes))
+	for i, r := range runes {
+		if r > 255 {
+			r = '?'
+		}
+		b[i] = byte(r)
+	}
+
+	return b
+}
+
+// newWidgetForm creates a form XObject of size w x h for content.
+func newWidgetForm(xRefTable *XRefTable, w, h float64, content string, resources *PDFDict) (*PDFIndirectRef, error) {
+
+	sd := &PDFStreamDict{
+		PDFDict: PDFDict{
+			Dict: map[string]PDFObject{
+				"Type":     PDFName("XObject"),
+				"Subtype":  PDFName("Form"),
+				"FormType": PDFInteger(1),
+				"BBox":     NewRectangle(0, 0, w, h),
+				"Matrix":   NewIntegerArray(1, 0, 0, 1, 0, 0),
+			},
+		},
+		Content: []byte(content),
+	}
+
+	if resources != nil {
+		sd.Insert("Resources", *resources)
+	}
+
+	err := encodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return xRefTable.IndRefForNewObject(*sd)
+}
+
+// widgetObjNr returns the object number of the widget annotation dict or 0 for a direct dict.
+// The object number only matters for the annotation change log.
+func widgetObjNr(xRefTable *XRefTable, dict *PDFDict) int {
+
+	if xRefTable.annotChanges == nil {
+		return 0
+	}
+
+	p := reflect.ValueOf(dict.Dict).Pointer()
+
+	for objNr, entry := range xRefTable.Table {
+		if d, ok := entry.Object.(PDFDict); ok && !entry.Free && reflect.ValueOf(d.Dict).Pointer() == p {
+			return objNr
+		}
+	}
+
+	return 0
+}
+
+// setWidgetAppearance replaces the appearance dict of widget obj#objNr by ap
+// and frees the previous appearance streams no longer referenced.
+func setWidgetAppearance(xRefTable *XRefTable, objNr int, dict *PDFDict, ap PDFDict) error {
+
+	candidates := IntSet{}
+
+	if indRef, ok := dict.Dict["AP"].(PDFIndirectRef); ok {
+		candidates[indRef.ObjectNumber.Value()] = true
+	}
+
+	err := visitAppearanceStreams(xRefTable, dict, func(key string, indRef *PDFIndirectRef, sd *PDFStreamDict) error {
+		if indRef != nil {
+			candidates[indRef.ObjectNumber.Value()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	setAnnotationEntry(xRefTable, objNr, dict, "AP", ap)
+
+	return freeUnreferenced(xRefTable, candidates)
+}
+
+// widgetText returns the content rendering s within a w x h widget using the default appearance da.
+// A zero font size in da means auto sized text. q is the quadding of the field.
+func widgetText(s []byte, da, fontName string, w, h, bw float64, q int) string {
+
+	pad := bw + 2
+
+	m := reDAFont.FindStringSubmatch(da)
+
+	size := 0.
+	if m != nil {
+		size, _ = strconv.ParseFloat(m[2], 64)
+	}
+
+	if size <= 0 {
+		// Auto size: fit height and width.
+		size = (h - 2*pad) * 0.75
+		if tw := textWidth(s, fontName, size); tw > w-2*pad && tw > 0 {
+			size *= (w - 2*pad) / tw
+		}
+		size = math.Max(math.Floor(size*10)/10, 1)
+	}
+
+	da = reDAFont.ReplaceAllString(da, fmt.Sprintf("/${1} %.1f Tf", size))
+
+	tw := textWidth(s, fontName, size)
+
+	x := pad
+	switch q {
+	case 1:
+		x = (w - tw) / 2
+	case 2:
+		x = w - pad - tw
+	}
+
+	// Center vertically assuming a cap height of 0.7 em.
+	y := (h - size*0.7) / 2
+
+	e, _ := Escape(string(s))
+
+	return fmt.Sprintf("BT %s %.2f %.2f Td (%s) Tj ET\n", da, x, y, *e)
+}
+
+// GenerateWidgetAppearance generates the normal appearance of the pushbutton, check box or text field widget dict
+// using its MK appearance characteristics, replacing any existing appearance dict.
+// Text gets rendered using the font of the default appearance DA as defined by the default resources of the interactive form,
+// falling back to Helvetica.
+func GenerateWidgetAppearance(xRefTable *XRefTable, dict *PDFDict) error {
+	return GenerateWidgetAppearanceWithFont(xRefTable, dict, nil)
+}
+
+// GenerateWidgetAppearanceWithFont works like GenerateWidgetAppearance using font as default font
+// for captions and text whenever the default resources of the interactive form lack the font of the DA.
+func GenerateWidgetAppearanceWithFont(xRefTable *XRefTable, dict *PDFDict, font PDFObject) error {
+
+	if st := dict.Subtype(); st == nil || *st != "Widget" {
+		return errors.New("GenerateWidgetAppearance: not a widget annotation")
+	}
+
+	r, err := numbers(xRefTable, dict.Dict["Rect"])
+	if err != nil || len(r) != 4 {
+		return errors.New("GenerateWidgetAppearance: corrupt Rect")
+	}
+
+	w, h := math.Abs(r[2]-r[0]), math.Abs(r[3]-r[1])
+
+	mk, err := xRefTable.DereferenceDict(dict.Dict["MK"])
+	if err != nil {
+		return err
+	}
+
+	bw := 0.
+	if mk != nil && mk.Dict["BC"] != nil {
+		bw = widgetBorderWidth(xRefTable, dict)
+	}
+
+	background := widgetBackground(xRefTable, mk, bw, w, h)
+
+	ft, err := inheritableAttr(xRefTable, *dict, "FT")
+	if err != nil {
+		return err
+	}
+
+	ff := 0
+	if o, err := inheritableAttr(xRefTable, *dict, "Ff"); err == nil {
+		if i, ok := o.(PDFInteger); ok {
+			ff = i.Value()
+		}
+	}
+
+	fieldType, _ := ft.(PDFName)
+
+	objNr := widgetObjNr(xRefTable, dict)
+
+	switch {
+
+	case fieldType == "Btn" && ff&fieldFlagPushbutton > 0:
+		return generatePushbuttonAppearance(xRefTable, objNr, dict, mk, font, background, w, h, bw)
+
+	case fieldType == "Btn" && ff&fieldFlagRadio == 0:
+		return generateCheckBoxAppearance(xRefTable, objNr, dict, mk, background, w, h)
+
+	case fieldType == "Tx":
+		return generateTextFieldAppearance(xRefTable, objNr, dict, font, background, w, h, bw)
+
+	}
+
+	return errors.Errorf("GenerateWidgetAppearance: unsupported field type: %s", fieldType)
+}
+
+// widgetDA returns the effective default appearance of a widget and the font resource name it uses.
+func widgetDA(xRefTable *XRefTable, dict *PDFDict) (string, string, error) {
+
+	o, err := inheritableAttr(xRefTable, *dict, "DA")
+	if err != nil {
+		return "", "", err
+	}
+
+	da, err := stringValue(xRefTable, o)
+	if err != nil {
+		return "", "", err
+	}
+
+	if da == nil {
+		if da, err = defaultAppearance(xRefTable, dict); err != nil {
+			return "", "", err
+		}
+	}
+
+	if da == nil || daFontName(*da) == "" {
+		return "/Helv 0 Tf 0 g", "Helv", nil
+	}
+
+	return *da, daFontName(*da), nil
+}
+
+// widgetTextAppearance creates the form rendering text s with a background.
+func widgetTextAppearance(xRefTable *XRefTable, dict *PDFDict, font PDFObject, background string, s []byte, w, h, bw float64, q int, marked bool) (*PDFIndirectRef, error) {
+
+	da, fontName, err := widgetDA(xRefTable, dict)
+	if err != nil {
+		return nil, err
+	}
+
+	fontObj, metricsName, err := widgetFont(xRefTable, fontName, font)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := PDFDict{
+		Dict: map[string]PDFObject{
+			"Font": PDFDict{Dict: map[string]PDFObject{fontName: fontObj}},
+		},
+	}
+
+	var b bytes.Buffer
+	b.WriteString(background)
+
+	if marked {
+		b.WriteString("/Tx BMC\n")
+	}
+
+	if len(s) > 0 {
+		fmt.Fprintf(&b, "q %.2f %.2f %.2f %.2f re W n\n", bw, bw, w-2*bw, h-2*bw)
+		b.WriteString(widgetText(s, da, metricsName, w, h, bw, q))
+		b.WriteString("Q\n")
+	}
+
+	if marked {
+		b.WriteString("EMC\n")
+	}
+
+	return newWidgetForm(xRefTable, w, h, b.String(), &resources)
+}
+
+func generatePushbuttonAppearance(xRefTable *XRefTable, objNr int, dict, mk *PDFDict, font PDFObject, background string, w, h, bw float64) error {
+
+	var caption []byte
+	if mk != nil && mk.Dict["CA"] != nil {
+		caption = pdfDocBytes(mk.Dict["CA"])
+	}
+
+	indRef, err := widgetTextAppearance(xRefTable, dict, font, background, caption, w, h, bw, 1, false)
+	if err != nil {
+		return err
+	}
+
+	if _, found := dict.Find("AS"); found {
+		setAnnotationEntry(xRefTable, objNr, dict, "AS", nil)
+	}
+
+	return setWidgetAppearance(xRefTable, objNr, dict, PDFDict{Dict: map[string]PDFObject{"N": *indRef}})
+}
+
+func generateTextFieldAppearance(xRefTable *XRefTable, objNr int, dict *PDFDict, font PDFObject, background string, w, h, bw float64) error {
+
+	v, err := inheritableAttr(xRefTable, *dict, "V")
+	if err != nil {
+		return err
+	}
+
+	var s []byte
+	if v != nil {
+		s = pdfDocBytes(v)
+	}
+
+	q := 0
+	if o, err := inheritableAttr(xRefTable, *dict, "Q"); err == nil {
+		if i, ok := o.(PDFInteger); ok {
+			q = i.Value()
+		}
+	}
+
+	indRef, err := widgetTextAppearance(xRefTable, dict, font, background, s, w, h, bw, q, true)
+	if err != nil {
+		return err
+	}
+
+	return setWidgetAppearance(xRefTable, objNr, dict, PDFDict{Dict: map[string]PDFObject{"N": *indRef}})
+}
+
+func generateCheckBoxAppearance(xRefTable *XRefTable, objNr int, dict, mk *PDFDict, background string, w, h float64) error {
+
+	v, err := inheritableAttr(xRefTable, *dict, "V")
+	if err != nil {
+		return err
+	}
+
+	// The on state is named by the value or the appearance state of a checked box.
+	onState := "Yes"
+	if n, ok := v.(PDFName); ok && n != "Off" {
+		onState = n.Value()
+	} else if as := dict.NameEntry("AS"); as != nil && *as != "Off" {
+		onState = *as
+	}
+
+	// ZapfDingbats check mark.
+	symbol := []byte("4")
+	if mk != nil && mk.Dict["CA"] != nil {
+		if b := pdfDocBytes(mk.Dict["CA"]); len(b) > 0 {
+			symbol = b
+		}
+	}
+
+	zapf := NewPDFDict()
+	zapf.InsertName("Type", "Font")
+	zapf.InsertName("Subtype", "Type1")
+	zapf.InsertName("BaseFont", "ZapfDingbats")
+
+	resources := PDFDict{
+		Dict: map[string]PDFObject{
+			"Font": PDFDict{Dict: map[string]PDFObject{"ZaDb": zapf}},
+		},
+	}
+
+	// ZapfDingbats glyphs are about 0.8 em wide and 0.7 em high.
+	size := math.Min(w, h) * 0.8
+	e, _ := Escape(string(symbol))
+
+	on := background + fmt.Sprintf("q BT /ZaDb %.2f Tf 0 g %.2f %.2f Td (%s) Tj ET Q\n", size, (w-size*0.8)/2, (h-size*0.7)/2, *e)
+
+	onIndRef, err := newWidgetForm(xRefTable, w, h, on, &resources)
+	if err != nil {
+		return err
+	}
+
+	offIndRef, err := newWidgetForm(xRefTable, w, h, background, nil)
+	if err != nil {
+		return err
+	}
+
+	n := PDFDict{
+		Dict: map[string]PDFObject{
+			onState: *onIndRef,
+			"Off":   *offIndRef,
+		},
+	}
+
+	// Without a value the current appearance state remains in effect.
+	as := "Off"
+	if n, ok := v.(PDFName); ok {
+		if n.Value() == onState {
+			as = onState
+		}
+	} else if cur := dict.NameEntry("AS"); cur != nil && *cur == onState {
+		as = onState
+	}
+
+	setAnnotationEntry(xRefTable, objNr, dict, "AS", PDFName(as))
+
+	return setWidgetAppearance(xRefTable, objNr, dict, PDFDict{Dict: map[string]PDFObject{"N": n}})
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2018 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func widgetForTest(ft string, ff int, rect PDFArray) PDFDict {
+
+	return PDFDict{
+		Dict: map[string]PDFObject{
+			"Type":    PDFName("Annot"),
+			"Subtype": PDFName("Widget"),
+			"FT":      PDFName(ft),
+			"Ff":      PDFInteger(ff),
+			"T":       PDFStringLiteral(ft),
+			"Rect":    rect,
+		},
+	}
+}
+
+// widgetAppearanceForTest returns the normal appearance stream of d for appearance state as.
+func widgetAppearanceForTest(t *testing.T, xRefTable *XRefTable, d PDFDict, as string) (*PDFStreamDict, string) {
+
+	ap := d.PDFDictEntry("AP")
+	if ap == nil {
+		t.Fatalf("widgetAppearanceForTest: missing AP\n")
+	}
+
+	obj := ap.Dict["N"]
+	if as != "" {
+		n, ok := obj.(PDFDict)
+		if !ok {
+			t.Fatalf("widgetAppearanceForTest: missing appearance states\n")
+		}
+		obj = n.Dict[as]
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(obj)
+	if err != nil || sd == nil {
+		t.Fatalf("widgetAppearanceForTest: missing appearance %s: %v\n", as, err)
+	}
+
+	b, err := streamContent(sd)
+	if err != nil {
+		t.Fatalf("widgetAppearanceForTest: %v\n", err)
+	}
+
+	return sd, string(b)
+}
+
+func TestGenerateWidgetAppearance(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	// Pushbutton
+	d := widgetForTest("Btn", fieldFlagPushbutton, NewRectangle(100, 100, 200, 130))
+	d.Insert("DA", PDFStringLiteral("/Helv 12 Tf 0 g"))
+	d.Insert("MK", PDFDict{
+		Dict: map[string]PDFObject{
+			"BG": NewNumberArray(0.8),
+			"BC": NewNumberArray(0, 0, 1),
+			"CA": PDFStringLiteral("OK"),
+		},
+	})
+
+	if err := GenerateWidgetAppearance(xRefTable, &d); err != nil {
+		t.Fatalf("TestGenerateWidgetAppearance: %v\n", err)
+	}
+
+	sd, content := widgetAppearanceForTest(t, xRefTable, d, "")
+
+	if bbox, _ := numbers(xRefTable, sd.Dict["BBox"]); len(bbox) != 4 || bbox[2] != 100 || bbox[3] != 30 {
+		t.Errorf("TestGenerateWidgetAppearance: unexpected BBox: %v\n", bbox)
+	}
+
+	for _, s := range []string{"0.800 g 0 0 100.00 30.00 re f", "0.000 0.000 1.000 RG", "/Helv 12.0 Tf", "(OK) Tj"} {
+		if !strings.Contains(content, s) {
+			t.Errorf("TestGenerateWidgetAppearance: pushbutton appearance missing %q: %s\n", s, content)
+		}
+	}
+
+	// Check box
+	d = widgetForTest("Btn", 0, NewRectangle(100, 200, 115, 215))
+	d.Insert("V", PDFName("Checked"))
+
+	if err := GenerateWidgetAppearance(xRefTable, &d); err != nil {
+		t.Fatalf("TestGenerateWidgetAppearance: %v\n", err)
+	}
+
+	if as := d.NameEntry("AS"); as == nil || *as != "Checked" {
+		t.Errorf("TestGenerateWidgetAppearance: expected AS Checked, got %v\n", as)
+	}
+
+	if _, content = widgetAppearanceForTest(t, xRefTable, d, "Checked"); !strings.Contains(content, "/ZaDb") {
+		t.Errorf("TestGenerateWidgetAppearance: unexpected on appearance: %s\n", content)
+	}
+
+	widgetAppearanceForTest(t, xRefTable, d, "Off")
+
+	d.Update("V", PDFName("Off"))
+
+	if err := GenerateWidgetAppearance(xRefTable, &d); err != nil {
+		t.Fatalf("TestGenerateWidgetAppearance: %v\n", err)
+	}
+
+	if as := d.NameEntry("AS"); as == nil || *as != "Off" {
+		t.Errorf("TestGenerateWidgetAppearance: expected AS Off, got %v\n", as)
+	}
+
+	// Text field using a default font.
+	d = widgetForTest("Tx", 0, NewRectangle(100, 300, 300, 320))
+	d.Insert("DA", PDFStringLiteral("/TiRo 0 Tf 0 g"))
+	d.Insert("V", PDFStringLiteral("Hello"))
+	d.Insert("Q", PDFInteger(1))
+
+	font := NewPDFDict()
+	font.InsertName("Type", "Font")
+	font.InsertName("Subtype", "Type1")
+	font.InsertName("BaseFont", "Times-Roman")
+
+	if err := GenerateWidgetAppearanceWithFont(xRefTable, &d, font); err != nil {
+		t.Fatalf("TestGenerateWidgetAppearance: %v\n", err)
+	}
+
+	sd, content = widgetAppearanceForTest(t, xRefTable, d, "")
+
+	if !strings.Contains(content, "/Tx BMC") || !strings.Contains(content, "(Hello) Tj") || strings.Contains(content, "/TiRo 0 Tf") {
+		t.Errorf("TestGenerateWidgetAppearance: unexpected text field appearance: %s\n", content)
+	}
+
+	f, err := fontResource(xRefTable, sd.Dict["Resources"], "TiRo")
+	if err != nil || f == nil || *f.NameEntry("BaseFont") != "Times-Roman" {
+		t.Errorf("TestGenerateWidgetAppearance: missing default font: %v\n", err)
+	}
+
+	// Choice fields are not supported.
+	d = widgetForTest("Ch", 0, NewRectangle(100, 400, 200, 420))
+	if err := GenerateWidgetAppearance(xRefTable, &d); err == nil {
+		t.Errorf("TestGenerateWidgetAppearance: expected error for choice field\n")
+	}
+}
+
+func TestGenerateCheckBoxAppearanceWithoutValue(t *testing.T) {
+
+	xRefTable := createAnnotTestXRef(t, 1)
+
+	on := formForTest(t, xRefTable, "0 0 15 15 re f", NewRectangle(0, 0, 15, 15), nil)
+	off := formForTest(t, xRefTable, "", NewRectangle(0, 0, 15, 15), nil)
+
+	d := widgetForTest("Btn", 0, NewRectangle(100, 200, 115, 215))
+	d.Insert("AS", PDFName("Yes"))
+	d.Insert("AP", PDFDict{Dict: map[string]PDFObject{"N": PDFDict{Dict: map[string]PDFObject{"Yes": on, "Off": off}}}})
+	indRef := addAnnotForTest(t, xRefTable, 1, d)
+
+	xRefTable.EnableAnnotationChangeLog()
+
+	if err := GenerateWidgetAppearance(xRefTable, &d); err != nil {
+		t.Fatalf("TestGenerateCheckBoxAppearanceWithoutValue: %v\n", err)
+	}
+
+	// A checked box without V remains checked.
+	if as := d.NameEntry("AS"); as == nil || *as != "Yes" {
+		t.Errorf("TestGenerateCheckBoxAppearanceWithoutValue: expected AS Yes, got %v\n", as)
+	}
+
+	widgetAppearanceForTest(t, xRefTable, d, "Yes")
+
+	for _, indRef := range []PDFIndirectRef{on, off} {
+		if entry, found := xRefTable.Find(indRef.ObjectNumber.Value()); found && !entry.Free {
+			t.Errorf("TestGenerateCheckBoxAppearanceWithoutValue: previous appearance obj#%d not freed\n", indRef.ObjectNumber.Value())
+		}
+	}
+
+	recorded := false
+	for _, c := range xRefTable.AnnotationChanges() {
+		if c.Kind == AnnotationEdited && c.ObjNr == indRef.ObjectNumber.Value() && c.Field == "AP" {
+			recorded = true
+		}
+	}
+
+	if !recorded {
+		t.Errorf("TestGenerateCheckBoxAppearanceWithoutValue: AP change not recorded: %v\n", xRefTable.AnnotationChanges())
+	}
+}
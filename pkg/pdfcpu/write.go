@@ -64,8 +64,13 @@ func WritePDFFile(ctx *PDFContext) error {
 	}
 
 	// Since we support PDF Collections (since V1.7) for file attachments
-	// we need to always generate V1.7 PDF filess.
-	err = writeHeader(ctx.Write, V17)
+	// we need to always generate at least V1.7 PDF filess.
+	v := V17
+	if ctx.Version() == V20 {
+		v = V20
+	}
+
+	err = writeHeader(ctx.Write, v)
 	if err != nil {
 		return err
 	}
@@ -115,10 +115,120 @@ type XRefTable struct {
 	// Validation
 	Valid          bool // true means successful validated against ISO 32000.
 	ValidationMode int  // see Configuration
+	warnings       []ValidationWarning
+
+	// CollectWarnings makes strict validation record non fatal issues as warnings and continue.
+	CollectWarnings bool
+
+	// Annotation subtypes tolerated in relaxed mode, see UnsupportedAnnotationSubtypes.
+	unsupportedAnnotSubtypes StringSet
+
+	// Number of initially open popups encountered in relaxed mode, see OpenPopups.
+	openPopups int
+
+	// MaxAppearanceStreamBytes limits the decoded size of annotation appearance streams.
+	// 0 means unlimited.
+	MaxAppearanceStreamBytes int
+
+	// MaxAnnotationsPerPage limits the number of entries of the Annots array of a page.
+	// 0 means unlimited.
+	MaxAnnotationsPerPage int
+
+	// StrictPrinterMarks makes strict validation reject PrinterMark annotations lacking the NoZoom and NoRotate flags.
+	StrictPrinterMarks bool
+
+	// StrictWidgetRects makes strict validation reject widget kids of a field sharing a Rect on the same page.
+	StrictWidgetRects bool
+
+	// Optional annotation change log, see EnableAnnotationChangeLog.
+	annotChanges *AnnotationChangeLog
 
 	Optimized bool
 }
 
+// ValidationWarning represents a non fatal issue detected during validation.
+type ValidationWarning struct {
+	Msg string
+}
+
+func (w ValidationWarning) String() string {
+	return w.Msg
+}
+
+// ValidationWarnings returns the non fatal issues detected during validation.
+func (xRefTable *XRefTable) ValidationWarnings() []ValidationWarning {
+	return xRefTable.warnings
+}
+
+func (xRefTable *XRefTable) addWarning(format string, args ...interface{}) {
+
+	w := ValidationWarning{Msg: fmt.Sprintf(format, args...)}
+
+	log.Info.Printf("warning: %s\n", w)
+
+	xRefTable.warnings = append(xRefTable.warnings, w)
+}
+
+// reportNonFatal returns an error for a non fatal issue during strict validation.
+// In relaxed mode or if warnings are being collected the issue gets recorded as a warning instead.
+func (xRefTable *XRefTable) reportNonFatal(format string, args ...interface{}) error {
+
+	if xRefTable.ValidationMode == ValidationStrict && !xRefTable.CollectWarnings {
+		return errors.Errorf(format, args...)
+	}
+
+	xRefTable.addWarning(format, args...)
+
+	return nil
+}
+
+// reportOptIn records a non fatal issue as a warning.
+// If strict is set the issue gets reported via reportNonFatal instead.
+func (xRefTable *XRefTable) reportOptIn(strict bool, format string, args ...interface{}) error {
+
+	if strict {
+		return xRefTable.reportNonFatal(format, args...)
+	}
+
+	xRefTable.addWarning(format, args...)
+
+	return nil
+}
+
+// UnsupportedAnnotationSubtypes returns the sorted annotation subtypes unknown to ISO 32000
+// skipped during relaxed validation.
+func (xRefTable *XRefTable) UnsupportedAnnotationSubtypes() []string {
+
+	var ss []string
+	for s := range xRefTable.unsupportedAnnotSubtypes {
+		ss = append(ss, s)
+	}
+
+	sort.Strings(ss)
+
+	return ss
+}
+
+func (xRefTable *XRefTable) addUnsupportedAnnotationSubtype(subtype string) {
+
+	if xRefTable.unsupportedAnnotSubtypes == nil {
+		xRefTable.unsupportedAnnotSubtypes = StringSet{}
+	}
+
+	if xRefTable.unsupportedAnnotSubtypes[subtype] {
+		return
+	}
+
+	xRefTable.unsupportedAnnotSubtypes[subtype] = true
+
+	xRefTable.addWarning("unsupported annotation subtype: %s", subtype)
+}
+
+// OpenPopups returns the number of Popup annotations open by default encountered during relaxed validation.
+func (xRefTable *XRefTable) OpenPopups() int {
+	return xRefTable.openPopups
+}
+
 // NewXRefTable creates a new XRefTable.
 func newXRefTable(validationMode int) (xRefTable *XRefTable) {
 	return &XRefTable{
@@ -169,11 +279,16 @@ func (xRefTable *XRefTable) ParseRootVersion() (v *string, err error) {
 // ValidateVersion validates against the xRefTable's version.
 func (xRefTable *XRefTable) ValidateVersion(element string, sinceVersion PDFVersion) error {
 
-	if xRefTable.Version() < sinceVersion {
-		return errors.Errorf("%s: unsupported in version %s\n", element, xRefTable.VersionString())
+	if xRefTable.Version() >= sinceVersion {
+		return nil
 	}
 
-	return nil
+	// Relaxed mode tolerates PDF 2.0 features in PDF 1.7 documents.
+	if sinceVersion == V20 && xRefTable.Version() == V17 && xRefTable.ValidationMode == ValidationRelaxed {
+		return nil
+	}
+
+	return errors.Errorf("%s: unsupported in version %s\n", element, xRefTable.VersionString())
 }
 
 // IsLinearizationObject returns true if object #i is a a linearization object.